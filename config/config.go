@@ -1,15 +1,33 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultJWTSecret 未配置JWT_SECRET时使用的默认密钥，仅允许在开发环境使用
+const DefaultJWTSecret = "default_jwt_secret"
+
+// 配置校验错误
+var (
+	ErrDefaultSecret      = errors.New("非开发环境不能使用默认密钥")
+	ErrSmsProviderMissing = errors.New("非开发环境必须配置实际发送的短信服务商")
+)
+
 // Config 应用配置
 type Config struct {
+	// 运行环境：development、production 等，默认 production
+	AppEnv string
+
 	DBHost     string
 	DBUser     string
 	DBPassword string
@@ -26,19 +44,111 @@ type Config struct {
 	JWTSecret string
 	AppPort   int
 
+	// 非对称JWT签名配置
+	JWTKeysDir           string // 密钥目录，每个 <kid>.pem 文件为一个私钥或公钥
+	JWTSigningKeyID      string // 当前用于签发令牌的密钥kid，为空时使用JWT_SECRET进行HS256签名
+	JWTAcceptLegacyHS256 bool   // 是否继续接受切换前签发的HS256令牌（迁移期间避免所有用户被登出）
+
+	// 会话缓存配置
+	SessionCacheTTL  time.Duration // 会话有效性缓存时间，0 表示不缓存
+	SessionCacheSize int           // 最多缓存的会话数
+
+	// 审计日志写入队列长度，队列已满时丢弃新记录
+	AuditQueueSize int
+
 	// 设置管理配置
-	SettingSalt string
-	CacheDir    string // LevelDB缓存目录
+	CacheDir             string   // LevelDB缓存目录
+	SettingSigningSecret string   // 服务端签名写入设置的HMAC密钥，为空时不允许签名写入
+	SettingSigningKeys   []string // 签名写入允许修改的key，支持 * 通配，为空时不允许修改任何key
+	SettingCacheControl  string   // 读取接口按key前缀的客户端缓存时间，格式为 前缀=秒数,前缀=秒数
+
+	// 设置服务端缓存配置
+	SettingCacheTTL           time.Duration // 缓存有效期，0 表示不过期
+	SettingCacheNegativeTTL   time.Duration // 不存在的key的缓存有效期，0 表示不缓存
+	SettingCacheStaleTTL      time.Duration // 缓存过期后仍返回旧值并在后台刷新的时间，0 表示过期即重新查询
+	SettingCacheMemorySize    int           // 内存LRU缓存的最大条目数，0 表示不使用
+	SettingCachePurgeInterval time.Duration // 定时清理过期缓存的间隔，0 表示不清理
+
+	// 自定义角色，格式为 角色=权限,权限;角色=权限
+	RBACRoles string
 
 	// 微信登录配置
 	WechatAppID     string
 	WechatAppSecret string
+	// 微信接口地址（可替换为本地模拟服务用于测试）
+	WechatAPIBaseURL  string
+	WechatOpenBaseURL string
+	// 微信网页授权允许的重定向地址
+	WechatRedirectURIs []string
+	// 微信小程序配置
+	WechatMiniAppID     string
+	WechatMiniAppSecret string
+
+	// OAuth state签名密钥，未配置时由JWT_SECRET派生
+	OAuthStateSecret string
+	// 同一IP每分钟最多请求登录授权接口的次数，0 表示不限制
+	AuthRateLimit int
+	// 第三方令牌加密密钥
+	TokenEncryptionKey string
+	// 微信资料定时同步间隔，为0时不启用
+	WechatProfileSyncInterval time.Duration
 
 	// 苹果登录配置
 	AppleTeamID     string
 	AppleKeyID      string
 	ApplePrivateKey string
-	AppleBundleID   string
+	// base64编码的苹果私钥，优先于ApplePrivateKey
+	ApplePrivateKeyBase64 string
+	AppleBundleID         string
+	AppleBaseURL          string // 苹果登录接口地址（可替换为本地模拟服务用于测试）
+	// 苹果刷新令牌定时校验间隔，为0时不启用
+	AppleTokenValidateInterval time.Duration
+
+	// /oauth/login 旧格式（直接提交第三方用户ID）的服务端签名密钥，为空时不接受旧格式
+	OAuthLoginSigningSecret string
+	// 迁移期间允许未签名的旧格式请求（不安全，仅用于过渡）
+	OAuthLoginAllowUnsigned bool
+
+	// 第三方网页授权允许的重定向地址（所有提供方共用）
+	OAuthRedirectURIs []string
+	// Google登录配置
+	GoogleClientID     string
+	GoogleClientSecret string
+	// GitHub登录配置
+	GitHubClientID     string
+	GitHubClientSecret string
+	// 微博登录配置
+	WeiboAppKey    string
+	WeiboAppSecret string
+
+	// 短信验证码配置
+	SmsProvider        string        // 短信服务商：aliyun、tencent，开发环境可为空或log（仅记录日志）
+	SmsCodeTTL         time.Duration // 验证码有效期
+	SmsPhoneInterval   time.Duration // 同一手机号两次发送的最小间隔
+	SmsPhoneDailyLimit int           // 同一手机号24小时内最多发送次数
+	SmsIPHourlyLimit   int           // 同一IP一小时内最多发送次数
+	// 阿里云短信配置
+	AliyunSmsAccessKeyID     string
+	AliyunSmsAccessKeySecret string
+	AliyunSmsSignName        string
+	AliyunSmsTemplateCode    string
+	AliyunSmsEndpoint        string
+	// 腾讯云短信配置
+	TencentSmsSecretID   string
+	TencentSmsSecretKey  string
+	TencentSmsAppID      string
+	TencentSmsSignName   string
+	TencentSmsTemplateID string
+	TencentSmsRegion     string
+	TencentSmsEndpoint   string
+
+	// 通行密钥（WebAuthn）配置
+	WebAuthnRPID    string   // 依赖方ID（域名），为空时不启用通行密钥登录
+	WebAuthnRPName  string   // 依赖方显示名称
+	WebAuthnOrigins []string // 允许的来源，为空时为 https://<依赖方ID>
+
+	// 两步验证在验证器App中显示的服务名称
+	TOTPIssuer string
 
 	// AI服务配置
 	AIAPIKey  string
@@ -56,8 +166,28 @@ func LoadConfig() (*Config, error) {
 	dbPort, _ := strconv.Atoi(getEnv("DB_PORT", "3306"))
 	generalDBPort, _ := strconv.Atoi(getEnv("GENERAL_DB_PORT", "3306"))
 	appPort, _ := strconv.Atoi(getEnv("APP_PORT", "8080"))
+	wechatProfileSyncInterval, _ := time.ParseDuration(getEnv("WECHAT_PROFILE_SYNC_INTERVAL", "0"))
+	appleTokenValidateInterval, _ := time.ParseDuration(getEnv("APPLE_TOKEN_VALIDATE_INTERVAL", "0"))
+	oauthLoginAllowUnsigned, _ := strconv.ParseBool(getEnv("OAUTH_LOGIN_ALLOW_UNSIGNED", "false"))
+	smsCodeTTL, _ := time.ParseDuration(getEnv("SMS_CODE_TTL", "5m"))
+	smsPhoneInterval, _ := time.ParseDuration(getEnv("SMS_PHONE_INTERVAL", "60s"))
+	smsPhoneDailyLimit, _ := strconv.Atoi(getEnv("SMS_PHONE_DAILY_LIMIT", "10"))
+	smsIPHourlyLimit, _ := strconv.Atoi(getEnv("SMS_IP_HOURLY_LIMIT", "20"))
+	jwtAcceptLegacyHS256, _ := strconv.ParseBool(getEnv("JWT_ACCEPT_LEGACY_HS256", "true"))
+	sessionCacheTTL, _ := time.ParseDuration(getEnv("SESSION_CACHE_TTL", "30s"))
+	sessionCacheSize, _ := strconv.Atoi(getEnv("SESSION_CACHE_SIZE", "10000"))
+	auditQueueSize, _ := strconv.Atoi(getEnv("AUDIT_QUEUE_SIZE", "1024"))
+	settingCacheTTL, _ := time.ParseDuration(getEnv("SETTING_CACHE_TTL", "10m"))
+	settingCacheNegativeTTL, _ := time.ParseDuration(getEnv("SETTING_CACHE_NEGATIVE_TTL", "30s"))
+	settingCacheStaleTTL, _ := time.ParseDuration(getEnv("SETTING_CACHE_STALE_TTL", "1m"))
+	settingCacheMemorySize, _ := strconv.Atoi(getEnv("SETTING_CACHE_MEMORY_SIZE", "0"))
+	settingCachePurgeInterval, _ := time.ParseDuration(getEnv("SETTING_CACHE_PURGE_INTERVAL", "10m"))
+	authRateLimit, _ := strconv.Atoi(getEnv("AUTH_RATE_LIMIT", "30"))
+	jwtSecret := getEnv("JWT_SECRET", DefaultJWTSecret)
 
 	return &Config{
+		AppEnv: getEnv("APP_ENV", "production"),
+
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBUser:     getEnv("DB_USER", "root"),
 		DBPassword: getEnv("DB_PASSWORD", ""),
@@ -71,22 +201,114 @@ func LoadConfig() (*Config, error) {
 		GeneralDBPort:     generalDBPort,
 		GeneralDBName:     getEnv("GENERAL_DB_NAME", "yuanqi_general"),
 
-		JWTSecret: getEnv("JWT_SECRET", "default_jwt_secret"),
+		JWTSecret: jwtSecret,
 		AppPort:   appPort,
 
+		// 非对称JWT签名配置
+		JWTKeysDir:           getEnv("JWT_KEYS_DIR", "./keys/jwt"),
+		JWTSigningKeyID:      getEnv("JWT_SIGNING_KEY_ID", ""),
+		JWTAcceptLegacyHS256: jwtAcceptLegacyHS256,
+
+		// 会话缓存配置
+		SessionCacheTTL:  sessionCacheTTL,
+		SessionCacheSize: sessionCacheSize,
+
+		// 审计日志配置
+		AuditQueueSize: auditQueueSize,
+
 		// 设置管理配置
-		SettingSalt: getEnv("SETTING_SALT", "default_setting_salt"),
-		CacheDir:    getEnv("CACHE_DIR", "./cache"), // 默认缓存目录
+		CacheDir:             getEnv("CACHE_DIR", "./cache"), // 默认缓存目录
+		SettingSigningSecret: getEnv("SETTING_SIGNING_SECRET", ""),
+		SettingSigningKeys:   getEnvList("SETTING_SIGNING_KEYS"),
+		SettingCacheControl:  getEnv("SETTING_CACHE_CONTROL", ""),
+
+		SettingCacheTTL:           settingCacheTTL,
+		SettingCacheNegativeTTL:   settingCacheNegativeTTL,
+		SettingCacheStaleTTL:      settingCacheStaleTTL,
+		SettingCacheMemorySize:    settingCacheMemorySize,
+		SettingCachePurgeInterval: settingCachePurgeInterval,
+
+		// 自定义角色
+		RBACRoles: getEnv("RBAC_ROLES", ""),
 
 		// 微信登录配置
 		WechatAppID:     getEnv("WECHAT_APP_ID", ""),
 		WechatAppSecret: getEnv("WECHAT_APP_SECRET", ""),
+		// 微信接口地址
+		WechatAPIBaseURL:  getEnv("WECHAT_API_BASE_URL", "https://api.weixin.qq.com"),
+		WechatOpenBaseURL: getEnv("WECHAT_OPEN_BASE_URL", "https://open.weixin.qq.com"),
+		// 微信网页授权允许的重定向地址（逗号分隔）
+		WechatRedirectURIs: getEnvList("WECHAT_REDIRECT_URIS"),
+		// 微信小程序配置
+		WechatMiniAppID:     getEnv("WECHAT_MINI_APP_ID", ""),
+		WechatMiniAppSecret: getEnv("WECHAT_MINI_APP_SECRET", ""),
+
+		// OAuth state签名密钥，未配置时由JWT密钥派生
+		OAuthStateSecret: getEnv("OAUTH_STATE_SECRET", DeriveSecret(jwtSecret, "oauth-state")),
+		// 登录授权接口按IP限流
+		AuthRateLimit: authRateLimit,
+		// 第三方令牌加密密钥，未配置时使用JWT密钥
+		TokenEncryptionKey: getEnv("TOKEN_ENCRYPTION_KEY", getEnv("JWT_SECRET", DefaultJWTSecret)),
+		// 微信资料定时同步间隔
+		WechatProfileSyncInterval: wechatProfileSyncInterval,
 
 		// 苹果登录配置
 		AppleTeamID:     getEnv("APPLE_TEAM_ID", ""),
 		AppleKeyID:      getEnv("APPLE_KEY_ID", ""),
 		ApplePrivateKey: getEnv("APPLE_PRIVATE_KEY", ""),
-		AppleBundleID:   getEnv("APPLE_BUNDLE_ID", ""),
+		// base64编码的苹果私钥
+		ApplePrivateKeyBase64: getEnv("APPLE_PRIVATE_KEY_BASE64", ""),
+		AppleBundleID:         getEnv("APPLE_BUNDLE_ID", ""),
+		AppleBaseURL:          getEnv("APPLE_BASE_URL", "https://appleid.apple.com"),
+		// 苹果刷新令牌定时校验间隔
+		AppleTokenValidateInterval: appleTokenValidateInterval,
+
+		// /oauth/login 旧格式签名配置
+		OAuthLoginSigningSecret: getEnv("OAUTH_LOGIN_SIGNING_SECRET", ""),
+		OAuthLoginAllowUnsigned: oauthLoginAllowUnsigned,
+
+		// 第三方网页授权允许的重定向地址（逗号分隔）
+		OAuthRedirectURIs: getEnvList("OAUTH_REDIRECT_URIS"),
+		// Google登录配置
+		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		// GitHub登录配置
+		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
+		// 微博登录配置
+		WeiboAppKey:    getEnv("WEIBO_APP_KEY", ""),
+		WeiboAppSecret: getEnv("WEIBO_APP_SECRET", ""),
+
+		// 短信验证码配置
+		SmsProvider:        getEnv("SMS_PROVIDER", ""),
+		SmsCodeTTL:         smsCodeTTL,
+		SmsPhoneInterval:   smsPhoneInterval,
+		SmsPhoneDailyLimit: smsPhoneDailyLimit,
+		SmsIPHourlyLimit:   smsIPHourlyLimit,
+		// 阿里云短信配置
+		AliyunSmsAccessKeyID:     getEnv("ALIYUN_SMS_ACCESS_KEY_ID", ""),
+		AliyunSmsAccessKeySecret: getEnv("ALIYUN_SMS_ACCESS_KEY_SECRET", ""),
+		AliyunSmsSignName:        getEnv("ALIYUN_SMS_SIGN_NAME", ""),
+		AliyunSmsTemplateCode:    getEnv("ALIYUN_SMS_TEMPLATE_CODE", ""),
+		AliyunSmsEndpoint:        getEnv("ALIYUN_SMS_ENDPOINT", "https://dysmsapi.aliyuncs.com"),
+		// 腾讯云短信配置
+		TencentSmsSecretID:   getEnv("TENCENT_SMS_SECRET_ID", ""),
+		TencentSmsSecretKey:  getEnv("TENCENT_SMS_SECRET_KEY", ""),
+		TencentSmsAppID:      getEnv("TENCENT_SMS_APP_ID", ""),
+		TencentSmsSignName:   getEnv("TENCENT_SMS_SIGN_NAME", ""),
+		TencentSmsTemplateID: getEnv("TENCENT_SMS_TEMPLATE_ID", ""),
+		TencentSmsRegion:     getEnv("TENCENT_SMS_REGION", "ap-guangzhou"),
+		TencentSmsEndpoint:   getEnv("TENCENT_SMS_ENDPOINT", "https://sms.tencentcloudapi.com"),
+
+		// 通行密钥（WebAuthn）配置
+		WebAuthnRPID: getEnv("WEBAUTHN_RP_ID", ""),
+		// 依赖方显示名称，未配置时使用依赖方ID
+		WebAuthnRPName: getEnv("WEBAUTHN_RP_NAME", getEnv("WEBAUTHN_RP_ID", "")),
+		// 允许的来源（逗号分隔）
+		WebAuthnOrigins: getEnvList("WEBAUTHN_ORIGINS"),
+
+		// 两步验证服务名称
+		TOTPIssuer: getEnv("TOTP_ISSUER", "ios-api"),
 
 		// AI服务配置
 		AIAPIKey:  getEnv("AI_API_KEY", ""),
@@ -94,6 +316,34 @@ func LoadConfig() (*Config, error) {
 	}, nil
 }
 
+// IsDevelopment 是否为开发环境
+func (c *Config) IsDevelopment() bool {
+	return c.AppEnv == "development"
+}
+
+// Validate 检查配置的安全性，非开发环境禁止使用默认密钥和仅写日志的短信发送器
+func (c *Config) Validate() error {
+	if c.IsDevelopment() {
+		return nil
+	}
+	// 使用HS256签发或继续接受HS256令牌时，JWT_SECRET 即为签名密钥
+	if c.JWTSecret == DefaultJWTSecret && (c.JWTSigningKeyID == "" || c.JWTAcceptLegacyHS256) {
+		return fmt.Errorf("%w: JWT_SECRET", ErrDefaultSecret)
+	}
+	// 以下密钥未单独配置时继承或派生自 JWT_SECRET
+	if c.OAuthStateSecret == DefaultJWTSecret || c.OAuthStateSecret == DeriveSecret(DefaultJWTSecret, "oauth-state") {
+		return fmt.Errorf("%w: OAUTH_STATE_SECRET", ErrDefaultSecret)
+	}
+	if c.TokenEncryptionKey == DefaultJWTSecret {
+		return fmt.Errorf("%w: TOKEN_ENCRYPTION_KEY", ErrDefaultSecret)
+	}
+	// log 只把验证码写入日志，任何能看到日志的人都能登录任意手机号
+	if c.SmsProvider == "" || c.SmsProvider == "log" {
+		return fmt.Errorf("%w: SMS_PROVIDER", ErrSmsProviderMissing)
+	}
+	return nil
+}
+
 // GetDSN 获取数据库连接字符串
 func (c *Config) GetDSN() string {
 	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
@@ -107,6 +357,13 @@ func (c *Config) GetGeneralDSN() string {
 }
 
 // 获取环境变量，如果不存在则返回默认值
+// DeriveSecret 从主密钥派生指定用途的密钥，不同用途的密钥互不相同，泄露其一不影响主密钥
+func DeriveSecret(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -114,3 +371,14 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// 获取逗号分隔的环境变量列表，忽略空项
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,385 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"ios-api/services"
+	"ios-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminController 管理后台控制器
+type AdminController struct {
+	UserService *services.UserService
+	RBAC        *services.RBACService
+	Audit       *services.AuditService
+}
+
+// 分配角色请求参数
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// 封禁用户请求参数
+type BanUserRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// SearchUsers 搜索用户
+func (c *AdminController) SearchUsers(ctx *gin.Context) {
+	var params services.UserSearchParams
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	users, total, err := c.UserService.SearchUsers(params)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	// 搜索没有单个操作对象，对象ID留空，detail记录查询条件
+	entry := auditEntry(ctx, services.AuditAdminUserSearch, 0, gin.H{
+		"q":                params.Query,
+		"email":            params.Email,
+		"nickname":         params.Nickname,
+		"phone":            params.Phone,
+		"provider":         params.Provider,
+		"provider_user_id": params.ProviderUserID,
+		"banned":           params.Banned,
+		"total":            total,
+	})
+	entry.TargetID = ""
+	c.Audit.Record(entry)
+
+	utils.Success(ctx, "获取用户列表成功", gin.H{
+		"users": users,
+		"total": total,
+	})
+}
+
+// GetUser 获取用户详情，包含会话、第三方账号绑定和角色
+func (c *AdminController) GetUser(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	detail, err := c.UserService.GetUserDetail(userID)
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			utils.NotFound(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	roles, err := c.RBAC.GetUserRoles(userID)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminUserView, userID, nil))
+
+	utils.Success(ctx, "获取用户详情成功", gin.H{
+		"user":           detail.User,
+		"sessions":       detail.Sessions,
+		"oauth_accounts": detail.OAuthAccounts,
+		"roles":          roles,
+	})
+}
+
+// UpdateUser 修改用户资料
+func (c *AdminController) UpdateUser(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var params services.AdminUpdateUserParams
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	user, changes, err := c.UserService.AdminUpdateUser(userID, params)
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			utils.NotFound(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	if len(changes) > 0 {
+		c.Audit.Record(auditEntry(ctx, services.AuditAdminUserUpdate, userID, changes))
+	}
+
+	utils.Success(ctx, "修改用户资料成功", gin.H{
+		"user": user,
+	})
+}
+
+// BanUser 封禁用户，同时撤销其所有会话
+func (c *AdminController) BanUser(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req BanUserRequest
+	// 请求体可为空
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.ParamError(ctx, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	// 不能封禁自己
+	if actorID, _ := ctx.Get("userID"); actorID == userID {
+		utils.ParamError(ctx, "不能封禁自己")
+		return
+	}
+
+	revoked, err := c.UserService.BanUser(userID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(ctx, err.Error())
+		case errors.Is(err, services.ErrUserAlreadyBanned):
+			utils.Conflict(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminUserBan, userID, gin.H{
+		"reason":           req.Reason,
+		"revoked_sessions": revoked,
+	}))
+
+	utils.Success(ctx, "封禁用户成功", gin.H{
+		"revoked_sessions": revoked,
+	})
+}
+
+// UnbanUser 解除封禁
+func (c *AdminController) UnbanUser(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	if err := c.UserService.UnbanUser(userID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(ctx, err.Error())
+		case errors.Is(err, services.ErrUserNotBanned):
+			utils.Conflict(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminUserUnban, userID, nil))
+
+	utils.Success(ctx, "解除封禁成功", nil)
+}
+
+// LogoutUser 强制用户退出所有设备
+func (c *AdminController) LogoutUser(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	revoked, err := c.UserService.RevokeUserSessions(userID)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminUserLogout, userID, gin.H{
+		"revoked_sessions": revoked,
+	}))
+
+	utils.Success(ctx, "强制退出登录成功", gin.H{
+		"revoked_sessions": revoked,
+	})
+}
+
+// RevokeSession 撤销用户的指定会话
+func (c *AdminController) RevokeSession(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+	sessionID, err := strconv.ParseUint(ctx.Param("session_id"), 10, 64)
+	if err != nil || sessionID == 0 {
+		utils.ParamError(ctx, "会话ID格式错误")
+		return
+	}
+
+	if err := c.UserService.RevokeSession(userID, uint(sessionID)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			utils.NotFound(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminSessionRevoke, userID, gin.H{
+		"session_id": sessionID,
+	}))
+
+	utils.Success(ctx, "撤销会话成功", nil)
+}
+
+// ListRoles 获取所有角色及其权限
+func (c *AdminController) ListRoles(ctx *gin.Context) {
+	utils.Success(ctx, "获取角色列表成功", gin.H{
+		"roles": c.RBAC.Roles(),
+	})
+}
+
+// GetUserRoles 获取用户的角色
+func (c *AdminController) GetUserRoles(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	roles, err := c.RBAC.GetUserRoles(userID)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, "获取用户角色成功", gin.H{
+		"roles":       roles,
+		"permissions": c.RBAC.RolePermissions(roles),
+	})
+}
+
+// AssignRole 为用户分配角色
+func (c *AdminController) AssignRole(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	var req AssignRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if err := c.RBAC.AssignRole(userID, req.Role); err != nil {
+		switch {
+		case errors.Is(err, services.ErrRoleNotFound):
+			utils.ParamError(ctx, err.Error())
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(ctx, err.Error())
+		case errors.Is(err, services.ErrRoleAlreadyAssigned):
+			utils.Conflict(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminRoleAssign, userID, gin.H{
+		"role": req.Role,
+	}))
+
+	utils.Success(ctx, "分配角色成功", nil)
+}
+
+// RemoveRole 移除用户的角色
+func (c *AdminController) RemoveRole(ctx *gin.Context) {
+	userID, ok := parseUserIDParam(ctx)
+	if !ok {
+		return
+	}
+
+	role := ctx.Param("role")
+	if err := c.RBAC.RemoveRole(userID, role); err != nil {
+		if errors.Is(err, services.ErrRoleNotAssigned) {
+			utils.NotFound(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	c.Audit.Record(auditEntry(ctx, services.AuditAdminRoleRemove, userID, gin.H{
+		"role": role,
+	}))
+
+	utils.Success(ctx, "移除角色成功", nil)
+}
+
+// ListAuditLogs 查询审计日志
+func (c *AdminController) ListAuditLogs(ctx *gin.Context) {
+	var params services.AuditLogQuery
+	if err := ctx.ShouldBindQuery(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	logs, total, err := c.Audit.Query(params)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, "获取审计日志成功", gin.H{
+		"logs":  logs,
+		"total": total,
+	})
+}
+
+// parseUserIDParam 解析路径中的用户ID
+func parseUserIDParam(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		utils.ParamError(ctx, "用户ID格式错误")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// auditEntry 生成针对用户的管理操作审计记录，操作人为当前登录用户
+func auditEntry(ctx *gin.Context, action string, targetUserID uint, detail interface{}) services.AuditEntry {
+	client := clientInfo(ctx)
+	return services.AuditEntry{
+		ActorID:    client.ActorID,
+		Action:     action,
+		TargetType: services.AuditTargetUser,
+		TargetID:   strconv.FormatUint(uint64(targetUserID), 10),
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		Detail:     detail,
+	}
+}
+
+// clientInfo 获取当前请求的客户端信息，未登录时操作人为0
+func clientInfo(ctx *gin.Context) services.ClientInfo {
+	userID, _ := ctx.Get("userID")
+	userIDUint, _ := userID.(uint)
+	return services.ClientInfo{
+		ActorID:   userIDUint,
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}
+}
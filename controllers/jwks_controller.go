@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"net/http"
+
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSController 公钥发布控制器，供其他服务离线验证本服务签发的令牌
+type JWKSController struct {
+	Keys *services.JWTKeySet
+}
+
+// JWKS 返回令牌验证公钥（标准JWKS格式，不使用统一响应结构）
+func (c *JWKSController) JWKS(ctx *gin.Context) {
+	keySet := services.JSONWebKeySet{Keys: []services.JSONWebKey{}}
+	if c.Keys != nil {
+		keySet = c.Keys.JWKS()
+	}
+
+	// 允许短时间缓存，轮换密钥时新公钥需提前发布
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, keySet)
+}
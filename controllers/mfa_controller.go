@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+
+	"ios-api/services"
+	"ios-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MFAController 两步验证控制器
+type MFAController struct {
+	UserService *services.UserService
+	TOTP        *services.TOTPService
+}
+
+// Login 登录第二步：提交密码登录返回的挑战令牌和验证码（或恢复码）
+func (c *MFAController) Login(ctx *gin.Context) {
+	var params services.MFALoginParams
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	userID, err := c.TOTP.VerifyChallenge(params.MFAToken, params.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMFAChallengeInvalid),
+			errors.Is(err, services.ErrMFATooManyTries),
+			errors.Is(err, services.ErrTOTPCodeInvalid),
+			errors.Is(err, services.ErrUserNotFound):
+			utils.Unauthorized(ctx, err.Error())
+		case errors.Is(err, services.ErrMFALocked):
+			utils.TooManyRequests(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	user, err := c.UserService.GetUserByID(userID)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	token, err := c.UserService.GenerateToken(user.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+	c.UserService.WithClient(clientInfo(ctx)).RecordLogin(user.ID, "totp")
+
+	utils.Success(ctx, "登录成功", gin.H{
+		"user":  user,
+		"token": token,
+	})
+}
+
+// SetupTOTP 生成两步验证密钥，客户端展示二维码供验证器App扫描
+func (c *MFAController) SetupTOTP(ctx *gin.Context) {
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	enrollment, err := c.TOTP.BeginEnrollment(userIDUint)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTOTPPasswordRequired):
+			utils.ParamError(ctx, err.Error())
+		case errors.Is(err, services.ErrTOTPAlreadyEnabled):
+			utils.Conflict(ctx, err.Error())
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	utils.Success(ctx, "获取两步验证密钥成功", enrollment)
+}
+
+// ConfirmTOTP 使用第一个验证码确认开启两步验证，返回恢复码（只展示一次）
+func (c *MFAController) ConfirmTOTP(ctx *gin.Context) {
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	var params services.TOTPConfirmParams
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	codes, err := c.TOTP.ConfirmEnrollment(userIDUint, params.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTOTPCodeInvalid), errors.Is(err, services.ErrTOTPNotEnrolled):
+			utils.ParamError(ctx, err.Error())
+		case errors.Is(err, services.ErrTOTPAlreadyEnabled):
+			utils.Conflict(ctx, err.Error())
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	utils.Success(ctx, "两步验证已开启", gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP 重新输入密码后关闭两步验证
+func (c *MFAController) DisableTOTP(ctx *gin.Context) {
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	var params services.TOTPDisableParams
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	if err := c.TOTP.Disable(userIDUint, params.Password); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidPassword):
+			utils.Unauthorized(ctx, err.Error())
+		case errors.Is(err, services.ErrTOTPNotEnabled):
+			utils.ParamError(ctx, err.Error())
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	utils.Success(ctx, "两步验证已关闭", nil)
+}
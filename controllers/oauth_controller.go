@@ -1,6 +1,10 @@
 package controllers
 
 import (
+	"errors"
+	"net/http"
+	"time"
+
 	"ios-api/services"
 	"ios-api/utils"
 
@@ -12,18 +16,38 @@ type OAuthController struct {
 	UserService   *services.UserService
 	WechatService *services.WechatService
 	AppleService  *services.AppleService
+	StateService  *services.OAuthStateService
+	WechatSync    *services.WechatSyncService
+	Providers     *services.OAuthRegistry
+}
+
+// 第三方授权请求参数
+type ProviderAuthRequest struct {
+	RedirectURI string `json:"redirect_uri" binding:"required"`
+}
+
+// 第三方授权回调请求参数（支持查询参数和表单提交）
+type ProviderCallbackRequest struct {
+	Code  string `form:"code" binding:"required"`
+	State string `form:"state" binding:"required"`
 }
 
 // 微信授权请求参数
 type WechatAuthRequest struct {
 	RedirectURI string `json:"redirect_uri" binding:"required"`
-	State       string `json:"state"`
 }
 
 // 微信授权回调请求参数
 type WechatCallbackRequest struct {
 	Code  string `form:"code" binding:"required"`
-	State string `form:"state"`
+	State string `form:"state" binding:"required"`
+}
+
+// 微信小程序登录请求参数
+type WechatMiniProgramLoginRequest struct {
+	Code     string `json:"code" binding:"required"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
 }
 
 // 苹果授权请求参数
@@ -41,6 +65,11 @@ type AppleCallbackRequest struct {
 	LastName  string `json:"last_name"`
 }
 
+// 苹果服务端通知请求参数
+type AppleNotificationRequest struct {
+	Payload string `json:"payload" binding:"required"`
+}
+
 // WechatAuthURL 获取微信授权URL
 func (c *OAuthController) WechatAuthURL(ctx *gin.Context) {
 	var req WechatAuthRequest
@@ -49,14 +78,24 @@ func (c *OAuthController) WechatAuthURL(ctx *gin.Context) {
 		return
 	}
 
-	// 设置重定向URI
-	c.WechatService.RedirectURI = req.RedirectURI
+	// 生成绑定重定向地址的一次性state
+	state, nonce, err := c.StateService.Generate("wechat", req.RedirectURI)
+	if err != nil {
+		if errors.Is(err, services.ErrRedirectURINotAllowed) {
+			utils.ParamError(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, "生成授权state失败: "+err.Error())
+		}
+		return
+	}
 
 	// 获取授权URL
-	authURL := c.WechatService.GetAuthURL(req.State)
+	authURL := c.WechatService.GetAuthURL(req.RedirectURI, state)
+	c.setStateNonce(ctx, nonce)
 
 	utils.Success(ctx, "获取微信授权链接成功", gin.H{
 		"auth_url": authURL,
+		"state":    state,
 	})
 }
 
@@ -68,6 +107,12 @@ func (c *OAuthController) WechatCallback(ctx *gin.Context) {
 		return
 	}
 
+	// 校验并消费state，防止CSRF
+	redirectURI, ok := c.consumeState(ctx, "wechat", req.State)
+	if !ok {
+		return
+	}
+
 	// 处理微信回调
 	oauthParams, err := c.WechatService.HandleCallback(req.Code)
 	if err != nil {
@@ -76,18 +121,82 @@ func (c *OAuthController) WechatCallback(ctx *gin.Context) {
 	}
 
 	// 使用OAuth参数进行登录
-	user, token, err := c.UserService.OAuthLogin(*oauthParams)
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).OAuthLogin(*oauthParams)
 	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
 		utils.ServerError(ctx, "登录失败: "+err.Error())
 		return
 	}
 
 	utils.Success(ctx, "微信登录成功", gin.H{
+		"user":         user,
+		"token":        token,
+		"redirect_uri": redirectURI,
+	})
+}
+
+// WechatMiniProgramLogin 微信小程序登录
+func (c *OAuthController) WechatMiniProgramLogin(ctx *gin.Context) {
+	var req WechatMiniProgramLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 通过code2session换取用户标识
+	oauthParams, err := c.WechatService.HandleMiniProgramLogin(req.Code, req.Nickname, req.Avatar)
+	if err != nil {
+		utils.ServerError(ctx, "微信小程序授权处理失败: "+err.Error())
+		return
+	}
+
+	// 使用OAuth参数进行登录
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).OAuthLogin(*oauthParams)
+	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
+		utils.ServerError(ctx, "登录失败: "+err.Error())
+		return
+	}
+
+	utils.Success(ctx, "微信小程序登录成功", gin.H{
 		"user":  user,
 		"token": token,
 	})
 }
 
+// WechatSyncProfile 从微信重新同步当前用户的昵称和头像
+func (c *OAuthController) WechatSyncProfile(ctx *gin.Context) {
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	user, err := c.WechatSync.SyncUser(userIDUint)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrWechatNotBound):
+			utils.NotFound(ctx, err.Error())
+		case errors.Is(err, services.ErrWechatRefreshExpired):
+			utils.Unauthorized(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, "同步微信资料失败: "+err.Error())
+		}
+		return
+	}
+
+	utils.Success(ctx, "同步微信资料成功", gin.H{
+		"user": user,
+	})
+}
+
 // AppleAuth 苹果授权
 func (c *OAuthController) AppleAuth(ctx *gin.Context) {
 	var req AppleAuthRequest
@@ -119,13 +228,21 @@ func (c *OAuthController) AppleCallback(ctx *gin.Context) {
 	// 处理苹果回调
 	oauthParams, err := c.AppleService.HandleCallback(req.Code, req.IdToken, name, req.Email)
 	if err != nil {
-		utils.ServerError(ctx, "苹果授权处理失败: "+err.Error())
+		if services.IsOAuthCredentialError(err) {
+			utils.Unauthorized(ctx, "苹果授权校验失败: "+err.Error())
+		} else {
+			utils.ServerError(ctx, "苹果授权处理失败: "+err.Error())
+		}
 		return
 	}
 
 	// 使用OAuth参数进行登录
-	user, token, err := c.UserService.OAuthLogin(*oauthParams)
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).OAuthLogin(*oauthParams)
 	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
 		utils.ServerError(ctx, "登录失败: "+err.Error())
 		return
 	}
@@ -135,3 +252,148 @@ func (c *OAuthController) AppleCallback(ctx *gin.Context) {
 		"token": token,
 	})
 }
+
+// AppleNotification 处理苹果服务端通知
+// 苹果以签名JWT推送邮箱转发状态变更、撤销授权和删除账号等事件
+func (c *OAuthController) AppleNotification(ctx *gin.Context) {
+	var req AppleNotificationRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 验证通知签名
+	event, err := c.AppleService.VerifyNotification(req.Payload)
+	if err != nil {
+		utils.Unauthorized(ctx, err.Error())
+		return
+	}
+
+	// 处理通知事件，未绑定的用户直接确认
+	if err := c.UserService.HandleAppleNotification(event); err != nil && !errors.Is(err, services.ErrUserNotFound) {
+		utils.ServerError(ctx, "处理苹果通知失败: "+err.Error())
+		return
+	}
+
+	utils.Success(ctx, "苹果通知处理成功", nil)
+}
+
+// setStateNonce 将state的nonce写入HttpOnly Cookie，回调时校验，绑定发起授权的浏览器
+// HTTPS下使用 SameSite=None，以支持以表单POST方式回调的提供方。
+func (c *OAuthController) setStateNonce(ctx *gin.Context, nonce string) {
+	secure := ctx.Request.TLS != nil || ctx.GetHeader("X-Forwarded-Proto") == "https"
+	if secure {
+		ctx.SetSameSite(http.SameSiteNoneMode)
+	} else {
+		ctx.SetSameSite(http.SameSiteLaxMode)
+	}
+	ctx.SetCookie(services.OAuthNonceCookie, nonce, int(c.StateService.TTL/time.Second), "/", "", secure, true)
+}
+
+// consumeState 校验并消费state和Cookie中的nonce，失败时写入响应并返回false
+func (c *OAuthController) consumeState(ctx *gin.Context, provider, state string) (string, bool) {
+	nonce, _ := ctx.Cookie(services.OAuthNonceCookie)
+	redirectURI, err := c.StateService.Consume(provider, state, nonce)
+	if err != nil {
+		utils.Unauthorized(ctx, "授权state校验失败: "+err.Error())
+		return "", false
+	}
+	// nonce只能使用一次，回调后删除Cookie
+	ctx.SetCookie(services.OAuthNonceCookie, "", -1, "/", "", false, true)
+	return redirectURI, true
+}
+
+// getProvider 根据路径参数获取第三方登录提供方
+func (c *OAuthController) getProvider(ctx *gin.Context) (services.OAuthProvider, bool) {
+	provider, err := c.Providers.Get(ctx.Param("provider"))
+	if err != nil {
+		utils.NotFound(ctx, err.Error())
+		return nil, false
+	}
+	return provider, true
+}
+
+// ProviderAuthURL 获取第三方授权URL
+func (c *OAuthController) ProviderAuthURL(ctx *gin.Context) {
+	provider, ok := c.getProvider(ctx)
+	if !ok {
+		return
+	}
+
+	var req ProviderAuthRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 客户端完成授权的提供方（如苹果）没有网页授权链接
+	if provider.AuthURL(req.RedirectURI, "") == "" {
+		utils.ParamError(ctx, services.ErrOAuthAuthURLNotSupported.Error())
+		return
+	}
+
+	// 生成绑定提供方和重定向地址的一次性state
+	state, nonce, err := c.StateService.Generate(provider.Name(), req.RedirectURI)
+	if err != nil {
+		if errors.Is(err, services.ErrRedirectURINotAllowed) {
+			utils.ParamError(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, "生成授权state失败: "+err.Error())
+		}
+		return
+	}
+
+	c.setStateNonce(ctx, nonce)
+	utils.Success(ctx, "获取授权链接成功", gin.H{
+		"auth_url": provider.AuthURL(req.RedirectURI, state),
+		"state":    state,
+	})
+}
+
+// ProviderCallback 处理第三方授权回调
+func (c *OAuthController) ProviderCallback(ctx *gin.Context) {
+	provider, ok := c.getProvider(ctx)
+	if !ok {
+		return
+	}
+
+	var req ProviderCallbackRequest
+	if err := ctx.ShouldBind(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	// 校验并消费state，防止CSRF
+	redirectURI, ok := c.consumeState(ctx, provider.Name(), req.State)
+	if !ok {
+		return
+	}
+
+	// 使用授权码换取用户信息
+	oauthParams, err := provider.ExchangeCode(req.Code, redirectURI)
+	if err != nil {
+		if services.IsOAuthCredentialError(err) {
+			utils.Unauthorized(ctx, "第三方凭证校验失败: "+err.Error())
+		} else {
+			utils.ServerError(ctx, "第三方授权处理失败: "+err.Error())
+		}
+		return
+	}
+
+	// 使用OAuth参数进行登录
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).OAuthLogin(*oauthParams)
+	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
+		utils.ServerError(ctx, "登录失败: "+err.Error())
+		return
+	}
+
+	utils.Success(ctx, "登录成功", gin.H{
+		"user":         user,
+		"token":        token,
+		"redirect_uri": redirectURI,
+	})
+}
@@ -1,6 +1,14 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ios-api/models"
+	"ios-api/remoteconfig"
 	"ios-api/services"
 	"ios-api/utils"
 
@@ -12,6 +20,16 @@ type SettingController struct {
 	SettingService *services.SettingService
 }
 
+// SettingSchemaRequest 设置定义请求参数
+type SettingSchemaRequest struct {
+	Type        string          `json:"type" binding:"required,oneof=string int bool json"`
+	Schema      json.RawMessage `json:"schema"` // JSON Schema，仅 json 类型
+	Enum        json.RawMessage `json:"enum"`   // 可选值数组，不能用于 json 类型
+	Min         *int64          `json:"min"`    // int 的最小值或 string 的最小长度
+	Max         *int64          `json:"max"`    // int 的最大值或 string 的最大长度
+	Description string          `json:"description" binding:"max=255"`
+}
+
 // GetSetting 获取指定key的设置
 // GET /api/v1/settings/:key
 func (sc *SettingController) GetSetting(c *gin.Context) {
@@ -23,6 +41,12 @@ func (sc *SettingController) GetSetting(c *gin.Context) {
 		return
 	}
 
+	// 远程配置定义不公开，与不存在的key返回相同的结果
+	if services.IsPrivateSettingKey(key) {
+		utils.NotFound(c, "设置不存在")
+		return
+	}
+
 	// 获取设置
 	setting, err := sc.SettingService.GetSetting(key)
 	if err != nil {
@@ -30,16 +54,140 @@ func (sc *SettingController) GetSetting(c *gin.Context) {
 		return
 	}
 
+	// 不存在的key使用相同的缓存时间，避免反复请求
+	c.Header("Cache-Control", services.CacheControlHeader(sc.SettingService.CacheControl.MaxAge(key)))
 	if setting == nil {
 		utils.NotFound(c, "设置不存在")
 		return
 	}
 
+	// 支持条件请求，设置未变化时返回304
+	if utils.NotModified(c, services.SettingsETag([]models.Setting{*setting}), setting.UpdatedAt) {
+		return
+	}
+	utils.Success(c, "获取设置成功", setting)
+}
+
+// BatchGetSettings 批量获取设置
+// POST /api/v1/settings/batch
+func (sc *SettingController) BatchGetSettings(c *gin.Context) {
+	var req struct {
+		Keys []string `json:"keys" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	settings, missing, err := sc.SettingService.GetSettings(req.Keys)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSettingBatchEmpty),
+			errors.Is(err, services.ErrSettingBatchTooLarge),
+			errors.Is(err, services.ErrSettingKeyInvalid),
+			errors.Is(err, services.ErrSettingKeyLength):
+			utils.ParamError(c, err.Error())
+		default:
+			utils.ServerError(c, "获取设置失败: "+err.Error())
+		}
+		return
+	}
+
+	// 远程配置定义不公开，按不存在返回
+	settings, hidden := services.PublicSettings(settings)
+	if len(hidden) > 0 {
+		missing = append(missing, hidden...)
+		sort.Strings(missing)
+	}
+
+	if utils.NotModified(c, services.SettingsETag(settings), services.SettingsLastModified(settings)) {
+		return
+	}
+	utils.Success(c, "获取设置成功", gin.H{
+		"settings": settings,
+		"missing":  missing,
+	})
+}
+
+// ListSettings 获取命名空间下的全部设置
+// GET /api/v1/settings?prefix=app.ios.
+func (sc *SettingController) ListSettings(c *gin.Context) {
+	prefix, settings, err := sc.SettingService.ListSettingsByPrefix(c.Query("prefix"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSettingPrefixInvalid),
+			errors.Is(err, services.ErrSettingPrefixTooLarge):
+			utils.ParamError(c, err.Error())
+		default:
+			utils.ServerError(c, "获取设置失败: "+err.Error())
+		}
+		return
+	}
+
+	// 远程配置定义不公开，prefix 覆盖 config. 命名空间时不返回其中的设置
+	settings, _ = services.PublicSettings(settings)
+
+	c.Header("Cache-Control", services.CacheControlHeader(sc.SettingService.CacheControl.MaxAgeForPrefix(prefix)))
+	if utils.NotModified(c, services.SettingsETag(settings), services.SettingsLastModified(settings)) {
+		return
+	}
+	utils.Success(c, "获取设置成功", gin.H{
+		"prefix":   prefix,
+		"settings": settings,
+	})
+}
+
+// GetConfig 获取当前客户端的远程配置
+// GET /api/v1/config?platform=ios&app_version=2.1.0&locale=zh-Hans-CN
+// 参数也可以通过 X-Platform、X-App-Version、Accept-Language 请求头传递，登录用户按用户ID匹配规则。
+func (sc *SettingController) GetConfig(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	userIDUint, _ := userID.(uint)
+	ctx := remoteconfig.Context{
+		UserID:     userIDUint,
+		Platform:   queryOrHeader(c, "platform", "X-Platform"),
+		AppVersion: queryOrHeader(c, "app_version", "X-App-Version"),
+		Locale:     c.Query("locale"),
+	}
+	if ctx.Locale == "" {
+		ctx.Locale = preferredLanguage(c.GetHeader("Accept-Language"))
+	}
+
+	// 结果按用户定向，不能被共享缓存（CDN、代理）按URL缓存后返回给其他用户
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("Vary", "Authorization")
+
+	values, err := sc.SettingService.ResolveConfig(ctx)
+	if err != nil {
+		utils.ServerError(c, "获取远程配置失败: "+err.Error())
+		return
+	}
+
+	utils.Success(c, "获取远程配置成功", gin.H{
+		"config": values,
+	})
+}
+
+// AdminGetSetting 获取指定key的设置，包括不公开的远程配置定义
+// GET /api/v1/admin/settings/:key（需要 settings:write 权限）
+func (sc *SettingController) AdminGetSetting(c *gin.Context) {
+	setting, err := sc.SettingService.GetSetting(c.Param("key"))
+	if err != nil {
+		utils.ServerError(c, "获取设置失败: "+err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	if setting == nil {
+		utils.NotFound(c, "设置不存在")
+		return
+	}
 	utils.Success(c, "获取设置成功", setting)
 }
 
 // SetSetting 设置/更新指定key的值
-// PUT /api/v1/settings/:key
+// PUT /api/v1/admin/settings/:key（需要 settings:write 权限）
+// PUT /api/v1/settings/:key（需要请求签名）
 func (sc *SettingController) SetSetting(c *gin.Context) {
 	key := c.Param("key")
 
@@ -51,8 +199,8 @@ func (sc *SettingController) SetSetting(c *gin.Context) {
 
 	// 解析请求体
 	var req struct {
-		Value  string `json:"value" binding:"required"`
-		KeyMD5 string `json:"key_md5" binding:"required"`
+		Value   string `json:"value" binding:"required"`
+		Comment string `json:"comment" binding:"max=255"` // 修改说明，保存在修改记录中
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -61,22 +209,110 @@ func (sc *SettingController) SetSetting(c *gin.Context) {
 	}
 
 	// 设置/更新设置
-	setting, err := sc.SettingService.SetSetting(key, req.Value, req.KeyMD5)
+	setting, err := sc.SettingService.WithClient(clientInfo(c)).SetSettingWithComment(key, req.Value, req.Comment)
 	if err != nil {
 		// 根据错误类型返回不同的响应
-		if err.Error() == "key的MD5校验失败" {
-			utils.Unauthorized(c, "MD5校验失败，无权限操作此设置")
-			return
+		switch {
+		case errors.Is(err, services.ErrSettingKeyInvalid),
+			errors.Is(err, services.ErrSettingKeyLength),
+			errors.Is(err, services.ErrSettingValueTooLarge),
+			errors.Is(err, services.ErrSettingValueInvalid):
+			utils.ParamError(c, err.Error())
+		default:
+			utils.ServerError(c, "保存设置失败: "+err.Error())
 		}
-		utils.ParamError(c, err.Error())
 		return
 	}
 
 	utils.Success(c, "设置保存成功", setting)
 }
 
+// ListRevisions 获取指定key的修改记录
+// GET /api/v1/admin/settings/:key/revisions
+func (sc *SettingController) ListRevisions(c *gin.Context) {
+	var params services.SettingRevisionQuery
+	if err := c.ShouldBindQuery(&params); err != nil {
+		utils.ParamError(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	revisions, total, err := sc.SettingService.ListRevisions(c.Param("key"), params)
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "获取修改记录成功", gin.H{
+		"revisions": revisions,
+		"total":     total,
+	})
+}
+
+// DiffRevisions 对比指定key的两个版本
+// GET /api/v1/admin/settings/:key/revisions/diff?from=1&to=2
+func (sc *SettingController) DiffRevisions(c *gin.Context) {
+	var req struct {
+		From uint `form:"from" binding:"required"`
+		To   uint `form:"to" binding:"required"`
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ParamError(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	diff, err := sc.SettingService.DiffRevisions(c.Param("key"), req.From, req.To)
+	if err != nil {
+		if errors.Is(err, services.ErrSettingRevisionNotFound) {
+			utils.NotFound(c, err.Error())
+		} else {
+			utils.ServerError(c, err.Error())
+		}
+		return
+	}
+
+	utils.Success(c, "对比成功", diff)
+}
+
+// RollbackSetting 将设置恢复为指定版本的值
+// POST /api/v1/admin/settings/:key/revisions/:revision_id/rollback
+func (sc *SettingController) RollbackSetting(c *gin.Context) {
+	revisionID, err := strconv.ParseUint(c.Param("revision_id"), 10, 64)
+	if err != nil || revisionID == 0 {
+		utils.ParamError(c, "版本ID格式错误")
+		return
+	}
+
+	// 请求体可选
+	var req struct {
+		Comment string `json:"comment" binding:"max=255"` // 修改说明，默认为“回滚到版本 N”
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ParamError(c, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	setting, err := sc.SettingService.WithClient(clientInfo(c)).Rollback(c.Param("key"), uint(revisionID), req.Comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSettingRevisionNotFound):
+			utils.NotFound(c, err.Error())
+		case errors.Is(err, services.ErrSettingRevisionUnchanged),
+			errors.Is(err, services.ErrSettingValueInvalid):
+			// 旧版本的值可能不符合当前的设置定义
+			utils.Conflict(c, err.Error())
+		default:
+			utils.ServerError(c, "回滚设置失败: "+err.Error())
+		}
+		return
+	}
+
+	utils.Success(c, "回滚设置成功", setting)
+}
+
 // ClearCache 清除指定key的缓存
-// DELETE /api/v1/settings/:key/cache
+// DELETE /api/v1/admin/settings/:key/cache
 func (sc *SettingController) ClearCache(c *gin.Context) {
 	key := c.Param("key")
 
@@ -87,7 +323,7 @@ func (sc *SettingController) ClearCache(c *gin.Context) {
 	}
 
 	// 清除缓存
-	err := sc.SettingService.ClearCache(key)
+	err := sc.SettingService.WithClient(clientInfo(c)).ClearCache(key)
 	if err != nil {
 		utils.ServerError(c, "清除缓存失败: "+err.Error())
 		return
@@ -97,10 +333,10 @@ func (sc *SettingController) ClearCache(c *gin.Context) {
 }
 
 // ClearAllCache 清除所有设置缓存
-// DELETE /api/v1/settings/cache
+// DELETE /api/v1/admin/settings/cache
 func (sc *SettingController) ClearAllCache(c *gin.Context) {
 	// 清除所有缓存
-	err := sc.SettingService.ClearAllCache()
+	err := sc.SettingService.WithClient(clientInfo(c)).ClearAllCache()
 	if err != nil {
 		utils.ServerError(c, "清除所有缓存失败: "+err.Error())
 		return
@@ -110,8 +346,92 @@ func (sc *SettingController) ClearAllCache(c *gin.Context) {
 }
 
 // GetCacheStats 获取缓存统计信息
-// GET /api/v1/settings/cache/stats
+// GET /api/v1/admin/settings/cache/stats
 func (sc *SettingController) GetCacheStats(c *gin.Context) {
 	stats := sc.SettingService.GetCacheStats()
 	utils.Success(c, "获取缓存统计成功", stats)
 }
+
+// ListSchemas 获取全部设置定义
+// GET /api/v1/admin/setting-schemas
+func (sc *SettingController) ListSchemas(c *gin.Context) {
+	schemas, err := sc.SettingService.ListSchemas()
+	if err != nil {
+		utils.ServerError(c, err.Error())
+		return
+	}
+
+	utils.Success(c, "获取设置定义成功", gin.H{"schemas": schemas})
+}
+
+// SetSchema 创建或更新指定key的设置定义
+// PUT /api/v1/admin/setting-schemas/:key
+func (sc *SettingController) SetSchema(c *gin.Context) {
+	var req SettingSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(c, "请求参数错误: "+err.Error())
+		return
+	}
+
+	schema := &models.SettingSchema{
+		Key:         c.Param("key"),
+		Type:        req.Type,
+		Schema:      nullableJSON(req.Schema),
+		Enum:        nullableJSON(req.Enum),
+		Min:         req.Min,
+		Max:         req.Max,
+		Description: req.Description,
+	}
+	if err := sc.SettingService.WithClient(clientInfo(c)).SetSchema(schema); err != nil {
+		switch {
+		case errors.Is(err, services.ErrSettingKeyInvalid),
+			errors.Is(err, services.ErrSettingKeyLength),
+			errors.Is(err, services.ErrSettingSchemaInvalid):
+			utils.ParamError(c, err.Error())
+		case errors.Is(err, services.ErrSettingValueInvalid):
+			utils.Conflict(c, err.Error())
+		default:
+			utils.ServerError(c, err.Error())
+		}
+		return
+	}
+
+	utils.Success(c, "保存设置定义成功", schema)
+}
+
+// DeleteSchema 删除指定key的设置定义
+// DELETE /api/v1/admin/setting-schemas/:key
+func (sc *SettingController) DeleteSchema(c *gin.Context) {
+	if err := sc.SettingService.WithClient(clientInfo(c)).DeleteSchema(c.Param("key")); err != nil {
+		if errors.Is(err, services.ErrSettingSchemaNotFound) {
+			utils.NotFound(c, err.Error())
+		} else {
+			utils.ServerError(c, err.Error())
+		}
+		return
+	}
+
+	utils.Success(c, "删除设置定义成功", nil)
+}
+
+// nullableJSON 将JSON null视为未设置
+func nullableJSON(data json.RawMessage) json.RawMessage {
+	if string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+// queryOrHeader 优先读取查询参数，为空时读取请求头
+func queryOrHeader(c *gin.Context, query, header string) string {
+	if value := c.Query(query); value != "" {
+		return value
+	}
+	return c.GetHeader(header)
+}
+
+// preferredLanguage 取 Accept-Language 中的第一个语言区域，忽略权重
+func preferredLanguage(acceptLanguage string) string {
+	first := strings.Split(acceptLanguage, ",")[0]
+	return strings.TrimSpace(strings.Split(first, ";")[0])
+}
@@ -1,15 +1,30 @@
 package controllers
 
 import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
 	"ios-api/services"
 	"ios-api/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // UserController 用户控制器
 type UserController struct {
 	UserService *services.UserService
+	AppleTokens *services.AppleTokenService
+	Providers   *services.OAuthRegistry
+	// 授权码登录时按其允许列表校验客户端提交的重定向地址
+	StateService *services.OAuthStateService
+	// 旧格式第三方登录的服务端签名校验
+	LoginSigner             *services.RequestSigner
+	AllowUnsignedOAuthLogin bool
+	// 短信验证码服务
+	SmsCodes *services.SmsCodeService
 }
 
 // Register 注册用户
@@ -20,7 +35,7 @@ func (c *UserController) Register(ctx *gin.Context) {
 		return
 	}
 
-	user, token, err := c.UserService.Register(params)
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).Register(params)
 	if err != nil {
 		if err == services.ErrEmailExists {
 			utils.Conflict(ctx, err.Error())
@@ -44,8 +59,22 @@ func (c *UserController) Login(ctx *gin.Context) {
 		return
 	}
 
-	user, token, err := c.UserService.Login(params)
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).Login(params)
 	if err != nil {
+		// 已开启两步验证：返回挑战令牌，客户端再调用 /login/mfa 完成登录
+		var mfaErr *services.MFARequiredError
+		if errors.As(err, &mfaErr) {
+			utils.Success(ctx, mfaErr.Error(), gin.H{
+				"mfa_required": true,
+				"mfa_token":    mfaErr.Token,
+				"expires_in":   int(mfaErr.ExpiresIn.Seconds()),
+			})
+			return
+		}
+		if err == services.ErrUserBanned {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
 		if err == services.ErrUserNotFound || err == services.ErrInvalidPassword {
 			utils.Unauthorized(ctx, err.Error())
 		} else {
@@ -60,22 +89,141 @@ func (c *UserController) Login(ctx *gin.Context) {
 	})
 }
 
+// SendSmsCode 发送短信验证码
+func (c *UserController) SendSmsCode(ctx *gin.Context) {
+	var params services.SendSmsCodeParams
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	phone, err := services.NormalizePhone(params.Phone)
+	if err != nil {
+		utils.ParamError(ctx, err.Error())
+		return
+	}
+
+	if err := c.SmsCodes.SendCode(phone, ctx.ClientIP()); err != nil {
+		switch {
+		case errors.Is(err, services.ErrSmsTooFrequent), errors.Is(err, services.ErrSmsPhoneLimit), errors.Is(err, services.ErrSmsIPLimit):
+			utils.TooManyRequests(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	utils.Success(ctx, "验证码已发送", gin.H{
+		"expires_in": int(c.SmsCodes.CodeTTL.Seconds()),
+	})
+}
+
+// SmsLogin 短信验证码登录，手机号未注册时自动注册
+func (c *UserController) SmsLogin(ctx *gin.Context) {
+	var params services.SmsLoginParams
+	if err := ctx.ShouldBindJSON(&params); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	phone, err := services.NormalizePhone(params.Phone)
+	if err != nil {
+		utils.ParamError(ctx, err.Error())
+		return
+	}
+
+	if err := c.SmsCodes.VerifyCode(phone, params.Code); err != nil {
+		utils.Unauthorized(ctx, err.Error())
+		return
+	}
+
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).SmsLogin(phone)
+	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, "登录成功", gin.H{
+		"user":  user,
+		"token": token,
+	})
+}
+
+// OAuthLoginRequest 第三方登录请求参数
+// 客户端提交第三方返回的凭证（授权码或苹果ID令牌），由服务端向提供方验证后登录；
+// 直接提交 provider_user_id 的旧格式仅允许受信任的服务端以签名请求调用
+type OAuthLoginRequest struct {
+	Provider    string `json:"provider" binding:"required"`
+	Code        string `json:"code"`
+	IdToken     string `json:"id_token"`
+	RedirectURI string `json:"redirect_uri"`
+	Nickname    string `json:"nickname"`
+	Avatar      string `json:"avatar"`
+
+	// 旧格式字段（需要签名）
+	ProviderUserID string `json:"provider_user_id"`
+	UnionID        string `json:"union_id"`
+	Email          string `json:"email"`
+}
+
 // OAuthLogin 第三方登录
 func (c *UserController) OAuthLogin(ctx *gin.Context) {
-	var params services.OAuthLoginParams
-	if err := ctx.ShouldBindJSON(&params); err != nil {
+	var req OAuthLoginRequest
+	// 保留原始请求体用于签名校验
+	if err := ctx.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		utils.ParamError(ctx, "请求参数错误: "+err.Error())
 		return
 	}
 
 	// 校验 provider 参数值
-	if params.Provider != "wechat" && params.Provider != "apple" {
-		utils.ParamError(ctx, "不支持的登录方式，仅支持 wechat 和 apple")
+	if !c.Providers.Has(req.Provider) {
+		utils.ParamError(ctx, "不支持的登录方式，仅支持 "+strings.Join(c.Providers.Names(), "、"))
 		return
 	}
 
-	user, token, err := c.UserService.OAuthLogin(params)
+	var params *services.OAuthLoginParams
+	if req.Code != "" || req.IdToken != "" {
+		// 向第三方验证客户端提交的凭证
+		var err error
+		params, err = c.verifyOAuthCredential(&req)
+		if err != nil {
+			if errors.Is(err, services.ErrRedirectURINotAllowed) {
+				utils.ParamError(ctx, err.Error())
+			} else if services.IsOAuthCredentialError(err) {
+				utils.Unauthorized(ctx, "第三方凭证校验失败: "+err.Error())
+			} else {
+				utils.ServerError(ctx, "第三方授权处理失败: "+err.Error())
+			}
+			return
+		}
+	} else {
+		if req.ProviderUserID == "" {
+			utils.ParamError(ctx, "请求参数错误: 需要提供 code 或 id_token")
+			return
+		}
+		if !c.allowTrustedOAuthLogin(ctx, req.Provider) {
+			return
+		}
+		params = &services.OAuthLoginParams{
+			Provider:       req.Provider,
+			ProviderUserID: req.ProviderUserID,
+			UnionID:        req.UnionID,
+			Nickname:       req.Nickname,
+			Avatar:         req.Avatar,
+			Email:          req.Email,
+		}
+	}
+
+	user, token, err := c.UserService.WithClient(clientInfo(ctx)).OAuthLogin(*params)
 	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
 		utils.ServerError(ctx, err.Error())
 		return
 	}
@@ -86,6 +234,73 @@ func (c *UserController) OAuthLogin(ctx *gin.Context) {
 	})
 }
 
+// verifyOAuthCredential 使用授权码或ID令牌向第三方换取已验证的用户信息
+func (c *UserController) verifyOAuthCredential(req *OAuthLoginRequest) (*services.OAuthLoginParams, error) {
+	provider, err := c.Providers.Get(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// 苹果客户端可以只提交ID令牌，且用户姓名只在客户端首次授权时返回
+	if apple, ok := provider.(*services.AppleService); ok {
+		return apple.HandleCallback(req.Code, req.IdToken, req.Nickname, "")
+	}
+
+	if req.Code == "" {
+		return nil, services.ErrOAuthCodeInvalid
+	}
+	// 重定向地址会转交给提供方换取令牌，与网页授权使用同一允许列表；移动端SDK获取的授权码可不提交
+	if req.RedirectURI != "" && !c.StateService.IsRedirectURIAllowed(req.RedirectURI) {
+		return nil, services.ErrRedirectURINotAllowed
+	}
+	params, err := provider.ExchangeCode(req.Code, req.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// 第三方未返回昵称和头像时使用客户端提交的值
+	if params.Nickname == "" {
+		params.Nickname = req.Nickname
+	}
+	if params.Avatar == "" {
+		params.Avatar = req.Avatar
+	}
+
+	return params, nil
+}
+
+// allowTrustedOAuthLogin 校验旧格式请求的服务端签名，校验失败时写入响应并返回false
+func (c *UserController) allowTrustedOAuthLogin(ctx *gin.Context, provider string) bool {
+	var body []byte
+	if cached, ok := ctx.Get(gin.BodyBytesKey); ok {
+		body, _ = cached.([]byte)
+	}
+
+	err := c.LoginSigner.Verify(
+		ctx.Request.Method,
+		ctx.Request.URL.RequestURI(),
+		ctx.GetHeader(services.SignatureTimestampHeader),
+		ctx.GetHeader(services.SignatureNonceHeader),
+		ctx.GetHeader(services.SignatureHeader),
+		body,
+	)
+	if err == nil {
+		return true
+	}
+
+	// 迁移期间允许未签名的旧客户端，签名错误的请求仍然拒绝
+	unsigned := errors.Is(err, services.ErrSignatureMissing) || errors.Is(err, services.ErrSignerNotConfigured)
+	if c.AllowUnsignedOAuthLogin && unsigned {
+		log.Printf("警告: 接受未签名的旧格式第三方登录请求 provider=%s ip=%s", provider, ctx.ClientIP())
+		ctx.Header("Deprecation", "true")
+		ctx.Header("Warning", `299 - "未签名的 provider_user_id 登录即将停用，请改为提交 code 或 id_token"`)
+		return true
+	}
+
+	utils.Unauthorized(ctx, "请提交第三方授权码或ID令牌: "+err.Error())
+	return false
+}
+
 // Logout 用户退出登录
 func (c *UserController) Logout(ctx *gin.Context) {
 	token, _ := ctx.Get("token")
@@ -95,7 +310,7 @@ func (c *UserController) Logout(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.UserService.Logout(tokenStr); err != nil {
+	if err := c.UserService.WithClient(clientInfo(ctx)).Logout(tokenStr); err != nil {
 		utils.ServerError(ctx, err.Error())
 		return
 	}
@@ -142,7 +357,7 @@ func (c *UserController) UpdateUserInfo(ctx *gin.Context) {
 		return
 	}
 
-	user, err := c.UserService.UpdateUser(userIDUint, params)
+	user, err := c.UserService.WithClient(clientInfo(ctx)).UpdateUser(userIDUint, params)
 	if err != nil {
 		if err == services.ErrUserNotFound {
 			utils.NotFound(ctx, err.Error())
@@ -156,3 +371,42 @@ func (c *UserController) UpdateUserInfo(ctx *gin.Context) {
 		"user": user,
 	})
 }
+
+// DeleteAccount 注销当前用户账号
+func (c *UserController) DeleteAccount(ctx *gin.Context) {
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	// 苹果要求删除账号时撤销令牌：删除前读取令牌，删除成功后再撤销，撤销失败不影响账号删除
+	var appleTokens []string
+	if c.AppleTokens != nil {
+		tokens, err := c.AppleTokens.UserRefreshTokens(userIDUint)
+		if err != nil {
+			log.Printf("读取苹果令牌失败 (用户ID %d): %v", userIDUint, err)
+		}
+		appleTokens = tokens
+	}
+
+	if err := c.UserService.DeleteUser(userIDUint); err != nil {
+		if err == services.ErrUserNotFound {
+			utils.NotFound(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	if len(appleTokens) > 0 {
+		go func() {
+			if err := c.AppleTokens.RevokeTokens(appleTokens, time.Second); err != nil {
+				log.Printf("撤销苹果令牌失败 (用户ID %d): %v", userIDUint, err)
+			}
+		}()
+	}
+
+	utils.Success(ctx, "账号注销成功", nil)
+}
@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"errors"
+
+	"ios-api/services"
+	"ios-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebAuthnController 通行密钥控制器
+type WebAuthnController struct {
+	UserService *services.UserService
+	WebAuthn    *services.WebAuthnService
+}
+
+// 通行密钥注册完成请求参数
+type WebAuthnRegisterFinishRequest struct {
+	Credential services.WebAuthnRegistrationResponse `json:"credential"`
+	Name       string                                `json:"name" binding:"max=100"`
+}
+
+// 通行密钥登录开始请求参数（邮箱可选，为空时由认证器列出可用的通行密钥）
+type WebAuthnLoginBeginRequest struct {
+	Email string `json:"email"`
+}
+
+// RegisterBegin 开始注册通行密钥，返回传给认证器的注册选项
+func (c *WebAuthnController) RegisterBegin(ctx *gin.Context) {
+	if !c.WebAuthn.Enabled() {
+		utils.ServerError(ctx, services.ErrWebAuthnNotConfigured.Error())
+		return
+	}
+
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	user, err := c.UserService.GetUserByID(userIDUint)
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			utils.NotFound(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	options, err := c.WebAuthn.BeginRegistration(user)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, "获取通行密钥注册选项成功", gin.H{
+		"public_key": options,
+	})
+}
+
+// RegisterFinish 完成注册通行密钥
+func (c *WebAuthnController) RegisterFinish(ctx *gin.Context) {
+	if !c.WebAuthn.Enabled() {
+		utils.ServerError(ctx, services.ErrWebAuthnNotConfigured.Error())
+		return
+	}
+
+	userID, _ := ctx.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.ServerError(ctx, "获取用户信息失败")
+		return
+	}
+
+	var req WebAuthnRegisterFinishRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	credential, err := c.WebAuthn.FinishRegistration(userIDUint, req.Credential, req.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrWebAuthnCredentialExists):
+			utils.Conflict(ctx, err.Error())
+		case services.IsWebAuthnVerificationError(err):
+			utils.ParamError(ctx, err.Error())
+		default:
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	utils.Created(ctx, "通行密钥注册成功", gin.H{
+		"credential": credential,
+	})
+}
+
+// LoginBegin 开始通行密钥登录，返回传给认证器的登录选项
+func (c *WebAuthnController) LoginBegin(ctx *gin.Context) {
+	if !c.WebAuthn.Enabled() {
+		utils.ServerError(ctx, services.ErrWebAuthnNotConfigured.Error())
+		return
+	}
+
+	var req WebAuthnLoginBeginRequest
+	// 请求体可为空
+	if ctx.Request.ContentLength > 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			utils.ParamError(ctx, "请求参数错误: "+err.Error())
+			return
+		}
+	}
+
+	options, err := c.WebAuthn.BeginLogin(req.Email)
+	if err != nil {
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+
+	utils.Success(ctx, "获取通行密钥登录选项成功", gin.H{
+		"public_key": options,
+	})
+}
+
+// LoginFinish 完成通行密钥登录
+func (c *WebAuthnController) LoginFinish(ctx *gin.Context) {
+	if !c.WebAuthn.Enabled() {
+		utils.ServerError(ctx, services.ErrWebAuthnNotConfigured.Error())
+		return
+	}
+
+	var req services.WebAuthnAssertionResponse
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.ParamError(ctx, "请求参数错误: "+err.Error())
+		return
+	}
+
+	credential, err := c.WebAuthn.FinishLogin(req)
+	if err != nil {
+		if services.IsWebAuthnVerificationError(err) {
+			utils.Unauthorized(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	user, err := c.UserService.GetUserByID(credential.UserID)
+	if err != nil {
+		if err == services.ErrUserNotFound {
+			utils.Unauthorized(ctx, err.Error())
+		} else {
+			utils.ServerError(ctx, err.Error())
+		}
+		return
+	}
+
+	token, err := c.UserService.GenerateToken(user.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserBanned) {
+			utils.Forbidden(ctx, err.Error())
+			return
+		}
+		utils.ServerError(ctx, err.Error())
+		return
+	}
+	c.UserService.WithClient(clientInfo(ctx)).RecordLogin(user.ID, "passkey")
+
+	utils.Success(ctx, "登录成功", gin.H{
+		"user":  user,
+		"token": token,
+	})
+}
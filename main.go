@@ -12,6 +12,7 @@ import (
 	"ios-api/middlewares"
 	"ios-api/routes"
 	"ios-api/services"
+	"ios-api/utils"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/mysql"
@@ -24,6 +25,10 @@ func main() {
 	if err != nil {
 		log.Fatalf("加载配置失败: %v", err)
 	}
+	// 非开发环境禁止使用默认密钥
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("配置校验失败: %v", err)
+	}
 
 	// 连接主数据库
 	db, err := gorm.Open(mysql.Open(cfg.GetDSN()), &gorm.Config{})
@@ -37,22 +42,103 @@ func main() {
 		log.Fatalf("连接通用数据库失败: %v", err)
 	}
 
+	// 创建第三方令牌加密器
+	tokenCipher, err := utils.NewTokenCipher(cfg.TokenEncryptionKey)
+	if err != nil {
+		log.Fatalf("创建令牌加密器失败: %v", err)
+	}
+
+	// 加载JWT签名密钥
+	jwtKeys, err := services.LoadJWTKeySet(cfg)
+	if err != nil {
+		log.Fatalf("加载JWT密钥失败: %v", err)
+	}
+
+	// 创建审计日志服务（后台批量写入）
+	auditService := services.NewAuditService(db, cfg.AuditQueueSize)
+
 	// 创建用户服务
 	userService := &services.UserService{
-		DB:        db,
-		JWTSecret: cfg.JWTSecret,
-		Config:    cfg,
+		DB:          db,
+		JWTSecret:   cfg.JWTSecret,
+		Config:      cfg,
+		TokenCipher: tokenCipher,
+		// 两步验证服务（TOTP密钥使用令牌加密器加密存储）
+		MFA:  services.NewTOTPService(db, tokenCipher, cfg),
+		Keys: jwtKeys,
+		// 会话有效性缓存（退出登录和撤销时立即失效）
+		Sessions: services.NewSessionCache(cfg.SessionCacheSize, cfg.SessionCacheTTL),
+		Audit:    auditService,
 	}
 
 	// 创建设置服务（带缓存）
-	settingService, err := services.NewSettingService(generalDB, cfg.SettingSalt, cfg.CacheDir)
+	settingService, err := services.NewSettingService(generalDB, cfg.CacheDir)
 	if err != nil {
 		log.Fatalf("创建设置服务失败: %v", err)
 	}
+	settingService.Audit = auditService
+	settingService.CacheControl, err = services.ParseSettingCacheControl(cfg.SettingCacheControl)
+	if err != nil {
+		log.Fatalf("解析设置缓存策略失败: %v", err)
+	}
+	settingService.CacheTTL = cfg.SettingCacheTTL
+	settingService.NegativeCacheTTL = cfg.SettingCacheNegativeTTL
+	settingService.StaleTTL = cfg.SettingCacheStaleTTL
+	settingService.Memory = services.NewSettingMemoryCache(cfg.SettingCacheMemorySize)
+	stopCachePurge := func() {}
+	if cfg.SettingCachePurgeInterval > 0 {
+		// 启动过期缓存定时清理
+		stopCachePurge = settingService.StartCachePurge(cfg.SettingCachePurgeInterval)
+	}
 
 	// 创建AI服务
 	aiService := services.NewAIService(cfg)
 
+	// 创建微信服务
+	wechatService := services.NewWechatService(cfg)
+
+	// 创建苹果服务（启动时解析私钥，配置错误直接退出）
+	appleService, err := services.NewAppleService(cfg)
+	if err != nil {
+		log.Fatalf("创建苹果服务失败: %v", err)
+	}
+
+	// 创建微信资料同步服务
+	wechatSyncService := services.NewWechatSyncService(db, wechatService, tokenCipher)
+	stopWechatSync := func() {}
+	if cfg.WechatProfileSyncInterval > 0 {
+		// 启动微信资料定时同步
+		stopWechatSync = wechatSyncService.StartPeriodicSync(cfg.WechatProfileSyncInterval)
+	}
+
+	// 创建苹果令牌服务
+	appleTokenService := services.NewAppleTokenService(db, appleService, userService, tokenCipher)
+	stopAppleValidation := func() {}
+	if cfg.AppleTokenValidateInterval > 0 {
+		// 启动苹果刷新令牌定时校验
+		stopAppleValidation = appleTokenService.StartPeriodicValidation(cfg.AppleTokenValidateInterval)
+	}
+
+	// 创建短信验证码服务（短信服务商配置错误直接退出）
+	smsSender, err := services.NewSmsSender(cfg)
+	if err != nil {
+		log.Fatalf("创建短信服务失败: %v", err)
+	}
+	smsCodeService := services.NewSmsCodeService(smsSender, cfg)
+
+	// 创建通行密钥服务
+	webAuthnService := services.NewWebAuthnService(db, cfg)
+
+	// 创建权限服务
+	rbacService := services.NewRBACService(db)
+	customRoles, err := services.ParseRoles(cfg.RBACRoles)
+	if err != nil {
+		log.Fatalf("解析自定义角色失败: %v", err)
+	}
+	if err := rbacService.AddRoles(customRoles...); err != nil {
+		log.Fatalf("加载自定义角色失败: %v", err)
+	}
+
 	// 设置优雅关闭
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -60,11 +146,19 @@ func main() {
 		<-c
 		log.Println("正在关闭服务器...")
 
+		// 停止定时任务
+		stopWechatSync()
+		stopAppleValidation()
+		stopCachePurge()
+
 		// 关闭缓存连接
 		if err := settingService.Close(); err != nil {
 			log.Printf("关闭缓存失败: %v", err)
 		}
 
+		// 写入队列中剩余的审计日志
+		auditService.Close()
+
 		os.Exit(0)
 	}()
 
@@ -89,7 +183,7 @@ func main() {
 	r.Use(middlewares.CORSMiddleware(corsCfg))
 
 	// 设置路由
-	routes.SetupRoutes(r, userService, settingService, aiService)
+	routes.SetupRoutes(r, userService, settingService, aiService, wechatService, wechatSyncService, appleService, appleTokenService, smsCodeService, webAuthnService, rbacService, auditService)
 
 	// 启动服务器
 	port := fmt.Sprintf(":%d", cfg.AppPort)
@@ -32,6 +32,11 @@ func AuthMiddleware(userService *services.UserService) gin.HandlerFunc {
 
 		// 验证 token
 		userID, err := userService.VerifyToken(tokenString)
+		if err == services.ErrUserBanned {
+			utils.Forbidden(c, err.Error())
+			c.Abort()
+			return
+		}
 		if err != nil {
 			errMsg := "认证失败"
 			if err == services.ErrTokenExpired {
@@ -51,3 +56,19 @@ func AuthMiddleware(userService *services.UserService) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware 可选认证中间件
+// 带有效令牌时与 AuthMiddleware 一样写入用户ID，未带令牌或令牌无效时按未登录继续处理。
+func OptionalAuthMiddleware(userService *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			if userID, err := userService.VerifyToken(parts[1]); err == nil {
+				c.Set("userID", userID)
+				c.Set("token", parts[1])
+			}
+		}
+
+		c.Next()
+	}
+}
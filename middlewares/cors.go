@@ -48,8 +48,8 @@ func CORSMiddleware(config CORSConfig) gin.HandlerFunc {
 			// 设置允许跨域的Headers - 返回具体的origin而不是*
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, User-Agent, Content-Length, X-Requested-With")
-			c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Type")
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, User-Agent, Content-Length, X-Requested-With, If-None-Match, If-Modified-Since")
+			c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Type, ETag")
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
 
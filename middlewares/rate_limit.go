@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"ios-api/services"
+	"ios-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitByIP 按客户端IP限流的中间件，limiter 为nil时不限流
+func RateLimitByIP(limiter *services.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.Allow(c.ClientIP()) {
+			utils.TooManyRequests(c, "请求过于频繁，请稍后再试")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"ios-api/services"
+	"ios-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole 角色校验中间件，用户拥有任一指定角色即可访问，需放在 AuthMiddleware 之后
+func RequireRole(rbac *services.RBACService, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := contextUserID(c)
+		if !ok {
+			return
+		}
+
+		allowed, err := rbac.HasAnyRole(userID, roles...)
+		if err != nil {
+			utils.ServerError(c, err.Error())
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.Forbidden(c, "无权限执行此操作")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission 权限校验中间件，用户需拥有全部指定权限，需放在 AuthMiddleware 之后
+func RequirePermission(rbac *services.RBACService, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := contextUserID(c)
+		if !ok {
+			return
+		}
+
+		allowed, err := rbac.HasPermissions(userID, permissions...)
+		if err != nil {
+			utils.ServerError(c, err.Error())
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.Forbidden(c, "无权限执行此操作")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScopedPermission 按路径参数限定范围的权限校验中间件，需放在 AuthMiddleware 之后
+// 用户拥有 permission 或 permission:<路径参数> 即可访问，如 settings:write:app.theme
+func RequireScopedPermission(rbac *services.RBACService, permission, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := contextUserID(c)
+		if !ok {
+			return
+		}
+
+		allowed, err := rbac.HasScopedPermission(userID, permission, c.Param(param))
+		if err != nil {
+			utils.ServerError(c, err.Error())
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.Forbidden(c, "无权限执行此操作")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// contextUserID 获取 AuthMiddleware 写入的用户ID，未认证时中止请求
+func contextUserID(c *gin.Context) (uint, bool) {
+	userID, _ := c.Get("userID")
+	userIDUint, ok := userID.(uint)
+	if !ok {
+		utils.Unauthorized(c, "未提供认证信息")
+		c.Abort()
+		return 0, false
+	}
+	return userIDUint, true
+}
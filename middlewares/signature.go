@@ -0,0 +1,36 @@
+package middlewares
+
+import (
+	"ios-api/services"
+	"ios-api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireSignature 请求签名校验中间件，用于服务端之间的调用
+// 签名方式见 services.RequestSigner，未配置签名密钥时拒绝全部请求。
+func RequireSignature(signer *services.RequestSigner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := signer.VerifyRequest(c.Request); err != nil {
+			utils.Unauthorized(c, "请求签名校验失败: "+err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireParamScope 路径参数范围校验中间件，参数需匹配 scopes 中任一项
+// scopes 支持 * 通配，如 * 表示全部，app.* 表示 app. 开头的值
+func RequireParamScope(param string, scopes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.PermissionGranted(scopes, c.Param(param)) {
+			utils.Forbidden(c, "无权限执行此操作")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -7,44 +7,191 @@ USE `yuanqi_ios`;
 CREATE TABLE IF NOT EXISTS `users` (
   `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
   `email` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '邮箱',
+  `phone` varchar(32) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '手机号（E.164格式）',
   `password` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '密码',
   `nickname` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '昵称',
   `avatar` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '头像URL',
   `signature` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '个性签名',
+  `totp_secret` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '两步验证TOTP密钥（加密）',
+  `totp_enabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否开启两步验证',
+  `totp_last_step` bigint(20) NOT NULL DEFAULT 0 COMMENT '最近使用的TOTP时间步',
+  `totp_failures` int(11) NOT NULL DEFAULT 0 COMMENT '两步验证连续失败次数',
+  `totp_locked_until` timestamp NULL DEFAULT NULL COMMENT '两步验证锁定截止时间',
+  `banned_at` timestamp NULL DEFAULT NULL COMMENT '封禁时间',
+  `ban_reason` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '封禁原因',
   `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
   PRIMARY KEY (`id`),
-  UNIQUE KEY `users_email_unique` (`email`)
+  UNIQUE KEY `users_email_unique` (`email`),
+  UNIQUE KEY `users_phone_unique` (`phone`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 已有数据库升级：增加手机号字段
+-- ALTER TABLE `users` ADD COLUMN `phone` varchar(32) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '手机号（E.164格式）' AFTER `email`, ADD UNIQUE KEY `users_phone_unique` (`phone`);
+
+-- 已有数据库升级：增加两步验证字段
+-- ALTER TABLE `users`
+--   ADD COLUMN `totp_secret` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '两步验证TOTP密钥（加密）' AFTER `signature`,
+--   ADD COLUMN `totp_enabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否开启两步验证' AFTER `totp_secret`,
+--   ADD COLUMN `totp_last_step` bigint(20) NOT NULL DEFAULT 0 COMMENT '最近使用的TOTP时间步' AFTER `totp_enabled`;
+
+-- 已有数据库升级：增加两步验证失败锁定字段
+-- ALTER TABLE `users`
+--   ADD COLUMN `totp_failures` int(11) NOT NULL DEFAULT 0 COMMENT '两步验证连续失败次数' AFTER `totp_last_step`,
+--   ADD COLUMN `totp_locked_until` timestamp NULL DEFAULT NULL COMMENT '两步验证锁定截止时间' AFTER `totp_failures`;
+
+-- 已有数据库升级：增加封禁字段
+-- ALTER TABLE `users`
+--   ADD COLUMN `banned_at` timestamp NULL DEFAULT NULL COMMENT '封禁时间' AFTER `totp_last_step`,
+--   ADD COLUMN `ban_reason` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '封禁原因' AFTER `banned_at`;
+
 -- 第三方账号绑定表
 CREATE TABLE IF NOT EXISTS `oauth_accounts` (
   `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
   `user_id` bigint(20) UNSIGNED NOT NULL COMMENT '用户ID',
-  `provider` varchar(50) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '第三方提供商（wechat/apple）',
+  `provider` varchar(50) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '第三方提供商（wechat/apple/google/github/weibo）',
   `provider_user_id` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '第三方用户ID',
+  `union_id` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '微信UnionID',
+  `email` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '第三方提供的邮箱',
+  `email_disabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否关闭了中转邮箱转发',
+  `access_token` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '第三方访问令牌（加密）',
+  `refresh_token` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '第三方刷新令牌（加密）',
+  `token_expires_at` timestamp NULL DEFAULT NULL COMMENT '访问令牌过期时间',
+  `synced_nickname` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '最近同步的第三方昵称',
+  `synced_avatar` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '最近同步的第三方头像',
   `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
   PRIMARY KEY (`id`),
   UNIQUE KEY `oauth_accounts_provider_id_unique` (`provider`, `provider_user_id`),
   KEY `oauth_accounts_user_id_foreign` (`user_id`),
+  KEY `oauth_accounts_union_id_index` (`union_id`),
   CONSTRAINT `oauth_accounts_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 已有数据库升级：为第三方账号绑定表增加微信UnionID（字段或索引已存在时跳过，可重复执行）
+-- 旧的OpenID绑定会在用户下次微信登录时自动补齐UnionID；该UnionID已绑定到其他用户时不补齐，需人工合并账号
+SET @ddl = (SELECT IF(COUNT(*) = 0,
+  'ALTER TABLE `oauth_accounts` ADD COLUMN `union_id` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT ''微信UnionID'' AFTER `provider_user_id`',
+  'DO 0')
+  FROM information_schema.COLUMNS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'oauth_accounts' AND COLUMN_NAME = 'union_id');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+SET @ddl = (SELECT IF(COUNT(*) = 0,
+  'ALTER TABLE `oauth_accounts` ADD KEY `oauth_accounts_union_id_index` (`union_id`)',
+  'DO 0')
+  FROM information_schema.STATISTICS
+  WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'oauth_accounts' AND INDEX_NAME = 'oauth_accounts_union_id_index');
+PREPARE stmt FROM @ddl;
+EXECUTE stmt;
+DEALLOCATE PREPARE stmt;
+
+-- 查找同一UnionID绑定到多个用户的记录（需人工合并）
+-- SELECT `provider`, `union_id`, GROUP_CONCAT(DISTINCT `user_id`) FROM `oauth_accounts` WHERE `union_id` IS NOT NULL GROUP BY `provider`, `union_id` HAVING COUNT(DISTINCT `user_id`) > 1;
+
+-- 已有数据库升级：保存第三方令牌和资料同步状态
+-- ALTER TABLE `oauth_accounts`
+--   ADD COLUMN `access_token` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '第三方访问令牌（加密）',
+--   ADD COLUMN `refresh_token` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '第三方刷新令牌（加密）',
+--   ADD COLUMN `token_expires_at` timestamp NULL DEFAULT NULL COMMENT '访问令牌过期时间',
+--   ADD COLUMN `synced_nickname` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '最近同步的第三方昵称',
+--   ADD COLUMN `synced_avatar` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '最近同步的第三方头像';
+
+-- 已有数据库升级：记录第三方邮箱（苹果中转邮箱）及转发状态
+-- ALTER TABLE `oauth_accounts`
+--   ADD COLUMN `email` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '第三方提供的邮箱' AFTER `union_id`,
+--   ADD COLUMN `email_disabled` tinyint(1) NOT NULL DEFAULT 0 COMMENT '是否关闭了中转邮箱转发' AFTER `email`;
+
 -- 用户会话表
 CREATE TABLE IF NOT EXISTS `user_sessions` (
   `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
   `user_id` bigint(20) UNSIGNED NOT NULL COMMENT '用户ID',
-  `token` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '会话token',
+  `jti` varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '会话ID（令牌jti）',
+  `token` varchar(1024) CHARACTER SET ascii COLLATE ascii_bin NOT NULL COMMENT '会话token（RS256令牌约530字符）',
   `expired_at` timestamp NULL DEFAULT NULL COMMENT '过期时间',
   `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
   `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
   PRIMARY KEY (`id`),
   UNIQUE KEY `user_sessions_token_unique` (`token`),
+  UNIQUE KEY `user_sessions_jti_unique` (`jti`),
   KEY `user_sessions_user_id_foreign` (`user_id`),
   CONSTRAINT `user_sessions_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- 已有数据库升级：增加会话ID字段（升级前的会话为空，按token验证）
+-- ALTER TABLE `user_sessions` ADD COLUMN `jti` varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '会话ID（令牌jti）' AFTER `user_id`, ADD UNIQUE KEY `user_sessions_jti_unique` (`jti`);
+
+-- 已有数据库升级：加长会话token字段，RS256/ES256签名的令牌超过255字符（令牌只包含ascii字符，唯一索引不超过3072字节）
+-- ALTER TABLE `user_sessions` MODIFY `token` varchar(1024) CHARACTER SET ascii COLLATE ascii_bin NOT NULL COMMENT '会话token（RS256令牌约530字符）';
+
+-- 通行密钥表
+CREATE TABLE IF NOT EXISTS `webauthn_credentials` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL COMMENT '用户ID',
+  `credential_id` varchar(512) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '凭证ID（base64url）',
+  `public_key` blob NOT NULL COMMENT 'COSE格式公钥',
+  `sign_count` int(10) UNSIGNED NOT NULL DEFAULT 0 COMMENT '认证器签名计数',
+  `aaguid` varchar(36) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '认证器型号标识',
+  `transports` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '传输方式（逗号分隔）',
+  `name` varchar(100) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '备注名',
+  `last_used_at` timestamp NULL DEFAULT NULL COMMENT '最近登录时间',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `webauthn_credentials_credential_id_unique` (`credential_id`),
+  KEY `webauthn_credentials_user_id_foreign` (`user_id`),
+  CONSTRAINT `webauthn_credentials_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 两步验证恢复码表
+CREATE TABLE IF NOT EXISTS `mfa_recovery_codes` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL COMMENT '用户ID',
+  `code_hash` varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '恢复码SHA-256哈希',
+  `used_at` timestamp NULL DEFAULT NULL COMMENT '使用时间',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  KEY `mfa_recovery_codes_user_id_foreign` (`user_id`),
+  CONSTRAINT `mfa_recovery_codes_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 用户角色表（角色包含的权限在代码中定义）
+CREATE TABLE IF NOT EXISTS `user_roles` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `user_id` bigint(20) UNSIGNED NOT NULL COMMENT '用户ID',
+  `role` varchar(32) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '角色：admin、operator',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `user_roles_user_role_unique` (`user_id`, `role`),
+  CONSTRAINT `user_roles_user_id_foreign` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 指定第一个管理员（之后可通过管理接口分配角色）
+-- INSERT INTO `user_roles` (`user_id`, `role`) VALUES (1, 'admin');
+
+-- 审计日志表（只追加，删除用户时保留）
+CREATE TABLE IF NOT EXISTS `audit_logs` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `actor_id` bigint(20) UNSIGNED DEFAULT NULL COMMENT '操作人用户ID，系统操作为空',
+  `action` varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '操作',
+  `target_type` varchar(32) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '操作对象类型',
+  `target_id` varchar(128) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '操作对象ID',
+  `ip` varchar(64) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '客户端IP',
+  `user_agent` varchar(255) COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '客户端User-Agent',
+  `detail` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '详情（JSON）',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  PRIMARY KEY (`id`),
+  KEY `audit_logs_actor_id_index` (`actor_id`),
+  KEY `audit_logs_action_index` (`action`),
+  KEY `audit_logs_target_index` (`target_type`, `target_id`),
+  KEY `audit_logs_created_at_index` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 已有数据库升级：按操作对象查询审计日志
+-- ALTER TABLE `audit_logs` ADD KEY `audit_logs_target_index` (`target_type`, `target_id`);
+
 -- =====================================================
 -- yuanqi_general 数据库
 -- =====================================================
@@ -61,4 +208,32 @@ CREATE TABLE IF NOT EXISTS `settings` (
   `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
   `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录更新时间',
   PRIMARY KEY (`key`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci; 
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 创建设置定义表（没有定义的key不校验值）
+CREATE TABLE IF NOT EXISTS `setting_schemas` (
+  `key` varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '设置键',
+  `type` varchar(16) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '值类型 string/int/bool/json',
+  `schema` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT 'JSON Schema（json类型）',
+  `enum` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '可选值（JSON数组）',
+  `min` bigint(20) DEFAULT NULL COMMENT '最小值（int）或最小长度（string）',
+  `max` bigint(20) DEFAULT NULL COMMENT '最大值（int）或最大长度（string）',
+  `description` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '说明',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
+  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录更新时间',
+  PRIMARY KEY (`key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- 设置修改记录表（只追加，用于查看历史和回滚）
+CREATE TABLE IF NOT EXISTS `setting_revisions` (
+  `id` bigint(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  `key` varchar(64) COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '设置键',
+  `old_value` text COLLATE utf8mb4_unicode_ci DEFAULT NULL COMMENT '修改前的值，新建时为空',
+  `new_value` text COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '修改后的值',
+  `author_id` bigint(20) UNSIGNED DEFAULT NULL COMMENT '修改人用户ID，签名请求或系统操作为空',
+  `comment` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '修改说明',
+  `reverted_from` bigint(20) UNSIGNED DEFAULT NULL COMMENT '回滚时恢复的版本ID',
+  `created_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '修改时间',
+  PRIMARY KEY (`id`),
+  KEY `setting_revisions_key_index` (`key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog 审计日志，只追加不修改
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ActorID    *uint     `json:"actor_id" gorm:"index"`                                                            // 操作人用户ID，系统操作为空
+	Action     string    `json:"action" gorm:"size:64;index;not null"`                                             // 操作，如 admin.user.ban
+	TargetType string    `json:"target_type" gorm:"size:32;default:null;index:audit_logs_target_index,priority:1"` // 操作对象类型，如 user、setting
+	TargetID   string    `json:"target_id" gorm:"size:128;default:null;index:audit_logs_target_index,priority:2"`  // 操作对象ID
+	IP         string    `json:"ip" gorm:"column:ip;size:64;default:null"`                                         // 客户端IP
+	UserAgent  string    `json:"user_agent" gorm:"size:255;default:null"`                                          // 客户端User-Agent
+	Detail     string    `json:"detail" gorm:"type:text;default:null"`                                             // 详情（JSON），修改操作为字段变更前后的值
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// TableName 指定表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// MFARecoveryCode 两步验证恢复码，只保存哈希值，每个恢复码只能使用一次
+type MFARecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"` // 恢复码的SHA-256哈希（十六进制）
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	User      User       `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (MFARecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
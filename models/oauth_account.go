@@ -6,11 +6,19 @@ import (
 
 // OAuthAccount 第三方账号绑定模型
 type OAuthAccount struct {
-	ID             uint      `json:"id" gorm:"primaryKey"`
-	UserID         uint      `json:"user_id" gorm:"index"`
-	Provider       string    `json:"provider" gorm:"size:50;not null"`
-	ProviderUserID string    `json:"provider_user_id" gorm:"size:255;not null"`
-	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt      time.Time `json:"updated_at" gorm:"autoUpdateTime"`
-	User           User      `json:"-" gorm:"foreignKey:UserID"`
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"index"`
+	Provider       string     `json:"provider" gorm:"size:50;not null"`
+	ProviderUserID string     `json:"provider_user_id" gorm:"size:255;not null"`
+	UnionID        string     `json:"union_id" gorm:"size:255;index;default:null"` // 微信UnionID，同一开放平台下的多个应用共享
+	Email          string     `json:"email" gorm:"size:255;default:null"`          // 第三方提供的邮箱（苹果可能为中转邮箱）
+	EmailDisabled  bool       `json:"email_disabled" gorm:"default:false"`         // 用户是否关闭了中转邮箱转发
+	AccessToken    string     `json:"-" gorm:"type:text;default:null"`             // 第三方访问令牌（加密存储）
+	RefreshToken   string     `json:"-" gorm:"type:text;default:null"`             // 第三方刷新令牌（加密存储）
+	TokenExpiresAt *time.Time `json:"-"`                                           // 访问令牌过期时间
+	SyncedNickname string     `json:"-" gorm:"size:255;default:null"`              // 最近一次从第三方同步的昵称
+	SyncedAvatar   string     `json:"-" gorm:"size:255;default:null"`              // 最近一次从第三方同步的头像
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt      time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	User           User       `json:"-" gorm:"foreignKey:UserID"`
 }
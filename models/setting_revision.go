@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// SettingRevision 设置修改记录，对应setting_revisions表，每次写入设置追加一条，只追加不修改
+type SettingRevision struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Key          string    `json:"key" gorm:"size:64;not null;index;comment:设置键"`
+	OldValue     *string   `json:"old_value" gorm:"type:text;comment:修改前的值，新建时为空"`
+	NewValue     string    `json:"new_value" gorm:"type:text;not null;comment:修改后的值"`
+	AuthorID     *uint     `json:"author_id" gorm:"comment:修改人用户ID，签名请求或系统操作为空"`
+	Comment      string    `json:"comment" gorm:"size:255;not null;default:'';comment:修改说明"`
+	RevertedFrom *uint     `json:"reverted_from" gorm:"comment:回滚时恢复的版本ID"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime;comment:修改时间"`
+}
+
+// TableName 指定表名
+func (SettingRevision) TableName() string {
+	return "setting_revisions"
+}
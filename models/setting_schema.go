@@ -0,0 +1,24 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SettingSchema 设置值定义，对应setting_schemas表，没有定义的key不校验值
+type SettingSchema struct {
+	Key         string          `json:"key" gorm:"primaryKey;size:64;comment:设置键"`
+	Type        string          `json:"type" gorm:"size:16;not null;comment:值类型 string/int/bool/json"`
+	Schema      json.RawMessage `json:"schema,omitempty" gorm:"type:text;comment:JSON Schema（json类型）"`
+	Enum        json.RawMessage `json:"enum,omitempty" gorm:"type:text;comment:可选值（JSON数组）"`
+	Min         *int64          `json:"min,omitempty" gorm:"comment:最小值（int）或最小长度（string）"`
+	Max         *int64          `json:"max,omitempty" gorm:"comment:最大值（int）或最大长度（string）"`
+	Description string          `json:"description" gorm:"size:255;comment:说明"`
+	CreatedAt   time.Time       `json:"created_at" gorm:"autoCreateTime;comment:记录创建时间"`
+	UpdatedAt   time.Time       `json:"updated_at" gorm:"autoUpdateTime;comment:记录更新时间"`
+}
+
+// TableName 指定表名
+func (SettingSchema) TableName() string {
+	return "setting_schemas"
+}
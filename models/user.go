@@ -8,10 +8,28 @@ import (
 type User struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
 	Email     string    `json:"email" gorm:"uniqueIndex;size:255;default:null"`
-	Password  string    `json:"-" gorm:"size:255;default:null"` // 不返回给前端
+	Phone     string    `json:"phone" gorm:"uniqueIndex;size:32;default:null"` // E.164格式手机号
+	Password  string    `json:"-" gorm:"size:255;default:null"`                // 不返回给前端
 	Nickname  string    `json:"nickname" gorm:"size:255;default:null"`
 	Avatar    string    `json:"avatar" gorm:"size:255;default:null"`
 	Signature string    `json:"signature" gorm:"type:text;default:null"`
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+
+	// 两步验证（TOTP）
+	TOTPSecret   string `json:"-" gorm:"column:totp_secret;type:text;default:null"` // TOTP密钥（加密存储），确认开启前也会保存
+	TOTPEnabled  bool   `json:"totp_enabled" gorm:"column:totp_enabled;default:false"`
+	TOTPLastStep int64  `json:"-" gorm:"column:totp_last_step;default:0"` // 最近一次使用的时间步，防止验证码重放
+	// 登录第二步连续失败次数和锁定截止时间，跨挑战令牌累计，防止反复密码登录获取新令牌后继续猜测
+	TOTPFailures    int        `json:"-" gorm:"column:totp_failures;default:0"`
+	TOTPLockedUntil *time.Time `json:"-" gorm:"column:totp_locked_until"`
+
+	// 封禁状态
+	BannedAt  *time.Time `json:"banned_at,omitempty"`
+	BanReason string     `json:"ban_reason,omitempty" gorm:"size:255;default:null"`
+}
+
+// IsBanned 用户是否已被封禁
+func (u *User) IsBanned() bool {
+	return u.BannedAt != nil
 }
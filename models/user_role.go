@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// UserRole 用户角色，角色包含的权限在代码中定义
+type UserRole struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:user_roles_user_role_unique;not null"`
+	Role      string    `json:"role" gorm:"uniqueIndex:user_roles_user_role_unique;size:32;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	User      User      `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (UserRole) TableName() string {
+	return "user_roles"
+}
@@ -8,7 +8,8 @@ import (
 type UserSession struct {
 	ID        uint       `json:"id" gorm:"primaryKey"`
 	UserID    uint       `json:"user_id" gorm:"index"`
-	Token     string     `json:"token" gorm:"uniqueIndex;size:255;not null"`
+	JTI       *string    `json:"-" gorm:"column:jti;uniqueIndex;size:64"` // 会话ID（令牌jti），升级前创建的会话为空
+	Token     string     `json:"token" gorm:"uniqueIndex;size:1024;type:varchar(1024) CHARACTER SET ascii COLLATE ascii_bin;not null"`
 	ExpiredAt *time.Time `json:"expired_at"`
 	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
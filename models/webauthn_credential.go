@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// WebAuthnCredential 用户注册的通行密钥（WebAuthn凭证）
+type WebAuthnCredential struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"index"`
+	CredentialID string     `json:"credential_id" gorm:"size:512;uniqueIndex;not null"` // 凭证ID（base64url编码）
+	PublicKey    []byte     `json:"-" gorm:"type:blob;not null"`                        // COSE格式公钥
+	SignCount    uint32     `json:"-" gorm:"default:0"`                                 // 认证器签名计数，用于发现克隆的认证器
+	AAGUID       string     `json:"aaguid" gorm:"column:aaguid;size:36;default:null"`   // 认证器型号标识
+	Transports   string     `json:"transports" gorm:"size:255;default:null"`            // 认证器支持的传输方式（逗号分隔）
+	Name         string     `json:"name" gorm:"size:100;default:null"`                  // 用户设置的备注名
+	LastUsedAt   *time.Time `json:"last_used_at"`                                       // 最近一次登录时间
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"autoUpdateTime"`
+	User         User       `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// TableName 指定表名
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
@@ -0,0 +1,290 @@
+// Package remoteconfig 远程配置和功能开关的规则定义与求值
+// 不依赖数据库和缓存，定义的存储和读取由 services.SettingService 负责。
+package remoteconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BucketCount 按比例放量时的分桶数量，比例精度为 0.01%
+const BucketCount = 10000
+
+// 自定义错误
+var (
+	ErrDefinitionInvalid = errors.New("远程配置定义格式错误")
+	ErrVersionInvalid    = errors.New("版本号格式错误")
+)
+
+// Context 发起请求的客户端信息，用于匹配规则
+type Context struct {
+	UserID     uint   // 用户ID，未登录时为0
+	Platform   string // 平台，如 ios、android
+	AppVersion string // App版本号，如 2.1.0
+	Locale     string // 语言区域，如 zh-Hans-CN
+}
+
+// Definition 一个配置项的定义：按顺序匹配规则，第一条命中的规则决定取值，都不命中时取默认值
+type Definition struct {
+	Default json.RawMessage `json:"default"`
+	Salt    string          `json:"salt,omitempty"` // 分桶盐值，为空时使用配置名；修改后放量用户会重新分配
+	Rules   []Rule          `json:"rules,omitempty"`
+}
+
+// Rule 定向规则，条件之间为且的关系，未设置的条件不限制
+type Rule struct {
+	Name       string          `json:"name,omitempty"`        // 规则名称，用于排查命中情况
+	Platforms  []string        `json:"platforms,omitempty"`   // 平台，不区分大小写
+	MinVersion string          `json:"min_version,omitempty"` // 最低App版本（含）
+	MaxVersion string          `json:"max_version,omitempty"` // 最高App版本（含）
+	UserIDs    []uint          `json:"user_ids,omitempty"`    // 用户ID白名单
+	Locales    []string        `json:"locales,omitempty"`     // 语言区域，zh 可匹配 zh-Hans-CN
+	Percentage *float64        `json:"percentage,omitempty"`  // 按用户ID放量的比例（0-100）
+	Value      json.RawMessage `json:"value"`                 // 命中时的取值
+}
+
+// Result 求值结果
+type Result struct {
+	Value json.RawMessage // 取值
+	Rule  int             // 命中的规则序号，未命中时为 -1
+}
+
+// Parse 解析并校验配置定义，不允许未知字段
+func Parse(data []byte) (*Definition, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var definition Definition
+	if err := decoder.Decode(&definition); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDefinitionInvalid, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: 包含多余的内容", ErrDefinitionInvalid)
+	}
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// Validate 检查配置定义是否有效
+func (d *Definition) Validate() error {
+	if !isJSONValue(d.Default) {
+		return fmt.Errorf("%w: default 不能为空", ErrDefinitionInvalid)
+	}
+	for i, rule := range d.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("%w: rules[%d]: %v", ErrDefinitionInvalid, i, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate 按客户端信息求值，name 为配置名，salt 为空时用于分桶
+func (d *Definition) Evaluate(name string, ctx Context) Result {
+	seed := d.Salt
+	if seed == "" {
+		seed = name
+	}
+	for i := range d.Rules {
+		if d.Rules[i].Match(seed, ctx) {
+			return Result{Value: d.Rules[i].Value, Rule: i}
+		}
+	}
+	return Result{Value: d.Default, Rule: -1}
+}
+
+// Match 判断客户端是否命中规则，seed 为分桶种子
+// 规则限制了版本而客户端版本号无效，或规则限制了用户而客户端未登录时，不命中。
+func (r *Rule) Match(seed string, ctx Context) bool {
+	if len(r.Platforms) > 0 && !containsFold(r.Platforms, ctx.Platform) {
+		return false
+	}
+
+	if r.MinVersion != "" || r.MaxVersion != "" {
+		if r.MinVersion != "" {
+			if c, err := CompareVersions(ctx.AppVersion, r.MinVersion); err != nil || c < 0 {
+				return false
+			}
+		}
+		if r.MaxVersion != "" {
+			if c, err := CompareVersions(ctx.AppVersion, r.MaxVersion); err != nil || c > 0 {
+				return false
+			}
+		}
+	}
+
+	if len(r.UserIDs) > 0 {
+		matched := false
+		for _, id := range r.UserIDs {
+			if ctx.UserID != 0 && id == ctx.UserID {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.Locales) > 0 {
+		matched := false
+		for _, locale := range r.Locales {
+			if MatchLocale(locale, ctx.Locale) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if r.Percentage != nil {
+		if ctx.UserID == 0 {
+			return false
+		}
+		if float64(Bucket(seed, ctx.UserID)) >= *r.Percentage*BucketCount/100 {
+			return false
+		}
+	}
+	return true
+}
+
+// validate 检查规则是否有效
+func (r *Rule) validate() error {
+	if !isJSONValue(r.Value) {
+		return errors.New("value 不能为空")
+	}
+	for _, platform := range r.Platforms {
+		if strings.TrimSpace(platform) == "" {
+			return errors.New("platforms 不能包含空字符串")
+		}
+	}
+	for _, locale := range r.Locales {
+		if normalizeLocale(locale) == "" {
+			return errors.New("locales 不能包含空字符串")
+		}
+	}
+	for _, id := range r.UserIDs {
+		if id == 0 {
+			return errors.New("user_ids 不能包含0")
+		}
+	}
+	if r.MinVersion != "" {
+		if _, err := parseVersion(r.MinVersion); err != nil {
+			return fmt.Errorf("min_version: %v", err)
+		}
+	}
+	if r.MaxVersion != "" {
+		if _, err := parseVersion(r.MaxVersion); err != nil {
+			return fmt.Errorf("max_version: %v", err)
+		}
+	}
+	if r.MinVersion != "" && r.MaxVersion != "" {
+		if c, _ := CompareVersions(r.MinVersion, r.MaxVersion); c > 0 {
+			return errors.New("min_version 不能大于 max_version")
+		}
+	}
+	if r.Percentage != nil && (*r.Percentage < 0 || *r.Percentage > 100) {
+		return errors.New("percentage 应在 0-100 之间")
+	}
+	return nil
+}
+
+// Bucket 根据种子和用户ID计算稳定的分桶，范围 [0, BucketCount)
+// 同一用户在同一配置下的分桶固定，放量比例增加时已命中的用户保持命中。
+func Bucket(seed string, userID uint) int {
+	sum := sha256.Sum256([]byte(seed + ":" + strconv.FormatUint(uint64(userID), 10)))
+	return int(binary.BigEndian.Uint64(sum[:8]) % BucketCount)
+}
+
+// CompareVersions 比较点号分隔的数字版本号，缺少的部分按0处理，如 2.1 等于 2.1.0
+// a 小于、等于、大于 b 时分别返回 -1、0、1。
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y uint64
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x < y {
+			return -1, nil
+		}
+		if x > y {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// MatchLocale 判断客户端语言区域是否属于规则中的语言区域
+// 不区分大小写，下划线等同于连字符，按子标签前缀匹配：zh 匹配 zh-Hans-CN，zh-Hans 不匹配 zh-Hant。
+func MatchLocale(pattern, locale string) bool {
+	pattern = normalizeLocale(pattern)
+	locale = normalizeLocale(locale)
+	if pattern == "" || locale == "" {
+		return false
+	}
+	return locale == pattern || strings.HasPrefix(locale, pattern+"-")
+}
+
+// parseVersion 解析版本号，只允许点号分隔的数字
+func parseVersion(version string) ([]uint64, error) {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil, fmt.Errorf("%w: 不能为空", ErrVersionInvalid)
+	}
+
+	parts := strings.Split(version, ".")
+	numbers := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrVersionInvalid, version)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
+
+// normalizeLocale 规范化语言区域：小写，下划线替换为连字符
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// containsFold 不区分大小写判断是否包含
+func containsFold(values []string, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	for _, candidate := range values {
+		if strings.EqualFold(strings.TrimSpace(candidate), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONValue 是否为非空的JSON值
+func isJSONValue(data json.RawMessage) bool {
+	return len(bytes.TrimSpace(data)) > 0
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"time"
+
 	"ios-api/controllers"
 	"ios-api/middlewares"
 	"ios-api/services"
@@ -9,24 +11,28 @@ import (
 )
 
 // SetupRoutes 设置路由
-func SetupRoutes(r *gin.Engine, userService *services.UserService, settingService *services.SettingService, aiService *services.AIService) {
-	// 创建微信服务
-	wechatService := &services.WechatService{
-		AppID:     userService.Config.WechatAppID,
-		AppSecret: userService.Config.WechatAppSecret,
-	}
+func SetupRoutes(r *gin.Engine, userService *services.UserService, settingService *services.SettingService, aiService *services.AIService, wechatService *services.WechatService, wechatSyncService *services.WechatSyncService, appleService *services.AppleService, appleTokenService *services.AppleTokenService, smsCodeService *services.SmsCodeService, webAuthnService *services.WebAuthnService, rbacService *services.RBACService, auditService *services.AuditService) {
+	// 创建第三方登录提供方注册表
+	providers := services.NewOAuthRegistryFromConfig(userService.Config, wechatService, appleService)
 
-	// 创建苹果服务
-	appleService := &services.AppleService{
-		TeamID:     userService.Config.AppleTeamID,
-		KeyID:      userService.Config.AppleKeyID,
-		PrivateKey: userService.Config.ApplePrivateKey,
-		BundleID:   userService.Config.AppleBundleID,
-	}
+	// 创建OAuth state服务，微信专用的重定向地址与通用地址合并
+	redirectURIs := append(append([]string{}, userService.Config.OAuthRedirectURIs...), userService.Config.WechatRedirectURIs...)
+	stateService := services.NewOAuthStateService(userService.Config.OAuthStateSecret, redirectURIs)
+
+	// 无需认证的授权接口按IP限流
+	authLimit := middlewares.RateLimitByIP(services.NewRateLimiter(userService.Config.AuthRateLimit, time.Minute))
 
 	// 创建控制器
 	userController := &controllers.UserController{
 		UserService: userService,
+		AppleTokens: appleTokenService,
+		Providers:   providers,
+		// 授权码登录的重定向地址与网页授权共用允许列表
+		StateService: stateService,
+		// 旧格式第三方登录仅接受签名请求
+		LoginSigner:             services.NewRequestSigner(userService.Config.OAuthLoginSigningSecret),
+		AllowUnsignedOAuthLogin: userService.Config.OAuthLoginAllowUnsigned,
+		SmsCodes:                smsCodeService,
 	}
 
 	// 创建OAuth控制器
@@ -34,6 +40,21 @@ func SetupRoutes(r *gin.Engine, userService *services.UserService, settingServic
 		UserService:   userService,
 		WechatService: wechatService,
 		AppleService:  appleService,
+		StateService:  stateService,
+		WechatSync:    wechatSyncService,
+		Providers:     providers,
+	}
+
+	// 创建通行密钥控制器
+	webAuthnController := &controllers.WebAuthnController{
+		UserService: userService,
+		WebAuthn:    webAuthnService,
+	}
+
+	// 创建两步验证控制器
+	mfaController := &controllers.MFAController{
+		UserService: userService,
+		TOTP:        userService.MFA,
 	}
 
 	// 创建设置控制器
@@ -44,6 +65,21 @@ func SetupRoutes(r *gin.Engine, userService *services.UserService, settingServic
 	// 创建AI控制器
 	aiController := controllers.NewAIController(aiService)
 
+	// 创建管理后台控制器
+	adminController := &controllers.AdminController{
+		UserService: userService,
+		RBAC:        rbacService,
+		Audit:       auditService,
+	}
+
+	// 创建公钥发布控制器
+	jwksController := &controllers.JWKSController{
+		Keys: userService.Keys,
+	}
+
+	// 令牌验证公钥（标准路径，不在/api/v1下）
+	r.GET("/.well-known/jwks.json", jwksController.JWKS)
+
 	// 无需认证的路由
 	v1 := r.Group("/api/v1")
 	{
@@ -51,25 +87,42 @@ func SetupRoutes(r *gin.Engine, userService *services.UserService, settingServic
 		v1.POST("/register", userController.Register)
 		// 用户登录
 		v1.POST("/login", userController.Login)
+		// 两步验证登录（密码登录返回挑战令牌后调用）
+		v1.POST("/login/mfa", mfaController.Login)
+		// 发送短信验证码
+		v1.POST("/sms/code", userController.SendSmsCode)
+		// 短信验证码登录
+		v1.POST("/login/sms", userController.SmsLogin)
+		// 通行密钥登录
+		v1.POST("/webauthn/login/begin", authLimit, webAuthnController.LoginBegin)
+		v1.POST("/webauthn/login/finish", webAuthnController.LoginFinish)
 		// 第三方登录
 		v1.POST("/oauth/login", userController.OAuthLogin)
 
 		// 微信授权相关
-		v1.POST("/oauth/wechat/auth", oauthController.WechatAuthURL)
-		v1.GET("/oauth/wechat/callback", oauthController.WechatCallback)
+		v1.POST("/oauth/wechat/auth", authLimit, oauthController.WechatAuthURL)
+		v1.GET("/oauth/wechat/callback", authLimit, oauthController.WechatCallback)
+		v1.POST("/oauth/wechat/miniprogram/login", oauthController.WechatMiniProgramLogin)
 
 		// 苹果授权相关
-		v1.POST("/oauth/apple/auth", oauthController.AppleAuth)
-		v1.POST("/oauth/apple/callback", oauthController.AppleCallback)
+		v1.POST("/oauth/apple/auth", authLimit, oauthController.AppleAuth)
+		v1.POST("/oauth/apple/callback", authLimit, oauthController.AppleCallback)
+		v1.POST("/oauth/apple/notifications", oauthController.AppleNotification)
 
-		// 设置相关API（不需要认证）
-		v1.GET("/settings/:key", settingController.GetSetting)
-		v1.PUT("/settings/:key", settingController.SetSetting)
+		// 通用第三方授权（Google、GitHub、微博等已注册的提供方）
+		v1.POST("/oauth/:provider/auth", authLimit, oauthController.ProviderAuthURL)
+		v1.GET("/oauth/:provider/callback", authLimit, oauthController.ProviderCallback)
+		v1.POST("/oauth/:provider/callback", authLimit, oauthController.ProviderCallback)
 
-		// 缓存管理API（不需要认证，但建议在生产环境中添加认证）
-		v1.DELETE("/settings/:key/cache", settingController.ClearCache)  // 清除指定key的缓存
-		v1.DELETE("/settings/cache", settingController.ClearAllCache)    // 清除所有缓存
-		v1.GET("/settings/cache/stats", settingController.GetCacheStats) // 获取缓存统计
+		// 设置相关API（读取不需要认证，不返回 config. 命名空间的远程配置定义）
+		v1.GET("/settings", settingController.ListSettings)            // 按命名空间获取，如 ?prefix=app.ios.
+		v1.POST("/settings/batch", settingController.BatchGetSettings) // 批量获取
+		v1.GET("/settings/:key", settingController.GetSetting)
+		// 远程配置（可选登录，登录用户可命中按用户定向和放量的规则）
+		v1.GET("/config", middlewares.OptionalAuthMiddleware(userService), settingController.GetConfig)
+		// 服务端签名写入设置，只能修改 SETTING_SIGNING_KEYS 范围内的key
+		settingSigner := services.NewRequestSigner(userService.Config.SettingSigningSecret)
+		v1.PUT("/settings/:key", middlewares.RequireSignature(settingSigner), middlewares.RequireParamScope("key", userService.Config.SettingSigningKeys), settingController.SetSetting)
 
 		// AI相关API（不需要认证）
 		v1.POST("/ai/chat/completions", aiController.ChatCompletion) // 通用AI聊天
@@ -88,5 +141,62 @@ func SetupRoutes(r *gin.Engine, userService *services.UserService, settingServic
 		auth.GET("/user", userController.GetUserInfo)
 		// 更新用户信息
 		auth.PUT("/user", userController.UpdateUserInfo)
+		// 注销账号
+		auth.DELETE("/user", userController.DeleteAccount)
+		// 从微信重新同步资料
+		auth.POST("/oauth/wechat/sync", oauthController.WechatSyncProfile)
+		// 两步验证（TOTP）
+		auth.POST("/mfa/totp/setup", mfaController.SetupTOTP)
+		auth.POST("/mfa/totp/confirm", mfaController.ConfirmTOTP)
+		auth.POST("/mfa/totp/disable", mfaController.DisableTOTP)
+		// 注册通行密钥
+		auth.POST("/webauthn/register/begin", webAuthnController.RegisterBegin)
+		auth.POST("/webauthn/register/finish", webAuthnController.RegisterFinish)
+	}
+
+	// 管理后台路由（需要认证，并按权限控制）
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middlewares.AuthMiddleware(userService))
+	{
+		// 设置管理（可按key授权，如 settings:write:app.*）
+		settingWrite := middlewares.RequireScopedPermission(rbacService, services.PermSettingsWrite, "key")
+		admin.GET("/settings/:key", settingWrite, settingController.AdminGetSetting) // 读取原始值，包括不公开的远程配置定义
+		admin.PUT("/settings/:key", settingWrite, settingController.SetSetting)
+		admin.GET("/settings/:key/revisions", settingWrite, settingController.ListRevisions)                          // 修改记录
+		admin.GET("/settings/:key/revisions/diff", settingWrite, settingController.DiffRevisions)                     // 对比两个版本
+		admin.POST("/settings/:key/revisions/:revision_id/rollback", settingWrite, settingController.RollbackSetting) // 回滚到指定版本
+
+		// 设置定义（值类型和校验规则）
+		schemas := middlewares.RequirePermission(rbacService, services.PermSettingsSchema)
+		admin.GET("/setting-schemas", schemas, settingController.ListSchemas)
+		admin.PUT("/setting-schemas/:key", schemas, settingController.SetSchema)
+		admin.DELETE("/setting-schemas/:key", schemas, settingController.DeleteSchema)
+
+		// 缓存管理
+		cache := middlewares.RequirePermission(rbacService, services.PermSettingsCache)
+		admin.DELETE("/settings/:key/cache", cache, settingController.ClearCache)  // 清除指定key的缓存
+		admin.DELETE("/settings/cache", cache, settingController.ClearAllCache)    // 清除所有缓存
+		admin.GET("/settings/cache/stats", cache, settingController.GetCacheStats) // 获取缓存统计
+
+		// 用户管理
+		usersRead := middlewares.RequirePermission(rbacService, services.PermUsersRead)
+		usersWrite := middlewares.RequirePermission(rbacService, services.PermUsersWrite)
+		admin.GET("/users", usersRead, adminController.SearchUsers)
+		admin.GET("/users/:id", usersRead, adminController.GetUser)
+		admin.PUT("/users/:id", usersWrite, adminController.UpdateUser)
+		admin.POST("/users/:id/ban", usersWrite, adminController.BanUser)
+		admin.POST("/users/:id/unban", usersWrite, adminController.UnbanUser)
+		admin.POST("/users/:id/logout", usersWrite, adminController.LogoutUser)
+		admin.DELETE("/users/:id/sessions/:session_id", usersWrite, adminController.RevokeSession)
+
+		// 角色管理
+		roles := middlewares.RequirePermission(rbacService, services.PermRolesManage)
+		admin.GET("/roles", roles, adminController.ListRoles)
+		admin.GET("/users/:id/roles", roles, adminController.GetUserRoles)
+		admin.POST("/users/:id/roles", roles, adminController.AssignRole)
+		admin.DELETE("/users/:id/roles/:role", roles, adminController.RemoveRole)
+
+		// 审计日志
+		admin.GET("/audit-logs", middlewares.RequirePermission(rbacService, services.PermAuditRead), adminController.ListAuditLogs)
 	}
 }
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"ios-api/config"
+)
+
+// DefaultAliyunSmsEndpoint 阿里云短信接口默认地址
+const DefaultAliyunSmsEndpoint = "https://dysmsapi.aliyuncs.com"
+
+// AliyunSmsSender 阿里云短信发送器（SendSms，RPC签名V1）
+type AliyunSmsSender struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SignName        string
+	TemplateCode    string       // 模板中的验证码变量名为 code
+	Endpoint        string       // 接口地址，默认 https://dysmsapi.aliyuncs.com
+	Client          *http.Client // HTTP客户端，为空时使用默认客户端
+}
+
+// NewAliyunSmsSender 创建新的阿里云短信发送器
+func NewAliyunSmsSender(cfg *config.Config) *AliyunSmsSender {
+	return &AliyunSmsSender{
+		AccessKeyID:     cfg.AliyunSmsAccessKeyID,
+		AccessKeySecret: cfg.AliyunSmsAccessKeySecret,
+		SignName:        cfg.AliyunSmsSignName,
+		TemplateCode:    cfg.AliyunSmsTemplateCode,
+		Endpoint:        cfg.AliyunSmsEndpoint,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// aliyunSmsResponse 阿里云短信接口响应
+type aliyunSmsResponse struct {
+	Code      string `json:"Code"`
+	Message   string `json:"Message"`
+	BizID     string `json:"BizId"`
+	RequestID string `json:"RequestId"`
+}
+
+// endpoint 获取接口地址
+func (s *AliyunSmsSender) endpoint() string {
+	if s.Endpoint == "" {
+		return DefaultAliyunSmsEndpoint
+	}
+	return strings.TrimRight(s.Endpoint, "/")
+}
+
+// httpClient 获取HTTP客户端
+func (s *AliyunSmsSender) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// SendCode 发送验证码短信
+func (s *AliyunSmsSender) SendCode(phone, code string) error {
+	templateParam, _ := json.Marshal(map[string]string{"code": code})
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("%w: %v", ErrSmsSendFailed, err)
+	}
+
+	params := map[string]string{
+		"AccessKeyId":      s.AccessKeyID,
+		"Action":           "SendSms",
+		"Format":           "JSON",
+		"PhoneNumbers":     mainlandPhone(phone),
+		"RegionId":         "cn-hangzhou",
+		"SignName":         s.SignName,
+		"SignatureMethod":  "HMAC-SHA1",
+		"SignatureNonce":   hex.EncodeToString(nonce),
+		"SignatureVersion": "1.0",
+		"TemplateCode":     s.TemplateCode,
+		"TemplateParam":    string(templateParam),
+		"Timestamp":        time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		"Version":          "2017-05-25",
+	}
+
+	query := aliyunCanonicalQuery(params)
+	signature := AliyunSignature(s.AccessKeySecret, http.MethodGet, query)
+	requestURL := s.endpoint() + "/?Signature=" + aliyunPercentEncode(signature) + "&" + query
+
+	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSmsSendFailed, err)
+	}
+
+	var resp aliyunSmsResponse
+	if _, err := doJSON(s.httpClient(), req, &resp); err != nil {
+		return fmt.Errorf("%w: %v", ErrSmsSendFailed, err)
+	}
+	if resp.Code != "OK" {
+		return fmt.Errorf("%w: %s %s", ErrSmsSendFailed, resp.Code, resp.Message)
+	}
+
+	return nil
+}
+
+// AliyunSignature 计算阿里云RPC接口签名
+// 待签名字符串为 方法&%2F&编码后的规范化查询字符串，密钥为 AccessKeySecret&
+func AliyunSignature(secret, method, canonicalQuery string) string {
+	stringToSign := method + "&" + aliyunPercentEncode("/") + "&" + aliyunPercentEncode(canonicalQuery)
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// aliyunCanonicalQuery 按参数名排序并编码查询字符串
+func aliyunCanonicalQuery(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, aliyunPercentEncode(key)+"="+aliyunPercentEncode(params[key]))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// aliyunPercentEncode 阿里云要求的URL编码（空格编码为%20，保留~）
+func aliyunPercentEncode(value string) string {
+	encoded := url.QueryEscape(value)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	encoded = strings.ReplaceAll(encoded, "%7E", "~")
+	return encoded
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"ios-api/models"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// 苹果服务端通知事件类型
+const (
+	AppleEventEmailDisabled  = "email-disabled"
+	AppleEventEmailEnabled   = "email-enabled"
+	AppleEventConsentRevoked = "consent-revoked"
+	AppleEventAccountDelete  = "account-delete"
+)
+
+// 自定义错误
+var (
+	ErrAppleNotificationInvalid = errors.New("无效的苹果服务端通知")
+)
+
+// AppleNotificationEvent 苹果服务端通知事件
+type AppleNotificationEvent struct {
+	Type           string      `json:"type"`
+	Sub            string      `json:"sub"`
+	Email          string      `json:"email,omitempty"`
+	IsPrivateEmail interface{} `json:"is_private_email,omitempty"` // 苹果可能返回字符串或布尔值
+	EventTime      int64       `json:"event_time"`
+}
+
+// publicKey 获取指定kid的苹果公钥
+func (s *AppleService) publicKey(kid string) (*rsa.PublicKey, error) {
+	key, err := s.jwks.publicKey(s.httpClient(), s.baseURL()+"/auth/keys", kid)
+	if err != nil && !errors.Is(err, ErrPublicKeyNotFound) {
+		return nil, fmt.Errorf("%w: %v", ErrAppleServerError, err)
+	}
+	return key, err
+}
+
+// verifyAppleJWT 使用苹果公钥验证JWT签名、发行者和受众
+func (s *AppleService) verifyAppleJWT(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("不支持的签名算法: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return s.publicKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("令牌无效")
+	}
+	if !claims.VerifyIssuer(DefaultAppleBaseURL, true) {
+		return nil, errors.New("发行者无效")
+	}
+	if !claims.VerifyAudience(s.BundleID, true) {
+		return nil, errors.New("受众无效")
+	}
+
+	return claims, nil
+}
+
+// VerifyNotification 验证苹果服务端通知并解析事件
+func (s *AppleService) VerifyNotification(payload string) (*AppleNotificationEvent, error) {
+	claims, err := s.verifyAppleJWT(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAppleNotificationInvalid, err)
+	}
+
+	// events字段是JSON字符串
+	var event AppleNotificationEvent
+	switch events := claims["events"].(type) {
+	case string:
+		err = json.Unmarshal([]byte(events), &event)
+	case map[string]interface{}:
+		var data []byte
+		if data, err = json.Marshal(events); err == nil {
+			err = json.Unmarshal(data, &event)
+		}
+	default:
+		err = errors.New("缺少events字段")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAppleNotificationInvalid, err)
+	}
+
+	if event.Type == "" || event.Sub == "" {
+		return nil, fmt.Errorf("%w: 事件类型或用户标识为空", ErrAppleNotificationInvalid)
+	}
+
+	return &event, nil
+}
+
+// HandleAppleNotification 处理苹果服务端通知事件
+// 未找到对应绑定时返回 ErrUserNotFound，调用方可直接确认通知
+func (s *UserService) HandleAppleNotification(event *AppleNotificationEvent) error {
+	var account models.OAuthAccount
+	if err := s.DB.Where("provider = ? AND provider_user_id = ?", "apple", event.Sub).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	switch event.Type {
+	case AppleEventEmailDisabled, AppleEventEmailEnabled:
+		return s.updateAppleRelayEmail(&account, event)
+	case AppleEventConsentRevoked:
+		// 用户在设置中停止使用Apple登录，清除已失效的令牌并撤销所有会话
+		if err := s.DB.Model(&account).Updates(map[string]interface{}{
+			"access_token":     nil,
+			"refresh_token":    nil,
+			"token_expires_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		_, err := s.RevokeUserSessions(account.UserID)
+		return err
+	case AppleEventAccountDelete:
+		// 用户删除了Apple账号，删除对应的用户
+		err := s.DeleteUser(account.UserID)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		return err
+	default:
+		log.Printf("忽略未知的苹果通知事件: %s", event.Type)
+		return nil
+	}
+}
+
+// updateAppleRelayEmail 更新苹果中转邮箱及其转发状态
+func (s *UserService) updateAppleRelayEmail(account *models.OAuthAccount, event *AppleNotificationEvent) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"email_disabled": event.Type == AppleEventEmailDisabled,
+		}
+		if event.Email != "" {
+			updates["email"] = event.Email
+		}
+		if err := tx.Model(account).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// 用户邮箱来自苹果时同步更新
+		if event.Email != "" && account.Email != "" && account.Email != event.Email {
+			if err := tx.Model(&models.User{}).
+				Where("id = ? AND email = ?", account.UserID, account.Email).
+				Update("email", event.Email).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
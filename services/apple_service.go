@@ -8,21 +8,71 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"ios-api/config"
+
 	"github.com/golang-jwt/jwt/v4"
 )
 
+// DefaultAppleBaseURL 苹果登录接口默认地址
+const DefaultAppleBaseURL = "https://appleid.apple.com"
+
+// 苹果客户端密钥有效期
+const (
+	AppleClientSecretMaxTTL      = 180 * 24 * time.Hour // 苹果允许的最长有效期约为6个月
+	appleClientSecretRenewBefore = time.Hour            // 过期前提前重新签名的时间
+)
+
 // AppleService 苹果服务
 type AppleService struct {
-	TeamID     string
-	KeyID      string
-	PrivateKey string
-	BundleID   string
+	TeamID           string
+	KeyID            string
+	PrivateKey       string // PEM格式私钥内容或.p8文件路径
+	PrivateKeyBase64 string // base64编码的私钥，优先于PrivateKey
+	BundleID         string
+	BaseURL          string        // 苹果登录接口地址，默认 https://appleid.apple.com
+	Client           *http.Client  // HTTP客户端，为空时使用默认客户端
+	ClientSecretTTL  time.Duration // 客户端密钥有效期，默认且最长为 AppleClientSecretMaxTTL
+
+	// 已解析的私钥和缓存的客户端密钥
+	secretMu              sync.Mutex
+	signingKey            *ecdsa.PrivateKey
+	clientSecret          string
+	clientSecretExpiresAt time.Time
+
+	// 苹果公钥缓存，用于验证苹果签发的JWT
+	jwks jwksCache
+}
+
+// NewAppleService 创建新的苹果服务实例
+// 配置了私钥时在创建时解析，私钥无效则返回错误，避免到用户登录时才发现配置问题
+func NewAppleService(cfg *config.Config) (*AppleService, error) {
+	service := &AppleService{
+		TeamID:           cfg.AppleTeamID,
+		KeyID:            cfg.AppleKeyID,
+		PrivateKey:       cfg.ApplePrivateKey,
+		PrivateKeyBase64: cfg.ApplePrivateKeyBase64,
+		BundleID:         cfg.AppleBundleID,
+		BaseURL:          cfg.AppleBaseURL,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+
+	if service.HasPrivateKey() {
+		if err := service.LoadPrivateKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	return service, nil
 }
 
 // AppleIdTokenPayload 苹果ID令牌载荷
@@ -35,10 +85,10 @@ type AppleIdTokenPayload struct {
 	Sub   string `json:"sub"`
 	Nonce string `json:"nonce,omitempty"`
 	// 苹果特有字段
-	Email          string `json:"email,omitempty"`
-	EmailVerified  string `json:"email_verified,omitempty"`
-	IsPrivateEmail string `json:"is_private_email,omitempty"`
-	RealUserStatus int    `json:"real_user_status,omitempty"`
+	Email          string      `json:"email,omitempty"`
+	EmailVerified  interface{} `json:"email_verified,omitempty"`   // 苹果可能返回字符串或布尔值
+	IsPrivateEmail interface{} `json:"is_private_email,omitempty"` // 苹果可能返回字符串或布尔值
+	RealUserStatus int         `json:"real_user_status,omitempty"`
 	Name           struct {
 		FirstName string `json:"firstName,omitempty"`
 		LastName  string `json:"lastName,omitempty"`
@@ -62,108 +112,167 @@ var (
 	ErrAppleTokenInvalid    = errors.New("无效的苹果令牌")
 	ErrAppleServerError     = errors.New("苹果服务器错误")
 	ErrApplePrivateKeyError = errors.New("苹果私钥解析错误")
+	ErrAppleTokenRevoked    = errors.New("苹果授权已被用户撤销")
 )
 
-// GenerateClientSecret 生成客户端密钥
-func (s *AppleService) GenerateClientSecret() (string, error) {
-	// 解析私钥
-	var privateKey *ecdsa.PrivateKey
+// baseURL 获取苹果登录接口地址
+func (s *AppleService) baseURL() string {
+	if s.BaseURL == "" {
+		return DefaultAppleBaseURL
+	}
+	return strings.TrimRight(s.BaseURL, "/")
+}
 
-	// 检查私钥是否为文件路径
-	if strings.HasPrefix(s.PrivateKey, "/") || strings.HasPrefix(s.PrivateKey, "./") {
+// httpClient 获取HTTP客户端
+func (s *AppleService) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// LoadPrivateKey 解析并加载苹果私钥，同时清除已缓存的客户端密钥（用于启动时校验配置和轮换私钥）
+// 私钥来源优先级：PrivateKeyBase64（base64编码的PEM或DER）> PrivateKey（PEM内容或文件路径）
+func (s *AppleService) LoadPrivateKey() error {
+	s.secretMu.Lock()
+	defer s.secretMu.Unlock()
+
+	key, err := s.parsePrivateKey()
+	if err != nil {
+		return err
+	}
+
+	s.signingKey = key
+	s.clientSecret = ""
+	s.clientSecretExpiresAt = time.Time{}
+	return nil
+}
+
+// HasPrivateKey 是否配置了苹果私钥
+func (s *AppleService) HasPrivateKey() bool {
+	return s.PrivateKey != "" || s.PrivateKeyBase64 != ""
+}
+
+// parsePrivateKey 从配置中读取并解析私钥
+func (s *AppleService) parsePrivateKey() (*ecdsa.PrivateKey, error) {
+	var keyData []byte
+
+	switch {
+	case s.PrivateKeyBase64 != "":
+		// base64编码的私钥（便于通过单行环境变量注入）
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s.PrivateKeyBase64))
+		if err != nil {
+			return nil, fmt.Errorf("%w: base64解码失败: %v", ErrApplePrivateKeyError, err)
+		}
+		keyData = decoded
+	case strings.Contains(s.PrivateKey, "-----BEGIN"):
+		// 直接提供的PEM内容，兼容环境变量中转义的换行符
+		keyData = []byte(strings.ReplaceAll(s.PrivateKey, `\n`, "\n"))
+	case s.PrivateKey != "":
 		// 从文件读取私钥
-		keyData, err := ioutil.ReadFile(s.PrivateKey)
+		fileData, err := os.ReadFile(s.PrivateKey)
 		if err != nil {
-			return "", fmt.Errorf("读取私钥文件失败: %w", err)
+			return nil, fmt.Errorf("%w: 读取私钥文件失败: %v", ErrApplePrivateKeyError, err)
 		}
+		keyData = fileData
+	default:
+		return nil, fmt.Errorf("%w: 未配置私钥", ErrApplePrivateKeyError)
+	}
 
-		// 解析PEM格式
-		block, _ := pem.Decode(keyData)
-		if block == nil {
-			return "", fmt.Errorf("%w: 无法解码PEM格式", ErrApplePrivateKeyError)
-		}
+	// 解析PEM格式，非PEM时按DER格式解析
+	der := keyData
+	if block, _ := pem.Decode(keyData); block != nil {
+		der = block.Bytes
+	}
 
-		// 解析私钥
-		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
-		if err != nil {
-			return "", fmt.Errorf("%w: %v", ErrApplePrivateKeyError, err)
-		}
+	// 解析私钥
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrApplePrivateKeyError, err)
+	}
 
-		var ok bool
-		privateKey, ok = key.(*ecdsa.PrivateKey)
-		if !ok {
-			return "", fmt.Errorf("%w: 不是ECDSA私钥", ErrApplePrivateKeyError)
-		}
-	} else {
-		// 直接解析私钥内容
-		// 假设内容已经是标准的PEM格式
-		block, _ := pem.Decode([]byte(s.PrivateKey))
-		if block == nil {
-			return "", fmt.Errorf("%w: 无法解码PEM格式", ErrApplePrivateKeyError)
-		}
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: 不是ECDSA私钥", ErrApplePrivateKeyError)
+	}
+
+	return privateKey, nil
+}
+
+// GenerateClientSecret 获取客户端密钥
+// 签名后的密钥会被缓存，在过期前 appleClientSecretRenewBefore 才重新签名
+func (s *AppleService) GenerateClientSecret() (string, error) {
+	s.secretMu.Lock()
+	defer s.secretMu.Unlock()
 
-		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	now := time.Now()
+	if s.clientSecret != "" && now.Before(s.clientSecretExpiresAt.Add(-appleClientSecretRenewBefore)) {
+		return s.clientSecret, nil
+	}
+
+	// 未在启动时加载私钥时按需加载
+	if s.signingKey == nil {
+		key, err := s.parsePrivateKey()
 		if err != nil {
-			return "", fmt.Errorf("%w: %v", ErrApplePrivateKeyError, err)
+			return "", err
 		}
+		s.signingKey = key
+	}
 
-		var ok bool
-		privateKey, ok = key.(*ecdsa.PrivateKey)
-		if !ok {
-			return "", fmt.Errorf("%w: 不是ECDSA私钥", ErrApplePrivateKeyError)
-		}
+	ttl := s.ClientSecretTTL
+	if ttl <= 0 || ttl > AppleClientSecretMaxTTL {
+		ttl = AppleClientSecretMaxTTL
 	}
 
 	// 创建JWT
-	now := time.Now()
+	expiresAt := now.Add(ttl)
 	claims := jwt.MapClaims{
-		"iss": s.TeamID,                       // 发行者是Team ID
-		"iat": now.Unix(),                     // 发行时间
-		"exp": now.Add(time.Hour * 24).Unix(), // 过期时间（24小时）
-		"aud": "https://appleid.apple.com",    // 目标受众
-		"sub": s.BundleID,                     // 主题（应用的Bundle ID）
+		"iss": s.TeamID,                    // 发行者是Team ID
+		"iat": now.Unix(),                  // 发行时间
+		"exp": expiresAt.Unix(),            // 过期时间
+		"aud": "https://appleid.apple.com", // 目标受众
+		"sub": s.BundleID,                  // 主题（应用的Bundle ID）
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
 	token.Header["kid"] = s.KeyID
 
 	// 签名token
-	clientSecret, err := token.SignedString(privateKey)
+	clientSecret, err := token.SignedString(s.signingKey)
 	if err != nil {
 		return "", fmt.Errorf("签名客户端密钥失败: %w", err)
 	}
 
+	s.clientSecret = clientSecret
+	s.clientSecretExpiresAt = expiresAt
 	return clientSecret, nil
 }
 
 // ValidateIdToken 验证苹果ID令牌
+// 使用苹果公钥验证签名，并校验发行者、受众（Bundle ID）和有效期
 func (s *AppleService) ValidateIdToken(idToken string) (*AppleIdTokenPayload, error) {
-	// 解析JWT令牌而不验证签名
-	parts := strings.Split(idToken, ".")
-	if len(parts) != 3 {
-		return nil, ErrAppleTokenInvalid
+	claims, err := s.verifyAppleJWT(idToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAppleTokenInvalid, err)
 	}
 
-	// 解码JWT载荷
-	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	// ID令牌必须包含过期时间
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, fmt.Errorf("%w: 令牌已过期", ErrAppleTokenInvalid)
+	}
+
+	// 转换为结构化载荷
+	data, err := json.Marshal(claims)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrAppleTokenInvalid, err)
 	}
-
-	// 解析为JSON
 	var tokenPayload AppleIdTokenPayload
-	if err := json.Unmarshal(payload, &tokenPayload); err != nil {
+	if err := json.Unmarshal(data, &tokenPayload); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrAppleTokenInvalid, err)
 	}
 
-	// 验证token是否过期
-	if tokenPayload.Exp < time.Now().Unix() {
-		return nil, fmt.Errorf("%w: 令牌已过期", ErrAppleTokenInvalid)
-	}
-
-	// 验证发行者
-	if tokenPayload.Iss != "https://appleid.apple.com" {
-		return nil, fmt.Errorf("%w: 发行者无效", ErrAppleTokenInvalid)
+	if tokenPayload.Sub == "" {
+		return nil, fmt.Errorf("%w: 缺少用户标识", ErrAppleTokenInvalid)
 	}
 
 	return &tokenPayload, nil
@@ -171,28 +280,98 @@ func (s *AppleService) ValidateIdToken(idToken string) (*AppleIdTokenPayload, er
 
 // ExchangeAuthCodeForToken 使用授权码交换访问令牌
 func (s *AppleService) ExchangeAuthCodeForToken(code string) (*AppleTokenResponse, error) {
+	// 创建请求数据
+	data := url.Values{}
+	data.Set("code", code)
+	data.Set("grant_type", "authorization_code")
+
+	tokenResp, err := s.requestToken(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查错误
+	if tokenResp.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrAppleAuthFailed, tokenResp.Error)
+	}
+
+	return tokenResp, nil
+}
+
+// ValidateRefreshToken 使用刷新令牌向苹果验证授权是否仍然有效
+// 用户在iOS设置中停止使用Apple登录后，苹果会返回 invalid_grant
+func (s *AppleService) ValidateRefreshToken(refreshToken string) (*AppleTokenResponse, error) {
+	// 创建请求数据
+	data := url.Values{}
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	tokenResp, err := s.requestToken(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查错误
+	switch tokenResp.Error {
+	case "":
+		return tokenResp, nil
+	case "invalid_grant":
+		return nil, fmt.Errorf("%w: %s", ErrAppleTokenRevoked, tokenResp.Error)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrAppleAuthFailed, tokenResp.Error)
+	}
+}
+
+// RevokeToken 撤销苹果令牌，tokenTypeHint 为 refresh_token 或 access_token
+func (s *AppleService) RevokeToken(token, tokenTypeHint string) error {
 	// 生成客户端密钥
 	clientSecret, err := s.GenerateClientSecret()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	// 创建请求数据
 	data := url.Values{}
 	data.Set("client_id", s.BundleID)
 	data.Set("client_secret", clientSecret)
-	data.Set("code", code)
-	data.Set("grant_type", "authorization_code")
+	data.Set("token", token)
+	data.Set("token_type_hint", tokenTypeHint)
 
 	// 发送POST请求
-	resp, err := http.PostForm("https://appleid.apple.com/auth/token", data)
+	resp, err := s.httpClient().PostForm(s.baseURL()+"/auth/revoke", data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAppleServerError, err)
+	}
+	defer resp.Body.Close()
+
+	// 苹果撤销成功时返回200且响应体为空
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: 撤销令牌失败，状态码 %d %s", ErrAppleAuthFailed, resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// requestToken 调用苹果令牌接口，苹果返回的业务错误由调用方根据 Error 字段处理
+func (s *AppleService) requestToken(data url.Values) (*AppleTokenResponse, error) {
+	// 生成客户端密钥
+	clientSecret, err := s.GenerateClientSecret()
+	if err != nil {
+		return nil, err
+	}
+	data.Set("client_id", s.BundleID)
+	data.Set("client_secret", clientSecret)
+
+	// 发送POST请求
+	resp, err := s.httpClient().PostForm(s.baseURL()+"/auth/token", data)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrAppleServerError, err)
 	}
 	defer resp.Body.Close()
 
 	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrAppleServerError, err)
 	}
@@ -203,17 +382,31 @@ func (s *AppleService) ExchangeAuthCodeForToken(code string) (*AppleTokenRespons
 		return nil, fmt.Errorf("%w: %v", ErrAppleServerError, err)
 	}
 
-	// 检查错误
-	if tokenResp.Error != "" {
-		return nil, fmt.Errorf("%w: %s", ErrAppleAuthFailed, tokenResp.Error)
-	}
-
 	return &tokenResp, nil
 }
 
+// Name 提供方名称
+func (s *AppleService) Name() string {
+	return "apple"
+}
+
+// AuthURL 苹果登录由客户端完成授权，不提供网页授权链接（实现 OAuthProvider）
+func (s *AppleService) AuthURL(redirectURI, state string) string {
+	return ""
+}
+
+// ExchangeCode 使用客户端获取的授权码换取用户信息（实现 OAuthProvider）
+func (s *AppleService) ExchangeCode(code, redirectURI string) (*OAuthLoginParams, error) {
+	if code == "" {
+		return nil, ErrAppleCodeInvalid
+	}
+	return s.HandleCallback(code, "", "", "")
+}
+
 // HandleCallback 处理苹果授权回调
 func (s *AppleService) HandleCallback(code, idToken, name, email string) (*OAuthLoginParams, error) {
 	var tokenPayload *AppleIdTokenPayload
+	var refreshToken string
 
 	// 如果提供了授权码，则交换访问令牌
 	if code != "" {
@@ -221,6 +414,7 @@ func (s *AppleService) HandleCallback(code, idToken, name, email string) (*OAuth
 		if err != nil {
 			return nil, err
 		}
+		refreshToken = tokenResp.RefreshToken
 
 		// 验证ID令牌
 		tokenPayload, err = s.ValidateIdToken(tokenResp.IdToken)
@@ -258,6 +452,7 @@ func (s *AppleService) HandleCallback(code, idToken, name, email string) (*OAuth
 		ProviderUserID: tokenPayload.Sub, // 使用Sub作为用户标识
 		Nickname:       nickname,
 		Email:          email, // 如果前端提供了邮箱（首次登录时），则使用前端提供的
+		RefreshToken:   refreshToken,
 	}
 
 	// 如果没有提供邮箱，但令牌中有邮箱，则使用令牌中的
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"ios-api/models"
+	"ios-api/utils"
+
+	"gorm.io/gorm"
+)
+
+// AppleTokenService 苹果刷新令牌校验和撤销服务
+type AppleTokenService struct {
+	DB     *gorm.DB
+	Apple  *AppleService
+	Users  *UserService
+	Cipher *utils.TokenCipher
+}
+
+// NewAppleTokenService 创建新的苹果令牌服务
+func NewAppleTokenService(db *gorm.DB, apple *AppleService, users *UserService, cipher *utils.TokenCipher) *AppleTokenService {
+	return &AppleTokenService{
+		DB:     db,
+		Apple:  apple,
+		Users:  users,
+		Cipher: cipher,
+	}
+}
+
+// clearToken 清除绑定上保存的苹果令牌
+func (s *AppleTokenService) clearToken(account *models.OAuthAccount) error {
+	return s.DB.Model(account).Updates(map[string]interface{}{
+		"access_token":     nil,
+		"refresh_token":    nil,
+		"token_expires_at": nil,
+	}).Error
+}
+
+// ValidateAccount 向苹果校验绑定的刷新令牌
+// 用户已在iOS设置中撤销授权时，清除令牌并撤销该用户的所有会话，返回 ErrAppleTokenRevoked
+func (s *AppleTokenService) ValidateAccount(account *models.OAuthAccount) error {
+	refreshToken, err := s.Cipher.Decrypt(account.RefreshToken, utils.CipherAAD("oauth_accounts", account.ID, "refresh_token"))
+	if err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	_, err = s.Apple.ValidateRefreshToken(refreshToken)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrAppleTokenRevoked) {
+		return err
+	}
+
+	// 授权已撤销，与 consent-revoked 通知的处理保持一致
+	if err := s.clearToken(account); err != nil {
+		return err
+	}
+	if _, err := s.Users.RevokeUserSessions(account.UserID); err != nil {
+		return err
+	}
+	return ErrAppleTokenRevoked
+}
+
+// ValidateAll 校验所有保存了刷新令牌的苹果绑定，返回被撤销的数量
+func (s *AppleTokenService) ValidateAll() (int, error) {
+	var accounts []models.OAuthAccount
+	err := s.DB.Where("provider = ? AND refresh_token IS NOT NULL AND refresh_token <> ''", "apple").
+		Find(&accounts).Error
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for i := range accounts {
+		err := s.ValidateAccount(&accounts[i])
+		if errors.Is(err, ErrAppleTokenRevoked) {
+			revoked++
+		} else if err != nil {
+			log.Printf("校验苹果令牌失败 (绑定ID %d): %v", accounts[i].ID, err)
+		}
+	}
+
+	return revoked, nil
+}
+
+// appleRevokeAttempts 删除账号后撤销苹果令牌的最多尝试次数
+const appleRevokeAttempts = 3
+
+// UserRefreshTokens 读取用户所有苹果绑定的刷新令牌（已解密），删除账号前调用
+func (s *AppleTokenService) UserRefreshTokens(userID uint) ([]string, error) {
+	var accounts []models.OAuthAccount
+	err := s.DB.Where("user_id = ? AND provider = ? AND refresh_token IS NOT NULL AND refresh_token <> ''", userID, "apple").
+		Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]string, 0, len(accounts))
+	for i := range accounts {
+		refreshToken, err := s.Cipher.Decrypt(accounts[i].RefreshToken, utils.CipherAAD("oauth_accounts", accounts[i].ID, "refresh_token"))
+		if err != nil {
+			return nil, err
+		}
+		if refreshToken != "" {
+			tokens = append(tokens, refreshToken)
+		}
+	}
+
+	return tokens, nil
+}
+
+// RevokeTokens 向苹果撤销刷新令牌，失败时按退避间隔重试，返回最后一次失败的错误
+// 账号删除后绑定已不存在，只能使用删除前读取的令牌。
+func (s *AppleTokenService) RevokeTokens(tokens []string, backoff time.Duration) error {
+	var lastErr error
+	for _, refreshToken := range tokens {
+		var err error
+		for attempt := 0; attempt < appleRevokeAttempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(backoff << (attempt - 1))
+			}
+			if err = s.Apple.RevokeToken(refreshToken, "refresh_token"); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// StartPeriodicValidation 启动定时校验任务，返回停止函数
+// 苹果建议每天最多校验一次刷新令牌
+func (s *AppleTokenService) StartPeriodicValidation(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				revoked, err := s.ValidateAll()
+				if err != nil {
+					log.Printf("定时校验苹果令牌失败: %v", err)
+					continue
+				}
+				log.Printf("定时校验苹果令牌完成，%d 个用户已撤销授权", revoked)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ios-api/models"
+
+	"gorm.io/gorm"
+)
+
+// 审计操作
+const (
+	AuditAdminUserSearch    = "admin.user.search"
+	AuditAdminUserView      = "admin.user.view"
+	AuditAdminUserUpdate    = "admin.user.update"
+	AuditAdminUserBan       = "admin.user.ban"
+	AuditAdminUserUnban     = "admin.user.unban"
+	AuditAdminUserLogout    = "admin.user.logout"
+	AuditAdminSessionRevoke = "admin.session.revoke"
+	AuditAdminRoleAssign    = "admin.role.assign"
+	AuditAdminRoleRemove    = "admin.role.remove"
+
+	AuditUserRegister    = "user.register"
+	AuditUserLogin       = "user.login"
+	AuditUserLoginFailed = "user.login_failed"
+	AuditUserOAuthLogin  = "user.oauth_login"
+	AuditUserLogout      = "user.logout"
+	AuditUserUpdate      = "user.update"
+
+	AuditSettingUpdate        = "setting.update"
+	AuditSettingCacheClear    = "setting.cache.clear"
+	AuditSettingCacheClearAll = "setting.cache.clear_all"
+	AuditSettingSchemaUpdate  = "setting.schema.update"
+	AuditSettingSchemaDelete  = "setting.schema.delete"
+)
+
+// 审计对象类型
+const (
+	AuditTargetUser    = "user"
+	AuditTargetSetting = "setting"
+)
+
+// 审计日志写入队列
+const (
+	DefaultAuditQueueSize = 1024 // 默认队列长度
+	auditBatchSize        = 100  // 单次批量写入的最大条数
+)
+
+// AuditEntry 一条审计记录
+type AuditEntry struct {
+	ActorID    uint        // 操作人用户ID，0 表示系统操作
+	Action     string      // 操作
+	TargetType string      // 操作对象类型
+	TargetID   string      // 操作对象ID
+	IP         string      // 客户端IP
+	UserAgent  string      // 客户端User-Agent
+	Detail     interface{} // 详情，序列化为JSON保存
+}
+
+// FieldChange 字段变更前后的值
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ClientInfo 发起请求的客户端信息，记录审计日志时使用
+type ClientInfo struct {
+	ActorID   uint   // 当前登录用户ID，未登录时为0
+	IP        string // 客户端IP
+	UserAgent string // 客户端User-Agent
+}
+
+// entry 生成由该客户端发起的审计记录
+func (c ClientInfo) entry(action, targetType, targetID string, detail interface{}) AuditEntry {
+	return AuditEntry{
+		ActorID:    c.ActorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		IP:         c.IP,
+		UserAgent:  c.UserAgent,
+		Detail:     detail,
+	}
+}
+
+// AuditLogQuery 审计日志查询条件，条件之间为且的关系
+type AuditLogQuery struct {
+	ActorID    uint       `form:"actor_id"`
+	Action     string     `form:"action"` // 精确匹配，以 * 结尾时按前缀匹配，如 user.*
+	TargetType string     `form:"target_type"`
+	TargetID   string     `form:"target_id"`
+	IP         string     `form:"ip"`
+	From       *time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"` // 起始时间（含）
+	To         *time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`   // 结束时间（不含）
+	Page       int        `form:"page"`
+	PageSize   int        `form:"page_size"`
+}
+
+// auditRequest 写入队列中的请求，flushed 不为空时表示等待之前的记录写入完成
+type auditRequest struct {
+	record  *models.AuditLog
+	flushed chan struct{}
+}
+
+// AuditService 审计日志服务
+// 记录经有界队列由后台协程批量写入数据库，队列已满时丢弃记录，不阻塞业务操作。
+type AuditService struct {
+	dropped uint64 // 丢弃的记录数，原子操作需要64位对齐，放在首位
+
+	DB *gorm.DB
+
+	queue  chan auditRequest
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAuditService 创建审计日志服务并启动后台写入协程
+// queueSize 为写入队列长度，不大于0时使用默认值。
+func NewAuditService(db *gorm.DB, queueSize int) *AuditService {
+	if queueSize <= 0 {
+		queueSize = DefaultAuditQueueSize
+	}
+	s := &AuditService{
+		DB:    db,
+		queue: make(chan auditRequest, queueSize),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Record 将审计记录加入写入队列，队列已满或服务已关闭时丢弃并计数
+// 服务为空时不记录。
+func (s *AuditService) Record(entry AuditEntry) {
+	if s == nil {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.drop(entry)
+		return
+	}
+	select {
+	case s.queue <- auditRequest{record: entry.toModel()}:
+	default:
+		s.drop(entry)
+	}
+}
+
+// Flush 等待已加入队列的记录全部写入
+func (s *AuditService) Flush() {
+	if s == nil {
+		return
+	}
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	s.queue <- auditRequest{flushed: flushed}
+	s.mu.RUnlock()
+	<-flushed
+}
+
+// Close 停止接收新记录，等待队列中的记录写入完成
+func (s *AuditService) Close() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+}
+
+// Dropped 返回因队列已满或服务已关闭而丢弃的记录数
+func (s *AuditService) Dropped() uint64 {
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Query 按条件查询审计日志，返回当前页的记录和总数，按时间倒序排列
+func (s *AuditService) Query(params AuditLogQuery) ([]models.AuditLog, int64, error) {
+	query := s.DB.Model(&models.AuditLog{})
+	if params.ActorID != 0 {
+		query = query.Where("actor_id = ?", params.ActorID)
+	}
+	if params.Action != "" {
+		if prefix := strings.TrimSuffix(params.Action, "*"); prefix != params.Action {
+			query = query.Where("action LIKE ?", likeEscaper.Replace(prefix)+"%")
+		} else {
+			query = query.Where("action = ?", params.Action)
+		}
+	}
+	if params.TargetType != "" {
+		query = query.Where("target_type = ?", params.TargetType)
+	}
+	if params.TargetID != "" {
+		query = query.Where("target_id = ?", params.TargetID)
+	}
+	if params.IP != "" {
+		query = query.Where("ip = ?", params.IP)
+	}
+	if params.From != nil {
+		query = query.Where("created_at >= ?", *params.From)
+	}
+	if params.To != nil {
+		query = query.Where("created_at < ?", *params.To)
+	}
+
+	// 同一查询条件用于统计总数和分页查询
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := normalizePage(params.Page, params.PageSize)
+	logs := []models.AuditLog{}
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// run 后台写入协程，合并队列中已有的记录批量写入，队列关闭后退出
+func (s *AuditService) run() {
+	defer close(s.done)
+
+	for request := range s.queue {
+		records := []*models.AuditLog{}
+		var flushed []chan struct{}
+		collect := func(request auditRequest) {
+			if request.record != nil {
+				records = append(records, request.record)
+			}
+			if request.flushed != nil {
+				flushed = append(flushed, request.flushed)
+			}
+		}
+		collect(request)
+
+	drain:
+		for len(records) < auditBatchSize {
+			select {
+			case request, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				collect(request)
+			default:
+				break drain
+			}
+		}
+
+		s.write(records)
+		for _, ch := range flushed {
+			close(ch)
+		}
+	}
+}
+
+// write 批量写入审计记录，写入失败只记录错误日志
+func (s *AuditService) write(records []*models.AuditLog) {
+	if len(records) == 0 {
+		return
+	}
+	if err := s.DB.CreateInBatches(records, auditBatchSize).Error; err != nil {
+		log.Printf("写入审计日志失败: count=%d err=%v", len(records), err)
+	}
+}
+
+// drop 丢弃审计记录，每丢弃100条记录一次日志
+func (s *AuditService) drop(entry AuditEntry) {
+	if dropped := atomic.AddUint64(&s.dropped, 1); dropped%100 == 1 {
+		log.Printf("审计日志无法加入写入队列，丢弃记录: action=%s target=%s/%s dropped=%d", entry.Action, entry.TargetType, entry.TargetID, dropped)
+	}
+}
+
+// toModel 转换为数据库模型
+func (e AuditEntry) toModel() *models.AuditLog {
+	record := &models.AuditLog{
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.IP,
+		UserAgent:  truncateString(e.UserAgent, 255),
+		CreatedAt:  time.Now(),
+	}
+	if e.ActorID != 0 {
+		actorID := e.ActorID
+		record.ActorID = &actorID
+	}
+	if e.Detail != nil {
+		if detail, err := json.Marshal(e.Detail); err == nil {
+			record.Detail = string(detail)
+		}
+	}
+	return record
+}
+
+// truncateString 按字符截断字符串
+func truncateString(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// cborMaxDepth 嵌套数组/映射的最大深度
+const cborMaxDepth = 16
+
+// ErrCBORInvalid CBOR数据格式错误
+var ErrCBORInvalid = errors.New("CBOR数据格式错误")
+
+// cborDecode 解码data开头的一个CBOR数据项，返回解码结果和占用的字节数
+// 仅支持WebAuthn用到的确定长度编码：整数解码为int64，字节串为[]byte，文本串为string，
+// 数组为[]interface{}，映射为map[interface{}]interface{}（键为int64或string），
+// true/false解码为bool，null/undefined解码为nil；标签会被忽略，只返回其内容。
+func cborDecode(data []byte) (interface{}, int, error) {
+	return cborDecodeItem(data, 0)
+}
+
+func cborDecodeItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth {
+		return nil, 0, fmt.Errorf("%w: 嵌套层级过深", ErrCBORInvalid)
+	}
+	if len(data) == 0 {
+		return nil, 0, fmt.Errorf("%w: 数据不完整", ErrCBORInvalid)
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	// 简单值与浮点数
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, 1, nil
+		case 21:
+			return true, 1, nil
+		case 22, 23:
+			return nil, 1, nil
+		default:
+			return nil, 0, fmt.Errorf("%w: 不支持的简单值 %d", ErrCBORInvalid, info)
+		}
+	}
+
+	arg, offset, err := cborArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, 0, fmt.Errorf("%w: 整数溢出", ErrCBORInvalid)
+		}
+		return int64(arg), offset, nil
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, 0, fmt.Errorf("%w: 整数溢出", ErrCBORInvalid)
+		}
+		return -1 - int64(arg), offset, nil
+	case 2, 3:
+		if arg > uint64(len(data)-offset) {
+			return nil, 0, fmt.Errorf("%w: 数据不完整", ErrCBORInvalid)
+		}
+		end := offset + int(arg)
+		if major == 3 {
+			return string(data[offset:end]), end, nil
+		}
+		value := make([]byte, arg)
+		copy(value, data[offset:end])
+		return value, end, nil
+	case 4:
+		// 每个元素至少占用1字节
+		if arg > uint64(len(data)-offset) {
+			return nil, 0, fmt.Errorf("%w: 数据不完整", ErrCBORInvalid)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, n, err := cborDecodeItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			offset += n
+		}
+		return items, offset, nil
+	case 5:
+		// 每个键值对至少占用2字节
+		if arg > uint64(len(data)-offset)/2 {
+			return nil, 0, fmt.Errorf("%w: 数据不完整", ErrCBORInvalid)
+		}
+		entries := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, n, err := cborDecodeItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, fmt.Errorf("%w: 不支持的映射键类型", ErrCBORInvalid)
+			}
+			if _, exists := entries[key]; exists {
+				return nil, 0, fmt.Errorf("%w: 映射键重复", ErrCBORInvalid)
+			}
+
+			value, n, err := cborDecodeItem(data[offset:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			offset += n
+			entries[key] = value
+		}
+		return entries, offset, nil
+	case 6:
+		// 标签：忽略标签号，返回被标记的数据项
+		item, n, err := cborDecodeItem(data[offset:], depth+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return item, offset + n, nil
+	}
+
+	return nil, 0, fmt.Errorf("%w: 未知类型 %d", ErrCBORInvalid, major)
+}
+
+// cborArgument 读取数据项头部的参数值，返回参数和头部长度
+func cborArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(data) < 2 {
+			break
+		}
+		return uint64(data[1]), 2, nil
+	case info == 25:
+		if len(data) < 3 {
+			break
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case info == 26:
+		if len(data) < 5 {
+			break
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case info == 27:
+		if len(data) < 9 {
+			break
+		}
+		return binary.BigEndian.Uint64(data[1:9]), 9, nil
+	default:
+		// 28-30保留，31为不定长度编码（WebAuthn要求确定长度）
+		return 0, 0, fmt.Errorf("%w: 不支持的长度编码 %d", ErrCBORInvalid, info)
+	}
+	return 0, 0, fmt.Errorf("%w: 数据不完整", ErrCBORInvalid)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ios-api/config"
+)
+
+// GitHub接口默认地址
+const (
+	DefaultGitHubBaseURL    = "https://github.com"
+	DefaultGitHubAPIBaseURL = "https://api.github.com"
+)
+
+// GitHubService GitHub登录服务
+type GitHubService struct {
+	ClientID     string
+	ClientSecret string
+	BaseURL      string       // GitHub授权地址，默认 https://github.com
+	APIBaseURL   string       // GitHub API地址，默认 https://api.github.com
+	Client       *http.Client // HTTP客户端，为空时使用默认客户端
+}
+
+// NewGitHubService 创建新的GitHub登录服务实例
+func NewGitHubService(cfg *config.Config) *GitHubService {
+	return &GitHubService{
+		ClientID:     cfg.GitHubClientID,
+		ClientSecret: cfg.GitHubClientSecret,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// GitHubTokenResponse GitHub访问令牌响应
+type GitHubTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// GitHubUser GitHub用户信息
+type GitHubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+	Email     string `json:"email"`
+}
+
+// GitHubEmail GitHub用户邮箱
+type GitHubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// 自定义错误
+var (
+	ErrGitHubAuthFailed     = errors.New("GitHub授权失败")
+	ErrGitHubUserInfoFailed = errors.New("获取GitHub用户信息失败")
+	ErrGitHubServerError    = errors.New("GitHub服务器错误")
+)
+
+// Name 提供方名称
+func (s *GitHubService) Name() string {
+	return "github"
+}
+
+// baseURL 获取GitHub授权地址
+func (s *GitHubService) baseURL() string {
+	if s.BaseURL == "" {
+		return DefaultGitHubBaseURL
+	}
+	return strings.TrimRight(s.BaseURL, "/")
+}
+
+// apiBaseURL 获取GitHub API地址
+func (s *GitHubService) apiBaseURL() string {
+	if s.APIBaseURL == "" {
+		return DefaultGitHubAPIBaseURL
+	}
+	return strings.TrimRight(s.APIBaseURL, "/")
+}
+
+// httpClient 获取HTTP客户端
+func (s *GitHubService) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// AuthURL 获取GitHub授权链接
+func (s *GitHubService) AuthURL(redirectURI, state string) string {
+	query := url.Values{
+		"client_id":    {s.ClientID},
+		"redirect_uri": {redirectURI},
+		"scope":        {"read:user user:email"},
+		"state":        {state},
+	}
+	return s.baseURL() + "/login/oauth/authorize?" + query.Encode()
+}
+
+// GetAccessToken 使用授权码换取访问令牌
+func (s *GitHubService) GetAccessToken(code, redirectURI string) (*GitHubTokenResponse, error) {
+	data := url.Values{
+		"client_id":     {s.ClientID},
+		"client_secret": {s.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.baseURL()+"/login/oauth/access_token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGitHubServerError, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tokenResp GitHubTokenResponse
+	if _, err := doJSON(s.httpClient(), req, &tokenResp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGitHubServerError, err)
+	}
+
+	// GitHub授权失败时仍返回200，需要检查error字段
+	if tokenResp.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrGitHubAuthFailed, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("%w: 响应中缺少access_token", ErrGitHubAuthFailed)
+	}
+
+	return &tokenResp, nil
+}
+
+// getAPI 请求GitHub API
+func (s *GitHubService) getAPI(accessToken, path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, s.apiBaseURL()+path, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrGitHubServerError, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	status, err := doJSON(s.httpClient(), req, out)
+	if status != 0 && status != http.StatusOK {
+		return fmt.Errorf("%w: 状态码 %d", ErrGitHubUserInfoFailed, status)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrGitHubServerError, err)
+	}
+	return nil
+}
+
+// GetUser 获取GitHub用户信息
+func (s *GitHubService) GetUser(accessToken string) (*GitHubUser, error) {
+	var user GitHubUser
+	if err := s.getAPI(accessToken, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: 缺少用户标识", ErrGitHubUserInfoFailed)
+	}
+	return &user, nil
+}
+
+// GetPrimaryEmail 获取已验证的主邮箱，用户隐藏公开邮箱时使用
+func (s *GitHubService) GetPrimaryEmail(accessToken string) (string, error) {
+	var emails []GitHubEmail
+	if err := s.getAPI(accessToken, "/user/emails", &emails); err != nil {
+		return "", err
+	}
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			return email.Email, nil
+		}
+	}
+	return "", nil
+}
+
+// ExchangeCode 使用授权码换取用户信息
+func (s *GitHubService) ExchangeCode(code, redirectURI string) (*OAuthLoginParams, error) {
+	if code == "" {
+		return nil, ErrOAuthCodeInvalid
+	}
+
+	tokenResp, err := s.GetAccessToken(code, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUser(tokenResp.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// 公开邮箱为空时查询主邮箱，失败不影响登录
+	email := user.Email
+	if email == "" {
+		email, _ = s.GetPrimaryEmail(tokenResp.AccessToken)
+	}
+
+	nickname := user.Name
+	if nickname == "" {
+		nickname = user.Login
+	}
+
+	// 构建OAuth登录参数，GitHub OAuth应用的访问令牌不会过期
+	params := &OAuthLoginParams{
+		Provider:       "github",
+		ProviderUserID: strconv.FormatInt(user.ID, 10), // 使用数字ID，用户名可修改
+		Nickname:       nickname,
+		Avatar:         user.AvatarURL,
+		Email:          email,
+		AccessToken:    tokenResp.AccessToken,
+	}
+
+	return params, nil
+}
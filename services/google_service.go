@@ -0,0 +1,228 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ios-api/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Google登录接口默认地址
+const (
+	DefaultGoogleAuthEndpoint  = "https://accounts.google.com/o/oauth2/v2/auth"
+	DefaultGoogleTokenEndpoint = "https://oauth2.googleapis.com/token"
+	DefaultGoogleJWKSEndpoint  = "https://www.googleapis.com/oauth2/v3/certs"
+)
+
+// googleIssuers Google ID令牌的合法发行者
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
+// GoogleService Google登录服务（OpenID Connect）
+type GoogleService struct {
+	ClientID      string
+	ClientSecret  string
+	AuthEndpoint  string       // 授权地址，默认 DefaultGoogleAuthEndpoint
+	TokenEndpoint string       // 令牌地址，默认 DefaultGoogleTokenEndpoint
+	JWKSEndpoint  string       // 公钥地址，默认 DefaultGoogleJWKSEndpoint
+	Client        *http.Client // HTTP客户端，为空时使用默认客户端
+
+	// Google公钥缓存，用于验证ID令牌
+	jwks jwksCache
+}
+
+// NewGoogleService 创建新的Google登录服务实例
+func NewGoogleService(cfg *config.Config) *GoogleService {
+	return &GoogleService{
+		ClientID:     cfg.GoogleClientID,
+		ClientSecret: cfg.GoogleClientSecret,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// GoogleTokenResponse Google令牌响应
+type GoogleTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	IdToken          string `json:"id_token"`
+	Scope            string `json:"scope"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// GoogleIdTokenClaims Google ID令牌声明
+type GoogleIdTokenClaims struct {
+	Sub           string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// 自定义错误
+var (
+	ErrGoogleAuthFailed     = errors.New("Google授权失败")
+	ErrGoogleIdTokenInvalid = errors.New("无效的Google ID令牌")
+	ErrGoogleServerError    = errors.New("Google服务器错误")
+)
+
+// Name 提供方名称
+func (s *GoogleService) Name() string {
+	return "google"
+}
+
+// endpoint 获取接口地址，未配置时使用默认值
+func (s *GoogleService) endpoint(configured, fallback string) string {
+	if configured == "" {
+		return fallback
+	}
+	return configured
+}
+
+// httpClient 获取HTTP客户端
+func (s *GoogleService) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// AuthURL 获取Google授权链接
+func (s *GoogleService) AuthURL(redirectURI, state string) string {
+	query := url.Values{
+		"client_id":     {s.ClientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {"openid email profile"},
+		"state":         {state},
+	}
+	return s.endpoint(s.AuthEndpoint, DefaultGoogleAuthEndpoint) + "?" + query.Encode()
+}
+
+// GetToken 使用授权码换取令牌
+func (s *GoogleService) GetToken(code, redirectURI string) (*GoogleTokenResponse, error) {
+	data := url.Values{
+		"client_id":     {s.ClientID},
+		"client_secret": {s.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"grant_type":    {"authorization_code"},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.endpoint(s.TokenEndpoint, DefaultGoogleTokenEndpoint), strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGoogleServerError, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tokenResp GoogleTokenResponse
+	if _, err := doJSON(s.httpClient(), req, &tokenResp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGoogleServerError, err)
+	}
+
+	// 检查错误
+	if tokenResp.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrGoogleAuthFailed, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IdToken == "" {
+		return nil, fmt.Errorf("%w: 响应中缺少id_token", ErrGoogleAuthFailed)
+	}
+
+	return &tokenResp, nil
+}
+
+// VerifyIdToken 使用Google公钥验证ID令牌签名、发行者、受众和有效期
+func (s *GoogleService) VerifyIdToken(idToken string) (*GoogleIdTokenClaims, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("不支持的签名算法: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return s.jwks.publicKey(s.httpClient(), s.endpoint(s.JWKSEndpoint, DefaultGoogleJWKSEndpoint), kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrGoogleIdTokenInvalid, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrGoogleIdTokenInvalid
+	}
+
+	issuerValid := false
+	for _, issuer := range googleIssuers {
+		if claims.VerifyIssuer(issuer, true) {
+			issuerValid = true
+			break
+		}
+	}
+	if !issuerValid {
+		return nil, fmt.Errorf("%w: 发行者无效", ErrGoogleIdTokenInvalid)
+	}
+	if !claims.VerifyAudience(s.ClientID, true) {
+		return nil, fmt.Errorf("%w: 受众无效", ErrGoogleIdTokenInvalid)
+	}
+
+	result := &GoogleIdTokenClaims{}
+	result.Sub, _ = claims["sub"].(string)
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.Picture, _ = claims["picture"].(string)
+	// email_verified 可能是布尔值或字符串
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	if result.Sub == "" {
+		return nil, fmt.Errorf("%w: 缺少用户标识", ErrGoogleIdTokenInvalid)
+	}
+
+	return result, nil
+}
+
+// ExchangeCode 使用授权码换取用户信息
+func (s *GoogleService) ExchangeCode(code, redirectURI string) (*OAuthLoginParams, error) {
+	if code == "" {
+		return nil, ErrOAuthCodeInvalid
+	}
+
+	tokenResp, err := s.GetToken(code, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.VerifyIdToken(tokenResp.IdToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// 构建OAuth登录参数
+	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	params := &OAuthLoginParams{
+		Provider:       "google",
+		ProviderUserID: claims.Sub,
+		Nickname:       claims.Name,
+		Avatar:         claims.Picture,
+		AccessToken:    tokenResp.AccessToken,
+		RefreshToken:   tokenResp.RefreshToken,
+		TokenExpiresAt: &expiresAt,
+	}
+	// 仅使用已验证的邮箱
+	if claims.EmailVerified {
+		params.Email = claims.Email
+	}
+
+	return params, nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"unicode/utf8"
+)
+
+// JSONSchema JSON Schema 的常用子集，用于校验 json 类型设置的值
+// 支持 type、enum、properties、required、additionalProperties、items、
+// minimum、maximum、minLength、maxLength、minItems、maxItems，不支持的关键字在解析时报错。
+type JSONSchema struct {
+	Schema      string      `json:"$schema,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+
+	Type                 string                 `json:"type,omitempty"` // object、array、string、number、integer、boolean、null
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+}
+
+// jsonSchemaTypes 支持的类型
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// ParseJSONSchema 解析JSON Schema
+func ParseJSONSchema(data []byte) (*JSONSchema, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var schema JSONSchema
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, err
+	}
+	if err := schema.check("$"); err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// check 检查Schema定义本身是否有效
+func (s *JSONSchema) check(path string) error {
+	if s.Type != "" && !jsonSchemaTypes[s.Type] {
+		return fmt.Errorf("%s: 不支持的类型 %s", path, s.Type)
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		return fmt.Errorf("%s: minimum 不能大于 maximum", path)
+	}
+	for name, property := range s.Properties {
+		if property == nil {
+			return fmt.Errorf("%s.%s: 属性定义不能为空", path, name)
+		}
+		if err := property.check(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.check(path + "[]")
+	}
+	return nil
+}
+
+// ValidateJSON 校验JSON文本是否符合Schema
+func (s *JSONSchema) ValidateJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("不是有效的JSON: %v", err)
+	}
+	return s.Validate(value)
+}
+
+// Validate 校验 encoding/json 解码得到的值是否符合Schema
+func (s *JSONSchema) Validate(value interface{}) error {
+	return s.validate("$", value)
+}
+
+// validate 按路径递归校验，错误信息包含出错位置
+func (s *JSONSchema) validate(path string, value interface{}) error {
+	if s.Type != "" && !matchJSONType(s.Type, value) {
+		return fmt.Errorf("%s: 类型应为 %s", path, s.Type)
+	}
+
+	if len(s.Enum) > 0 {
+		matched := false
+		for _, candidate := range s.Enum {
+			if reflect.DeepEqual(candidate, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s: 不在可选值范围内", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			return fmt.Errorf("%s: 不能小于 %v", path, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			return fmt.Errorf("%s: 不能大于 %v", path, *s.Maximum)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			return fmt.Errorf("%s: 长度不能小于 %d", path, *s.MinLength)
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return fmt.Errorf("%s: 长度不能大于 %d", path, *s.MaxLength)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fmt.Errorf("%s: 元素数量不能小于 %d", path, *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fmt.Errorf("%s: 元素数量不能大于 %d", path, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: 缺少必填字段 %s", path, name)
+			}
+		}
+		// 按字段名排序，保证错误信息稳定
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: 不允许的字段 %s", path, name)
+				}
+				continue
+			}
+			if err := property.validate(path+"."+name, v[name]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchJSONType 判断值是否为指定的JSON类型
+func matchJSONType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksRefreshInterval 公钥缓存未命中时两次拉取的最小间隔
+const jwksRefreshInterval = time.Minute
+
+// ErrPublicKeyNotFound 未找到签名公钥
+var ErrPublicKeyNotFound = errors.New("未找到签名公钥")
+
+// JSONWebKey 公钥（JWK格式），RSA公钥使用N/E，EC公钥使用Crv/X/Y
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet 公钥集合（JWKS）
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// jwksCache 第三方JWKS公钥缓存，用于验证苹果、Google等签发的JWT
+type jwksCache struct {
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// publicKey 获取指定kid的公钥，缓存未命中时重新拉取（应对密钥轮换）
+func (c *jwksCache) publicKey(client *http.Client, jwksURL, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+
+	// 限制拉取频率，避免伪造的kid导致频繁请求第三方
+	if c.keys != nil && time.Since(c.fetchedAt) < jwksRefreshInterval {
+		return nil, ErrPublicKeyNotFound
+	}
+
+	keys, err := fetchJWKS(client, jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	c.keys = keys
+	c.fetchedAt = time.Now()
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrPublicKeyNotFound
+}
+
+// fetchJWKS 拉取并解析JWKS中的RSA公钥
+func fetchJWKS(client *http.Client, jwksURL string) (map[string]*rsa.PublicKey, error) {
+	resp, err := client.Get(jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("获取公钥失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("获取公钥失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("获取公钥失败，状态码 %d", resp.StatusCode)
+	}
+
+	var keySet JSONWebKeySet
+	if err := json.Unmarshal(body, &keySet); err != nil {
+		return nil, fmt.Errorf("解析公钥失败: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(keySet.Keys))
+	for _, key := range keySet.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			continue
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
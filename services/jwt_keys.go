@@ -0,0 +1,224 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"ios-api/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// 自定义错误
+var (
+	ErrJWTKeyInvalid         = errors.New("JWT密钥无效")
+	ErrJWTSigningKeyNotFound = errors.New("未找到JWT签名密钥")
+)
+
+// jwtMinRSABits RSA密钥的最小长度
+const jwtMinRSABits = 2048
+
+// JWTKey 一个JWT密钥，只有公钥的密钥仅用于验证（已轮换下线的旧密钥）
+type JWTKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey interface{} // *rsa.PrivateKey 或 *ecdsa.PrivateKey，可为空
+	PublicKey  interface{} // *rsa.PublicKey 或 *ecdsa.PublicKey
+}
+
+// JWTKeySet 签发和验证用户令牌的密钥集合
+// 使用非对称密钥时，令牌头部带有kid，验证时按kid选择公钥；
+// 轮换时新增密钥并切换签名kid，旧密钥保留到其签发的令牌全部过期即可，不会导致用户被登出。
+type JWTKeySet struct {
+	signing      *JWTKey
+	keys         map[string]*JWTKey
+	legacySecret []byte // HS256密钥：未配置非对称密钥时用于签发，迁移期间用于验证不带kid的旧令牌
+}
+
+// NewHS256KeySet 创建仅使用HS256共享密钥的密钥集合（未配置非对称密钥时使用）
+func NewHS256KeySet(secret string) *JWTKeySet {
+	return &JWTKeySet{
+		keys:         make(map[string]*JWTKey),
+		legacySecret: []byte(secret),
+	}
+}
+
+// NewJWTKeySet 使用已解析的密钥创建密钥集合，signingKeyID为签发令牌使用的kid
+// legacySecret 不为空时继续接受不带kid的HS256令牌
+func NewJWTKeySet(keys []*JWTKey, signingKeyID, legacySecret string) (*JWTKeySet, error) {
+	set := &JWTKeySet{keys: make(map[string]*JWTKey, len(keys))}
+	for _, key := range keys {
+		set.keys[key.ID] = key
+	}
+
+	signing, ok := set.keys[signingKeyID]
+	if !ok || signing.PrivateKey == nil {
+		return nil, fmt.Errorf("%w: %s", ErrJWTSigningKeyNotFound, signingKeyID)
+	}
+	set.signing = signing
+
+	if legacySecret != "" {
+		set.legacySecret = []byte(legacySecret)
+	}
+	return set, nil
+}
+
+// LoadJWTKeySet 根据配置加载密钥集合
+// 未配置 JWT_SIGNING_KEY_ID 时使用 JWT_SECRET 进行HS256签名；
+// 否则从 JWT_KEYS_DIR 加载所有 <kid>.pem 密钥，并使用指定kid的私钥签名。
+func LoadJWTKeySet(cfg *config.Config) (*JWTKeySet, error) {
+	if cfg.JWTSigningKeyID == "" {
+		return NewHS256KeySet(cfg.JWTSecret), nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.JWTKeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*JWTKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseJWTKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	legacySecret := ""
+	if cfg.JWTAcceptLegacyHS256 {
+		legacySecret = cfg.JWTSecret
+	}
+	return NewJWTKeySet(keys, cfg.JWTSigningKeyID, legacySecret)
+}
+
+// ParseJWTKey 解析PEM格式的私钥或公钥，RSA密钥使用RS256，P-256密钥使用ES256
+func ParseJWTKey(kid string, data []byte) (*JWTKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: 不是PEM格式", ErrJWTKeyInvalid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: 不支持的PEM类型 %s", ErrJWTKeyInvalid, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrJWTKeyInvalid, err)
+	}
+
+	key := &JWTKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.PrivateKey, key.PublicKey = k, &k.PublicKey
+	case *ecdsa.PrivateKey:
+		key.PrivateKey, key.PublicKey = k, &k.PublicKey
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		key.PublicKey = k
+	default:
+		return nil, fmt.Errorf("%w: 仅支持RSA和ECDSA密钥", ErrJWTKeyInvalid)
+	}
+
+	switch pub := key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < jwtMinRSABits {
+			return nil, fmt.Errorf("%w: RSA密钥长度不能少于%d位", ErrJWTKeyInvalid, jwtMinRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w: ECDSA密钥仅支持P-256曲线", ErrJWTKeyInvalid)
+		}
+		key.Method = jwt.SigningMethodES256
+	}
+	return key, nil
+}
+
+// Sign 签发令牌，使用非对称密钥时在头部写入kid
+func (s *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.legacySecret)
+	}
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+	return token.SignedString(s.signing.PrivateKey)
+}
+
+// Keyfunc 供jwt解析时选择验证密钥：按kid查找公钥并要求算法与密钥一致
+func (s *JWTKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		// 不带kid的令牌只能是HS256签名
+		if s.legacySecret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidToken
+		}
+		return s.legacySecret, nil
+	}
+
+	key, ok := s.keys[kid]
+	if !ok || token.Method.Alg() != key.Method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.PublicKey, nil
+}
+
+// SigningKeyID 当前签名密钥的kid，使用HS256时为空
+func (s *JWTKeySet) SigningKeyID() string {
+	if s.signing == nil {
+		return ""
+	}
+	return s.signing.ID
+}
+
+// JWKS 返回所有非对称密钥的公钥（不包含HS256共享密钥），按kid排序
+func (s *JWTKeySet) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(s.keys))}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// JWK 将公钥转换为JWK格式
+func (k *JWTKey) JWK() JSONWebKey {
+	key := JSONWebKey{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+	switch pub := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		key.Kty = "EC"
+		key.Crv = pub.Curve.Params().Name
+		key.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		key.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	}
+	return key
+}
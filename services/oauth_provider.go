@@ -0,0 +1,145 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"ios-api/config"
+)
+
+// 自定义错误
+var (
+	ErrOAuthCodeInvalid         = errors.New("无效的授权码")
+	ErrOAuthProviderNotFound    = errors.New("不支持的登录方式")
+	ErrOAuthAuthURLNotSupported = errors.New("该登录方式不支持网页授权")
+)
+
+// OAuthProvider 第三方登录提供方
+type OAuthProvider interface {
+	// Name 提供方名称，与 oauth_accounts.provider 一致
+	Name() string
+	// AuthURL 获取授权链接，不支持网页授权时返回空字符串
+	AuthURL(redirectURI, state string) string
+	// ExchangeCode 使用授权码换取用户信息，redirectURI 为发起授权时使用的重定向地址
+	ExchangeCode(code, redirectURI string) (*OAuthLoginParams, error)
+}
+
+// 确保各提供方实现了 OAuthProvider 接口
+var (
+	_ OAuthProvider = (*WechatService)(nil)
+	_ OAuthProvider = (*AppleService)(nil)
+	_ OAuthProvider = (*GoogleService)(nil)
+	_ OAuthProvider = (*GitHubService)(nil)
+	_ OAuthProvider = (*WeiboService)(nil)
+)
+
+// OAuthRegistry 第三方登录提供方注册表
+type OAuthRegistry struct {
+	providers map[string]OAuthProvider
+}
+
+// NewOAuthRegistry 创建空的提供方注册表
+func NewOAuthRegistry(providers ...OAuthProvider) *OAuthRegistry {
+	registry := &OAuthRegistry{providers: make(map[string]OAuthProvider)}
+	for _, provider := range providers {
+		registry.Register(provider)
+	}
+	return registry
+}
+
+// NewOAuthRegistryFromConfig 根据配置创建提供方注册表
+// 微信和苹果始终注册，其他提供方仅在配置了凭证时注册
+func NewOAuthRegistryFromConfig(cfg *config.Config, wechat *WechatService, apple *AppleService) *OAuthRegistry {
+	registry := NewOAuthRegistry()
+
+	if wechat != nil {
+		registry.Register(wechat)
+	}
+	if apple != nil {
+		registry.Register(apple)
+	}
+	if cfg.GoogleClientID != "" {
+		registry.Register(NewGoogleService(cfg))
+	}
+	if cfg.GitHubClientID != "" {
+		registry.Register(NewGitHubService(cfg))
+	}
+	if cfg.WeiboAppKey != "" {
+		registry.Register(NewWeiboService(cfg))
+	}
+
+	return registry
+}
+
+// Register 注册提供方，同名提供方会被覆盖
+func (r *OAuthRegistry) Register(provider OAuthProvider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Get 获取指定名称的提供方
+func (r *OAuthRegistry) Get(name string) (OAuthProvider, error) {
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, ErrOAuthProviderNotFound
+	}
+	return provider, nil
+}
+
+// Has 检查是否注册了指定名称的提供方
+func (r *OAuthRegistry) Has(name string) bool {
+	_, ok := r.providers[name]
+	return ok
+}
+
+// Names 获取已注册的提供方名称（按字母排序）
+func (r *OAuthRegistry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsOAuthCredentialError 判断错误是否由客户端提交的第三方凭证无效引起（而非第三方服务异常）
+func IsOAuthCredentialError(err error) bool {
+	for _, target := range []error{
+		ErrOAuthCodeInvalid,
+		ErrWechatCodeInvalid, ErrWechatAuthFailed,
+		ErrAppleCodeInvalid, ErrAppleTokenInvalid, ErrAppleAuthFailed,
+		ErrGoogleAuthFailed, ErrGoogleIdTokenInvalid,
+		ErrGitHubAuthFailed,
+		ErrWeiboAuthFailed,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// doJSON 发送请求并解析JSON响应，返回HTTP状态码
+func doJSON(client *http.Client, req *http.Request, out interface{}) (int, error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth state默认参数
+const (
+	DefaultOAuthStateTTL   = 10 * time.Minute // state默认有效期
+	MaxOAuthConsumedStates = 100000           // 最多记录的已使用nonce数量
+)
+
+// OAuthNonceCookie 绑定授权流程和浏览器的nonce Cookie名称
+const OAuthNonceCookie = "oauth_nonce"
+
+// 自定义错误
+var (
+	ErrOAuthStateInvalid     = errors.New("无效的授权state")
+	ErrOAuthStateExpired     = errors.New("授权state已过期")
+	ErrRedirectURINotAllowed = errors.New("重定向地址不在允许列表中")
+)
+
+// consumedState 已使用的nonce，按过期时间顺序记录
+type consumedState struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// OAuthStateService OAuth state管理服务
+// state自包含：nonce、过期时间、重定向地址摘要和HMAC签名（覆盖nonce、提供方、重定向地址和过期时间），
+// 服务端不保存未使用的state，多实例部署时回调可以落在任意实例。
+// nonce同时写入HttpOnly Cookie，回调时校验Cookie与state一致，防止攻击者用自己的state让受害者登录（登录CSRF）。
+// 已使用的nonce记录到过期为止，保证一次性使用；记录只在本实例内生效。
+// 记录数量有上限，已满时淘汰最早使用的nonce而不是拒绝回调，避免攻击者填满记录后阻断所有人登录；
+// 被淘汰的nonce仍需对应浏览器Cookie才能重放，授权入口另按IP限流（见 middlewares.RateLimitByIP）。
+type OAuthStateService struct {
+	Secret              []byte        // HMAC签名密钥
+	TTL                 time.Duration // state有效期
+	AllowedRedirectURIs []string      // 允许的重定向地址（精确匹配）
+	MaxConsumed         int           // 最多记录的已使用nonce数量，已满时淘汰最早的记录
+
+	mu       sync.Mutex
+	consumed map[string]*list.Element // 已使用的nonce
+	order    *list.List               // 已使用的nonce，按过期时间排序（TTL固定，即签发顺序）
+	now      func() time.Time
+}
+
+// NewOAuthStateService 创建新的OAuth state管理服务
+func NewOAuthStateService(secret string, allowedRedirectURIs []string) *OAuthStateService {
+	return &OAuthStateService{
+		Secret:              []byte(secret),
+		TTL:                 DefaultOAuthStateTTL,
+		AllowedRedirectURIs: allowedRedirectURIs,
+		MaxConsumed:         MaxOAuthConsumedStates,
+		consumed:            make(map[string]*list.Element),
+		order:               list.New(),
+		now:                 time.Now,
+	}
+}
+
+// IsRedirectURIAllowed 检查重定向地址是否在允许列表中
+func (s *OAuthStateService) IsRedirectURIAllowed(redirectURI string) bool {
+	for _, allowed := range s.AllowedRedirectURIs {
+		if redirectURI == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Generate 为指定提供方和重定向地址生成一次性state，返回state和需要写入Cookie的nonce
+// state格式为 nonce.过期时间.重定向地址摘要.签名，长度不超过128字节（微信的限制）。
+func (s *OAuthStateService) Generate(provider, redirectURI string) (state string, nonce string, err error) {
+	if !s.IsRedirectURIAllowed(redirectURI) {
+		return "", "", ErrRedirectURINotAllowed
+	}
+
+	// 生成随机nonce
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	nonce = base64.RawURLEncoding.EncodeToString(buf)
+	expires := strconv.FormatInt(s.clock().Add(s.TTL).Unix(), 10)
+
+	state = strings.Join([]string{nonce, expires, redirectDigest(redirectURI), s.sign(nonce, provider, redirectURI, expires)}, ".")
+	return state, nonce, nil
+}
+
+// Consume 校验并消费state，返回其绑定的重定向地址
+// cookieNonce 为回调请求中 OAuthNonceCookie 的值，必须与state中的nonce一致。
+// state只能用于签发时的提供方，防止将一个提供方的回调转交给另一个提供方。
+func (s *OAuthStateService) Consume(provider, state, cookieNonce string) (string, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 4 {
+		return "", ErrOAuthStateInvalid
+	}
+	nonce, expires, digest, signature := parts[0], parts[1], parts[2], parts[3]
+
+	// 按摘要找到重定向地址；允许列表可能在state签发后发生变化
+	redirectURI := ""
+	for _, allowed := range s.AllowedRedirectURIs {
+		if hmac.Equal([]byte(redirectDigest(allowed)), []byte(digest)) {
+			redirectURI = allowed
+			break
+		}
+	}
+	if redirectURI == "" {
+		return "", ErrRedirectURINotAllowed
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(nonce, provider, redirectURI, expires))) {
+		return "", ErrOAuthStateInvalid
+	}
+	if cookieNonce == "" || !hmac.Equal([]byte(cookieNonce), []byte(nonce)) {
+		return "", ErrOAuthStateInvalid
+	}
+	expiresUnix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", ErrOAuthStateInvalid
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.After(expiresAt) {
+		return "", ErrOAuthStateExpired
+	}
+	s.pruneLocked(now)
+	if _, ok := s.consumed[nonce]; ok {
+		// 已被使用
+		return "", ErrOAuthStateInvalid
+	}
+	for s.order.Len() >= s.MaxConsumed {
+		s.removeLocked(s.order.Front())
+	}
+	s.consumed[nonce] = s.insertLocked(consumedState{nonce: nonce, expiresAt: expiresAt})
+
+	return redirectURI, nil
+}
+
+// SetClock 设置时钟函数（用于测试）
+func (s *OAuthStateService) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// clock 返回当前时间
+func (s *OAuthStateService) clock() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now()
+}
+
+// sign 计算state的HMAC签名
+func (s *OAuthStateService) sign(nonce, provider, redirectURI, expires string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(strings.Join([]string{nonce, provider, redirectURI, expires}, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// pruneLocked 删除已过期的nonce记录（调用方需持有锁），过期后的state本身已无法通过校验
+func (s *OAuthStateService) pruneLocked(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		entry := elem.Value.(consumedState)
+		if !now.After(entry.expiresAt) {
+			return
+		}
+		s.removeLocked(elem)
+	}
+}
+
+// insertLocked 按过期时间插入nonce记录（调用方需持有锁），回调顺序与签发顺序不同时从队尾向前查找位置
+func (s *OAuthStateService) insertLocked(entry consumedState) *list.Element {
+	for elem := s.order.Back(); elem != nil; elem = elem.Prev() {
+		if !elem.Value.(consumedState).expiresAt.After(entry.expiresAt) {
+			return s.order.InsertAfter(entry, elem)
+		}
+	}
+	return s.order.PushFront(entry)
+}
+
+// removeLocked 删除一条nonce记录（调用方需持有锁）
+func (s *OAuthStateService) removeLocked(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.consumed, elem.Value.(consumedState).nonce)
+}
+
+// redirectDigest 重定向地址的摘要，用于在回调时从允许列表中找到签发时的地址
+func redirectDigest(redirectURI string) string {
+	sum := sha256.Sum256([]byte(redirectURI))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimiterEntries 限流器最多记录的key数量
+const DefaultRateLimiterEntries = 100000
+
+// rateWindow 一个key在当前时间窗口内的请求次数
+type rateWindow struct {
+	key       string
+	count     int
+	expiresAt time.Time
+}
+
+// RateLimiter 按key（如客户端IP）的固定窗口限流器
+// 记录按窗口结束时间排序，过期的记录从队首清理；记录数量达到上限时淘汰最早的窗口，
+// 被淘汰的key重新计数，不会因为记录已满而拒绝其他key的请求。
+// 计数只在本实例内生效。
+type RateLimiter struct {
+	Limit      int           // 每个窗口内最多请求次数
+	Window     time.Duration // 窗口长度
+	MaxEntries int           // 最多记录的key数量
+
+	mu      sync.Mutex
+	windows map[string]*list.Element
+	order   *list.List // 按窗口结束时间排序（窗口长度固定，即开始顺序）
+	now     func() time.Time
+}
+
+// NewRateLimiter 创建新的限流器，limit 小于等于0时返回nil，表示不限流
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		Limit:      limit,
+		Window:     window,
+		MaxEntries: DefaultRateLimiterEntries,
+		windows:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Allow 记录一次请求，超过当前窗口的次数上限时返回false
+func (l *RateLimiter) Allow(key string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.pruneLocked(now)
+	if elem, ok := l.windows[key]; ok {
+		window := elem.Value.(*rateWindow)
+		if window.count >= l.Limit {
+			return false
+		}
+		window.count++
+		return true
+	}
+
+	for l.order.Len() >= l.MaxEntries {
+		l.removeLocked(l.order.Front())
+	}
+	l.windows[key] = l.order.PushBack(&rateWindow{key: key, count: 1, expiresAt: now.Add(l.Window)})
+	return true
+}
+
+// SetClock 设置时钟函数（用于测试）
+func (l *RateLimiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+// pruneLocked 删除已结束的窗口（调用方需持有锁）
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	for elem := l.order.Front(); elem != nil; elem = l.order.Front() {
+		if now.Before(elem.Value.(*rateWindow).expiresAt) {
+			return
+		}
+		l.removeLocked(elem)
+	}
+}
+
+// removeLocked 删除一条窗口记录（调用方需持有锁）
+func (l *RateLimiter) removeLocked(elem *list.Element) {
+	l.order.Remove(elem)
+	delete(l.windows, elem.Value.(*rateWindow).key)
+}
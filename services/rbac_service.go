@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"ios-api/models"
+
+	"gorm.io/gorm"
+)
+
+// 角色
+const (
+	RoleAdmin    = "admin"    // 管理员，拥有全部权限
+	RoleOperator = "operator" // 运营，管理设置和查看用户
+)
+
+// 权限，格式为 资源:操作，授予时可用 资源:* 或 * 表示通配
+// 修改设置支持按key授权：settings:write:<key>，如 settings:write:app.* 只能修改 app. 开头的设置
+const (
+	PermSettingsWrite  = "settings:write"  // 修改设置（全部key）
+	PermSettingsCache  = "settings:cache"  // 管理设置缓存
+	PermSettingsSchema = "settings:schema" // 管理设置定义
+	PermUsersRead      = "users:read"      // 查看用户
+	PermUsersWrite     = "users:write"     // 管理用户
+	PermRolesManage    = "roles:manage"    // 分配角色
+	PermAuditRead      = "audit:read"      // 查看审计日志
+)
+
+// 自定义错误
+var (
+	ErrRoleNotFound        = errors.New("角色不存在")
+	ErrRoleAlreadyAssigned = errors.New("用户已拥有该角色")
+	ErrRoleNotAssigned     = errors.New("用户没有该角色")
+	ErrRoleInvalid         = errors.New("角色定义格式错误")
+)
+
+// Role 角色定义
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// DefaultRoles 内置角色
+var DefaultRoles = []Role{
+	{
+		Name:        RoleAdmin,
+		Description: "管理员",
+		Permissions: []string{"*"},
+	},
+	{
+		Name:        RoleOperator,
+		Description: "运营",
+		Permissions: []string{PermSettingsWrite, PermSettingsCache, PermUsersRead},
+	},
+}
+
+// RBACService 基于角色的权限服务
+type RBACService struct {
+	DB    *gorm.DB
+	roles map[string]Role
+}
+
+// NewRBACService 创建权限服务
+func NewRBACService(db *gorm.DB) *RBACService {
+	roles := make(map[string]Role, len(DefaultRoles))
+	for _, role := range DefaultRoles {
+		roles[role.Name] = role
+	}
+	return &RBACService{DB: db, roles: roles}
+}
+
+// AddRoles 增加自定义角色，不能覆盖已有角色
+func (s *RBACService) AddRoles(roles ...Role) error {
+	for _, role := range roles {
+		if _, ok := s.roles[role.Name]; ok {
+			return fmt.Errorf("%w: 角色 %s 已存在", ErrRoleInvalid, role.Name)
+		}
+		s.roles[role.Name] = role
+	}
+	return nil
+}
+
+// ParseRoles 解析自定义角色定义
+// 格式为 角色=权限,权限;角色=权限，如 app_editor=settings:write:app.*;auditor=audit:read,users:read
+func ParseRoles(spec string) ([]Role, error) {
+	var roles []Role
+	for _, item := range strings.Split(spec, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		name, permissionList, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: %s", ErrRoleInvalid, item)
+		}
+
+		role := Role{Name: name, Description: name}
+		for _, permission := range strings.Split(permissionList, ",") {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				role.Permissions = append(role.Permissions, permission)
+			}
+		}
+		if len(role.Permissions) == 0 {
+			return nil, fmt.Errorf("%w: 角色 %s 没有权限", ErrRoleInvalid, name)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// Roles 返回所有角色，按名称排序
+func (s *RBACService) Roles() []Role {
+	roles := make([]Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles
+}
+
+// GetUserRoles 获取用户的角色
+func (s *RBACService) GetUserRoles(userID uint) ([]string, error) {
+	roles := []string{}
+	if err := s.DB.Model(&models.UserRole{}).Where("user_id = ?", userID).
+		Order("role").Pluck("role", &roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// AssignRole 为用户分配角色
+func (s *RBACService) AssignRole(userID uint, role string) error {
+	if _, ok := s.roles[role]; !ok {
+		return ErrRoleNotFound
+	}
+
+	var user models.User
+	if err := s.DB.Select("id").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	var count int64
+	if err := s.DB.Model(&models.UserRole{}).Where("user_id = ? AND role = ?", userID, role).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleAlreadyAssigned
+	}
+	return s.DB.Create(&models.UserRole{UserID: userID, Role: role}).Error
+}
+
+// RemoveRole 移除用户的角色
+func (s *RBACService) RemoveRole(userID uint, role string) error {
+	result := s.DB.Where("user_id = ? AND role = ?", userID, role).Delete(&models.UserRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRoleNotAssigned
+	}
+	return nil
+}
+
+// RolePermissions 返回角色拥有的权限，未知角色没有权限
+func (s *RBACService) RolePermissions(roles []string) []string {
+	var permissions []string
+	for _, name := range roles {
+		if role, ok := s.roles[name]; ok {
+			permissions = append(permissions, role.Permissions...)
+		}
+	}
+	return permissions
+}
+
+// HasAnyRole 用户是否拥有任一指定角色
+func (s *RBACService) HasAnyRole(userID uint, roles ...string) (bool, error) {
+	userRoles, err := s.GetUserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, userRole := range userRoles {
+		for _, role := range roles {
+			if userRole == role {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// HasPermissions 用户是否拥有全部指定权限
+func (s *RBACService) HasPermissions(userID uint, permissions ...string) (bool, error) {
+	userRoles, err := s.GetUserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	granted := s.RolePermissions(userRoles)
+	for _, permission := range permissions {
+		if !PermissionGranted(granted, permission) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// HasScopedPermission 用户是否拥有权限本身或其限定范围的权限
+// 例如 permission 为 settings:write、scope 为 app.theme 时，settings:write 和 settings:write:app.theme 均可。
+func (s *RBACService) HasScopedPermission(userID uint, permission, scope string) (bool, error) {
+	userRoles, err := s.GetUserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	granted := s.RolePermissions(userRoles)
+	return PermissionGranted(granted, permission) || PermissionGranted(granted, permission+":"+scope), nil
+}
+
+// PermissionGranted 已授予的权限中是否包含required
+func PermissionGranted(granted []string, required string) bool {
+	for _, permission := range granted {
+		if MatchPermission(permission, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPermission 判断授予的权限是否覆盖所需权限
+// "*" 匹配全部权限，以 * 结尾时按前缀匹配，如 "settings:*" 匹配 "settings:" 开头的全部权限，
+// "settings:write:app.*" 匹配 "settings:write:app." 开头的全部权限
+func MatchPermission(granted, required string) bool {
+	if granted == "*" || granted == required {
+		return true
+	}
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(required, strings.TrimSuffix(granted, "*"))
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"ios-api/models"
+	"ios-api/remoteconfig"
+)
+
+// RemoteConfigPrefix 远程配置在设置中的命名空间，config.<name> 的值为配置定义（JSON）
+const RemoteConfigPrefix = "config."
+
+// IsPrivateSettingKey 是否为不能通过公开接口读取的设置
+// 远程配置定义包含定向规则（用户ID白名单、放量比例和盐值），只能由 GET /config 求值后返回，管理员通过管理接口读取原始定义。
+func IsPrivateSettingKey(key string) bool {
+	return strings.HasPrefix(key, RemoteConfigPrefix)
+}
+
+// PublicSettings 去掉不能公开读取的设置，返回剩余的设置和被去掉的key
+func PublicSettings(settings []models.Setting) ([]models.Setting, []string) {
+	public := make([]models.Setting, 0, len(settings))
+	hidden := []string{}
+	for _, setting := range settings {
+		if IsPrivateSettingKey(setting.Key) {
+			hidden = append(hidden, setting.Key)
+		} else {
+			public = append(public, setting)
+		}
+	}
+	return public, hidden
+}
+
+// ResolveConfig 按客户端信息求出全部远程配置的值，返回 配置名 -> 值
+// 配置定义通过命名空间读取（支持缓存），格式错误的定义跳过并记录日志。
+func (s *SettingService) ResolveConfig(ctx remoteconfig.Context) (map[string]json.RawMessage, error) {
+	_, settings, err := s.ListSettingsByPrefix(RemoteConfigPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]json.RawMessage, len(settings))
+	for _, setting := range settings {
+		name := strings.TrimPrefix(setting.Key, RemoteConfigPrefix)
+		definition, err := remoteconfig.Parse([]byte(setting.Value))
+		if err != nil {
+			log.Printf("远程配置定义无效，已跳过: key=%s err=%v", setting.Key, err)
+			continue
+		}
+		values[name] = definition.Evaluate(name, ctx).Value
+	}
+	return values, nil
+}
+
+// validateRemoteConfig 远程配置命名空间下的值必须是有效的配置定义
+func validateRemoteConfig(key, value string) error {
+	if !strings.HasPrefix(key, RemoteConfigPrefix) {
+		return nil
+	}
+	if _, err := remoteconfig.Parse([]byte(value)); err != nil {
+		return fmt.Errorf("%w: %v", ErrSettingValueInvalid, err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 签名请求头
+const (
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignatureHeader          = "X-Signature"
+)
+
+// DefaultSignatureMaxSkew 签名时间戳允许的最大偏差
+const DefaultSignatureMaxSkew = 5 * time.Minute
+
+// 自定义错误
+var (
+	ErrSignerNotConfigured = errors.New("未配置请求签名密钥")
+	ErrSignatureMissing    = errors.New("缺少请求签名")
+	ErrSignatureInvalid    = errors.New("请求签名无效")
+	ErrSignatureExpired    = errors.New("请求签名已过期")
+	ErrSignatureReplayed   = errors.New("请求签名已被使用")
+)
+
+// usedNonce 已使用的nonce，按过期时间顺序记录
+type usedNonce struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// RequestSigner 服务端之间调用的HMAC请求签名校验
+// 签名内容为 方法\n请求URI（路径和查询字符串，与请求行一致）\n时间戳\nnonce\n请求体，使用HMAC-SHA256并以十六进制编码。
+// 时间戳为Unix秒，超过 MaxSkew 的请求被拒绝；nonce在有效期内只能使用一次，防止重放。
+// 已使用的nonce只保存在进程内存中，不在实例间共享，多实例部署时签名接口需固定转发到同一实例。
+type RequestSigner struct {
+	Secret  []byte
+	MaxSkew time.Duration
+
+	mu     sync.Mutex
+	nonces map[string]*list.Element // 已使用的nonce
+	order  *list.List               // 已使用的nonce，按过期时间排序
+	now    func() time.Time
+}
+
+// NewRequestSigner 创建新的请求签名校验器
+func NewRequestSigner(secret string) *RequestSigner {
+	return &RequestSigner{
+		Secret:  []byte(secret),
+		MaxSkew: DefaultSignatureMaxSkew,
+		nonces:  make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Enabled 是否配置了签名密钥
+func (s *RequestSigner) Enabled() bool {
+	return s != nil && len(s.Secret) > 0
+}
+
+// Sign 计算请求签名，uri 为包含查询字符串的请求URI，如 /api/v1/settings/app.theme?env=prod
+func (s *RequestSigner) Sign(method, uri, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验请求签名、时间戳和nonce
+func (s *RequestSigner) Verify(method, uri, timestamp, nonce, signature string, body []byte) error {
+	if !s.Enabled() {
+		return ErrSignerNotConfigured
+	}
+	if timestamp == "" || nonce == "" || signature == "" {
+		return ErrSignatureMissing
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.Sign(method, uri, timestamp, nonce, body))) {
+		return ErrSignatureInvalid
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-s.MaxSkew)) || signedAt.After(now.Add(s.MaxSkew)) {
+		return ErrSignatureExpired
+	}
+
+	s.pruneLocked(now)
+	if _, ok := s.nonces[nonce]; ok {
+		return ErrSignatureReplayed
+	}
+	s.nonces[nonce] = s.insertLocked(usedNonce{nonce: nonce, expiresAt: signedAt.Add(s.MaxSkew)})
+
+	return nil
+}
+
+// VerifyRequest 校验HTTP请求的签名，读取请求体后会重新放回供后续解析
+func (s *RequestSigner) VerifyRequest(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return s.Verify(
+		req.Method,
+		req.URL.RequestURI(),
+		req.Header.Get(SignatureTimestampHeader),
+		req.Header.Get(SignatureNonceHeader),
+		req.Header.Get(SignatureHeader),
+		body,
+	)
+}
+
+// SetClock 设置时钟函数（用于测试）
+func (s *RequestSigner) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// pruneLocked 从队首删除已超出时间窗口的nonce（调用方需持有锁），窗口外的请求会因时间戳被拒绝
+func (s *RequestSigner) pruneLocked(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		entry := elem.Value.(usedNonce)
+		if !now.After(entry.expiresAt) {
+			return
+		}
+		s.order.Remove(elem)
+		delete(s.nonces, entry.nonce)
+	}
+}
+
+// insertLocked 按过期时间插入nonce记录（调用方需持有锁）
+// 过期时间由请求的时间戳决定，通常接近当前时间，从队尾向前查找位置。
+func (s *RequestSigner) insertLocked(entry usedNonce) *list.Element {
+	for elem := s.order.Back(); elem != nil; elem = elem.Prev() {
+		if !elem.Value.(usedNonce).expiresAt.After(entry.expiresAt) {
+			return s.order.InsertAfter(entry, elem)
+		}
+	}
+	return s.order.PushFront(entry)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// 会话缓存默认参数
+const (
+	DefaultSessionCacheTTL  = 30 * time.Second
+	DefaultSessionCacheSize = 10000
+)
+
+// SessionCache 会话有效性的本地LRU缓存，避免每个认证请求都查询数据库
+// 同时缓存已撤销（不存在）的会话，重复使用已退出的令牌也不会访问数据库。
+// 本实例上的退出登录和撤销会立即生效；多实例部署时，其他实例最多在TTL后生效。
+type SessionCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	size       int
+	ll         *list.List
+	items      map[string]*list.Element
+	generation uint64 // 每次失效递增，查询数据库期间发生失效的结果不写入缓存
+	now        func() time.Time
+}
+
+// sessionCacheEntry 会话缓存条目
+type sessionCacheEntry struct {
+	key       string
+	userID    uint
+	valid     bool
+	expiresAt time.Time
+}
+
+// NewSessionCache 创建会话缓存，size或ttl不大于0时返回nil（不缓存）
+// nil缓存的所有方法均可安全调用。
+func NewSessionCache(size int, ttl time.Duration) *SessionCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &SessionCache{
+		ttl:   ttl,
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// SetClock 设置时钟函数（用于测试）
+func (c *SessionCache) SetClock(now func() time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// Generation 返回当前失效计数，查询数据库前获取，写入缓存时传回
+func (c *SessionCache) Generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Get 查询缓存，ok为false表示未命中；valid为false表示会话已撤销
+func (c *SessionCache) Get(key string) (userID uint, valid bool, ok bool) {
+	if c == nil {
+		return 0, false, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		return 0, false, false
+	}
+	entry := elem.Value.(*sessionCacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.removeElement(elem)
+		return 0, false, false
+	}
+	c.ll.MoveToFront(elem)
+	return entry.userID, entry.valid, true
+}
+
+// Put 写入缓存，有效期不超过TTL和会话本身的过期时间（sessionExpiry为零值表示不限）
+// generation与当前值不一致时（期间有会话失效）不写入，避免把已撤销的会话重新缓存为有效。
+func (c *SessionCache) Put(key string, userID uint, valid bool, sessionExpiry time.Time, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	expiresAt := c.now().Add(c.ttl)
+	if !sessionExpiry.IsZero() && sessionExpiry.Before(expiresAt) {
+		expiresAt = sessionExpiry
+	}
+
+	if elem, found := c.items[key]; found {
+		entry := elem.Value.(*sessionCacheEntry)
+		entry.userID, entry.valid, entry.expiresAt = userID, valid, expiresAt
+		c.ll.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&sessionCacheEntry{
+		key:       key,
+		userID:    userID,
+		valid:     valid,
+		expiresAt: expiresAt,
+	})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Invalidate 使指定会话的缓存失效
+func (c *SessionCache) Invalidate(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, found := c.items[key]; found {
+		c.removeElement(elem)
+	}
+}
+
+// InvalidateUser 使用户所有会话的缓存失效
+func (c *SessionCache) InvalidateUser(userID uint) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for elem := c.ll.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*sessionCacheEntry).userID == userID {
+			c.removeElement(elem)
+		}
+		elem = next
+	}
+}
+
+// Len 返回缓存条目数
+func (c *SessionCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// removeElement 删除缓存条目（调用方需持有锁）
+func (c *SessionCache) removeElement(elem *list.Element) {
+	c.ll.Remove(elem)
+	delete(c.items, elem.Value.(*sessionCacheEntry).key)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"ios-api/models"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// 批量读取限制
+const (
+	MaxSettingBatchKeys  = 100 // 批量读取的最大key数量
+	MaxSettingPrefixKeys = 500 // 按命名空间读取的最大设置数量
+)
+
+// prefixCachePrefix 命名空间读取结果的缓存键前缀
+const prefixCachePrefix = "setting_prefix:"
+
+// 自定义错误
+var (
+	ErrSettingBatchEmpty     = errors.New("keys不能为空")
+	ErrSettingBatchTooLarge  = fmt.Errorf("单次最多读取%d个key", MaxSettingBatchKeys)
+	ErrSettingPrefixInvalid  = errors.New("prefix格式不正确，只允许字母、数字、下划线、点号，长度1-64字符")
+	ErrSettingPrefixTooLarge = fmt.Errorf("命名空间下的设置超过%d个，请使用更具体的prefix", MaxSettingPrefixKeys)
+)
+
+// GetSettings 批量获取设置（支持缓存），返回按key排序的设置和不存在的key
+// 缓存未命中的key合并为一次数据库查询，查询后仍不存在的key按不存在写入缓存。
+// 查询期间设置被修改或缓存被清除时，结果不写入缓存。
+func (s *SettingService) GetSettings(keys []string) ([]models.Setting, []string, error) {
+	keys, err := s.normalizeBatchKeys(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make(map[string]models.Setting, len(keys))
+	misses := []string{}
+	for _, key := range keys {
+		setting, hit := s.getCached(key)
+		if !hit {
+			misses = append(misses, key)
+		} else if setting != nil {
+			found[key] = *setting
+		}
+	}
+
+	if len(misses) > 0 {
+		generation := s.flight.Generation()
+		var loaded []models.Setting
+		if err := s.DB.Where("`key` IN ?", misses).Find(&loaded).Error; err != nil {
+			return nil, nil, fmt.Errorf("查询设置失败: %w", err)
+		}
+		for _, setting := range loaded {
+			found[setting.Key] = setting
+		}
+		s.flight.PutIfCurrent(generation, func() {
+			for i := range loaded {
+				s.putCached(&loaded[i])
+			}
+			for _, key := range misses {
+				if _, ok := found[key]; !ok {
+					s.putMissing(key)
+				}
+			}
+		})
+	}
+
+	settings := make([]models.Setting, 0, len(found))
+	missing := []string{}
+	for _, key := range keys {
+		if setting, ok := found[key]; ok {
+			settings = append(settings, setting)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return settings, missing, nil
+}
+
+// ListSettingsByPrefix 获取命名空间下的全部设置（支持缓存），按key排序
+// prefix 不以点号结尾时自动补上，如 app.ios 返回 app.ios. 开头的设置，不包含 app.ios 本身。
+func (s *SettingService) ListSettingsByPrefix(prefix string) (string, []models.Setting, error) {
+	prefix, err := s.normalizePrefix(prefix)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cacheKey := prefixCachePrefix + prefix
+	var cached []models.Setting
+	if hit, exists := s.cacheGet(cacheKey, &cached); hit && exists {
+		return prefix, cached, nil
+	}
+
+	// 多查一条用于判断是否超过上限
+	generation := s.flight.Generation()
+	settings := []models.Setting{}
+	if err := s.DB.Where("`key` LIKE ?", likeEscaper.Replace(prefix)+"%").
+		Order("`key`").Limit(MaxSettingPrefixKeys + 1).Find(&settings).Error; err != nil {
+		return "", nil, fmt.Errorf("查询设置失败: %w", err)
+	}
+	if len(settings) > MaxSettingPrefixKeys {
+		return "", nil, ErrSettingPrefixTooLarge
+	}
+
+	// 查询期间命名空间中的设置被修改或缓存被清除时不写入缓存
+	if s.Cache != nil {
+		s.flight.PutIfCurrent(generation, func() {
+			s.cachePut(cacheKey, settings, s.CacheTTL)
+			for i := range settings {
+				s.putCached(&settings[i])
+			}
+		})
+	}
+	return prefix, settings, nil
+}
+
+// SettingsETag 根据设置的key、值和更新时间计算ETag，设置需按key排序
+func SettingsETag(settings []models.Setting) string {
+	hash := sha256.New()
+	for _, setting := range settings {
+		fmt.Fprintf(hash, "%s\x00%s\x00%d\x00", setting.Key, setting.Value, setting.UpdatedAt.UnixNano())
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// SettingsLastModified 返回设置中最晚的更新时间，没有设置时为零值
+func SettingsLastModified(settings []models.Setting) time.Time {
+	var lastModified time.Time
+	for _, setting := range settings {
+		if setting.UpdatedAt.After(lastModified) {
+			lastModified = setting.UpdatedAt
+		}
+	}
+	return lastModified
+}
+
+// getCached 从缓存读取单个设置
+// hit为false表示未命中；hit为true而设置为nil表示缓存中记录了该key不存在。
+func (s *SettingService) getCached(key string) (*models.Setting, bool) {
+	var setting models.Setting
+	hit, exists := s.cacheGet(s.getCacheKey(key), &setting)
+	if !hit || !exists {
+		return nil, hit
+	}
+	return &setting, true
+}
+
+// putCached 将单个设置写入缓存
+func (s *SettingService) putCached(setting *models.Setting) {
+	s.cachePut(s.getCacheKey(setting.Key), setting, s.CacheTTL)
+}
+
+// putMissing 记录key不存在，NegativeCacheTTL不大于0时不缓存
+func (s *SettingService) putMissing(key string) {
+	if s.NegativeCacheTTL > 0 {
+		s.cachePut(s.getCacheKey(key), nil, s.NegativeCacheTTL)
+	}
+}
+
+// invalidatePrefixes 删除包含该key的命名空间缓存
+func (s *SettingService) invalidatePrefixes(key string) error {
+	if s.Cache == nil {
+		return nil
+	}
+
+	iter := s.Cache.NewIterator(util.BytesPrefix([]byte(prefixCachePrefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		prefix := strings.TrimPrefix(string(iter.Key()), prefixCachePrefix)
+		if strings.HasPrefix(key, prefix) {
+			if err := s.cacheDelete(string(iter.Key())); err != nil {
+				return err
+			}
+		}
+	}
+	return iter.Error()
+}
+
+// normalizeBatchKeys 校验并去重批量读取的key，按key排序
+func (s *SettingService) normalizeBatchKeys(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, ErrSettingBatchEmpty
+	}
+
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		if len(key) < 1 || len(key) > 64 {
+			return nil, fmt.Errorf("%w: %s", ErrSettingKeyLength, key)
+		}
+		if !s.validateKeyFormat(key) {
+			return nil, fmt.Errorf("%w: %s", ErrSettingKeyInvalid, key)
+		}
+		seen[key] = true
+		unique = append(unique, key)
+	}
+	if len(unique) > MaxSettingBatchKeys {
+		return nil, ErrSettingBatchTooLarge
+	}
+	sort.Strings(unique)
+	return unique, nil
+}
+
+// normalizePrefix 校验命名空间并补全结尾的点号
+func (s *SettingService) normalizePrefix(prefix string) (string, error) {
+	if !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	if prefix == "." || len(prefix) > 64 || !s.validateKeyFormat(prefix) {
+		return "", ErrSettingPrefixInvalid
+	}
+	return prefix, nil
+}
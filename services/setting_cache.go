@@ -0,0 +1,387 @@
+package services
+
+import (
+	"container/list"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// 设置缓存默认参数
+const (
+	DefaultSettingCacheTTL         = 10 * time.Minute
+	DefaultSettingNegativeCacheTTL = 30 * time.Second
+	DefaultSettingStaleTTL         = time.Minute
+)
+
+// settingCacheEntry 缓存条目，LevelDB和内存缓存中保存的是该结构的JSON
+type settingCacheEntry struct {
+	Data      json.RawMessage `json:"data"`       // 缓存的值，null 表示key不存在
+	ExpiresAt int64           `json:"expires_at"` // 过期时间（Unix纳秒），0 表示不过期
+}
+
+// settingCacheStats 缓存命中统计，自服务启动起累计
+type settingCacheStats struct {
+	hits         uint64 // 命中（包括不存在的key）
+	memoryHits   uint64 // 其中由内存缓存命中
+	negativeHits uint64 // 其中命中不存在的key
+	staleHits    uint64 // 其中返回已过期的旧值并在后台刷新
+	misses       uint64 // 未命中或已过期
+	expired      uint64 // 读取或清理时删除的过期条目
+}
+
+// SettingMemoryCache 位于LevelDB之前的内存LRU缓存，保存编码后的缓存条目
+// 条目数超过上限时淘汰最久未使用的条目。nil缓存的所有方法均可安全调用。
+type SettingMemoryCache struct {
+	evictions uint64 // 淘汰的条目数，原子操作需要64位对齐，放在首位
+
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// memoryCacheItem 内存缓存条目
+type memoryCacheItem struct {
+	key  string
+	data []byte
+}
+
+// NewSettingMemoryCache 创建内存缓存，size不大于0时返回nil（不使用内存缓存）
+func NewSettingMemoryCache(size int) *SettingMemoryCache {
+	if size <= 0 {
+		return nil
+	}
+	return &SettingMemoryCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get 查询缓存，ok为false表示未命中
+func (c *SettingMemoryCache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*memoryCacheItem).data, true
+}
+
+// Put 写入缓存，超过上限时淘汰最久未使用的条目
+func (c *SettingMemoryCache) Put(key string, data []byte) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.items[key]; found {
+		elem.Value.(*memoryCacheItem).data = data
+		c.ll.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&memoryCacheItem{key: key, data: data})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*memoryCacheItem).key)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// Delete 删除缓存
+func (c *SettingMemoryCache) Delete(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.items[key]; found {
+		c.ll.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// Clear 清空缓存
+func (c *SettingMemoryCache) Clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Len 返回当前条目数
+func (c *SettingMemoryCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Evictions 返回因超过上限而淘汰的条目数
+func (c *SettingMemoryCache) Evictions() uint64 {
+	if c == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&c.evictions)
+}
+
+// removeIf 删除满足条件的条目，返回删除的条目数
+func (c *SettingMemoryCache) removeIf(match func(key string, data []byte) bool) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, elem := range c.items {
+		if match(key, elem.Value.(*memoryCacheItem).data) {
+			c.ll.Remove(elem)
+			delete(c.items, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// SetClock 设置时钟函数（用于测试）
+func (s *SettingService) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// PurgeExpiredCache 删除LevelDB和内存缓存中已过期或格式无效的条目，返回删除的LevelDB条目数
+// 从未再次读取的key不会在读取时删除，需要定期清理以限制缓存大小。仍可作为旧值返回（StaleTTL内）的条目保留。
+func (s *SettingService) PurgeExpiredCache() (int, error) {
+	if s.Cache == nil {
+		return 0, nil
+	}
+
+	now := s.clock()
+	removed := 0
+	iter := s.Cache.NewIterator(util.BytesPrefix([]byte("setting")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := string(iter.Key())
+		if !isSettingCacheKey(key) {
+			continue
+		}
+		if entry, ok := decodeCacheEntry(iter.Value()); ok && !entry.expired(now.Add(-s.StaleTTL)) {
+			continue
+		}
+		if err := s.Cache.Delete(iter.Key(), nil); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	if err := iter.Error(); err != nil {
+		return removed, err
+	}
+
+	s.Memory.removeIf(func(key string, data []byte) bool {
+		entry, ok := decodeCacheEntry(data)
+		return !ok || entry.expired(now.Add(-s.StaleTTL))
+	})
+	if s.stats != nil {
+		atomic.AddUint64(&s.stats.expired, uint64(removed))
+	}
+	return removed, nil
+}
+
+// StartCachePurge 启动定时清理过期缓存的任务，返回停止函数
+func (s *SettingService) StartCachePurge(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := s.PurgeExpiredCache(); err != nil {
+					log.Printf("清理过期设置缓存失败: %v", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// cacheGet 读取缓存条目并解析到out，已过期的条目按未命中处理
+// hit为false表示未命中（不存在、已过期或格式无效）；hit为true且exists为false表示命中了不存在的key。
+func (s *SettingService) cacheGet(cacheKey string, out interface{}) (hit bool, exists bool) {
+	hit, exists, _ = s.cacheLookup(cacheKey, out, false)
+	return hit, exists
+}
+
+// cacheLookup 读取缓存条目并解析到out
+// allowStale为true时，过期不超过StaleTTL的条目仍然命中并返回stale为true，由调用方在后台刷新。
+func (s *SettingService) cacheLookup(cacheKey string, out interface{}, allowStale bool) (hit, exists, stale bool) {
+	if s.Cache == nil {
+		return false, false, false
+	}
+
+	data, fromMemory := s.Memory.Get(cacheKey)
+	if !fromMemory {
+		var err error
+		if data, err = s.Cache.Get([]byte(cacheKey), nil); err != nil {
+			s.countMiss()
+			return false, false, false
+		}
+	}
+
+	now := s.clock()
+	entry, ok := decodeCacheEntry(data)
+	if ok && entry.expired(now) {
+		stale = allowStale && s.StaleTTL > 0 && !entry.expired(now.Add(-s.StaleTTL))
+		ok = stale
+	}
+	if ok && !isNullJSON(entry.Data) {
+		ok = json.Unmarshal(entry.Data, out) == nil
+	}
+	if !ok {
+		// 过期或格式无效（包括旧版本未带过期时间的缓存），删除后按未命中处理
+		s.cacheDelete(cacheKey)
+		if s.stats != nil {
+			atomic.AddUint64(&s.stats.expired, 1)
+		}
+		s.countMiss()
+		return false, false, false
+	}
+
+	if !fromMemory {
+		s.Memory.Put(cacheKey, data)
+	}
+	if s.stats != nil {
+		atomic.AddUint64(&s.stats.hits, 1)
+		if fromMemory {
+			atomic.AddUint64(&s.stats.memoryHits, 1)
+		}
+		if isNullJSON(entry.Data) {
+			atomic.AddUint64(&s.stats.negativeHits, 1)
+		}
+		if stale {
+			atomic.AddUint64(&s.stats.staleHits, 1)
+		}
+	}
+	return true, !isNullJSON(entry.Data), stale
+}
+
+// cachePut 写入缓存，value为nil时表示key不存在；ttl不大于0时不过期
+func (s *SettingService) cachePut(cacheKey string, value interface{}, ttl time.Duration) {
+	if s.Cache == nil {
+		return
+	}
+
+	entry := settingCacheEntry{Data: json.RawMessage("null")}
+	if value != nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		entry.Data = data
+	}
+	if ttl > 0 {
+		entry.ExpiresAt = s.clock().Add(ttl).UnixNano()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := s.Cache.Put([]byte(cacheKey), data, nil); err != nil {
+		return
+	}
+	s.Memory.Put(cacheKey, data)
+}
+
+// cacheDelete 从LevelDB和内存缓存中删除
+func (s *SettingService) cacheDelete(cacheKey string) error {
+	s.Memory.Delete(cacheKey)
+	if s.Cache == nil {
+		return nil
+	}
+	return s.Cache.Delete([]byte(cacheKey), nil)
+}
+
+// cacheDiskSize 返回LevelDB缓存目录占用的磁盘空间（字节）
+func (s *SettingService) cacheDiskSize() int64 {
+	if s.cachePath == "" {
+		return 0
+	}
+	var size int64
+	filepath.WalkDir(s.cachePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// countMiss 记录一次未命中
+func (s *SettingService) countMiss() {
+	if s.stats != nil {
+		atomic.AddUint64(&s.stats.misses, 1)
+	}
+}
+
+// clock 返回当前时间
+func (s *SettingService) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// decodeCacheEntry 解析缓存条目，格式无效时返回false
+func decodeCacheEntry(data []byte) (settingCacheEntry, bool) {
+	var entry settingCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Data == nil {
+		return entry, false
+	}
+	return entry, true
+}
+
+// expired 条目在now时是否已过期
+func (e settingCacheEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != 0 && now.UnixNano() >= e.ExpiresAt
+}
+
+// isSettingCacheKey 是否为单个设置或命名空间的缓存键
+func isSettingCacheKey(key string) bool {
+	return strings.HasPrefix(key, "setting:") || strings.HasPrefix(key, prefixCachePrefix)
+}
+
+// isNullJSON 是否为JSON null
+func isNullJSON(data json.RawMessage) bool {
+	return string(data) == "null"
+}
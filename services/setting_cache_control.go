@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrCacheControlInvalid 缓存策略配置格式错误
+var ErrCacheControlInvalid = errors.New("设置缓存策略格式错误")
+
+// cacheControlRule 一条按key前缀配置的客户端缓存时间
+type cacheControlRule struct {
+	prefix string // key前缀，空字符串匹配全部key
+	maxAge int    // 秒
+}
+
+// SettingCacheControl 设置读取接口的 Cache-Control 策略，按最长的key前缀匹配
+// 没有匹配的规则或缓存时间为0时返回 no-cache，客户端和CDN每次通过ETag重新验证。
+type SettingCacheControl struct {
+	rules []cacheControlRule // 按前缀长度倒序排列
+}
+
+// ParseSettingCacheControl 解析缓存策略配置
+// 格式为 前缀=秒数,前缀=秒数，如 app.ios.=300,config.=60,*=0；前缀以 * 结尾时忽略 *，单独的 * 匹配全部key。
+func ParseSettingCacheControl(spec string) (*SettingCacheControl, error) {
+	policy := &SettingCacheControl{}
+	seen := map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		prefix, seconds, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrCacheControlInvalid, item)
+		}
+		prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "*")
+		maxAge, err := strconv.Atoi(strings.TrimSpace(seconds))
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("%w: %s 的缓存时间应为非负整数秒", ErrCacheControlInvalid, item)
+		}
+		if seen[prefix] {
+			return nil, fmt.Errorf("%w: 前缀 %s 重复", ErrCacheControlInvalid, prefix)
+		}
+		seen[prefix] = true
+		policy.rules = append(policy.rules, cacheControlRule{prefix: prefix, maxAge: maxAge})
+	}
+
+	sort.Slice(policy.rules, func(i, j int) bool { return len(policy.rules[i].prefix) > len(policy.rules[j].prefix) })
+	return policy, nil
+}
+
+// MaxAge 返回key的缓存时间（秒），没有匹配的规则时返回0
+func (p *SettingCacheControl) MaxAge(key string) int {
+	if p == nil {
+		return 0
+	}
+	for _, rule := range p.rules {
+		if strings.HasPrefix(key, rule.prefix) {
+			return rule.maxAge
+		}
+	}
+	return 0
+}
+
+// MaxAgeForPrefix 返回命名空间读取结果的缓存时间（秒）
+// 取命名空间本身匹配的缓存时间和命名空间内更具体规则中的最小值，保证其中每个key都不会超过各自的缓存时间。
+func (p *SettingCacheControl) MaxAgeForPrefix(prefix string) int {
+	maxAge := p.MaxAge(prefix)
+	if p == nil {
+		return maxAge
+	}
+	for _, rule := range p.rules {
+		if len(rule.prefix) > len(prefix) && strings.HasPrefix(rule.prefix, prefix) && rule.maxAge < maxAge {
+			maxAge = rule.maxAge
+		}
+	}
+	return maxAge
+}
+
+// CacheControlHeader 根据缓存时间生成 Cache-Control 响应头
+func CacheControlHeader(maxAge int) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("public, max-age=%d", maxAge)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"sync"
+
+	"ios-api/models"
+)
+
+// settingCall 一次正在进行的设置加载
+type settingCall struct {
+	done    chan struct{}
+	setting *models.Setting
+	err     error
+}
+
+// settingFlight 合并同一key的并发加载，缓存失效时大量请求同时未命中也只查询一次数据库
+// 同时记录缓存失效的代数：加载期间设置被修改或缓存被清除时，加载结果不写入缓存。
+// nil的所有方法均可安全调用，此时不合并加载。
+type settingFlight struct {
+	genMu      sync.RWMutex // 写入缓存时持有读锁，Invalidate 持有写锁
+	generation uint64       // 缓存失效的代数
+
+	mu    sync.Mutex
+	calls map[string]*settingCall
+}
+
+// newSettingFlight 创建并发加载合并器
+func newSettingFlight() *settingFlight {
+	return &settingFlight{calls: make(map[string]*settingCall)}
+}
+
+// Do 加载key，已有相同key的加载在进行时等待其结果，返回的设置为副本
+func (f *settingFlight) Do(key string, load func() (*models.Setting, error)) (*models.Setting, error) {
+	if f == nil {
+		return load()
+	}
+
+	call, started := f.start(key)
+	if started {
+		f.run(key, call, load)
+	} else {
+		<-call.done
+	}
+	if call.err != nil || call.setting == nil {
+		return nil, call.err
+	}
+	setting := *call.setting
+	return &setting, nil
+}
+
+// Go 在后台加载key，已有相同key的加载在进行时不重复加载
+func (f *settingFlight) Go(key string, load func() (*models.Setting, error)) {
+	if f == nil {
+		go load()
+		return
+	}
+	if call, started := f.start(key); started {
+		go f.run(key, call, load)
+	}
+}
+
+// Generation 返回当前的缓存失效代数，加载前记录，写入缓存时通过 PutIfCurrent 比较
+func (f *settingFlight) Generation() uint64 {
+	if f == nil {
+		return 0
+	}
+	f.genMu.RLock()
+	defer f.genMu.RUnlock()
+	return f.generation
+}
+
+// PutIfCurrent 代数仍为generation时执行put写入缓存，返回是否已写入
+// 比较和写入期间持有读锁，与 Invalidate 互斥：写入要么在失效之前完成（随后被调用方删除缓存时清除），
+// 要么因代数已变化而跳过，加载到的旧值不会留在缓存中。
+func (f *settingFlight) PutIfCurrent(generation uint64, put func()) bool {
+	if f == nil {
+		put()
+		return true
+	}
+	f.genMu.RLock()
+	defer f.genMu.RUnlock()
+	if f.generation != generation {
+		return false
+	}
+	put()
+	return true
+}
+
+// Invalidate 设置被修改或缓存被清除，正在进行的加载结果不再写入缓存，之后的请求重新加载
+// key为空时表示全部key。调用方需在 Invalidate 之后删除缓存，才能清除失效前已写入的旧值。
+func (f *settingFlight) Invalidate(key string) {
+	if f == nil {
+		return
+	}
+	f.genMu.Lock()
+	f.generation++
+	f.genMu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if key == "" {
+		f.calls = make(map[string]*settingCall)
+	} else {
+		delete(f.calls, key)
+	}
+}
+
+// start 登记key的加载，started为false表示已有加载在进行
+func (f *settingFlight) start(key string) (call *settingCall, started bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if call, found := f.calls[key]; found {
+		return call, false
+	}
+	call = &settingCall{done: make(chan struct{})}
+	f.calls[key] = call
+	return call, true
+}
+
+// run 执行加载并通知等待的请求
+func (f *settingFlight) run(key string, call *settingCall, load func() (*models.Setting, error)) {
+	defer func() {
+		f.mu.Lock()
+		// 加载期间被 Invalidate 移除后，key可能已登记了新的加载
+		if f.calls[key] == call {
+			delete(f.calls, key)
+		}
+		f.mu.Unlock()
+		close(call.done)
+	}()
+	call.setting, call.err = load()
+}
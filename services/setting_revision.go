@@ -0,0 +1,243 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"ios-api/models"
+
+	"gorm.io/gorm"
+)
+
+// 设置值对比格式
+const (
+	SettingDiffJSON = "json" // 两个版本都是JSON对象，按字段对比
+	SettingDiffText = "text" // 按行对比
+)
+
+// 设置值字段变更类型
+const (
+	SettingChangeAdded   = "added"
+	SettingChangeRemoved = "removed"
+	SettingChangeChanged = "changed"
+)
+
+// maxTextDiffCells 按行对比时最长公共子序列表格的最大单元数，超过时整体替换
+const maxTextDiffCells = 1000000
+
+// 自定义错误
+var (
+	ErrSettingRevisionNotFound  = errors.New("设置修改记录不存在")
+	ErrSettingRevisionUnchanged = errors.New("当前值与该版本相同，无需回滚")
+)
+
+// SettingRevisionQuery 设置修改记录分页参数
+type SettingRevisionQuery struct {
+	Page     int `form:"page"`
+	PageSize int `form:"page_size"`
+}
+
+// SettingValueChange JSON对象中一个字段的变更，路径形如 a.b.c
+type SettingValueChange struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"` // added、removed、changed
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// SettingDiff 两个版本的设置值对比结果
+// Format 为 json 时 Changes 为字段变更；为 text 时 Lines 为逐行对比，行首为 "+"、"-" 或空格。
+type SettingDiff struct {
+	From    *models.SettingRevision `json:"from"`
+	To      *models.SettingRevision `json:"to"`
+	Format  string                  `json:"format"`
+	Changes []SettingValueChange    `json:"changes,omitempty"`
+	Lines   []string                `json:"lines,omitempty"`
+}
+
+// ListRevisions 获取指定key的修改记录，返回当前页的记录和总数，按时间倒序排列
+func (s *SettingService) ListRevisions(key string, params SettingRevisionQuery) ([]models.SettingRevision, int64, error) {
+	query := s.DB.Model(&models.SettingRevision{}).Where("`key` = ?", key).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询修改记录失败: %w", err)
+	}
+
+	page, pageSize := normalizePage(params.Page, params.PageSize)
+	revisions := []models.SettingRevision{}
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&revisions).Error; err != nil {
+		return nil, 0, fmt.Errorf("查询修改记录失败: %w", err)
+	}
+	return revisions, total, nil
+}
+
+// GetRevision 获取指定key的某个版本
+func (s *SettingService) GetRevision(key string, id uint) (*models.SettingRevision, error) {
+	var revision models.SettingRevision
+	if err := s.DB.Where("id = ? AND `key` = ?", id, key).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSettingRevisionNotFound
+		}
+		return nil, fmt.Errorf("查询修改记录失败: %w", err)
+	}
+	return &revision, nil
+}
+
+// DiffRevisions 对比指定key两个版本修改后的值
+func (s *SettingService) DiffRevisions(key string, fromID, toID uint) (*SettingDiff, error) {
+	from, err := s.GetRevision(key, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.GetRevision(key, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffSettingValues(from.NewValue, to.NewValue)
+	diff.From = from
+	diff.To = to
+	return diff, nil
+}
+
+// Rollback 将设置恢复为指定版本的值
+// 与普通写入相同：校验设置定义、追加修改记录、删除缓存并记录审计日志。
+func (s *SettingService) Rollback(key string, revisionID uint, comment string) (*models.Setting, error) {
+	revision, err := s.GetRevision(key, revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var current models.Setting
+	err = s.DB.Where("`key` = ?", key).First(&current).Error
+	if err == nil && current.Value == revision.NewValue {
+		return nil, ErrSettingRevisionUnchanged
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询设置失败: %w", err)
+	}
+
+	if comment == "" {
+		comment = fmt.Sprintf("回滚到版本 %d", revision.ID)
+	}
+	return s.writeSetting(key, revision.NewValue, comment, &revision.ID)
+}
+
+// DiffSettingValues 对比两个设置值
+// 两个值都是JSON对象时按字段路径对比（数组作为整体比较），否则按行对比。
+func DiffSettingValues(oldValue, newValue string) *SettingDiff {
+	oldObject, oldOK := decodeJSONObject(oldValue)
+	newObject, newOK := decodeJSONObject(newValue)
+	if oldOK && newOK {
+		oldFields := map[string]interface{}{}
+		newFields := map[string]interface{}{}
+		flattenJSONObject("", oldObject, oldFields)
+		flattenJSONObject("", newObject, newFields)
+
+		changes := []SettingValueChange{}
+		for path, oldField := range oldFields {
+			newField, ok := newFields[path]
+			if !ok {
+				changes = append(changes, SettingValueChange{Path: path, Type: SettingChangeRemoved, Old: oldField})
+			} else if !reflect.DeepEqual(oldField, newField) {
+				changes = append(changes, SettingValueChange{Path: path, Type: SettingChangeChanged, Old: oldField, New: newField})
+			}
+		}
+		for path, newField := range newFields {
+			if _, ok := oldFields[path]; !ok {
+				changes = append(changes, SettingValueChange{Path: path, Type: SettingChangeAdded, New: newField})
+			}
+		}
+		// 按路径排序，保证结果稳定
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+		return &SettingDiff{Format: SettingDiffJSON, Changes: changes}
+	}
+
+	return &SettingDiff{Format: SettingDiffText, Lines: diffLines(oldValue, newValue)}
+}
+
+// decodeJSONObject 解析JSON对象，不是对象时返回false
+func decodeJSONObject(value string) (map[string]interface{}, bool) {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil || object == nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// flattenJSONObject 将嵌套对象展开为 路径 -> 值，空对象作为叶子值保留
+func flattenJSONObject(prefix string, object map[string]interface{}, out map[string]interface{}) {
+	for name, value := range object {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if child, ok := value.(map[string]interface{}); ok && len(child) > 0 {
+			flattenJSONObject(path, child, out)
+			continue
+		}
+		out[path] = value
+	}
+}
+
+// diffLines 按最长公共子序列逐行对比，行数过多时输出整体替换
+func diffLines(oldValue, newValue string) []string {
+	oldLines := strings.Split(oldValue, "\n")
+	newLines := strings.Split(newValue, "\n")
+	n, m := len(oldLines), len(newLines)
+
+	lines := make([]string, 0, n+m)
+	if n*m > maxTextDiffCells {
+		for _, line := range oldLines {
+			lines = append(lines, "-"+line)
+		}
+		for _, line := range newLines {
+			lines = append(lines, "+"+line)
+		}
+		return lines
+	}
+
+	// lcs[i][j] 为 oldLines[i:] 与 newLines[j:] 的最长公共子序列长度
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case oldLines[i] == newLines[j]:
+			lines = append(lines, " "+oldLines[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "-"+oldLines[i])
+			i++
+		default:
+			lines = append(lines, "+"+newLines[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		lines = append(lines, "-"+oldLines[i])
+	}
+	for ; j < m; j++ {
+		lines = append(lines, "+"+newLines[j])
+	}
+	return lines
+}
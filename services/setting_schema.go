@@ -0,0 +1,288 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ios-api/models"
+
+	"gorm.io/gorm"
+)
+
+// 设置值类型
+const (
+	SettingTypeString = "string"
+	SettingTypeInt    = "int"
+	SettingTypeBool   = "bool"
+	SettingTypeJSON   = "json"
+)
+
+// 自定义错误
+var (
+	ErrSettingValueInvalid   = errors.New("设置值不符合定义")
+	ErrSettingSchemaInvalid  = errors.New("设置定义格式错误")
+	ErrSettingSchemaNotFound = errors.New("设置定义不存在")
+	ErrSettingTypeMismatch   = errors.New("设置值类型错误")
+)
+
+// ValidateSettingSchema 检查设置定义本身是否有效
+// Schema 只用于 json 类型，Min/Max 只用于 int（值范围）和 string（长度范围），Enum 不能用于 json 类型。
+func ValidateSettingSchema(schema *models.SettingSchema) error {
+	switch schema.Type {
+	case SettingTypeString, SettingTypeInt, SettingTypeBool, SettingTypeJSON:
+	default:
+		return fmt.Errorf("%w: 不支持的类型 %s", ErrSettingSchemaInvalid, schema.Type)
+	}
+
+	if len(schema.Schema) > 0 {
+		if schema.Type != SettingTypeJSON {
+			return fmt.Errorf("%w: 只有 json 类型可以设置 schema", ErrSettingSchemaInvalid)
+		}
+		if _, err := ParseJSONSchema(schema.Schema); err != nil {
+			return fmt.Errorf("%w: schema 无效: %v", ErrSettingSchemaInvalid, err)
+		}
+	}
+
+	if schema.Min != nil || schema.Max != nil {
+		if schema.Type != SettingTypeInt && schema.Type != SettingTypeString {
+			return fmt.Errorf("%w: 只有 int 和 string 类型可以设置 min/max", ErrSettingSchemaInvalid)
+		}
+		if schema.Type == SettingTypeString && schema.Min != nil && *schema.Min < 0 {
+			return fmt.Errorf("%w: 长度下限不能小于0", ErrSettingSchemaInvalid)
+		}
+		if schema.Min != nil && schema.Max != nil && *schema.Min > *schema.Max {
+			return fmt.Errorf("%w: min 不能大于 max", ErrSettingSchemaInvalid)
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		if schema.Type == SettingTypeJSON {
+			return fmt.Errorf("%w: json 类型请在 schema 中使用 enum", ErrSettingSchemaInvalid)
+		}
+		values, err := decodeSettingEnum(schema.Enum)
+		if err != nil {
+			return err
+		}
+		for _, value := range values {
+			if !matchSettingEnumType(schema.Type, value) {
+				return fmt.Errorf("%w: 可选值 %v 与类型 %s 不符", ErrSettingSchemaInvalid, value, schema.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateSettingValue 校验设置值是否符合定义
+func ValidateSettingValue(schema *models.SettingSchema, value string) error {
+	var enumValue interface{} // 用于和可选值比较的值
+	switch schema.Type {
+	case SettingTypeString:
+		length := int64(utf8.RuneCountInString(value))
+		if schema.Min != nil && length < *schema.Min {
+			return fmt.Errorf("%w: 长度不能小于 %d", ErrSettingValueInvalid, *schema.Min)
+		}
+		if schema.Max != nil && length > *schema.Max {
+			return fmt.Errorf("%w: 长度不能大于 %d", ErrSettingValueInvalid, *schema.Max)
+		}
+		enumValue = value
+	case SettingTypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: 应为整数", ErrSettingValueInvalid)
+		}
+		if schema.Min != nil && n < *schema.Min {
+			return fmt.Errorf("%w: 不能小于 %d", ErrSettingValueInvalid, *schema.Min)
+		}
+		if schema.Max != nil && n > *schema.Max {
+			return fmt.Errorf("%w: 不能大于 %d", ErrSettingValueInvalid, *schema.Max)
+		}
+		enumValue = float64(n)
+	case SettingTypeBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%w: 应为 true 或 false", ErrSettingValueInvalid)
+		}
+		enumValue = value == "true"
+	case SettingTypeJSON:
+		if !json.Valid([]byte(value)) {
+			return fmt.Errorf("%w: 不是有效的JSON", ErrSettingValueInvalid)
+		}
+		if len(schema.Schema) > 0 {
+			jsonSchema, err := ParseJSONSchema(schema.Schema)
+			if err != nil {
+				return fmt.Errorf("%w: schema 无效: %v", ErrSettingSchemaInvalid, err)
+			}
+			if err := jsonSchema.ValidateJSON([]byte(value)); err != nil {
+				return fmt.Errorf("%w: %v", ErrSettingValueInvalid, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: 不支持的类型 %s", ErrSettingSchemaInvalid, schema.Type)
+	}
+
+	if len(schema.Enum) > 0 {
+		values, err := decodeSettingEnum(schema.Enum)
+		if err != nil {
+			return err
+		}
+		for _, candidate := range values {
+			if candidate == enumValue {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: 不在可选值范围内", ErrSettingValueInvalid)
+	}
+	return nil
+}
+
+// decodeSettingEnum 解析可选值列表
+func decodeSettingEnum(data json.RawMessage) ([]interface{}, error) {
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%w: enum 应为JSON数组", ErrSettingSchemaInvalid)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("%w: enum 不能为空", ErrSettingSchemaInvalid)
+	}
+	return values, nil
+}
+
+// matchSettingEnumType 可选值是否与设置类型一致
+func matchSettingEnumType(typ string, value interface{}) bool {
+	switch typ {
+	case SettingTypeString:
+		_, ok := value.(string)
+		return ok
+	case SettingTypeInt:
+		return matchJSONType("integer", value)
+	case SettingTypeBool:
+		_, ok := value.(bool)
+		return ok
+	}
+	return false
+}
+
+// GetSchema 获取指定key的设置定义，未定义时返回nil
+func (s *SettingService) GetSchema(key string) (*models.SettingSchema, error) {
+	var schema models.SettingSchema
+	if err := s.DB.Where("`key` = ?", key).First(&schema).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询设置定义失败: %w", err)
+	}
+	return &schema, nil
+}
+
+// ListSchemas 获取全部设置定义，按key排序
+func (s *SettingService) ListSchemas() ([]models.SettingSchema, error) {
+	schemas := []models.SettingSchema{}
+	if err := s.DB.Order("`key`").Find(&schemas).Error; err != nil {
+		return nil, fmt.Errorf("查询设置定义失败: %w", err)
+	}
+	return schemas, nil
+}
+
+// SetSchema 创建或更新设置定义，已有的设置值需符合新定义
+func (s *SettingService) SetSchema(schema *models.SettingSchema) error {
+	if !s.validateKeyFormat(schema.Key) {
+		return ErrSettingKeyInvalid
+	}
+	if len(schema.Key) < 1 || len(schema.Key) > 64 {
+		return ErrSettingKeyLength
+	}
+	if err := ValidateSettingSchema(schema); err != nil {
+		return err
+	}
+
+	var setting models.Setting
+	err := s.DB.Where("`key` = ?", schema.Key).First(&setting).Error
+	if err == nil {
+		if err := ValidateSettingValue(schema, setting.Value); err != nil {
+			return fmt.Errorf("当前值与新定义不符: %w", err)
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("查询设置失败: %w", err)
+	}
+
+	if err := s.DB.Save(schema).Error; err != nil {
+		return fmt.Errorf("保存设置定义失败: %w", err)
+	}
+
+	s.audit(AuditSettingSchemaUpdate, schema.Key, schema)
+	return nil
+}
+
+// DeleteSchema 删除设置定义，删除后该key的值不再校验
+func (s *SettingService) DeleteSchema(key string) error {
+	result := s.DB.Where("`key` = ?", key).Delete(&models.SettingSchema{})
+	if result.Error != nil {
+		return fmt.Errorf("删除设置定义失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSettingSchemaNotFound
+	}
+
+	s.audit(AuditSettingSchemaDelete, key, nil)
+	return nil
+}
+
+// validateValue 按设置定义校验值，未定义时不校验
+func (s *SettingService) validateValue(key, value string) error {
+	schema, err := s.GetSchema(key)
+	if err != nil || schema == nil {
+		return err
+	}
+	return ValidateSettingValue(schema, value)
+}
+
+// GetString 读取字符串设置，不存在时返回默认值
+func (s *SettingService) GetString(key, defaultValue string) (string, error) {
+	setting, err := s.GetSetting(key)
+	if err != nil || setting == nil {
+		return defaultValue, err
+	}
+	return setting.Value, nil
+}
+
+// GetInt 读取整数设置，不存在或不是整数时返回默认值
+func (s *SettingService) GetInt(key string, defaultValue int64) (int64, error) {
+	setting, err := s.GetSetting(key)
+	if err != nil || setting == nil {
+		return defaultValue, err
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(setting.Value), 10, 64)
+	if err != nil {
+		return defaultValue, fmt.Errorf("%w: %s 不是整数", ErrSettingTypeMismatch, key)
+	}
+	return n, nil
+}
+
+// GetBool 读取布尔设置，不存在或不是布尔值时返回默认值
+func (s *SettingService) GetBool(key string, defaultValue bool) (bool, error) {
+	setting, err := s.GetSetting(key)
+	if err != nil || setting == nil {
+		return defaultValue, err
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(setting.Value))
+	if err != nil {
+		return defaultValue, fmt.Errorf("%w: %s 不是布尔值", ErrSettingTypeMismatch, key)
+	}
+	return b, nil
+}
+
+// GetJSON 读取JSON设置并解析到out，不存在时不修改out，调用方可预先在out中填入默认值
+func (s *SettingService) GetJSON(key string, out interface{}) error {
+	setting, err := s.GetSetting(key)
+	if err != nil || setting == nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(setting.Value), out); err != nil {
+		return fmt.Errorf("%w: %s 不是有效的JSON: %v", ErrSettingTypeMismatch, key, err)
+	}
+	return nil
+}
@@ -1,25 +1,51 @@
 package services
 
 import (
-	"crypto/md5"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"ios-api/models"
+	"log"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 自定义错误
+var (
+	ErrSettingKeyInvalid    = errors.New("key格式不正确，只允许字母、数字、下划线、点号")
+	ErrSettingKeyLength     = errors.New("key长度必须在1-64字符之间")
+	ErrSettingValueTooLarge = errors.New("value长度不能超过10KB")
 )
 
 // SettingService 设置服务
+// 写入权限由调用方校验（管理员角色或签名请求），服务校验key格式和value是否符合设置定义。
 type SettingService struct {
-	DB    *gorm.DB    // 通用数据库连接
-	Salt  string      // MD5校验盐值
-	Cache *leveldb.DB // LevelDB缓存
+	DB    *gorm.DB      // 通用数据库连接
+	Cache *leveldb.DB   // LevelDB缓存
+	Audit *AuditService // 审计日志服务，为空时不记录
+
+	CacheControl *SettingCacheControl // 读取接口的客户端缓存策略，为空时不缓存
+
+	Memory           *SettingMemoryCache // LevelDB之前的内存LRU缓存，为空时不使用
+	CacheTTL         time.Duration       // 缓存有效期，不大于0时不过期
+	NegativeCacheTTL time.Duration       // 不存在的key的缓存有效期，不大于0时不缓存
+	StaleTTL         time.Duration       // 过期后仍可返回旧值并在后台刷新的时间，不大于0时过期即重新查询
+
+	cachePath string             // LevelDB缓存目录，用于统计磁盘占用
+	stats     *settingCacheStats // 缓存命中统计，WithClient 返回的副本共用
+	flight    *settingFlight     // 合并同一key的并发加载，WithClient 返回的副本共用
+	now       func() time.Time   // 时钟函数，为空时使用 time.Now
+
+	client ClientInfo // 当前请求的客户端信息，通过 WithClient 设置
 }
 
 // NewSettingService 创建新的设置服务实例
-func NewSettingService(db *gorm.DB, salt string, cacheDir string) (*SettingService, error) {
+func NewSettingService(db *gorm.DB, cacheDir string) (*SettingService, error) {
 	// 创建缓存目录路径
 	cachePath := filepath.Join(cacheDir, "settings_cache")
 
@@ -30,12 +56,24 @@ func NewSettingService(db *gorm.DB, salt string, cacheDir string) (*SettingServi
 	}
 
 	return &SettingService{
-		DB:    db,
-		Salt:  salt,
-		Cache: cache,
+		DB:               db,
+		Cache:            cache,
+		CacheTTL:         DefaultSettingCacheTTL,
+		NegativeCacheTTL: DefaultSettingNegativeCacheTTL,
+		StaleTTL:         DefaultSettingStaleTTL,
+		cachePath:        cachePath,
+		stats:            &settingCacheStats{},
+		flight:           newSettingFlight(),
 	}, nil
 }
 
+// WithClient 返回携带客户端信息的服务副本，审计日志据此记录操作人、IP和User-Agent
+func (s *SettingService) WithClient(client ClientInfo) *SettingService {
+	copied := *s
+	copied.client = client
+	return &copied
+}
+
 // Close 关闭缓存连接
 func (s *SettingService) Close() error {
 	if s.Cache != nil {
@@ -50,105 +88,173 @@ func (s *SettingService) getCacheKey(key string) string {
 }
 
 // GetSetting 获取指定key的设置（支持缓存）
+// 缓存未命中时同一key的并发请求只查询一次数据库；缓存过期不超过StaleTTL时先返回旧值，并在后台刷新。
 func (s *SettingService) GetSetting(key string) (*models.Setting, error) {
-	cacheKey := s.getCacheKey(key)
-
-	// 首先尝试从缓存读取
-	if s.Cache != nil {
-		cachedData, err := s.Cache.Get([]byte(cacheKey), nil)
-		if err == nil {
-			// 缓存命中，反序列化数据
-			var setting models.Setting
-			if err := json.Unmarshal(cachedData, &setting); err == nil {
-				return &setting, nil
-			}
-			// 如果反序列化失败，删除无效缓存
-			s.Cache.Delete([]byte(cacheKey), nil)
+	// 首先尝试从缓存读取，命中不存在的key时返回nil
+	var cached models.Setting
+	if hit, exists, stale := s.cacheLookup(s.getCacheKey(key), &cached, true); hit {
+		if stale {
+			s.flight.Go(key, func() (*models.Setting, error) { return s.refreshSetting(key) })
 		}
+		if !exists {
+			return nil, nil
+		}
+		return &cached, nil
 	}
 
 	// 缓存未命中，从数据库查询
+	return s.flight.Do(key, func() (*models.Setting, error) { return s.loadSetting(key) })
+}
+
+// loadSetting 从数据库查询设置并写入缓存，不存在时返回nil
+// 查询期间设置被修改或缓存被清除时，结果只返回给本次请求，不写入缓存。
+func (s *SettingService) loadSetting(key string) (*models.Setting, error) {
+	generation := s.flight.Generation()
+
 	var setting models.Setting
 	err := s.DB.Where("`key` = ?", key).First(&setting).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
+			// 短时间缓存不存在的key，避免反复查询数据库
+			s.flight.PutIfCurrent(generation, func() { s.putMissing(key) })
 			return nil, nil // 返回nil表示未找到
 		}
 		return nil, fmt.Errorf("查询设置失败: %w", err)
 	}
 
 	// 将结果存入缓存
-	if s.Cache != nil {
-		if cachedData, err := json.Marshal(setting); err == nil {
-			s.Cache.Put([]byte(cacheKey), cachedData, nil)
-		}
-	}
-
+	s.flight.PutIfCurrent(generation, func() { s.putCached(&setting) })
 	return &setting, nil
 }
 
-// SetSetting 设置/更新指定key的值，需要MD5校验
-func (s *SettingService) SetSetting(key, value, keyMD5 string) (*models.Setting, error) {
-	// 验证key的MD5值
-	if !s.validateKeyMD5(key, keyMD5) {
-		return nil, fmt.Errorf("key的MD5校验失败")
+// refreshSetting 后台刷新已过期的缓存，失败时记录日志，旧值在StaleTTL内继续返回
+func (s *SettingService) refreshSetting(key string) (*models.Setting, error) {
+	setting, err := s.loadSetting(key)
+	if err != nil {
+		log.Printf("后台刷新设置缓存失败: key=%s err=%v", key, err)
 	}
+	return setting, err
+}
 
+// SetSetting 设置/更新指定key的值
+func (s *SettingService) SetSetting(key, value string) (*models.Setting, error) {
+	return s.writeSetting(key, value, "", nil)
+}
+
+// SetSettingWithComment 设置/更新指定key的值，并在修改记录中保存修改说明
+func (s *SettingService) SetSettingWithComment(key, value, comment string) (*models.Setting, error) {
+	return s.writeSetting(key, value, comment, nil)
+}
+
+// writeSetting 写入设置的统一入口：校验、保存并追加修改记录、删除缓存、记录审计日志
+// revertedFrom 不为空时表示回滚到该版本。
+func (s *SettingService) writeSetting(key, value, comment string, revertedFrom *uint) (*models.Setting, error) {
 	// 验证key格式（只允许字母、数字、下划线、点号）
 	if !s.validateKeyFormat(key) {
-		return nil, fmt.Errorf("key格式不正确，只允许字母、数字、下划线、点号")
+		return nil, ErrSettingKeyInvalid
 	}
 
 	// 验证key长度
 	if len(key) < 1 || len(key) > 64 {
-		return nil, fmt.Errorf("key长度必须在1-64字符之间")
+		return nil, ErrSettingKeyLength
 	}
 
 	// 验证value长度（限制为10KB）
 	if len(value) > 10240 {
-		return nil, fmt.Errorf("value长度不能超过10KB")
+		return nil, ErrSettingValueTooLarge
 	}
 
-	var setting models.Setting
+	// 按设置定义校验值的类型和范围
+	if err := s.validateValue(key, value); err != nil {
+		return nil, err
+	}
 
-	// 尝试查找已存在的设置
-	err := s.DB.Where("`key` = ?", key).First(&setting).Error
-	if err == gorm.ErrRecordNotFound {
-		// 不存在，创建新设置
-		setting = models.Setting{
-			Key:   key,
-			Value: value,
+	// 远程配置的值必须是有效的配置定义，避免错误的推送影响客户端
+	if err := validateRemoteConfig(key, value); err != nil {
+		return nil, err
+	}
+
+	var setting models.Setting
+	var oldValue interface{} // 修改前的值，新建时为空
+
+	// 设置和修改记录在同一事务中写入
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		revision := models.SettingRevision{
+			Key:          key,
+			NewValue:     value,
+			Comment:      truncateString(comment, 255),
+			RevertedFrom: revertedFrom,
 		}
-		err = s.DB.Create(&setting).Error
-		if err != nil {
-			return nil, fmt.Errorf("创建设置失败: %w", err)
+		if s.client.ActorID != 0 {
+			authorID := s.client.ActorID
+			revision.AuthorID = &authorID
 		}
-	} else if err != nil {
-		return nil, fmt.Errorf("查询设置失败: %w", err)
-	} else {
-		// 存在，更新设置
-		setting.Value = value
-		err = s.DB.Save(&setting).Error
-		if err != nil {
-			return nil, fmt.Errorf("更新设置失败: %w", err)
+
+		// 尝试查找已存在的设置，加锁避免并发写入时修改记录中的旧值错乱
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("`key` = ?", key).First(&setting).Error
+		if err == gorm.ErrRecordNotFound {
+			// 不存在，创建新设置
+			setting = models.Setting{
+				Key:   key,
+				Value: value,
+			}
+			if err := tx.Create(&setting).Error; err != nil {
+				return fmt.Errorf("创建设置失败: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("查询设置失败: %w", err)
+		} else {
+			// 存在，更新设置
+			old := setting.Value
+			oldValue = old
+			revision.OldValue = &old
+			setting.Value = value
+			if err := tx.Save(&setting).Error; err != nil {
+				return fmt.Errorf("更新设置失败: %w", err)
+			}
 		}
+
+		if err := tx.Create(&revision).Error; err != nil {
+			return fmt.Errorf("保存修改记录失败: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// 删除缓存
+	// 删除缓存，包括包含该key的命名空间缓存
+	s.flight.Invalidate(key)
 	if s.Cache != nil {
-		cacheKey := s.getCacheKey(key)
-		s.Cache.Delete([]byte(cacheKey), nil)
+		s.cacheDelete(s.getCacheKey(key))
+		s.invalidatePrefixes(key)
 	}
 
+	detail := map[string]interface{}{
+		"value": FieldChange{Old: oldValue, New: value},
+	}
+	if comment != "" {
+		detail["comment"] = comment
+	}
+	if revertedFrom != nil {
+		detail["reverted_from"] = *revertedFrom
+	}
+	s.audit(AuditSettingUpdate, key, detail)
 	return &setting, nil
 }
 
 // ClearCache 清除指定key的缓存
 func (s *SettingService) ClearCache(key string) error {
+	s.flight.Invalidate(key)
 	if s.Cache != nil {
-		cacheKey := s.getCacheKey(key)
-		return s.Cache.Delete([]byte(cacheKey), nil)
+		if err := s.cacheDelete(s.getCacheKey(key)); err != nil {
+			return err
+		}
+		if err := s.invalidatePrefixes(key); err != nil {
+			return err
+		}
 	}
+	s.audit(AuditSettingCacheClear, key, nil)
 	return nil
 }
 
@@ -158,20 +264,27 @@ func (s *SettingService) ClearAllCache() error {
 		return nil
 	}
 
+	s.flight.Invalidate("")
+	s.Memory.Clear()
+
 	iter := s.Cache.NewIterator(nil, nil)
 	defer iter.Release()
 
 	for iter.Next() {
 		key := iter.Key()
-		// 只删除以"setting:"开头的缓存键
-		if len(key) > 8 && string(key[:8]) == "setting:" {
+		// 只删除单个设置和命名空间的缓存键
+		if isSettingCacheKey(string(key)) {
 			if err := s.Cache.Delete(key, nil); err != nil {
 				return fmt.Errorf("清除缓存失败: %w", err)
 			}
 		}
 	}
 
-	return iter.Error()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	s.audit(AuditSettingCacheClearAll, "", nil)
+	return nil
 }
 
 // GetCacheStats 获取缓存统计信息
@@ -185,27 +298,74 @@ func (s *SettingService) GetCacheStats() map[string]interface{} {
 
 	stats["cache_enabled"] = true
 
-	// 统计缓存中的设置数量
+	// 统计缓存中的设置数量，不存在的key和已过期但尚未清理的条目单独计数
 	count := 0
+	prefixCount := 0
+	negativeCount := 0
+	expiredCount := 0
+	now := s.clock()
 	iter := s.Cache.NewIterator(nil, nil)
 	defer iter.Release()
 
 	for iter.Next() {
-		key := iter.Key()
-		if len(key) > 8 && string(key[:8]) == "setting:" {
+		key := string(iter.Key())
+		if !isSettingCacheKey(key) {
+			continue
+		}
+		entry, ok := decodeCacheEntry(iter.Value())
+		if !ok || entry.expired(now) {
+			expiredCount++
+			continue
+		}
+		if strings.HasPrefix(key, prefixCachePrefix) {
+			prefixCount++
+		} else if isNullJSON(entry.Data) {
+			negativeCount++
+		} else {
 			count++
 		}
 	}
 
 	stats["cached_settings_count"] = count
+	stats["cached_prefixes_count"] = prefixCount
+	stats["cached_missing_count"] = negativeCount
+	stats["expired_entries_count"] = expiredCount
+	stats["disk_size_bytes"] = s.cacheDiskSize()
+	stats["ttl_seconds"] = int64(s.CacheTTL / time.Second)
+	stats["negative_ttl_seconds"] = int64(s.NegativeCacheTTL / time.Second)
+	stats["stale_ttl_seconds"] = int64(s.StaleTTL / time.Second)
+
+	// 命中统计，自服务启动起累计
+	var hits, memoryHits, negativeHits, staleHits, misses, expired uint64
+	if s.stats != nil {
+		hits = atomic.LoadUint64(&s.stats.hits)
+		memoryHits = atomic.LoadUint64(&s.stats.memoryHits)
+		negativeHits = atomic.LoadUint64(&s.stats.negativeHits)
+		staleHits = atomic.LoadUint64(&s.stats.staleHits)
+		misses = atomic.LoadUint64(&s.stats.misses)
+		expired = atomic.LoadUint64(&s.stats.expired)
+	}
+	hitRatio := 0.0
+	if hits+misses > 0 {
+		hitRatio = float64(hits) / float64(hits+misses)
+	}
+	stats["hits"] = hits
+	stats["memory_hits"] = memoryHits
+	stats["negative_hits"] = negativeHits
+	stats["stale_hits"] = staleHits
+	stats["misses"] = misses
+	stats["expired"] = expired
+	stats["hit_ratio"] = hitRatio
+
+	stats["memory_enabled"] = s.Memory != nil
+	stats["memory_entries"] = s.Memory.Len()
+	stats["evictions"] = s.Memory.Evictions()
 	return stats
 }
 
-// validateKeyMD5 验证key的MD5值（使用配置的盐值）
-func (s *SettingService) validateKeyMD5(key, keyMD5 string) bool {
-	// 计算 key + salt 的MD5值
-	expectedMD5 := fmt.Sprintf("%x", md5.Sum([]byte(key+s.Salt)))
-	return expectedMD5 == keyMD5
+// audit 记录针对设置的审计日志
+func (s *SettingService) audit(action, key string, detail interface{}) {
+	s.Audit.Record(s.client.entry(action, AuditTargetSetting, key, detail))
 }
 
 // validateKeyFormat 验证key格式（只允许字母、数字、下划线、点号）
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"ios-api/config"
+)
+
+// 短信验证码默认配置
+const (
+	DefaultSmsCodeTTL         = 5 * time.Minute
+	DefaultSmsPhoneInterval   = time.Minute
+	DefaultSmsPhoneDailyLimit = 10
+	DefaultSmsIPHourlyLimit   = 20
+	DefaultSmsMaxAttempts     = 5 // 每个验证码最多校验次数
+	smsCodeLength             = 6
+)
+
+// 自定义错误
+var (
+	ErrPhoneInvalid        = errors.New("手机号格式错误")
+	ErrSmsTooFrequent      = errors.New("验证码发送过于频繁，请稍后再试")
+	ErrSmsPhoneLimit       = errors.New("该手机号今日验证码发送次数已达上限")
+	ErrSmsIPLimit          = errors.New("当前网络发送验证码次数过多，请稍后再试")
+	ErrSmsCodeInvalid      = errors.New("验证码错误")
+	ErrSmsCodeExpired      = errors.New("验证码已过期，请重新获取")
+	ErrSmsCodeTooManyTries = errors.New("验证码错误次数过多，请重新获取")
+)
+
+var (
+	mainlandPhonePattern = regexp.MustCompile(`^1[3-9]\d{9}$`)
+	e164PhonePattern     = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+)
+
+// NormalizePhone 将手机号规范化为E.164格式，不带国家码的11位号码视为中国大陆手机号
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(phone))
+	if mainlandPhonePattern.MatchString(phone) {
+		phone = "+86" + phone
+	}
+	if !e164PhonePattern.MatchString(phone) {
+		return "", ErrPhoneInvalid
+	}
+	if strings.HasPrefix(phone, "+86") && !mainlandPhonePattern.MatchString(strings.TrimPrefix(phone, "+86")) {
+		return "", ErrPhoneInvalid
+	}
+	return phone, nil
+}
+
+// smsCodeEntry 服务端保存的验证码信息，只保存验证码摘要
+type smsCodeEntry struct {
+	Hash      []byte
+	ExpiresAt time.Time
+	Attempts  int
+}
+
+// SmsCodeService 短信验证码服务
+// 验证码保存在内存中，按手机号发送间隔、手机号每日次数和IP每小时次数限流。
+type SmsCodeService struct {
+	Sender          SmsSender
+	CodeTTL         time.Duration
+	PhoneInterval   time.Duration
+	PhoneDailyLimit int
+	IPHourlyLimit   int
+	MaxAttempts     int
+
+	mu         sync.Mutex
+	secret     []byte
+	codes      map[string]*smsCodeEntry
+	phoneSends map[string][]time.Time
+	ipSends    map[string][]time.Time
+	now        func() time.Time
+}
+
+// NewSmsCodeService 创建新的短信验证码服务
+func NewSmsCodeService(sender SmsSender, cfg *config.Config) *SmsCodeService {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+
+	service := &SmsCodeService{
+		Sender:          sender,
+		CodeTTL:         cfg.SmsCodeTTL,
+		PhoneInterval:   cfg.SmsPhoneInterval,
+		PhoneDailyLimit: cfg.SmsPhoneDailyLimit,
+		IPHourlyLimit:   cfg.SmsIPHourlyLimit,
+		MaxAttempts:     DefaultSmsMaxAttempts,
+		secret:          secret,
+		codes:           make(map[string]*smsCodeEntry),
+		phoneSends:      make(map[string][]time.Time),
+		ipSends:         make(map[string][]time.Time),
+		now:             time.Now,
+	}
+	if service.CodeTTL <= 0 {
+		service.CodeTTL = DefaultSmsCodeTTL
+	}
+	if service.PhoneInterval <= 0 {
+		service.PhoneInterval = DefaultSmsPhoneInterval
+	}
+	if service.PhoneDailyLimit <= 0 {
+		service.PhoneDailyLimit = DefaultSmsPhoneDailyLimit
+	}
+	if service.IPHourlyLimit <= 0 {
+		service.IPHourlyLimit = DefaultSmsIPHourlyLimit
+	}
+
+	return service
+}
+
+// SendCode 生成并发送验证码，phone 需为 NormalizePhone 规范化后的手机号
+func (s *SmsCodeService) SendCode(phone, ip string) error {
+	code, err := generateSmsCode()
+	if err != nil {
+		return err
+	}
+
+	// 在锁内完成限流检查和记录，发送短信不持有锁
+	s.mu.Lock()
+	now := s.now()
+	phoneSends := recentTimes(s.phoneSends[phone], now.Add(-24*time.Hour))
+	ipSends := recentTimes(s.ipSends[ip], now.Add(-time.Hour))
+
+	switch {
+	case len(phoneSends) > 0 && now.Sub(phoneSends[len(phoneSends)-1]) < s.PhoneInterval:
+		s.mu.Unlock()
+		return ErrSmsTooFrequent
+	case len(phoneSends) >= s.PhoneDailyLimit:
+		s.mu.Unlock()
+		return ErrSmsPhoneLimit
+	case len(ipSends) >= s.IPHourlyLimit:
+		s.mu.Unlock()
+		return ErrSmsIPLimit
+	}
+
+	// 发送失败也计入次数，避免借助失败请求绕过限流
+	s.phoneSends[phone] = append(phoneSends, now)
+	s.ipSends[ip] = append(ipSends, now)
+	entry := &smsCodeEntry{
+		Hash:      s.hashCode(phone, code),
+		ExpiresAt: now.Add(s.CodeTTL),
+	}
+	s.codes[phone] = entry
+	s.pruneLocked(now)
+	s.mu.Unlock()
+
+	if err := s.Sender.SendCode(phone, code); err != nil {
+		// 发送失败时作废本次验证码
+		s.mu.Lock()
+		if s.codes[phone] == entry {
+			delete(s.codes, phone)
+		}
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// VerifyCode 校验验证码，校验成功后验证码作废
+func (s *SmsCodeService) VerifyCode(phone, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.codes[phone]
+	if !ok {
+		return ErrSmsCodeInvalid
+	}
+
+	if s.now().After(entry.ExpiresAt) {
+		delete(s.codes, phone)
+		return ErrSmsCodeExpired
+	}
+
+	if !hmac.Equal(entry.Hash, s.hashCode(phone, code)) {
+		entry.Attempts++
+		if entry.Attempts >= s.MaxAttempts {
+			// 防止暴力猜测验证码
+			delete(s.codes, phone)
+			return ErrSmsCodeTooManyTries
+		}
+		return ErrSmsCodeInvalid
+	}
+
+	delete(s.codes, phone)
+	return nil
+}
+
+// SetClock 设置时钟函数（用于测试）
+func (s *SmsCodeService) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// hashCode 计算验证码摘要
+func (s *SmsCodeService) hashCode(phone, code string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(phone + ":" + code))
+	return mac.Sum(nil)
+}
+
+// pruneLocked 清理过期的验证码和限流记录（调用方需持有锁）
+func (s *SmsCodeService) pruneLocked(now time.Time) {
+	for phone, entry := range s.codes {
+		if now.After(entry.ExpiresAt) {
+			delete(s.codes, phone)
+		}
+	}
+	for phone, sends := range s.phoneSends {
+		if len(recentTimes(sends, now.Add(-24*time.Hour))) == 0 {
+			delete(s.phoneSends, phone)
+		}
+	}
+	for ip, sends := range s.ipSends {
+		if len(recentTimes(sends, now.Add(-time.Hour))) == 0 {
+			delete(s.ipSends, ip)
+		}
+	}
+}
+
+// recentTimes 返回晚于指定时间的记录
+func recentTimes(times []time.Time, since time.Time) []time.Time {
+	for i, t := range times {
+		if t.After(since) {
+			return times[i:]
+		}
+	}
+	return nil
+}
+
+// generateSmsCode 生成6位数字验证码
+func generateSmsCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", smsCodeLength, n.Int64()), nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"ios-api/config"
+)
+
+// 短信服务商
+const (
+	SmsProviderLog     = "log"
+	SmsProviderAliyun  = "aliyun"
+	SmsProviderTencent = "tencent"
+)
+
+// 自定义错误
+var (
+	ErrSmsSendFailed    = errors.New("短信发送失败")
+	ErrSmsNotConfigured = errors.New("短信服务未配置")
+)
+
+// SmsSender 短信验证码发送接口
+type SmsSender interface {
+	// SendCode 向E.164格式的手机号发送验证码
+	SendCode(phone, code string) error
+}
+
+// NewSmsSender 根据配置创建短信发送器
+// 未配置服务商时只写日志，非开发环境已由 Config.Validate 拒绝。
+func NewSmsSender(cfg *config.Config) (SmsSender, error) {
+	switch cfg.SmsProvider {
+	case "", SmsProviderLog:
+		return &LogSmsSender{}, nil
+	case SmsProviderAliyun:
+		sender := NewAliyunSmsSender(cfg)
+		if sender.AccessKeyID == "" || sender.AccessKeySecret == "" || sender.SignName == "" || sender.TemplateCode == "" {
+			return nil, fmt.Errorf("%w: 阿里云短信缺少AccessKey、签名或模板", ErrSmsNotConfigured)
+		}
+		return sender, nil
+	case SmsProviderTencent:
+		sender := NewTencentSmsSender(cfg)
+		if sender.SecretID == "" || sender.SecretKey == "" || sender.AppID == "" || sender.SignName == "" || sender.TemplateID == "" {
+			return nil, fmt.Errorf("%w: 腾讯云短信缺少密钥、应用ID、签名或模板", ErrSmsNotConfigured)
+		}
+		return sender, nil
+	default:
+		return nil, fmt.Errorf("%w: 不支持的短信服务商 %s", ErrSmsNotConfigured, cfg.SmsProvider)
+	}
+}
+
+// LogSmsSender 只记录日志不发送短信的发送器，用于开发和测试
+type LogSmsSender struct {
+	mu    sync.Mutex
+	codes map[string]string
+}
+
+// SendCode 将验证码写入日志
+func (s *LogSmsSender) SendCode(phone, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.codes == nil {
+		s.codes = make(map[string]string)
+	}
+	s.codes[phone] = code
+
+	log.Printf("短信验证码（未实际发送）: phone=%s code=%s", phone, code)
+	return nil
+}
+
+// LastCode 获取最近发送到指定手机号的验证码
+func (s *LogSmsSender) LastCode(phone string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.codes[phone]
+}
+
+// mainlandPhone 将中国大陆手机号转换为不带国家码的11位号码，其他号码去掉"+"
+func mainlandPhone(phone string) string {
+	if strings.HasPrefix(phone, "+86") {
+		return strings.TrimPrefix(phone, "+86")
+	}
+	return strings.TrimPrefix(phone, "+")
+}
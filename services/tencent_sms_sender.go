@@ -0,0 +1,173 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ios-api/config"
+)
+
+// 腾讯云短信接口默认配置
+const (
+	DefaultTencentSmsEndpoint = "https://sms.tencentcloudapi.com"
+	DefaultTencentSmsRegion   = "ap-guangzhou"
+)
+
+// TencentSmsSender 腾讯云短信发送器（SendSms 2021-01-11，TC3-HMAC-SHA256签名）
+type TencentSmsSender struct {
+	SecretID   string
+	SecretKey  string
+	AppID      string // 短信应用 SdkAppId
+	SignName   string
+	TemplateID string       // 模板的第一个参数为验证码
+	Region     string       // 地域，默认 ap-guangzhou
+	Endpoint   string       // 接口地址，默认 https://sms.tencentcloudapi.com
+	Client     *http.Client // HTTP客户端，为空时使用默认客户端
+}
+
+// NewTencentSmsSender 创建新的腾讯云短信发送器
+func NewTencentSmsSender(cfg *config.Config) *TencentSmsSender {
+	return &TencentSmsSender{
+		SecretID:   cfg.TencentSmsSecretID,
+		SecretKey:  cfg.TencentSmsSecretKey,
+		AppID:      cfg.TencentSmsAppID,
+		SignName:   cfg.TencentSmsSignName,
+		TemplateID: cfg.TencentSmsTemplateID,
+		Region:     cfg.TencentSmsRegion,
+		Endpoint:   cfg.TencentSmsEndpoint,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// tencentSmsResponse 腾讯云短信接口响应
+type tencentSmsResponse struct {
+	Response struct {
+		SendStatusSet []struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"SendStatusSet"`
+		Error *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+		RequestID string `json:"RequestId"`
+	} `json:"Response"`
+}
+
+// endpoint 获取接口地址
+func (s *TencentSmsSender) endpoint() string {
+	if s.Endpoint == "" {
+		return DefaultTencentSmsEndpoint
+	}
+	return strings.TrimRight(s.Endpoint, "/")
+}
+
+// region 获取地域
+func (s *TencentSmsSender) region() string {
+	if s.Region == "" {
+		return DefaultTencentSmsRegion
+	}
+	return s.Region
+}
+
+// httpClient 获取HTTP客户端
+func (s *TencentSmsSender) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// SendCode 发送验证码短信
+func (s *TencentSmsSender) SendCode(phone, code string) error {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"PhoneNumberSet":   []string{phone},
+		"SmsSdkAppId":      s.AppID,
+		"SignName":         s.SignName,
+		"TemplateId":       s.TemplateID,
+		"TemplateParamSet": []string{code},
+	})
+
+	endpoint, err := url.Parse(s.endpoint())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSmsSendFailed, err)
+	}
+
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.String()+"/", strings.NewReader(string(payload)))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSmsSendFailed, err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-TC-Action", "SendSms")
+	req.Header.Set("X-TC-Version", "2021-01-11")
+	req.Header.Set("X-TC-Region", s.region())
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("Authorization", TencentAuthorization(s.SecretID, s.SecretKey, "sms", endpoint.Host, timestamp, payload))
+
+	var resp tencentSmsResponse
+	if _, err := doJSON(s.httpClient(), req, &resp); err != nil {
+		return fmt.Errorf("%w: %v", ErrSmsSendFailed, err)
+	}
+	if resp.Response.Error != nil {
+		return fmt.Errorf("%w: %s %s", ErrSmsSendFailed, resp.Response.Error.Code, resp.Response.Error.Message)
+	}
+	if len(resp.Response.SendStatusSet) == 0 || resp.Response.SendStatusSet[0].Code != "Ok" {
+		message := "响应中缺少发送状态"
+		if len(resp.Response.SendStatusSet) > 0 {
+			message = resp.Response.SendStatusSet[0].Code + " " + resp.Response.SendStatusSet[0].Message
+		}
+		return fmt.Errorf("%w: %s", ErrSmsSendFailed, message)
+	}
+
+	return nil
+}
+
+// TencentAuthorization 计算腾讯云API 3.0的TC3-HMAC-SHA256签名请求头
+func TencentAuthorization(secretID, secretKey, service, host string, timestamp int64, payload []byte) string {
+	const signedHeaders = "content-type;host"
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodPost,
+		"/",
+		"",
+		"content-type:application/json; charset=utf-8\nhost:" + host + "\n",
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	credentialScope := date + "/" + service + "/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(timestamp, 10) + "\n" + credentialScope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	return fmt.Sprintf("TC3-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", secretID, credentialScope, signedHeaders, signature)
+}
+
+// sha256Hex 计算SHA256并以十六进制编码
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 计算HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
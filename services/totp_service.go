@@ -0,0 +1,476 @@
+package services
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ios-api/config"
+	"ios-api/models"
+	"ios-api/utils"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 两步验证默认参数
+const (
+	DefaultMFAChallengeTTL   = 5 * time.Minute  // 登录第二步的有效期
+	DefaultMFAMaxAttempts    = 5                // 每个挑战令牌最多尝试次数
+	DefaultMFAMaxFailures    = 10               // 同一用户连续失败多少次后锁定
+	DefaultMFALockDuration   = 15 * time.Minute // 连续失败后锁定的时间
+	MaxMFAChallenges         = 100000           // 最多同时保存的挑战令牌数量
+	DefaultMFARecoveryCodes  = 10               // 每次生成的恢复码数量
+	mfaRecoveryCodeByteCount = 8                // 恢复码随机字节数
+)
+
+// 自定义错误
+var (
+	ErrTOTPNotConfigured    = errors.New("未配置两步验证")
+	ErrTOTPPasswordRequired = errors.New("仅邮箱密码账号可以开启两步验证")
+	ErrTOTPAlreadyEnabled   = errors.New("两步验证已开启")
+	ErrTOTPNotEnrolled      = errors.New("请先获取两步验证密钥")
+	ErrTOTPNotEnabled       = errors.New("两步验证未开启")
+	ErrTOTPCodeInvalid      = errors.New("两步验证码错误")
+	ErrMFARequired          = errors.New("需要完成两步验证")
+	ErrMFAChallengeInvalid  = errors.New("无效或已过期的两步验证令牌")
+	ErrMFATooManyTries      = errors.New("两步验证码错误次数过多，请重新登录")
+	ErrMFALocked            = errors.New("两步验证码错误次数过多，请稍后再试")
+)
+
+// 两步验证登录参数
+type MFALoginParams struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP验证码或恢复码
+}
+
+// 确认开启两步验证参数
+type TOTPConfirmParams struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// 关闭两步验证参数
+type TOTPDisableParams struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TOTPEnrollment 开启两步验证时返回给客户端的密钥信息
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFARequiredError 密码校验通过但账号开启了两步验证，携带登录第二步使用的挑战令牌
+type MFARequiredError struct {
+	Token     string
+	ExpiresIn time.Duration
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+// Unwrap 支持 errors.Is(err, ErrMFARequired)
+func (e *MFARequiredError) Unwrap() error {
+	return ErrMFARequired
+}
+
+// mfaChallenge 登录第二步的挑战
+type mfaChallenge struct {
+	Token     string
+	UserID    uint
+	Attempts  int
+	ExpiresAt time.Time
+}
+
+// TOTPService 两步验证（TOTP）服务
+// 密钥使用令牌加密器加密后保存在用户表中，恢复码只保存哈希；
+// 登录第二步的挑战令牌保存在内存中，超过有效期或尝试次数后失效；令牌按过期时间顺序记录，
+// 数量达到上限时淘汰最早的令牌。每个令牌的尝试次数之外，同一用户的连续失败次数记录在用户表中，
+// 达到 MaxFailures 后锁定 LockDuration，重新密码登录获取新令牌也不能继续尝试。
+type TOTPService struct {
+	DB            *gorm.DB
+	Cipher        *utils.TokenCipher
+	Issuer        string        // 验证器App中显示的服务名称
+	ChallengeTTL  time.Duration // 挑战令牌有效期
+	MaxAttempts   int           // 每个挑战令牌最多尝试次数
+	MaxFailures   int           // 同一用户连续失败多少次后锁定
+	LockDuration  time.Duration // 锁定时间
+	MaxChallenges int           // 最多同时保存的挑战令牌数量
+
+	mu         sync.Mutex
+	challenges map[string]*list.Element // 挑战令牌 -> order中的元素
+	order      *list.List               // 挑战令牌，按过期时间排序（有效期固定，即生成顺序）
+	now        func() time.Time
+}
+
+// NewTOTPService 创建新的两步验证服务
+func NewTOTPService(db *gorm.DB, cipher *utils.TokenCipher, cfg *config.Config) *TOTPService {
+	return &TOTPService{
+		DB:            db,
+		Cipher:        cipher,
+		Issuer:        cfg.TOTPIssuer,
+		ChallengeTTL:  DefaultMFAChallengeTTL,
+		MaxAttempts:   DefaultMFAMaxAttempts,
+		MaxFailures:   DefaultMFAMaxFailures,
+		LockDuration:  DefaultMFALockDuration,
+		MaxChallenges: MaxMFAChallenges,
+		challenges:    make(map[string]*list.Element),
+		order:         list.New(),
+		now:           time.Now,
+	}
+}
+
+// SetClock 替换时间来源（用于测试）
+func (s *TOTPService) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// BeginEnrollment 生成新的TOTP密钥，确认前不生效；重复调用会替换未确认的密钥
+func (s *TOTPService) BeginEnrollment(userID uint) (*TOTPEnrollment, error) {
+	if s.Cipher == nil {
+		return nil, ErrTOTPNotConfigured
+	}
+
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Password == "" || user.Email == "" {
+		return nil, ErrTOTPPasswordRequired
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.Cipher.Encrypt(secret, utils.CipherAAD("users", userID, "totp_secret"))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":    encrypted,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: TOTPURI(s.Issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment 使用验证器App生成的第一个验证码确认开启两步验证，返回一次性展示的恢复码
+func (s *TOTPService) ConfirmEnrollment(userID uint, code string) ([]string, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	secret, err := s.decryptSecret(user)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := VerifyTOTP(secret, strings.TrimSpace(code), s.currentTime(), user.TOTPLastStep)
+	if !ok {
+		return nil, ErrTOTPCodeInvalid
+	}
+
+	codes, hashes, err := generateRecoveryCodes(DefaultMFARecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		records := make([]models.MFARecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			records = append(records, models.MFARecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Disable 重新输入密码后关闭两步验证，同时删除密钥和恢复码
+func (s *TOTPService) Disable(userID uint, password string) error {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return ErrInvalidPassword
+	}
+	if !user.TOTPEnabled && user.TOTPSecret == "" {
+		return ErrTOTPNotEnabled
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    nil,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+	})
+}
+
+// NewChallenge 密码校验通过后为用户创建登录第二步的挑战令牌
+func (s *TOTPService) NewChallenge(userID uint) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	// 顺带清理过期挑战，已满时淘汰最早的挑战
+	s.pruneLocked(now)
+	for s.order.Len() >= s.MaxChallenges {
+		s.removeLocked(s.order.Front())
+	}
+	s.challenges[token] = s.order.PushBack(&mfaChallenge{
+		Token:     token,
+		UserID:    userID,
+		ExpiresAt: now.Add(s.ChallengeTTL),
+	})
+	return token, nil
+}
+
+// VerifyChallenge 校验挑战令牌和验证码（TOTP验证码或恢复码），成功后令牌失效并返回用户ID
+func (s *TOTPService) VerifyChallenge(token, code string) (uint, error) {
+	userID, err := s.takeAttempt(token)
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := s.getUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	if !user.TOTPEnabled {
+		// 挑战发出后两步验证被关闭，要求重新登录
+		s.dropChallenge(token)
+		return 0, ErrMFAChallengeInvalid
+	}
+	if user.TOTPLockedUntil != nil && s.currentTime().Before(*user.TOTPLockedUntil) {
+		s.dropChallenge(token)
+		return 0, ErrMFALocked
+	}
+
+	if err := s.verifyCode(user, strings.TrimSpace(code)); err != nil {
+		if errors.Is(err, ErrTOTPCodeInvalid) {
+			return 0, s.recordFailure(user, token)
+		}
+		return 0, err
+	}
+
+	if user.TOTPFailures > 0 || user.TOTPLockedUntil != nil {
+		if err := s.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"totp_failures":     0,
+			"totp_locked_until": nil,
+		}).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	s.dropChallenge(token)
+	return userID, nil
+}
+
+// recordFailure 记录用户一次验证失败，连续失败达到上限时锁定并作废挑战令牌
+func (s *TOTPService) recordFailure(user *models.User, token string) error {
+	if user.TOTPFailures+1 < s.MaxFailures {
+		if err := s.DB.Model(&models.User{}).Where("id = ?", user.ID).
+			Update("totp_failures", gorm.Expr("totp_failures + 1")).Error; err != nil {
+			return err
+		}
+		return ErrTOTPCodeInvalid
+	}
+
+	if err := s.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_failures":     0,
+		"totp_locked_until": s.currentTime().Add(s.LockDuration),
+	}).Error; err != nil {
+		return err
+	}
+	s.dropChallenge(token)
+	return ErrMFALocked
+}
+
+// verifyCode 校验TOTP验证码，不是6位数字时按恢复码校验
+func (s *TOTPService) verifyCode(user *models.User, code string) error {
+	if len(code) == TOTPDigits && strings.Trim(code, "0123456789") == "" {
+		secret, err := s.decryptSecret(user)
+		if err != nil {
+			return err
+		}
+		step, ok := VerifyTOTP(secret, code, s.currentTime(), user.TOTPLastStep)
+		if !ok {
+			return ErrTOTPCodeInvalid
+		}
+		// 条件更新保证并发请求中同一验证码只有一个能成功
+		result := s.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTOTPCodeInvalid
+		}
+		return nil
+	}
+
+	result := s.DB.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, HashRecoveryCode(code)).
+		Update("used_at", s.currentTime())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeInvalid
+	}
+	return nil
+}
+
+// takeAttempt 记录一次尝试，令牌不存在、已过期或次数用尽时返回错误
+func (s *TOTPService) takeAttempt(token string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.challenges[token]
+	if !ok {
+		return 0, ErrMFAChallengeInvalid
+	}
+	challenge := elem.Value.(*mfaChallenge)
+	if s.now().After(challenge.ExpiresAt) {
+		s.removeLocked(elem)
+		return 0, ErrMFAChallengeInvalid
+	}
+	if challenge.Attempts >= s.MaxAttempts {
+		s.removeLocked(elem)
+		return 0, ErrMFATooManyTries
+	}
+	challenge.Attempts++
+	return challenge.UserID, nil
+}
+
+// dropChallenge 删除挑战令牌
+func (s *TOTPService) dropChallenge(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.challenges[token]; ok {
+		s.removeLocked(elem)
+	}
+}
+
+// pruneLocked 从队首删除已过期的挑战（调用方需持有锁）
+func (s *TOTPService) pruneLocked(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		if !now.After(elem.Value.(*mfaChallenge).ExpiresAt) {
+			return
+		}
+		s.removeLocked(elem)
+	}
+}
+
+// removeLocked 删除一个挑战（调用方需持有锁）
+func (s *TOTPService) removeLocked(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.challenges, elem.Value.(*mfaChallenge).Token)
+}
+
+func (s *TOTPService) currentTime() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now()
+}
+
+func (s *TOTPService) getUser(userID uint) (*models.User, error) {
+	var user models.User
+	if err := s.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *TOTPService) decryptSecret(user *models.User) (string, error) {
+	if s.Cipher == nil {
+		return "", ErrTOTPNotConfigured
+	}
+	secret, err := s.Cipher.Decrypt(user.TOTPSecret, utils.CipherAAD("users", user.ID, "totp_secret"))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrTOTPNotConfigured, err)
+	}
+	return secret, nil
+}
+
+// NormalizeRecoveryCode 规范化恢复码：忽略大小写、空格和连字符
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// HashRecoveryCode 计算规范化后恢复码的SHA-256哈希
+// 恢复码为64位随机数，无需使用慢哈希
+func HashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(NormalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes 生成恢复码（格式 xxxx-xxxx-xxxx-xxxx）及其哈希
+func generateRecoveryCodes(count int) ([]string, []string, error) {
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		buf := make([]byte, mfaRecoveryCodeByteCount)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		h := hex.EncodeToString(buf)
+		code := h[0:4] + "-" + h[4:8] + "-" + h[8:12] + "-" + h[12:16]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
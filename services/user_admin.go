@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"ios-api/models"
+
+	"gorm.io/gorm"
+)
+
+// 用户列表分页
+const (
+	DefaultUserPageSize = 20
+	MaxUserPageSize     = 100
+)
+
+// 自定义错误
+var (
+	ErrUserBanned        = errors.New("账号已被封禁")
+	ErrUserAlreadyBanned = errors.New("用户已被封禁")
+	ErrUserNotBanned     = errors.New("用户未被封禁")
+)
+
+// UserSearchParams 管理后台用户搜索参数，条件之间为且的关系
+type UserSearchParams struct {
+	Query          string `form:"q"`                // 模糊匹配邮箱、昵称、手机号
+	Email          string `form:"email"`            // 邮箱（模糊匹配）
+	Nickname       string `form:"nickname"`         // 昵称（模糊匹配）
+	Phone          string `form:"phone"`            // 手机号（模糊匹配）
+	Provider       string `form:"provider"`         // 第三方登录提供方
+	ProviderUserID string `form:"provider_user_id"` // 第三方用户ID（精确匹配）
+	Banned         *bool  `form:"banned"`           // 是否已封禁
+	Page           int    `form:"page"`
+	PageSize       int    `form:"page_size"`
+}
+
+// AdminUpdateUserParams 管理后台修改用户资料参数，字段为空表示不修改，空字符串表示清空
+type AdminUpdateUserParams struct {
+	Nickname  *string `json:"nickname" binding:"omitempty,max=255"`
+	Avatar    *string `json:"avatar" binding:"omitempty,max=255"`
+	Signature *string `json:"signature"`
+}
+
+// SessionInfo 会话信息（不包含令牌）
+type SessionInfo struct {
+	ID        uint       `json:"id"`
+	ExpiredAt *time.Time `json:"expired_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserDetail 管理后台用户详情
+type UserDetail struct {
+	User          *models.User          `json:"user"`
+	Sessions      []SessionInfo         `json:"sessions"`
+	OAuthAccounts []models.OAuthAccount `json:"oauth_accounts"`
+}
+
+// SearchUsers 搜索用户，返回当前页的用户和总数
+func (s *UserService) SearchUsers(params UserSearchParams) ([]models.User, int64, error) {
+	query := s.DB.Model(&models.User{})
+	if params.Query != "" {
+		like := likePattern(params.Query)
+		query = query.Where("email LIKE ? OR nickname LIKE ? OR phone LIKE ?", like, like, like)
+	}
+	if params.Email != "" {
+		query = query.Where("email LIKE ?", likePattern(params.Email))
+	}
+	if params.Nickname != "" {
+		query = query.Where("nickname LIKE ?", likePattern(params.Nickname))
+	}
+	if params.Phone != "" {
+		query = query.Where("phone LIKE ?", likePattern(params.Phone))
+	}
+	if params.Provider != "" || params.ProviderUserID != "" {
+		accounts := s.DB.Model(&models.OAuthAccount{}).Select("user_id")
+		if params.Provider != "" {
+			accounts = accounts.Where("provider = ?", params.Provider)
+		}
+		if params.ProviderUserID != "" {
+			accounts = accounts.Where("provider_user_id = ?", params.ProviderUserID)
+		}
+		query = query.Where("id IN (?)", accounts)
+	}
+	if params.Banned != nil {
+		if *params.Banned {
+			query = query.Where("banned_at IS NOT NULL")
+		} else {
+			query = query.Where("banned_at IS NULL")
+		}
+	}
+
+	// 同一查询条件用于统计总数和分页查询
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	page, pageSize := normalizePage(params.Page, params.PageSize)
+	users := []models.User{}
+	if err := query.Order("id DESC").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// GetUserDetail 获取用户详情，包含未过期的会话和第三方账号绑定
+func (s *UserService) GetUserDetail(userID uint) (*UserDetail, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []SessionInfo{}
+	if err := s.DB.Model(&models.UserSession{}).
+		Where("user_id = ? AND (expired_at IS NULL OR expired_at > ?)", userID, time.Now()).
+		Order("id DESC").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	accounts := []models.OAuthAccount{}
+	if err := s.DB.Where("user_id = ?", userID).Order("id").Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+
+	return &UserDetail{User: user, Sessions: sessions, OAuthAccounts: accounts}, nil
+}
+
+// AdminUpdateUser 管理后台修改用户资料，返回修改后的用户和字段变更
+func (s *UserService) AdminUpdateUser(userID uint, params AdminUpdateUserParams) (*models.User, map[string]FieldChange, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := map[string]interface{}{}
+	changes := map[string]FieldChange{}
+	setField := func(column string, current string, value *string) {
+		if value != nil && *value != current {
+			updates[column] = *value
+			changes[column] = FieldChange{Old: current, New: *value}
+		}
+	}
+	setField("nickname", user.Nickname, params.Nickname)
+	setField("avatar", user.Avatar, params.Avatar)
+	setField("signature", user.Signature, params.Signature)
+
+	if len(updates) > 0 {
+		if err := s.DB.Model(user).Updates(updates).Error; err != nil {
+			return nil, nil, err
+		}
+		if user, err = s.GetUserByID(userID); err != nil {
+			return nil, nil, err
+		}
+	}
+	return user, changes, nil
+}
+
+// BanUser 封禁用户：禁止登录并撤销所有会话，返回撤销的会话数
+func (s *UserService) BanUser(userID uint, reason string) (int64, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	if user.IsBanned() {
+		return 0, ErrUserAlreadyBanned
+	}
+
+	if err := s.DB.Model(user).Updates(map[string]interface{}{
+		"banned_at":  time.Now(),
+		"ban_reason": reason,
+	}).Error; err != nil {
+		return 0, err
+	}
+	return s.RevokeUserSessions(userID)
+}
+
+// UnbanUser 解除封禁
+func (s *UserService) UnbanUser(userID uint) error {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.IsBanned() {
+		return ErrUserNotBanned
+	}
+
+	return s.DB.Model(user).Updates(map[string]interface{}{
+		"banned_at":  nil,
+		"ban_reason": nil,
+	}).Error
+}
+
+// RevokeSession 撤销用户的指定会话，审计日志由调用方记录
+func (s *UserService) RevokeSession(userID, sessionID uint) error {
+	var session models.UserSession
+	if err := s.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+
+	result := s.DB.Delete(&session)
+	s.Sessions.Invalidate(sessionCacheKey(session.Token))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// isBanned 查询用户是否已被封禁，用户不存在时视为未封禁
+func (s *UserService) isBanned(userID uint) (bool, error) {
+	var count int64
+	if err := s.DB.Model(&models.User{}).
+		Where("id = ? AND banned_at IS NOT NULL", userID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// normalizePage 规范化分页参数
+func normalizePage(page, pageSize int) (int, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultUserPageSize
+	}
+	if pageSize > MaxUserPageSize {
+		pageSize = MaxUserPageSize
+	}
+	return page, pageSize
+}
+
+// likeEscaper 转义LIKE模式中的通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// likePattern 生成包含匹配的LIKE模式，转义通配符
+func likePattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
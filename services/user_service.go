@@ -1,11 +1,17 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"log"
+	"strconv"
 	"time"
 
 	"ios-api/config"
 	"ios-api/models"
+	"ios-api/utils"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
@@ -14,9 +20,25 @@ import (
 
 // UserService 用户服务
 type UserService struct {
-	DB        *gorm.DB
-	JWTSecret string
-	Config    *config.Config
+	DB          *gorm.DB
+	JWTSecret   string
+	Config      *config.Config
+	TokenCipher *utils.TokenCipher // 第三方令牌加密器，为空时不保存第三方令牌
+	MFA         *TOTPService       // 两步验证服务
+	Keys        *JWTKeySet         // JWT签名密钥集合，为空时使用JWTSecret进行HS256签名
+	Sessions    *SessionCache      // 会话有效性缓存，为空时每次验证都查询数据库
+	Audit       *AuditService      // 审计日志服务，为空时不记录
+
+	client ClientInfo // 当前请求的客户端信息，通过 WithClient 设置
+}
+
+// tokenTTL 登录令牌有效期
+const tokenTTL = time.Hour * 24 * 7
+
+// TokenClaims 登录令牌的载荷，jti为会话ID
+type TokenClaims struct {
+	UserID uint `json:"user_id"`
+	jwt.RegisteredClaims
 }
 
 // 用户注册参数
@@ -32,13 +54,29 @@ type LoginParams struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// 发送短信验证码参数
+type SendSmsCodeParams struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// 短信验证码登录参数
+type SmsLoginParams struct {
+	Phone string `json:"phone" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
 // 第三方登录参数
 type OAuthLoginParams struct {
 	Provider       string `json:"provider" binding:"required"`
 	ProviderUserID string `json:"provider_user_id" binding:"required"`
+	UnionID        string `json:"union_id"`
 	Nickname       string `json:"nickname"`
 	Avatar         string `json:"avatar"`
 	Email          string `json:"email"`
+	// 第三方令牌仅由服务端授权流程填充，不接受客户端传入
+	AccessToken    string     `json:"-"`
+	RefreshToken   string     `json:"-"`
+	TokenExpiresAt *time.Time `json:"-"`
 }
 
 // 更新用户信息参数
@@ -59,24 +97,51 @@ var (
 	ErrSessionNotFound = errors.New("会话不存在")
 )
 
-// 生成JWT
+// keySet 获取JWT密钥集合，未配置时使用JWTSecret进行HS256签名
+func (s *UserService) keySet() *JWTKeySet {
+	if s.Keys != nil {
+		return s.Keys
+	}
+	return NewHS256KeySet(s.JWTSecret)
+}
+
+// 生成JWT，已封禁的用户不能创建会话
 func (s *UserService) GenerateToken(userID uint) (string, error) {
-	// 创建一个token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24 * 7).Unix(), // 7天过期
-	})
+	banned, err := s.isBanned(userID)
+	if err != nil {
+		return "", err
+	}
+	if banned {
+		return "", ErrUserBanned
+	}
+
+	// 会话ID
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	jti := hex.EncodeToString(buf)
+
+	now := time.Now()
+	expiredAt := now.Add(tokenTTL) // 7天过期
 
 	// 签名并获得完整的编码后的字符串token
-	tokenString, err := token.SignedString([]byte(s.JWTSecret))
+	tokenString, err := s.keySet().Sign(TokenClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiredAt),
+		},
+	})
 	if err != nil {
 		return "", err
 	}
 
 	// 保存会话
-	expiredAt := time.Now().Add(time.Hour * 24 * 7)
 	session := models.UserSession{
 		UserID:    userID,
+		JTI:       &jti,
 		Token:     tokenString,
 		ExpiredAt: &expiredAt,
 	}
@@ -120,6 +185,7 @@ func (s *UserService) Register(params RegisterParams) (*models.User, string, err
 		return nil, "", err
 	}
 
+	s.audit(AuditUserRegister, user.ID, map[string]string{"method": "email"})
 	return &user, token, nil
 }
 
@@ -129,6 +195,7 @@ func (s *UserService) Login(params LoginParams) (*models.User, string, error) {
 	var user models.User
 	if err := s.DB.Where("email = ?", params.Email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.auditLoginFailed(0, params.Email, ErrUserNotFound)
 			return nil, "", ErrUserNotFound
 		}
 		return nil, "", err
@@ -136,44 +203,166 @@ func (s *UserService) Login(params LoginParams) (*models.User, string, error) {
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(params.Password)); err != nil {
+		s.auditLoginFailed(user.ID, params.Email, ErrInvalidPassword)
 		return nil, "", ErrInvalidPassword
 	}
 
+	// 密码正确后再提示封禁，避免泄露账号状态
+	if user.IsBanned() {
+		s.auditLoginFailed(user.ID, params.Email, ErrUserBanned)
+		return nil, "", ErrUserBanned
+	}
+
+	// 已开启两步验证时不创建会话，返回登录第二步使用的挑战令牌
+	if user.TOTPEnabled {
+		if s.MFA == nil {
+			return nil, "", ErrTOTPNotConfigured
+		}
+		challenge, err := s.MFA.NewChallenge(user.ID)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, "", &MFARequiredError{Token: challenge, ExpiresIn: s.MFA.ChallengeTTL}
+	}
+
 	// 生成token
 	token, err := s.GenerateToken(user.ID)
 	if err != nil {
 		return nil, "", err
 	}
 
+	s.RecordLogin(user.ID, "password")
+	return &user, token, nil
+}
+
+// SmsLogin 手机号验证码登录，手机号未注册时自动创建用户
+// phone 需为已通过验证码校验的规范化手机号
+func (s *UserService) SmsLogin(phone string) (*models.User, string, error) {
+	var user models.User
+	created := false
+	err := s.DB.Where("phone = ?", phone).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		user = models.User{
+			Phone:    phone,
+			Nickname: "用户" + phone[len(phone)-4:],
+		}
+		created = true
+		if err = s.DB.Create(&user).Error; err != nil {
+			// 并发注册同一手机号时唯一索引冲突，改为读取已创建的用户
+			if findErr := s.DB.Where("phone = ?", phone).First(&user).Error; findErr != nil {
+				return nil, "", err
+			}
+			created = false
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 生成token
+	token, err := s.GenerateToken(user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if created {
+		s.audit(AuditUserRegister, user.ID, map[string]string{"method": "sms"})
+	}
+	s.RecordLogin(user.ID, "sms")
 	return &user, token, nil
 }
 
 // OAuthLogin 第三方登录
+// 优先按提供商用户ID查找绑定；提供了UnionID时，再按UnionID查找同一开放平台下其他应用的绑定，
+// 找到则为当前OpenID追加绑定到同一用户，实现跨应用账号合并。
 func (s *UserService) OAuthLogin(params OAuthLoginParams) (*models.User, string, error) {
+	user, token, created, err := s.oauthLogin(params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.audit(AuditUserOAuthLogin, user.ID, map[string]interface{}{
+		"provider":         params.Provider,
+		"provider_user_id": params.ProviderUserID,
+		"new_user":         created,
+	})
+	return user, token, nil
+}
+
+// oauthLogin 第三方登录，created 表示是否创建了新用户
+func (s *UserService) oauthLogin(params OAuthLoginParams) (*models.User, string, bool, error) {
 	var oauthAccount models.OAuthAccount
 	tx := s.DB.Begin()
 
 	// 查找第三方账号是否已存在
 	if err := tx.Where("provider = ? AND provider_user_id = ?", params.Provider, params.ProviderUserID).First(&oauthAccount).Error; err == nil {
-		// 账号已存在，查找对应的用户
-		var user models.User
-		if err := tx.First(&user, oauthAccount.UserID).Error; err != nil {
+		updates, err := s.oauthTokenUpdates(oauthAccount.ID, params)
+		if err != nil {
 			tx.Rollback()
-			return nil, "", err
+			return nil, "", false, err
 		}
 
-		// 生成token
-		token, err := s.GenerateToken(user.ID)
-		if err != nil {
-			tx.Rollback()
-			return nil, "", err
+		// 旧绑定缺少UnionID时补齐，便于后续跨应用合并
+		// 同一UnionID已绑定到其他用户时不补齐，否则按UnionID合并时会登录到最早绑定的那个用户，需人工合并账号
+		if params.UnionID != "" && oauthAccount.UnionID == "" {
+			var conflicts int64
+			if err := tx.Model(&models.OAuthAccount{}).
+				Where("provider = ? AND union_id = ? AND user_id <> ?", params.Provider, params.UnionID, oauthAccount.UserID).
+				Count(&conflicts).Error; err != nil {
+				tx.Rollback()
+				return nil, "", false, err
+			}
+			if conflicts == 0 {
+				updates["union_id"] = params.UnionID
+			} else {
+				log.Printf("UnionID %s 已绑定到其他用户，未为用户 %d 的 %s 绑定补齐", params.UnionID, oauthAccount.UserID, params.Provider)
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&oauthAccount).Updates(updates).Error; err != nil {
+				tx.Rollback()
+				return nil, "", false, err
+			}
 		}
 
-		tx.Commit()
-		return &user, token, nil
+		user, token, err := s.loginBoundUser(tx, oauthAccount.UserID)
+		return user, token, false, err
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		tx.Rollback()
-		return nil, "", err
+		return nil, "", false, err
+	}
+
+	// 按UnionID查找同一开放平台下其他应用的绑定
+	if params.UnionID != "" {
+		var unionAccount models.OAuthAccount
+		if err := tx.Where("provider = ? AND union_id = ?", params.Provider, params.UnionID).Order("id").First(&unionAccount).Error; err == nil {
+			// 为当前OpenID追加绑定到已有用户
+			oauthAccount = models.OAuthAccount{
+				UserID:         unionAccount.UserID,
+				Provider:       params.Provider,
+				ProviderUserID: params.ProviderUserID,
+				UnionID:        params.UnionID,
+				Email:          params.Email,
+				SyncedNickname: params.Nickname,
+				SyncedAvatar:   params.Avatar,
+			}
+			if err := tx.Create(&oauthAccount).Error; err != nil {
+				tx.Rollback()
+				return nil, "", false, err
+			}
+			if err := s.saveOAuthTokens(tx, &oauthAccount, params); err != nil {
+				tx.Rollback()
+				return nil, "", false, err
+			}
+
+			user, token, err := s.loginBoundUser(tx, unionAccount.UserID)
+			return user, token, false, err
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			tx.Rollback()
+			return nil, "", false, err
+		}
 	}
 
 	// 账号不存在，创建新用户和账号绑定
@@ -185,7 +374,7 @@ func (s *UserService) OAuthLogin(params OAuthLoginParams) (*models.User, string,
 
 	if err := tx.Create(&user).Error; err != nil {
 		tx.Rollback()
-		return nil, "", err
+		return nil, "", false, err
 	}
 
 	// 创建第三方账号绑定
@@ -193,9 +382,38 @@ func (s *UserService) OAuthLogin(params OAuthLoginParams) (*models.User, string,
 		UserID:         user.ID,
 		Provider:       params.Provider,
 		ProviderUserID: params.ProviderUserID,
+		UnionID:        params.UnionID,
+		Email:          params.Email,
+		SyncedNickname: params.Nickname,
+		SyncedAvatar:   params.Avatar,
 	}
 
 	if err := tx.Create(&oauthAccount).Error; err != nil {
+		tx.Rollback()
+		return nil, "", false, err
+	}
+
+	if err := s.saveOAuthTokens(tx, &oauthAccount, params); err != nil {
+		tx.Rollback()
+		return nil, "", false, err
+	}
+
+	// 生成token
+	token, err := s.GenerateToken(user.ID)
+	if err != nil {
+		tx.Rollback()
+		return nil, "", false, err
+	}
+
+	tx.Commit()
+	return &user, token, true, nil
+}
+
+// loginBoundUser 登录已绑定第三方账号的用户并提交事务
+func (s *UserService) loginBoundUser(tx *gorm.DB, userID uint) (*models.User, string, error) {
+	// 查找对应的用户
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
 		tx.Rollback()
 		return nil, "", err
 	}
@@ -211,19 +429,99 @@ func (s *UserService) OAuthLogin(params OAuthLoginParams) (*models.User, string,
 	return &user, token, nil
 }
 
+// saveOAuthTokens 加密并保存新建绑定的第三方令牌
+// 密文绑定绑定记录的ID，因此在创建绑定之后写入。
+func (s *UserService) saveOAuthTokens(tx *gorm.DB, account *models.OAuthAccount, params OAuthLoginParams) error {
+	updates, err := s.oauthTokenUpdates(account.ID, params)
+	if err != nil || len(updates) == 0 {
+		return err
+	}
+	return tx.Model(account).Updates(updates).Error
+}
+
+// oauthTokenUpdates 生成第三方令牌的加密更新字段，密文绑定到指定的绑定记录
+func (s *UserService) oauthTokenUpdates(accountID uint, params OAuthLoginParams) (map[string]interface{}, error) {
+	updates := map[string]interface{}{}
+	if s.TokenCipher == nil {
+		return updates, nil
+	}
+
+	if params.AccessToken != "" {
+		encrypted, err := s.TokenCipher.Encrypt(params.AccessToken, utils.CipherAAD("oauth_accounts", accountID, "access_token"))
+		if err != nil {
+			return nil, err
+		}
+		updates["access_token"] = encrypted
+		updates["token_expires_at"] = params.TokenExpiresAt
+	}
+	if params.RefreshToken != "" {
+		encrypted, err := s.TokenCipher.Encrypt(params.RefreshToken, utils.CipherAAD("oauth_accounts", accountID, "refresh_token"))
+		if err != nil {
+			return nil, err
+		}
+		updates["refresh_token"] = encrypted
+	}
+
+	return updates, nil
+}
+
 // Logout 用户退出登录
 func (s *UserService) Logout(token string) error {
 	// 删除用户会话
 	result := s.DB.Where("token = ?", token).Delete(&models.UserSession{})
+	// 无论删除是否成功都清除缓存，下次验证以数据库为准
+	s.Sessions.Invalidate(sessionCacheKey(token))
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
 		return ErrSessionNotFound
 	}
+
+	s.audit(AuditUserLogout, s.client.ActorID, nil)
 	return nil
 }
 
+// RevokeUserSessions 撤销用户的所有会话，返回撤销的数量
+func (s *UserService) RevokeUserSessions(userID uint) (int64, error) {
+	result := s.DB.Where("user_id = ?", userID).Delete(&models.UserSession{})
+	s.Sessions.InvalidateUser(userID)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteUser 删除用户及其会话、第三方账号绑定、通行密钥、两步验证恢复码和角色
+func (s *UserService) DeleteUser(userID uint) error {
+	defer s.Sessions.InvalidateUser(userID)
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserSession{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.OAuthAccount{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserRole{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&models.User{}, userID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return nil
+	})
+}
+
 // GetUserByID 获取用户信息
 func (s *UserService) GetUserByID(userID uint) (*models.User, error) {
 	var user models.User
@@ -246,22 +544,24 @@ func (s *UserService) UpdateUser(userID uint, params UpdateUserParams) (*models.
 		return nil, err
 	}
 
-	// 更新用户信息
+	// 更新用户信息，记录字段变更
 	updates := map[string]interface{}{}
-	if params.Nickname != "" {
-		updates["nickname"] = params.Nickname
-	}
-	if params.Avatar != "" {
-		updates["avatar"] = params.Avatar
-	}
-	if params.Signature != "" {
-		updates["signature"] = params.Signature
+	changes := map[string]FieldChange{}
+	setField := func(column, current, value string) {
+		if value != "" && value != current {
+			updates[column] = value
+			changes[column] = FieldChange{Old: current, New: value}
+		}
 	}
+	setField("nickname", user.Nickname, params.Nickname)
+	setField("avatar", user.Avatar, params.Avatar)
+	setField("signature", user.Signature, params.Signature)
 
 	if len(updates) > 0 {
 		if err := s.DB.Model(&user).Updates(updates).Error; err != nil {
 			return nil, err
 		}
+		s.audit(AuditUserUpdate, userID, changes)
 	}
 
 	// 重新获取用户信息
@@ -273,38 +573,118 @@ func (s *UserService) UpdateUser(userID uint, params UpdateUserParams) (*models.
 }
 
 // VerifyToken 验证token
+// 先验证签名和有效期，再确认会话未被撤销（优先查询本地缓存）
 func (s *UserService) VerifyToken(tokenString string) (uint, error) {
-	// 查找会话
+	// 解析JWT，按kid选择验证密钥并校验算法
+	claims := &TokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keySet().Keyfunc)
+	if err != nil {
+		// 仅在签名有效时才提示过期
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors == jwt.ValidationErrorExpired {
+			return 0, ErrTokenExpired
+		}
+		return 0, ErrInvalidToken
+	}
+	if !token.Valid || claims.UserID == 0 {
+		return 0, ErrInvalidToken
+	}
+
+	// 查询会话缓存
+	key := sessionCacheKey(tokenString)
+	if userID, valid, ok := s.Sessions.Get(key); ok {
+		if !valid || userID != claims.UserID {
+			return 0, ErrInvalidToken
+		}
+		return userID, nil
+	}
+
+	// 查找会话：新令牌按jti查询，升级前签发的令牌没有jti，按token查询
+	generation := s.Sessions.Generation()
+	query := s.DB.Where("token = ?", tokenString)
+	if claims.ID != "" {
+		query = s.DB.Where("jti = ?", claims.ID)
+	}
 	var session models.UserSession
-	if err := s.DB.Where("token = ?", tokenString).First(&session).Error; err != nil {
+	if err := query.First(&session).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 缓存已撤销的会话，重复使用时不再查询数据库
+			s.Sessions.Put(key, claims.UserID, false, claimsExpiry(claims), generation)
 			return 0, ErrInvalidToken
 		}
 		return 0, err
 	}
+	if session.UserID != claims.UserID {
+		return 0, ErrInvalidToken
+	}
+
+	// 封禁时会撤销所有会话，这里再检查一次，防止封禁前并发创建的会话继续可用
+	banned, err := s.isBanned(session.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if banned {
+		s.Sessions.Put(key, session.UserID, false, claimsExpiry(claims), generation)
+		return 0, ErrUserBanned
+	}
 
 	// 检查会话是否过期
 	if session.ExpiredAt != nil && session.ExpiredAt.Before(time.Now()) {
 		return 0, ErrTokenExpired
 	}
 
-	// 解析JWT
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// 验证算法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(s.JWTSecret), nil
-	})
+	expiry := claimsExpiry(claims)
+	if session.ExpiredAt != nil {
+		expiry = *session.ExpiredAt
+	}
+	s.Sessions.Put(key, session.UserID, true, expiry, generation)
+	return session.UserID, nil
+}
 
-	if err != nil {
-		return 0, err
+// sessionCacheKey 会话缓存键：令牌摘要（旧令牌没有jti，统一按令牌计算）
+func sessionCacheKey(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// claimsExpiry 令牌过期时间，未设置时返回零值
+func claimsExpiry(claims *TokenClaims) time.Time {
+	if claims.ExpiresAt == nil {
+		return time.Time{}
 	}
+	return claims.ExpiresAt.Time
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID := uint(claims["user_id"].(float64))
-		return userID, nil
+// WithClient 返回携带客户端信息的服务副本，审计日志据此记录操作人、IP和User-Agent
+func (s *UserService) WithClient(client ClientInfo) *UserService {
+	copied := *s
+	copied.client = client
+	return &copied
+}
+
+// RecordLogin 记录用户登录成功，method 为登录方式，如 password、sms、totp、passkey
+func (s *UserService) RecordLogin(userID uint, method string) {
+	s.audit(AuditUserLogin, userID, map[string]string{"method": method})
+}
+
+// audit 记录针对用户的审计日志，未登录时操作人为该用户本人
+func (s *UserService) audit(action string, userID uint, detail interface{}) {
+	client := s.client
+	if client.ActorID == 0 {
+		client.ActorID = userID
 	}
+	s.Audit.Record(client.entry(action, AuditTargetUser, strconv.FormatUint(uint64(userID), 10), detail))
+}
 
-	return 0, ErrInvalidToken
+// auditLoginFailed 记录密码登录失败，用户不存在时不记录操作人和操作对象
+func (s *UserService) auditLoginFailed(userID uint, email string, reason error) {
+	targetID := ""
+	if userID != 0 {
+		targetID = strconv.FormatUint(uint64(userID), 10)
+	}
+	s.Audit.Record(s.client.entry(AuditUserLoginFailed, AuditTargetUser, targetID, map[string]string{
+		"method": "password",
+		"email":  email,
+		"reason": reason.Error(),
+	}))
 }
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// COSE算法标识
+const (
+	COSEAlgES256 = -7   // ECDSA P-256 + SHA-256
+	COSEAlgRS256 = -257 // RSASSA-PKCS1-v1_5 + SHA-256
+)
+
+// 认证器数据标志位
+const (
+	authenticatorFlagUserPresent   = 0x01 // UP：用户在场
+	authenticatorFlagUserVerified  = 0x04 // UV：已完成用户验证（生物识别或设备密码）
+	authenticatorFlagAttestedData  = 0x40 // AT：包含凭证数据
+	authenticatorFlagExtensionData = 0x80 // ED：包含扩展数据
+)
+
+// 认证器数据固定部分长度：rpIdHash(32) + flags(1) + signCount(4)
+const authenticatorDataMinLength = 37
+
+// authenticatorData 解析后的认证器数据
+type authenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	PublicKey    []byte // COSE格式公钥原始字节
+}
+
+// HasFlag 是否设置了指定标志位
+func (d *authenticatorData) HasFlag(flag byte) bool {
+	return d.Flags&flag == flag
+}
+
+// parseAuthenticatorData 解析认证器数据
+// https://www.w3.org/TR/webauthn-2/#sctn-authenticator-data
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < authenticatorDataMinLength {
+		return nil, errors.New("认证器数据长度不足")
+	}
+
+	parsed := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[authenticatorDataMinLength:]
+
+	if parsed.HasFlag(authenticatorFlagAttestedData) {
+		// aaguid(16) + credentialIdLength(2)
+		if len(rest) < 18 {
+			return nil, errors.New("凭证数据长度不足")
+		}
+		parsed.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || len(rest) < idLength {
+			return nil, errors.New("凭证ID长度无效")
+		}
+		parsed.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		// 公钥为一个CBOR映射，之后可能紧跟扩展数据
+		_, n, err := cborDecode(rest)
+		if err != nil {
+			return nil, fmt.Errorf("解析凭证公钥失败: %v", err)
+		}
+		parsed.PublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if parsed.HasFlag(authenticatorFlagExtensionData) {
+		_, n, err := cborDecode(rest)
+		if err != nil {
+			return nil, fmt.Errorf("解析扩展数据失败: %v", err)
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("认证器数据包含多余字节")
+	}
+	return parsed, nil
+}
+
+// webAuthnPublicKey 解析后的凭证公钥
+type webAuthnPublicKey struct {
+	Algorithm int64
+	ECDSA     *ecdsa.PublicKey
+	RSA       *rsa.PublicKey
+}
+
+// parseCOSEKey 解析COSE格式公钥，支持ES256（EC2/P-256）和RS256（RSA）
+// https://www.rfc-editor.org/rfc/rfc9053
+func parseCOSEKey(data []byte) (*webAuthnPublicKey, error) {
+	decoded, n, err := cborDecode(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnAlgorithmUnsupported, err)
+	}
+	if n != len(data) {
+		return nil, fmt.Errorf("%w: 公钥包含多余字节", ErrWebAuthnAlgorithmUnsupported)
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: 公钥格式错误", ErrWebAuthnAlgorithmUnsupported)
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256:
+		crv, _ := key[int64(-1)].(int64)
+		x, _ := key[int64(-2)].([]byte)
+		y, _ := key[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: EC2公钥参数错误", ErrWebAuthnAlgorithmUnsupported)
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("%w: EC2公钥不在曲线上", ErrWebAuthnAlgorithmUnsupported)
+		}
+		return &webAuthnPublicKey{Algorithm: alg, ECDSA: pub}, nil
+	case kty == 3 && alg == COSEAlgRS256:
+		nBytes, _ := key[int64(-1)].([]byte)
+		eBytes, _ := key[int64(-2)].([]byte)
+		if len(nBytes) < 256 || len(eBytes) == 0 || len(eBytes) > 4 {
+			return nil, fmt.Errorf("%w: RSA公钥参数错误", ErrWebAuthnAlgorithmUnsupported)
+		}
+		e := new(big.Int).SetBytes(eBytes)
+		return &webAuthnPublicKey{
+			Algorithm: alg,
+			RSA:       &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(e.Int64())},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: kty=%d alg=%d", ErrWebAuthnAlgorithmUnsupported, kty, alg)
+}
+
+// Verify 校验签名，data为 authenticatorData || SHA-256(clientDataJSON)
+func (k *webAuthnPublicKey) Verify(data, signature []byte) bool {
+	digest := sha256.Sum256(data)
+	switch k.Algorithm {
+	case COSEAlgES256:
+		return ecdsa.VerifyASN1(k.ECDSA, digest[:], signature)
+	case COSEAlgRS256:
+		return rsa.VerifyPKCS1v15(k.RSA, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+// webAuthnClientData 客户端数据（clientDataJSON）
+type webAuthnClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// parseClientData 解析客户端数据并校验仪式类型
+func parseClientData(raw []byte, ceremonyType string) (*webAuthnClientData, error) {
+	var clientData webAuthnClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnClientDataInvalid, err)
+	}
+	if clientData.Type != ceremonyType {
+		return nil, fmt.Errorf("%w: 类型应为 %s", ErrWebAuthnClientDataInvalid, ceremonyType)
+	}
+	if clientData.Challenge == "" {
+		return nil, fmt.Errorf("%w: 缺少挑战值", ErrWebAuthnClientDataInvalid)
+	}
+	if clientData.CrossOrigin {
+		return nil, fmt.Errorf("%w: 不接受跨域请求", ErrWebAuthnClientDataInvalid)
+	}
+	return &clientData, nil
+}
+
+// decodeWebAuthnBase64 解码客户端提交的base64url数据（兼容带填充和标准base64）
+func decodeWebAuthnBase64(value string) ([]byte, error) {
+	value = strings.TrimRight(value, "=")
+	if decoded, err := base64.RawURLEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+	return base64.RawStdEncoding.DecodeString(value)
+}
+
+// formatAAGUID 将认证器AAGUID格式化为UUID字符串
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
@@ -0,0 +1,648 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"ios-api/config"
+	"ios-api/models"
+
+	"gorm.io/gorm"
+)
+
+// 通行密钥挑战默认参数
+const (
+	DefaultWebAuthnTimeout = 5 * time.Minute // 挑战默认有效期
+	MaxWebAuthnChallenges  = 100000          // 最多同时保存的挑战数量
+)
+
+// 仪式类型（clientDataJSON中的type）
+const (
+	webAuthnCeremonyCreate = "webauthn.create"
+	webAuthnCeremonyGet    = "webauthn.get"
+)
+
+// 凭证ID最大长度（base64url编码后不超过数据库字段长度）
+const webAuthnMaxCredentialIDLength = 380
+
+// 自定义错误
+var (
+	ErrWebAuthnNotConfigured          = errors.New("未配置通行密钥登录")
+	ErrWebAuthnChallengeInvalid       = errors.New("无效或已过期的通行密钥挑战")
+	ErrWebAuthnClientDataInvalid      = errors.New("通行密钥客户端数据无效")
+	ErrWebAuthnOriginNotAllowed       = errors.New("通行密钥来源不在允许列表中")
+	ErrWebAuthnRPIDMismatch           = errors.New("通行密钥依赖方ID不匹配")
+	ErrWebAuthnUserNotVerified        = errors.New("通行密钥未完成用户验证")
+	ErrWebAuthnAttestationInvalid     = errors.New("通行密钥注册数据无效")
+	ErrWebAuthnAttestationUnsupported = errors.New("不支持的通行密钥证明格式")
+	ErrWebAuthnAlgorithmUnsupported   = errors.New("不支持的通行密钥公钥")
+	ErrWebAuthnAssertionInvalid       = errors.New("通行密钥登录数据无效")
+	ErrWebAuthnSignatureInvalid       = errors.New("通行密钥签名校验失败")
+	ErrWebAuthnSignCountInvalid       = errors.New("通行密钥签名计数异常，认证器可能被克隆")
+	ErrWebAuthnCredentialNotFound     = errors.New("通行密钥不存在")
+	ErrWebAuthnCredentialExists       = errors.New("通行密钥已注册")
+	ErrWebAuthnUserMismatch           = errors.New("通行密钥与用户不匹配")
+)
+
+// WebAuthnRelyingParty 依赖方信息
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// WebAuthnUserEntity 注册时提供给认证器的用户信息
+type WebAuthnUserEntity struct {
+	ID          string `json:"id"` // 用户句柄（base64url），不包含个人信息
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// WebAuthnCredentialParameter 可接受的公钥算法
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// WebAuthnCredentialDescriptor 凭证描述
+type WebAuthnCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// WebAuthnAuthenticatorSelection 认证器要求
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// WebAuthnCreationOptions 注册选项（对应 PublicKeyCredentialCreationOptions）
+type WebAuthnCreationOptions struct {
+	Challenge              string                         `json:"challenge"`
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"` // 毫秒
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+// WebAuthnRequestOptions 登录选项（对应 PublicKeyCredentialRequestOptions）
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	Timeout          int64                          `json:"timeout"` // 毫秒
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnAttestationData 注册结果中的认证器响应
+type WebAuthnAttestationData struct {
+	ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+	AttestationObject string   `json:"attestationObject" binding:"required"`
+	Transports        []string `json:"transports"`
+}
+
+// WebAuthnRegistrationResponse 客户端提交的注册结果（PublicKeyCredential的JSON形式）
+type WebAuthnRegistrationResponse struct {
+	ID       string                  `json:"id" binding:"required"`
+	RawID    string                  `json:"rawId"`
+	Type     string                  `json:"type"`
+	Response WebAuthnAttestationData `json:"response"`
+}
+
+// WebAuthnAssertionData 登录结果中的认证器响应
+type WebAuthnAssertionData struct {
+	ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+	AuthenticatorData string `json:"authenticatorData" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// WebAuthnAssertionResponse 客户端提交的登录结果（PublicKeyCredential的JSON形式）
+type WebAuthnAssertionResponse struct {
+	ID       string                `json:"id" binding:"required"`
+	RawID    string                `json:"rawId"`
+	Type     string                `json:"type"`
+	Response WebAuthnAssertionData `json:"response"`
+}
+
+// webAuthnSession 服务端保存的挑战信息
+type webAuthnSession struct {
+	Challenge string
+	Ceremony  string
+	UserID    uint // 注册时为当前用户；登录时指定了账号则为该用户，否则为0
+	ExpiresAt time.Time
+}
+
+// WebAuthnService 通行密钥（WebAuthn）注册与登录服务
+// 挑战由服务端随机生成并保存在内存中，校验时立即删除，保证一次性使用。
+// 挑战按过期时间顺序记录，生成时只清理队首已过期的挑战；数量达到上限时淘汰最早的挑战，
+// 不因挑战已满拒绝所有人登录，无需认证的登录入口另按IP限流（见 middlewares.RateLimitByIP）。
+// 注册只接受 "none" 证明格式，登录校验签名和签名计数。
+type WebAuthnService struct {
+	DB      *gorm.DB
+	RPID    string        // 依赖方ID（域名）
+	RPName  string        // 依赖方显示名称
+	Origins []string      // 允许的来源，未配置时为 https://<RPID>
+	Timeout time.Duration // 挑战有效期
+	// 最多同时保存的挑战数量，已满时淘汰最早的挑战
+	MaxChallenges int
+
+	mu       sync.Mutex
+	sessions map[string]*list.Element // 挑战 -> order中的元素
+	order    *list.List               // 未使用的挑战，按过期时间排序（有效期固定，即生成顺序）
+	now      func() time.Time
+	random   io.Reader
+}
+
+// NewWebAuthnService 创建新的通行密钥服务
+func NewWebAuthnService(db *gorm.DB, cfg *config.Config) *WebAuthnService {
+	origins := cfg.WebAuthnOrigins
+	if len(origins) == 0 && cfg.WebAuthnRPID != "" {
+		origins = []string{"https://" + cfg.WebAuthnRPID}
+	}
+	return &WebAuthnService{
+		DB:            db,
+		RPID:          cfg.WebAuthnRPID,
+		RPName:        cfg.WebAuthnRPName,
+		Origins:       origins,
+		Timeout:       DefaultWebAuthnTimeout,
+		MaxChallenges: MaxWebAuthnChallenges,
+		sessions:      make(map[string]*list.Element),
+		order:         list.New(),
+		now:           time.Now,
+		random:        rand.Reader,
+	}
+}
+
+// Enabled 是否已配置依赖方ID
+func (s *WebAuthnService) Enabled() bool {
+	return s.RPID != ""
+}
+
+// SetClock 替换时间来源（用于测试）
+func (s *WebAuthnService) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// SetRandom 替换挑战的随机数来源（用于测试回放录制的数据）
+func (s *WebAuthnService) SetRandom(random io.Reader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.random = random
+}
+
+// WebAuthnUserHandle 用户句柄：用户ID的8字节大端编码（base64url）
+func WebAuthnUserHandle(userID uint) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(userID))
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// RegistrationOptions 生成注册选项，existing为用户已注册的凭证（避免在同一认证器上重复注册）
+func (s *WebAuthnService) RegistrationOptions(user *models.User, existing []models.WebAuthnCredential) (*WebAuthnCreationOptions, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	challenge, err := s.newChallenge(webAuthnCeremonyCreate, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 账号名优先使用邮箱，其次手机号
+	name := user.Email
+	if name == "" {
+		name = user.Phone
+	}
+	if name == "" {
+		name = fmt.Sprintf("user%d", user.ID)
+	}
+	displayName := user.Nickname
+	if displayName == "" {
+		displayName = name
+	}
+
+	return &WebAuthnCreationOptions{
+		Challenge: challenge,
+		RP:        WebAuthnRelyingParty{ID: s.RPID, Name: s.RPName},
+		User: WebAuthnUserEntity{
+			ID:          WebAuthnUserHandle(user.ID),
+			Name:        name,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams: []WebAuthnCredentialParameter{
+			{Type: "public-key", Alg: COSEAlgES256},
+			{Type: "public-key", Alg: COSEAlgRS256},
+		},
+		Timeout:            s.Timeout.Milliseconds(),
+		ExcludeCredentials: credentialDescriptors(existing),
+		AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   "required",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// LoginOptions 生成登录选项
+// userID为0时不限定账号（由认证器列出可用的通行密钥），否则只允许该用户的凭证
+func (s *WebAuthnService) LoginOptions(userID uint, credentials []models.WebAuthnCredential) (*WebAuthnRequestOptions, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	challenge, err := s.newChallenge(webAuthnCeremonyGet, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnRequestOptions{
+		Challenge:        challenge,
+		Timeout:          s.Timeout.Milliseconds(),
+		RPID:             s.RPID,
+		AllowCredentials: credentialDescriptors(credentials),
+		UserVerification: "required",
+	}, nil
+}
+
+// VerifyRegistration 校验注册结果，返回待保存的凭证（不写数据库）
+// https://www.w3.org/TR/webauthn-2/#sctn-registering-a-new-credential
+func (s *WebAuthnService) VerifyRegistration(userID uint, resp WebAuthnRegistrationResponse) (*models.WebAuthnCredential, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	rawClientData, err := decodeWebAuthnBase64(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnClientDataInvalid, err)
+	}
+	clientData, err := parseClientData(rawClientData, webAuthnCeremonyCreate)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.consumeChallenge(webAuthnCeremonyCreate, clientData.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrWebAuthnUserMismatch
+	}
+	if !s.isOriginAllowed(clientData.Origin) {
+		return nil, ErrWebAuthnOriginNotAllowed
+	}
+
+	// 解析证明对象 {fmt, attStmt, authData}
+	rawAttestation, err := decodeWebAuthnBase64(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnAttestationInvalid, err)
+	}
+	decoded, n, err := cborDecode(rawAttestation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnAttestationInvalid, err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok || n != len(rawAttestation) {
+		return nil, fmt.Errorf("%w: 证明对象格式错误", ErrWebAuthnAttestationInvalid)
+	}
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attestation["authData"].([]byte)
+	if rawAuthData == nil {
+		return nil, fmt.Errorf("%w: 缺少认证器数据", ErrWebAuthnAttestationInvalid)
+	}
+	// 只请求并接受 "none" 证明，attStmt 必须为空映射
+	if format != "none" {
+		return nil, fmt.Errorf("%w: %s", ErrWebAuthnAttestationUnsupported, format)
+	}
+	if statement == nil || len(statement) != 0 {
+		return nil, fmt.Errorf("%w: none格式的attStmt必须为空", ErrWebAuthnAttestationInvalid)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnAttestationInvalid, err)
+	}
+	if err := s.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if !authData.HasFlag(authenticatorFlagAttestedData) {
+		return nil, fmt.Errorf("%w: 缺少凭证数据", ErrWebAuthnAttestationInvalid)
+	}
+	if len(authData.CredentialID) > webAuthnMaxCredentialIDLength {
+		return nil, fmt.Errorf("%w: 凭证ID过长", ErrWebAuthnAttestationInvalid)
+	}
+
+	// 客户端提交的凭证ID必须与认证器数据中的一致
+	credentialID := base64.RawURLEncoding.EncodeToString(authData.CredentialID)
+	if submitted, err := decodeWebAuthnBase64(resp.ID); err != nil || !bytes.Equal(submitted, authData.CredentialID) {
+		return nil, fmt.Errorf("%w: 凭证ID不一致", ErrWebAuthnAttestationInvalid)
+	}
+
+	if _, err := parseCOSEKey(authData.PublicKey); err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    authData.PublicKey,
+		SignCount:    authData.SignCount,
+		AAGUID:       formatAAGUID(authData.AAGUID),
+		Transports:   strings.Join(resp.Response.Transports, ","),
+	}, nil
+}
+
+// VerifyAssertion 使用已保存的凭证校验登录结果，返回认证器最新的签名计数（不写数据库）
+// https://www.w3.org/TR/webauthn-2/#sctn-verifying-assertion
+func (s *WebAuthnService) VerifyAssertion(resp WebAuthnAssertionResponse, credential *models.WebAuthnCredential) (uint32, error) {
+	if !s.Enabled() {
+		return 0, ErrWebAuthnNotConfigured
+	}
+
+	rawClientData, err := decodeWebAuthnBase64(resp.Response.ClientDataJSON)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrWebAuthnClientDataInvalid, err)
+	}
+	clientData, err := parseClientData(rawClientData, webAuthnCeremonyGet)
+	if err != nil {
+		return 0, err
+	}
+	session, err := s.consumeChallenge(webAuthnCeremonyGet, clientData.Challenge)
+	if err != nil {
+		return 0, err
+	}
+	if session.UserID != 0 && session.UserID != credential.UserID {
+		return 0, ErrWebAuthnUserMismatch
+	}
+	if !s.isOriginAllowed(clientData.Origin) {
+		return 0, ErrWebAuthnOriginNotAllowed
+	}
+
+	// 可发现凭证会返回用户句柄，必须与凭证所属用户一致
+	if resp.Response.UserHandle != "" {
+		handle, err := decodeWebAuthnBase64(resp.Response.UserHandle)
+		if err != nil || base64.RawURLEncoding.EncodeToString(handle) != WebAuthnUserHandle(credential.UserID) {
+			return 0, ErrWebAuthnUserMismatch
+		}
+	}
+
+	rawAuthData, err := decodeWebAuthnBase64(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrWebAuthnAssertionInvalid, err)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrWebAuthnAssertionInvalid, err)
+	}
+	if err := s.checkAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+
+	signature, err := decodeWebAuthnBase64(resp.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrWebAuthnSignatureInvalid, err)
+	}
+	publicKey, err := parseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	// 签名数据为 authenticatorData || SHA-256(clientDataJSON)
+	clientDataHash := sha256.Sum256(rawClientData)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if !publicKey.Verify(signed, signature) {
+		return 0, ErrWebAuthnSignatureInvalid
+	}
+
+	// 签名计数必须递增；两者都为0表示认证器不支持计数（如同步的通行密钥）
+	if (authData.SignCount != 0 || credential.SignCount != 0) && authData.SignCount <= credential.SignCount {
+		return 0, ErrWebAuthnSignCountInvalid
+	}
+
+	return authData.SignCount, nil
+}
+
+// BeginRegistration 为用户生成注册选项
+func (s *WebAuthnService) BeginRegistration(user *models.User) (*WebAuthnCreationOptions, error) {
+	var existing []models.WebAuthnCredential
+	if err := s.DB.Where("user_id = ?", user.ID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	return s.RegistrationOptions(user, existing)
+}
+
+// FinishRegistration 校验注册结果并保存凭证
+func (s *WebAuthnService) FinishRegistration(userID uint, resp WebAuthnRegistrationResponse, name string) (*models.WebAuthnCredential, error) {
+	credential, err := s.VerifyRegistration(userID, resp)
+	if err != nil {
+		return nil, err
+	}
+	credential.Name = name
+
+	var count int64
+	if err := s.DB.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credential.CredentialID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrWebAuthnCredentialExists
+	}
+
+	if err := s.DB.Create(credential).Error; err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// BeginLogin 生成登录选项，email为空时使用可发现凭证登录
+// 邮箱已注册且有通行密钥时，allowCredentials 为该账号的凭证列表；邮箱未注册或没有通行密钥时返回空列表。
+// 因此响应会暴露该邮箱是否注册了通行密钥，不需要这一点的客户端应不传邮箱，使用可发现凭证登录。
+func (s *WebAuthnService) BeginLogin(email string) (*WebAuthnRequestOptions, error) {
+	if email != "" {
+		var user models.User
+		err := s.DB.Where("email = ?", email).First(&user).Error
+		if err == nil {
+			var credentials []models.WebAuthnCredential
+			if err := s.DB.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+				return nil, err
+			}
+			if len(credentials) > 0 {
+				return s.LoginOptions(user.ID, credentials)
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return s.LoginOptions(0, nil)
+}
+
+// FinishLogin 校验登录结果并更新签名计数，返回登录所用的凭证
+func (s *WebAuthnService) FinishLogin(resp WebAuthnAssertionResponse) (*models.WebAuthnCredential, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnNotConfigured
+	}
+
+	rawID, err := decodeWebAuthnBase64(resp.ID)
+	if err != nil {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+	var credential models.WebAuthnCredential
+	if err := s.DB.Where("credential_id = ?", base64.RawURLEncoding.EncodeToString(rawID)).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, err
+	}
+
+	signCount, err := s.VerifyAssertion(resp, &credential)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.DB.Model(&credential).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": now,
+	}).Error; err != nil {
+		return nil, err
+	}
+	credential.SignCount = signCount
+	credential.LastUsedAt = &now
+	return &credential, nil
+}
+
+// IsWebAuthnVerificationError 判断是否为客户端提交的通行密钥数据校验失败
+func IsWebAuthnVerificationError(err error) bool {
+	for _, target := range []error{
+		ErrWebAuthnChallengeInvalid,
+		ErrWebAuthnClientDataInvalid,
+		ErrWebAuthnOriginNotAllowed,
+		ErrWebAuthnRPIDMismatch,
+		ErrWebAuthnUserNotVerified,
+		ErrWebAuthnAttestationInvalid,
+		ErrWebAuthnAttestationUnsupported,
+		ErrWebAuthnAlgorithmUnsupported,
+		ErrWebAuthnAssertionInvalid,
+		ErrWebAuthnSignatureInvalid,
+		ErrWebAuthnSignCountInvalid,
+		ErrWebAuthnCredentialNotFound,
+		ErrWebAuthnUserMismatch,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAuthenticatorData 校验依赖方ID哈希以及用户在场、用户验证标志
+func (s *WebAuthnService) checkAuthenticatorData(authData *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(s.RPID))
+	if !bytes.Equal(authData.RPIDHash, rpIDHash[:]) {
+		return ErrWebAuthnRPIDMismatch
+	}
+	// 通行密钥用于无密码登录，要求用户在场且完成了生物识别或设备密码验证
+	if !authData.HasFlag(authenticatorFlagUserPresent) || !authData.HasFlag(authenticatorFlagUserVerified) {
+		return ErrWebAuthnUserNotVerified
+	}
+	return nil
+}
+
+// isOriginAllowed 检查来源是否在允许列表中
+func (s *WebAuthnService) isOriginAllowed(origin string) bool {
+	for _, allowed := range s.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// newChallenge 生成并保存一次性挑战
+func (s *WebAuthnService) newChallenge(ceremony string, userID uint) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.pruneLocked(now)
+
+	buf := make([]byte, 32)
+	if _, err := io.ReadFull(s.random, buf); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(buf)
+
+	for s.order.Len() >= s.MaxChallenges {
+		s.removeLocked(s.order.Front())
+	}
+	s.sessions[challenge] = s.order.PushBack(webAuthnSession{
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		UserID:    userID,
+		ExpiresAt: now.Add(s.Timeout),
+	})
+	return challenge, nil
+}
+
+// consumeChallenge 校验并删除挑战，无论成功与否挑战都只能使用一次
+func (s *WebAuthnService) consumeChallenge(ceremony, challenge string) (webAuthnSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.sessions[challenge]
+	if !ok {
+		return webAuthnSession{}, ErrWebAuthnChallengeInvalid
+	}
+	session := elem.Value.(webAuthnSession)
+	s.removeLocked(elem)
+
+	if session.Ceremony != ceremony || s.now().After(session.ExpiresAt) {
+		return webAuthnSession{}, ErrWebAuthnChallengeInvalid
+	}
+	return session, nil
+}
+
+// pruneLocked 从队首删除已过期的挑战（调用方需持有锁），遇到未过期的挑战即停止
+func (s *WebAuthnService) pruneLocked(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		session := elem.Value.(webAuthnSession)
+		if !now.After(session.ExpiresAt) {
+			return
+		}
+		s.removeLocked(elem)
+	}
+}
+
+// removeLocked 删除一个挑战（调用方需持有锁）
+func (s *WebAuthnService) removeLocked(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.sessions, elem.Value.(webAuthnSession).Challenge)
+}
+
+// credentialDescriptors 将已保存的凭证转换为凭证描述列表
+func credentialDescriptors(credentials []models.WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	descriptors := make([]WebAuthnCredentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		descriptor := WebAuthnCredentialDescriptor{Type: "public-key", ID: credential.CredentialID}
+		if credential.Transports != "" {
+			descriptor.Transports = strings.Split(credential.Transports, ",")
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors
+}
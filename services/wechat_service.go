@@ -4,16 +4,45 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
+
+	"ios-api/config"
+)
+
+// 微信接口默认地址
+const (
+	DefaultWechatAPIBaseURL  = "https://api.weixin.qq.com"
+	DefaultWechatOpenBaseURL = "https://open.weixin.qq.com"
 )
 
 // WechatService 微信服务
 type WechatService struct {
-	AppID       string
-	AppSecret   string
-	RedirectURI string
+	AppID         string
+	AppSecret     string
+	MiniAppID     string       // 小程序AppID
+	MiniAppSecret string       // 小程序AppSecret
+	APIBaseURL    string       // 微信API地址，默认 https://api.weixin.qq.com
+	OpenBaseURL   string       // 微信开放平台地址，默认 https://open.weixin.qq.com
+	Client        *http.Client // HTTP客户端，为空时使用默认客户端
+}
+
+// NewWechatService 创建新的微信服务实例
+func NewWechatService(cfg *config.Config) *WechatService {
+	return &WechatService{
+		AppID:         cfg.WechatAppID,
+		AppSecret:     cfg.WechatAppSecret,
+		MiniAppID:     cfg.WechatMiniAppID,
+		MiniAppSecret: cfg.WechatMiniAppSecret,
+		APIBaseURL:    cfg.WechatAPIBaseURL,
+		OpenBaseURL:   cfg.WechatOpenBaseURL,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
 }
 
 // WechatAccessTokenResponse 微信访问令牌响应
@@ -23,10 +52,20 @@ type WechatAccessTokenResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	OpenID       string `json:"openid"`
 	Scope        string `json:"scope"`
+	UnionID      string `json:"unionid"`
 	ErrCode      int    `json:"errcode"`
 	ErrMsg       string `json:"errmsg"`
 }
 
+// WechatCode2SessionResponse 小程序登录凭证校验响应
+type WechatCode2SessionResponse struct {
+	OpenID     string `json:"openid"`
+	SessionKey string `json:"session_key"`
+	UnionID    string `json:"unionid"`
+	ErrCode    int    `json:"errcode"`
+	ErrMsg     string `json:"errmsg"`
+}
+
 // WechatUserInfoResponse 微信用户信息响应
 type WechatUserInfoResponse struct {
 	OpenID     string   `json:"openid"`
@@ -48,45 +87,120 @@ var (
 	ErrWechatCodeInvalid    = errors.New("无效的微信授权码")
 	ErrWechatServerError    = errors.New("微信服务器错误")
 	ErrWechatUserInfoFailed = errors.New("获取微信用户信息失败")
+	ErrWechatMiniNotConfig  = errors.New("微信小程序未配置")
 )
 
+// apiBaseURL 获取微信API地址
+func (s *WechatService) apiBaseURL() string {
+	if s.APIBaseURL == "" {
+		return DefaultWechatAPIBaseURL
+	}
+	return strings.TrimRight(s.APIBaseURL, "/")
+}
+
+// openBaseURL 获取微信开放平台地址
+func (s *WechatService) openBaseURL() string {
+	if s.OpenBaseURL == "" {
+		return DefaultWechatOpenBaseURL
+	}
+	return strings.TrimRight(s.OpenBaseURL, "/")
+}
+
+// httpClient 获取HTTP客户端
+func (s *WechatService) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// getJSON 请求微信接口并解析JSON响应
+func (s *WechatService) getJSON(requestURL string, out interface{}) error {
+	// 发送请求
+	resp, err := s.httpClient().Get(requestURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWechatServerError, err)
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWechatServerError, err)
+	}
+
+	// 解析JSON
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%w: 解析响应失败: %v", ErrWechatServerError, err)
+	}
+
+	return nil
+}
+
 // GetAuthURL 获取微信授权链接
-func (s *WechatService) GetAuthURL(state string) string {
+func (s *WechatService) GetAuthURL(redirectURI, state string) string {
 	authURL := fmt.Sprintf(
-		"https://open.weixin.qq.com/connect/oauth2/authorize?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_userinfo&state=%s#wechat_redirect",
+		"%s/connect/oauth2/authorize?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_userinfo&state=%s#wechat_redirect",
+		s.openBaseURL(),
 		s.AppID,
-		url.QueryEscape(s.RedirectURI),
-		state,
+		url.QueryEscape(redirectURI),
+		url.QueryEscape(state),
 	)
 	return authURL
 }
 
+// Name 提供方名称
+func (s *WechatService) Name() string {
+	return "wechat"
+}
+
+// AuthURL 获取授权链接（实现 OAuthProvider）
+func (s *WechatService) AuthURL(redirectURI, state string) string {
+	return s.GetAuthURL(redirectURI, state)
+}
+
+// ExchangeCode 使用授权码换取用户信息（实现 OAuthProvider）
+// 微信换取令牌时不需要重定向地址
+func (s *WechatService) ExchangeCode(code, redirectURI string) (*OAuthLoginParams, error) {
+	return s.HandleCallback(code)
+}
+
 // GetAccessToken 通过授权码获取访问令牌
 func (s *WechatService) GetAccessToken(code string) (*WechatAccessTokenResponse, error) {
 	// 构建接口URL
 	tokenURL := fmt.Sprintf(
-		"https://api.weixin.qq.com/sns/oauth2/access_token?appid=%s&secret=%s&code=%s&grant_type=authorization_code",
+		"%s/sns/oauth2/access_token?appid=%s&secret=%s&code=%s&grant_type=authorization_code",
+		s.apiBaseURL(),
 		s.AppID,
 		s.AppSecret,
-		code,
+		url.QueryEscape(code),
 	)
 
-	// 发送请求
-	resp, err := http.Get(tokenURL)
-	if err != nil {
+	var tokenResp WechatAccessTokenResponse
+	if err := s.getJSON(tokenURL, &tokenResp); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	// 检查错误
+	if tokenResp.ErrCode != 0 {
+		return nil, fmt.Errorf("%w: %d %s", ErrWechatAuthFailed, tokenResp.ErrCode, tokenResp.ErrMsg)
 	}
 
-	// 解析JSON
+	return &tokenResp, nil
+}
+
+// RefreshAccessToken 使用刷新令牌获取新的访问令牌
+func (s *WechatService) RefreshAccessToken(refreshToken string) (*WechatAccessTokenResponse, error) {
+	// 构建接口URL
+	refreshURL := fmt.Sprintf(
+		"%s/sns/oauth2/refresh_token?appid=%s&grant_type=refresh_token&refresh_token=%s",
+		s.apiBaseURL(),
+		s.AppID,
+		url.QueryEscape(refreshToken),
+	)
+
 	var tokenResp WechatAccessTokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
+	if err := s.getJSON(refreshURL, &tokenResp); err != nil {
 		return nil, err
 	}
 
@@ -102,27 +216,14 @@ func (s *WechatService) GetAccessToken(code string) (*WechatAccessTokenResponse,
 func (s *WechatService) GetUserInfo(accessToken, openID string) (*WechatUserInfoResponse, error) {
 	// 构建接口URL
 	userInfoURL := fmt.Sprintf(
-		"https://api.weixin.qq.com/sns/userinfo?access_token=%s&openid=%s&lang=zh_CN",
-		accessToken,
-		openID,
+		"%s/sns/userinfo?access_token=%s&openid=%s&lang=zh_CN",
+		s.apiBaseURL(),
+		url.QueryEscape(accessToken),
+		url.QueryEscape(openID),
 	)
 
-	// 发送请求
-	resp, err := http.Get(userInfoURL)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// 解析JSON
 	var userInfo WechatUserInfoResponse
-	if err := json.Unmarshal(body, &userInfo); err != nil {
+	if err := s.getJSON(userInfoURL, &userInfo); err != nil {
 		return nil, err
 	}
 
@@ -152,12 +253,75 @@ func (s *WechatService) HandleCallback(code string) (*OAuthLoginParams, error) {
 		return nil, err
 	}
 
+	// UnionID仅在应用绑定开放平台后返回，优先取用户信息中的值
+	unionID := userInfo.UnionID
+	if unionID == "" {
+		unionID = tokenResp.UnionID
+	}
+
 	// 构建OAuth登录参数
+	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
 	params := &OAuthLoginParams{
 		Provider:       "wechat",
-		ProviderUserID: userInfo.OpenID, // 使用OpenID作为用户标识
+		ProviderUserID: userInfo.OpenID, // 使用OpenID作为应用内用户标识
+		UnionID:        unionID,         // 使用UnionID跨应用合并账号
 		Nickname:       userInfo.Nickname,
 		Avatar:         userInfo.HeadImgURL,
+		AccessToken:    tokenResp.AccessToken,
+		RefreshToken:   tokenResp.RefreshToken,
+		TokenExpiresAt: &expiresAt,
+	}
+
+	return params, nil
+}
+
+// Code2Session 小程序登录凭证校验
+func (s *WechatService) Code2Session(code string) (*WechatCode2SessionResponse, error) {
+	if s.MiniAppID == "" || s.MiniAppSecret == "" {
+		return nil, ErrWechatMiniNotConfig
+	}
+
+	// 构建接口URL
+	sessionURL := fmt.Sprintf(
+		"%s/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code",
+		s.apiBaseURL(),
+		s.MiniAppID,
+		s.MiniAppSecret,
+		url.QueryEscape(code),
+	)
+
+	var sessionResp WechatCode2SessionResponse
+	if err := s.getJSON(sessionURL, &sessionResp); err != nil {
+		return nil, err
+	}
+
+	// 检查错误
+	if sessionResp.ErrCode != 0 {
+		return nil, fmt.Errorf("%w: %d %s", ErrWechatAuthFailed, sessionResp.ErrCode, sessionResp.ErrMsg)
+	}
+
+	return &sessionResp, nil
+}
+
+// HandleMiniProgramLogin 处理小程序登录
+// 小程序无法通过code获取用户资料，昵称和头像由客户端提供
+func (s *WechatService) HandleMiniProgramLogin(code, nickname, avatar string) (*OAuthLoginParams, error) {
+	if code == "" {
+		return nil, ErrWechatCodeInvalid
+	}
+
+	sessionResp, err := s.Code2Session(code)
+	if err != nil {
+		return nil, err
+	}
+
+	// 构建OAuth登录参数
+	params := &OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: sessionResp.OpenID,
+		UnionID:        sessionResp.UnionID,
+		Nickname:       nickname,
+		Avatar:         avatar,
 	}
 
 	return params, nil
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ios-api/models"
+	"ios-api/utils"
+
+	"gorm.io/gorm"
+)
+
+// 自定义错误
+var (
+	ErrWechatNotBound       = errors.New("未绑定可同步的微信账号")
+	ErrWechatRefreshExpired = errors.New("微信授权已失效，请重新登录")
+)
+
+// WechatSyncService 微信令牌刷新和资料同步服务
+type WechatSyncService struct {
+	DB     *gorm.DB
+	Wechat *WechatService
+	Cipher *utils.TokenCipher
+}
+
+// NewWechatSyncService 创建新的微信资料同步服务
+func NewWechatSyncService(db *gorm.DB, wechat *WechatService, cipher *utils.TokenCipher) *WechatSyncService {
+	return &WechatSyncService{
+		DB:     db,
+		Wechat: wechat,
+		Cipher: cipher,
+	}
+}
+
+// RefreshToken 刷新绑定的访问令牌，并加密保存新的令牌
+func (s *WechatSyncService) RefreshToken(account *models.OAuthAccount) (string, error) {
+	refreshToken, err := s.Cipher.Decrypt(account.RefreshToken, utils.CipherAAD("oauth_accounts", account.ID, "refresh_token"))
+	if err != nil {
+		return "", err
+	}
+	if refreshToken == "" {
+		return "", ErrWechatRefreshExpired
+	}
+
+	tokenResp, err := s.Wechat.RefreshAccessToken(refreshToken)
+	if err != nil {
+		if errors.Is(err, ErrWechatAuthFailed) {
+			// 刷新令牌已过期或被撤销，清除保存的令牌
+			if err := s.DB.Model(account).Updates(map[string]interface{}{
+				"access_token":     nil,
+				"refresh_token":    nil,
+				"token_expires_at": nil,
+			}).Error; err != nil {
+				return "", err
+			}
+			return "", fmt.Errorf("%w: %v", ErrWechatRefreshExpired, err)
+		}
+		return "", err
+	}
+
+	// 加密保存新的令牌
+	encryptedAccess, err := s.Cipher.Encrypt(tokenResp.AccessToken, utils.CipherAAD("oauth_accounts", account.ID, "access_token"))
+	if err != nil {
+		return "", err
+	}
+	updates := map[string]interface{}{
+		"access_token":     encryptedAccess,
+		"token_expires_at": time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second),
+	}
+	if tokenResp.RefreshToken != "" {
+		encryptedRefresh, err := s.Cipher.Encrypt(tokenResp.RefreshToken, utils.CipherAAD("oauth_accounts", account.ID, "refresh_token"))
+		if err != nil {
+			return "", err
+		}
+		updates["refresh_token"] = encryptedRefresh
+	}
+	if err := s.DB.Model(account).Updates(updates).Error; err != nil {
+		return "", err
+	}
+
+	return tokenResp.AccessToken, nil
+}
+
+// accessToken 获取有效的访问令牌，即将过期时自动刷新
+func (s *WechatSyncService) accessToken(account *models.OAuthAccount) (string, error) {
+	if account.TokenExpiresAt != nil && account.TokenExpiresAt.After(time.Now().Add(time.Minute)) {
+		accessToken, err := s.Cipher.Decrypt(account.AccessToken, utils.CipherAAD("oauth_accounts", account.ID, "access_token"))
+		if err != nil {
+			return "", err
+		}
+		if accessToken != "" {
+			return accessToken, nil
+		}
+	}
+	return s.RefreshToken(account)
+}
+
+// SyncAccount 从微信同步资料到用户
+// 仅当用户的昵称/头像为空或仍是上次从微信同步的值（即用户未自定义）时才更新
+func (s *WechatSyncService) SyncAccount(account *models.OAuthAccount) (*models.User, error) {
+	accessToken, err := s.accessToken(account)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := s.Wechat.GetUserInfo(accessToken, account.ProviderUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.DB.First(&user, account.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if userInfo.Nickname != "" && userInfo.Nickname != user.Nickname &&
+		(user.Nickname == "" || user.Nickname == account.SyncedNickname) {
+		updates["nickname"] = userInfo.Nickname
+	}
+	if userInfo.HeadImgURL != "" && userInfo.HeadImgURL != user.Avatar &&
+		(user.Avatar == "" || user.Avatar == account.SyncedAvatar) {
+		updates["avatar"] = userInfo.HeadImgURL
+	}
+
+	if len(updates) > 0 {
+		if err := s.DB.Model(&user).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		// 重新获取用户信息
+		if err := s.DB.First(&user, account.UserID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	// 记录本次同步的资料，用于判断用户是否自定义过
+	if err := s.DB.Model(account).Updates(map[string]interface{}{
+		"synced_nickname": userInfo.Nickname,
+		"synced_avatar":   userInfo.HeadImgURL,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// SyncUser 同步指定用户绑定的微信资料
+func (s *WechatSyncService) SyncUser(userID uint) (*models.User, error) {
+	var account models.OAuthAccount
+	err := s.DB.Where("user_id = ? AND provider = ? AND refresh_token IS NOT NULL AND refresh_token <> ''", userID, "wechat").
+		Order("updated_at DESC").First(&account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWechatNotBound
+		}
+		return nil, err
+	}
+
+	return s.SyncAccount(&account)
+}
+
+// SyncAll 同步所有保存了令牌的微信绑定，返回成功同步的数量
+func (s *WechatSyncService) SyncAll() (int, error) {
+	var accounts []models.OAuthAccount
+	err := s.DB.Where("provider = ? AND refresh_token IS NOT NULL AND refresh_token <> ''", "wechat").
+		Find(&accounts).Error
+	if err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	for i := range accounts {
+		if _, err := s.SyncAccount(&accounts[i]); err != nil {
+			log.Printf("同步微信资料失败 (绑定ID %d): %v", accounts[i].ID, err)
+			continue
+		}
+		synced++
+	}
+
+	return synced, nil
+}
+
+// StartPeriodicSync 启动定时同步任务，返回停止函数
+func (s *WechatSyncService) StartPeriodicSync(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				synced, err := s.SyncAll()
+				if err != nil {
+					log.Printf("定时同步微信资料失败: %v", err)
+					continue
+				}
+				log.Printf("定时同步微信资料完成，共同步 %d 个账号", synced)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
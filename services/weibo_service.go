@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"ios-api/config"
+)
+
+// DefaultWeiboBaseURL 微博接口默认地址
+const DefaultWeiboBaseURL = "https://api.weibo.com"
+
+// WeiboService 微博登录服务
+type WeiboService struct {
+	AppKey    string
+	AppSecret string
+	BaseURL   string       // 微博接口地址，默认 https://api.weibo.com
+	Client    *http.Client // HTTP客户端，为空时使用默认客户端
+}
+
+// NewWeiboService 创建新的微博登录服务实例
+func NewWeiboService(cfg *config.Config) *WeiboService {
+	return &WeiboService{
+		AppKey:    cfg.WeiboAppKey,
+		AppSecret: cfg.WeiboAppSecret,
+		Client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+// WeiboTokenResponse 微博访问令牌响应
+type WeiboTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	UID              string `json:"uid"`
+	Error            string `json:"error"`
+	ErrorCode        int    `json:"error_code"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// WeiboUserResponse 微博用户信息响应
+type WeiboUserResponse struct {
+	IDStr           string `json:"idstr"`
+	ScreenName      string `json:"screen_name"`
+	ProfileImageURL string `json:"profile_image_url"`
+	AvatarLarge     string `json:"avatar_large"`
+	Error           string `json:"error"`
+	ErrorCode       int    `json:"error_code"`
+}
+
+// 自定义错误
+var (
+	ErrWeiboAuthFailed     = errors.New("微博授权失败")
+	ErrWeiboUserInfoFailed = errors.New("获取微博用户信息失败")
+	ErrWeiboServerError    = errors.New("微博服务器错误")
+)
+
+// Name 提供方名称
+func (s *WeiboService) Name() string {
+	return "weibo"
+}
+
+// baseURL 获取微博接口地址
+func (s *WeiboService) baseURL() string {
+	if s.BaseURL == "" {
+		return DefaultWeiboBaseURL
+	}
+	return strings.TrimRight(s.BaseURL, "/")
+}
+
+// httpClient 获取HTTP客户端
+func (s *WeiboService) httpClient() *http.Client {
+	if s.Client == nil {
+		return http.DefaultClient
+	}
+	return s.Client
+}
+
+// AuthURL 获取微博授权链接
+func (s *WeiboService) AuthURL(redirectURI, state string) string {
+	query := url.Values{
+		"client_id":     {s.AppKey},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"state":         {state},
+	}
+	return s.baseURL() + "/oauth2/authorize?" + query.Encode()
+}
+
+// GetAccessToken 使用授权码换取访问令牌
+func (s *WeiboService) GetAccessToken(code, redirectURI string) (*WeiboTokenResponse, error) {
+	data := url.Values{
+		"client_id":     {s.AppKey},
+		"client_secret": {s.AppSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.baseURL()+"/oauth2/access_token", strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWeiboServerError, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tokenResp WeiboTokenResponse
+	if _, err := doJSON(s.httpClient(), req, &tokenResp); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWeiboServerError, err)
+	}
+
+	// 检查错误
+	if tokenResp.ErrorCode != 0 || tokenResp.Error != "" {
+		return nil, fmt.Errorf("%w: %d %s", ErrWeiboAuthFailed, tokenResp.ErrorCode, tokenResp.Error)
+	}
+	if tokenResp.AccessToken == "" || tokenResp.UID == "" {
+		return nil, fmt.Errorf("%w: 响应中缺少access_token或uid", ErrWeiboAuthFailed)
+	}
+
+	return &tokenResp, nil
+}
+
+// GetUserInfo 获取微博用户信息
+func (s *WeiboService) GetUserInfo(accessToken, uid string) (*WeiboUserResponse, error) {
+	query := url.Values{
+		"access_token": {accessToken},
+		"uid":          {uid},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.baseURL()+"/2/users/show.json?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWeiboServerError, err)
+	}
+
+	var userInfo WeiboUserResponse
+	if _, err := doJSON(s.httpClient(), req, &userInfo); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWeiboServerError, err)
+	}
+
+	// 检查错误
+	if userInfo.ErrorCode != 0 || userInfo.Error != "" {
+		return nil, fmt.Errorf("%w: %d %s", ErrWeiboUserInfoFailed, userInfo.ErrorCode, userInfo.Error)
+	}
+
+	return &userInfo, nil
+}
+
+// ExchangeCode 使用授权码换取用户信息
+func (s *WeiboService) ExchangeCode(code, redirectURI string) (*OAuthLoginParams, error) {
+	if code == "" {
+		return nil, ErrOAuthCodeInvalid
+	}
+
+	tokenResp, err := s.GetAccessToken(code, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	userInfo, err := s.GetUserInfo(tokenResp.AccessToken, tokenResp.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 优先使用高清头像
+	avatar := userInfo.AvatarLarge
+	if avatar == "" {
+		avatar = userInfo.ProfileImageURL
+	}
+
+	// 构建OAuth登录参数
+	expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	params := &OAuthLoginParams{
+		Provider:       "weibo",
+		ProviderUserID: tokenResp.UID,
+		Nickname:       userInfo.ScreenName,
+		Avatar:         avatar,
+		AccessToken:    tokenResp.AccessToken,
+		TokenExpiresAt: &expiresAt,
+	}
+
+	return params, nil
+}
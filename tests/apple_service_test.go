@@ -0,0 +1,531 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/services"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// generateApplePrivateKeyPEM 生成测试用的P8格式私钥
+func generateApplePrivateKeyPEM(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成测试私钥失败: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("序列化测试私钥失败: %v", err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// buildAppleIdToken 构造未经苹果签名的ID令牌（用于验证伪造令牌被拒绝）
+func buildAppleIdToken(payload map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "TEST"})
+	body, _ := json.Marshal(payload)
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(body) + ".c2lnbmF0dXJl"
+}
+
+// newTestAppleService 创建指向本地模拟服务的苹果服务
+func newTestAppleService(t *testing.T, baseURL string) (*services.AppleService, *ecdsa.PrivateKey) {
+	key, keyPEM := generateApplePrivateKeyPEM(t)
+	return &services.AppleService{
+		TeamID:     "TEAMID",
+		KeyID:      "KEYID",
+		PrivateKey: keyPEM,
+		BundleID:   "com.example.app",
+		BaseURL:    baseURL,
+		Client:     &http.Client{Timeout: 2 * time.Second},
+	}, key
+}
+
+// signAppleIdToken 使用模拟苹果公钥对应的私钥签发ID令牌
+func signAppleIdToken(t *testing.T, key *rsa.PrivateKey, payload map[string]interface{}) string {
+	return signAppleJWT(t, key, "APPLEKEY", jwt.MapClaims(payload))
+}
+
+func validAppleIdTokenPayload() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://appleid.apple.com",
+		"aud":   "com.example.app",
+		"sub":   "001234.apple.user",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"email": "relay@privaterelay.appleid.com",
+	}
+}
+
+func TestAppleService_HandleCallback_CodeSuccess(t *testing.T) {
+	var form map[string]string
+	var service *services.AppleService
+	var key *ecdsa.PrivateKey
+	var appleKey *rsa.PrivateKey
+
+	server, appleKey := newAppleKeysServer(t, "APPLEKEY", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		r.ParseForm()
+		form = map[string]string{
+			"client_id":  r.PostForm.Get("client_id"),
+			"code":       r.PostForm.Get("code"),
+			"grant_type": r.PostForm.Get("grant_type"),
+		}
+
+		// 校验客户端密钥签名
+		secret, err := jwt.Parse(r.PostForm.Get("client_secret"), func(token *jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "KEYID", secret.Header["kid"])
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "ACCESS",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "REFRESH",
+			"id_token":      signAppleIdToken(t, appleKey, validAppleIdTokenPayload()),
+		})
+	})
+	defer server.Close()
+
+	service, key = newTestAppleService(t, server.URL)
+	params, err := service.HandleCallback("CODE", "", "张三", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "apple", params.Provider)
+	assert.Equal(t, "001234.apple.user", params.ProviderUserID)
+	assert.Equal(t, "张三", params.Nickname)
+	assert.Equal(t, "relay@privaterelay.appleid.com", params.Email)
+	assert.Equal(t, "REFRESH", params.RefreshToken)
+	assert.Equal(t, map[string]string{"client_id": "com.example.app", "code": "CODE", "grant_type": "authorization_code"}, form)
+}
+
+func TestAppleService_HandleCallback_IdTokenOnly(t *testing.T) {
+	server, appleKey := newAppleKeysServer(t, "APPLEKEY", nil)
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+
+	params, err := service.HandleCallback("", signAppleIdToken(t, appleKey, validAppleIdTokenPayload()), "", "given@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "001234.apple.user", params.ProviderUserID)
+	assert.Equal(t, "Apple User", params.Nickname)
+	assert.Equal(t, "given@example.com", params.Email)
+
+	_, err = service.HandleCallback("", "", "", "")
+	assert.ErrorIs(t, err, services.ErrAppleCodeInvalid)
+}
+
+func TestAppleService_HandleCallback_ProviderError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant"}`)
+	}))
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+	_, err := service.HandleCallback("EXPIRED", "", "", "")
+	assert.ErrorIs(t, err, services.ErrAppleAuthFailed)
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+func TestAppleService_HandleCallback_InvalidIdToken(t *testing.T) {
+	payload := validAppleIdTokenPayload()
+	payload["iss"] = "https://evil.example.com"
+
+	var appleKey *rsa.PrivateKey
+	server, appleKey := newAppleKeysServer(t, "APPLEKEY", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id_token": signAppleIdToken(t, appleKey, payload)})
+	})
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+	_, err := service.HandleCallback("CODE", "", "", "")
+	assert.ErrorIs(t, err, services.ErrAppleTokenInvalid)
+}
+
+func TestAppleService_ValidateIdToken_Rejected(t *testing.T) {
+	server, appleKey := newAppleKeysServer(t, "APPLEKEY", nil)
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	expired := validAppleIdTokenPayload()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	otherAudience := validAppleIdTokenPayload()
+	otherAudience["aud"] = "com.other.app"
+	noExpiry := validAppleIdTokenPayload()
+	delete(noExpiry, "exp")
+
+	cases := map[string]string{
+		"未签名的令牌":  buildAppleIdToken(validAppleIdTokenPayload()),
+		"其他密钥签名":  signAppleIdToken(t, otherKey, validAppleIdTokenPayload()),
+		"已过期":     signAppleIdToken(t, appleKey, expired),
+		"缺少过期时间":  signAppleIdToken(t, appleKey, noExpiry),
+		"受众不匹配":   signAppleIdToken(t, appleKey, otherAudience),
+		"格式错误的令牌": "not-a-jwt",
+	}
+	for name, idToken := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := service.ValidateIdToken(idToken)
+			assert.ErrorIs(t, err, services.ErrAppleTokenInvalid)
+		})
+	}
+}
+
+func TestAppleService_HandleCallback_MalformedJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html>503 Service Unavailable</html>`)
+	}))
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+	_, err := service.HandleCallback("CODE", "", "", "")
+	assert.ErrorIs(t, err, services.ErrAppleServerError)
+}
+
+func TestAppleService_HandleCallback_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	service, _ := newTestAppleService(t, server.URL)
+	service.Client = &http.Client{Timeout: 100 * time.Millisecond}
+
+	_, err := service.HandleCallback("CODE", "", "", "")
+	assert.ErrorIs(t, err, services.ErrAppleServerError)
+	assert.Contains(t, err.Error(), "Client.Timeout")
+}
+
+func TestAppleService_HandleCallback_BadPrivateKey(t *testing.T) {
+	service, _ := newTestAppleService(t, "http://127.0.0.1:0")
+	service.PrivateKey = "not a pem"
+
+	_, err := service.HandleCallback("CODE", "", "", "")
+	assert.ErrorIs(t, err, services.ErrApplePrivateKeyError)
+}
+
+// newAppleKeysServer 创建提供苹果公钥的本地模拟服务，tokenHandler 不为空时同时模拟令牌接口
+func newAppleKeysServer(t *testing.T, kid string, tokenHandler http.HandlerFunc) (*httptest.Server, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成测试RSA密钥失败: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	if tokenHandler != nil {
+		mux.HandleFunc("/auth/token", tokenHandler)
+	}
+	return httptest.NewServer(mux), key
+}
+
+// signAppleJWT 使用测试RSA密钥签发模拟苹果JWT
+func signAppleJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("签发测试JWT失败: %v", err)
+	}
+	return signed
+}
+
+func appleNotificationClaims(events string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":    "https://appleid.apple.com",
+		"aud":    "com.example.app",
+		"iat":    time.Now().Unix(),
+		"jti":    "notification-id",
+		"events": events,
+	}
+}
+
+func TestAppleService_VerifyNotification(t *testing.T) {
+	server, key := newAppleKeysServer(t, "APPLEKEY", nil)
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+
+	events := `{"type":"email-disabled","sub":"001234.apple.user","email":"relay@privaterelay.appleid.com","is_private_email":"true","event_time":1700000000000}`
+	event, err := service.VerifyNotification(signAppleJWT(t, key, "APPLEKEY", appleNotificationClaims(events)))
+
+	assert.NoError(t, err)
+	assert.Equal(t, services.AppleEventEmailDisabled, event.Type)
+	assert.Equal(t, "001234.apple.user", event.Sub)
+	assert.Equal(t, "relay@privaterelay.appleid.com", event.Email)
+}
+
+func TestAppleService_VerifyNotification_Rejected(t *testing.T) {
+	server, key := newAppleKeysServer(t, "APPLEKEY", nil)
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+	events := `{"type":"consent-revoked","sub":"001234.apple.user","event_time":1700000000000}`
+
+	t.Run("其他密钥签名", func(t *testing.T) {
+		otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+		_, err := service.VerifyNotification(signAppleJWT(t, otherKey, "APPLEKEY", appleNotificationClaims(events)))
+		assert.ErrorIs(t, err, services.ErrAppleNotificationInvalid)
+	})
+
+	t.Run("受众不匹配", func(t *testing.T) {
+		claims := appleNotificationClaims(events)
+		claims["aud"] = "com.other.app"
+		_, err := service.VerifyNotification(signAppleJWT(t, key, "APPLEKEY", claims))
+		assert.ErrorIs(t, err, services.ErrAppleNotificationInvalid)
+	})
+
+	t.Run("发行者不匹配", func(t *testing.T) {
+		claims := appleNotificationClaims(events)
+		claims["iss"] = "https://evil.example.com"
+		_, err := service.VerifyNotification(signAppleJWT(t, key, "APPLEKEY", claims))
+		assert.ErrorIs(t, err, services.ErrAppleNotificationInvalid)
+	})
+
+	t.Run("未知的kid", func(t *testing.T) {
+		_, err := service.VerifyNotification(signAppleJWT(t, key, "UNKNOWN", appleNotificationClaims(events)))
+		assert.ErrorIs(t, err, services.ErrAppleNotificationInvalid)
+	})
+
+	t.Run("缺少事件", func(t *testing.T) {
+		claims := appleNotificationClaims(events)
+		delete(claims, "events")
+		_, err := service.VerifyNotification(signAppleJWT(t, key, "APPLEKEY", claims))
+		assert.ErrorIs(t, err, services.ErrAppleNotificationInvalid)
+	})
+
+	t.Run("未签名的令牌", func(t *testing.T) {
+		_, err := service.VerifyNotification(buildAppleIdToken(map[string]interface{}{"events": events}))
+		assert.ErrorIs(t, err, services.ErrAppleNotificationInvalid)
+	})
+}
+
+func TestAppleService_ValidateRefreshToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/auth/token", r.URL.Path)
+		r.ParseForm()
+		assert.Equal(t, "refresh_token", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "com.example.app", r.PostForm.Get("client_id"))
+
+		switch r.PostForm.Get("refresh_token") {
+		case "VALID":
+			fmt.Fprint(w, `{"access_token":"ACCESS","token_type":"Bearer","expires_in":3600,"id_token":"x.y.z"}`)
+		case "REVOKED":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+		}
+	}))
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+
+	tokenResp, err := service.ValidateRefreshToken("VALID")
+	assert.NoError(t, err)
+	assert.Equal(t, "ACCESS", tokenResp.AccessToken)
+
+	_, err = service.ValidateRefreshToken("REVOKED")
+	assert.ErrorIs(t, err, services.ErrAppleTokenRevoked)
+
+	_, err = service.ValidateRefreshToken("OTHER")
+	assert.ErrorIs(t, err, services.ErrAppleAuthFailed)
+	assert.NotErrorIs(t, err, services.ErrAppleTokenRevoked)
+}
+
+func TestAppleService_RevokeToken(t *testing.T) {
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/auth/revoke", r.URL.Path)
+		r.ParseForm()
+		form = map[string]string{
+			"client_id":       r.PostForm.Get("client_id"),
+			"token":           r.PostForm.Get("token"),
+			"token_type_hint": r.PostForm.Get("token_type_hint"),
+		}
+		assert.NotEmpty(t, r.PostForm.Get("client_secret"))
+		if r.PostForm.Get("token") == "BAD" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_request"}`)
+		}
+	}))
+	defer server.Close()
+
+	service, _ := newTestAppleService(t, server.URL)
+
+	err := service.RevokeToken("REFRESH", "refresh_token")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"client_id": "com.example.app", "token": "REFRESH", "token_type_hint": "refresh_token"}, form)
+
+	err = service.RevokeToken("BAD", "refresh_token")
+	assert.ErrorIs(t, err, services.ErrAppleAuthFailed)
+	assert.Contains(t, err.Error(), "invalid_request")
+}
+
+func TestAppleTokenService_RevokeTokensRetries(t *testing.T) {
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		token := r.PostForm.Get("token")
+		mu.Lock()
+		attempts[token]++
+		count := attempts[token]
+		mu.Unlock()
+		// FLAKY第一次失败后成功，BAD始终失败
+		if token == "BAD" || (token == "FLAKY" && count == 1) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	apple, _ := newTestAppleService(t, server.URL)
+	service := &services.AppleTokenService{Apple: apple}
+
+	assert.NoError(t, service.RevokeTokens([]string{"FLAKY", "OK"}, time.Millisecond))
+	assert.Equal(t, 2, attempts["FLAKY"])
+	assert.Equal(t, 1, attempts["OK"])
+
+	// 重试次数用尽后返回错误，不影响其他令牌的撤销
+	err := service.RevokeTokens([]string{"BAD", "OK"}, time.Millisecond)
+	assert.ErrorIs(t, err, services.ErrAppleAuthFailed)
+	assert.Equal(t, 3, attempts["BAD"])
+	assert.Equal(t, 2, attempts["OK"])
+}
+
+func TestAppleService_ClientSecretCached(t *testing.T) {
+	service, key := newTestAppleService(t, "http://127.0.0.1:0")
+
+	first, err := service.GenerateClientSecret()
+	assert.NoError(t, err)
+
+	// ES256签名带随机数，相同字符串说明复用了缓存
+	second, err := service.GenerateClientSecret()
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	token, err := jwt.Parse(first, func(token *jwt.Token) (interface{}, error) {
+		return &key.PublicKey, nil
+	})
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	exp := time.Unix(int64(claims["exp"].(float64)), 0)
+	assert.WithinDuration(t, time.Now().Add(services.AppleClientSecretMaxTTL), exp, time.Minute)
+	assert.Equal(t, "TEAMID", claims["iss"])
+	assert.Equal(t, "com.example.app", claims["sub"])
+}
+
+func TestAppleService_ClientSecretRenewedNearExpiry(t *testing.T) {
+	service, _ := newTestAppleService(t, "http://127.0.0.1:0")
+	service.ClientSecretTTL = time.Minute // 短于提前续签时间，每次都会重新签名
+
+	first, err := service.GenerateClientSecret()
+	assert.NoError(t, err)
+	second, err := service.GenerateClientSecret()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
+
+func TestAppleService_ClientSecretConcurrent(t *testing.T) {
+	service, _ := newTestAppleService(t, "http://127.0.0.1:0")
+
+	var wg sync.WaitGroup
+	secrets := make([]string, 20)
+	for i := range secrets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			secrets[i], _ = service.GenerateClientSecret()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, secret := range secrets {
+		assert.Equal(t, secrets[0], secret)
+	}
+}
+
+func TestAppleService_LoadPrivateKeySources(t *testing.T) {
+	key, keyPEM := generateApplePrivateKeyPEM(t)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	keyFile := filepath.Join(t.TempDir(), "AuthKey_TEST.p8")
+	assert.NoError(t, os.WriteFile(keyFile, []byte(keyPEM), 0600))
+
+	cases := map[string]*services.AppleService{
+		"PEM内容":      {PrivateKey: keyPEM},
+		"转义换行的PEM":   {PrivateKey: strings.ReplaceAll(keyPEM, "\n", `\n`)},
+		"文件路径":       {PrivateKey: keyFile},
+		"base64 PEM": {PrivateKeyBase64: base64.StdEncoding.EncodeToString([]byte(keyPEM))},
+		"base64 DER": {PrivateKeyBase64: base64.StdEncoding.EncodeToString(der)},
+	}
+	for name, service := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, service.LoadPrivateKey())
+		})
+	}
+
+	bad := map[string]*services.AppleService{
+		"未配置":       {},
+		"文件不存在":     {PrivateKey: filepath.Join(t.TempDir(), "missing.p8")},
+		"无效base64":  {PrivateKeyBase64: "!!!"},
+		"base64非私钥": {PrivateKeyBase64: base64.StdEncoding.EncodeToString([]byte("hello"))},
+	}
+	for name, service := range bad {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, service.LoadPrivateKey(), services.ErrApplePrivateKeyError)
+		})
+	}
+}
+
+func TestNewAppleService_FailsFastOnBadKey(t *testing.T) {
+	_, err := services.NewAppleService(&config.Config{ApplePrivateKey: "./does-not-exist.p8"})
+	assert.ErrorIs(t, err, services.ErrApplePrivateKeyError)
+
+	// 未配置私钥时允许启动（不启用苹果登录）
+	service, err := services.NewAppleService(&config.Config{})
+	assert.NoError(t, err)
+	assert.False(t, service.HasPrivateKey())
+}
@@ -0,0 +1,279 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/controllers"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeJWTKey 将私钥以PKCS#8格式写入 <dir>/<kid>.pem
+func writeJWTKey(t *testing.T, dir, kid string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600))
+}
+
+// writeJWTPublicKey 将公钥写入 <dir>/<kid>.pem（仅用于验证的旧密钥）
+func writeJWTPublicKey(t *testing.T, dir, kid string, key interface{}) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600))
+}
+
+func testJWTClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"user_id": 42,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func parseWithKeySet(keys *services.JWTKeySet, tokenString string) error {
+	_, err := jwt.Parse(tokenString, keys.Keyfunc)
+	return err
+}
+
+func TestJWTKeySet_SignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	writeJWTKey(t, dir, "ec-1", ecKey)
+	writeJWTKey(t, dir, "rsa-1", rsaKey)
+
+	for kid, alg := range map[string]string{"ec-1": "ES256", "rsa-1": "RS256"} {
+		keys, err := services.LoadJWTKeySet(&config.Config{
+			JWTKeysDir:      dir,
+			JWTSigningKeyID: kid,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, kid, keys.SigningKeyID())
+
+		tokenString, err := keys.Sign(testJWTClaims())
+		assert.NoError(t, err)
+
+		token, err := jwt.Parse(tokenString, keys.Keyfunc)
+		assert.NoError(t, err)
+		assert.True(t, token.Valid)
+		assert.Equal(t, kid, token.Header["kid"])
+		assert.Equal(t, alg, token.Method.Alg())
+	}
+}
+
+func TestJWTKeySet_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	writeJWTKey(t, dir, "2024-01", oldKey)
+
+	oldKeys, err := services.LoadJWTKeySet(&config.Config{JWTKeysDir: dir, JWTSigningKeyID: "2024-01"})
+	assert.NoError(t, err)
+	oldToken, err := oldKeys.Sign(testJWTClaims())
+	assert.NoError(t, err)
+
+	// 轮换：加入新密钥并切换签名kid，旧密钥只保留公钥
+	writeJWTKey(t, dir, "2024-02", newKey)
+	writeJWTPublicKey(t, dir, "2024-01", &oldKey.PublicKey)
+	keys, err := services.LoadJWTKeySet(&config.Config{JWTKeysDir: dir, JWTSigningKeyID: "2024-02"})
+	assert.NoError(t, err)
+
+	newToken, err := keys.Sign(testJWTClaims())
+	assert.NoError(t, err)
+	assert.NoError(t, parseWithKeySet(keys, newToken))
+	// 旧令牌仍然有效，用户不会被登出
+	assert.NoError(t, parseWithKeySet(keys, oldToken))
+
+	// 只有公钥的密钥不能用于签名
+	_, err = services.LoadJWTKeySet(&config.Config{JWTKeysDir: dir, JWTSigningKeyID: "2024-01"})
+	assert.True(t, errors.Is(err, services.ErrJWTSigningKeyNotFound))
+}
+
+func TestJWTKeySet_RejectsUnknownKidAndAlgorithmConfusion(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writeJWTKey(t, dir, "rsa-1", rsaKey)
+	keys, err := services.LoadJWTKeySet(&config.Config{
+		JWTKeysDir:           dir,
+		JWTSigningKeyID:      "rsa-1",
+		JWTSecret:            "legacy_secret",
+		JWTAcceptLegacyHS256: true,
+	})
+	assert.NoError(t, err)
+
+	// 未知kid
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, testJWTClaims())
+	token.Header["kid"] = "unknown"
+	tokenString, _ := token.SignedString(otherKey)
+	assert.Error(t, parseWithKeySet(keys, tokenString))
+
+	// 用RSA公钥作为HMAC密钥伪造令牌
+	pubDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, testJWTClaims())
+	token.Header["kid"] = "rsa-1"
+	tokenString, _ = token.SignedString(pubPEM)
+	assert.Error(t, parseWithKeySet(keys, tokenString))
+
+	// alg=none
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, testJWTClaims())
+	tokenString, _ = token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	assert.Error(t, parseWithKeySet(keys, tokenString))
+}
+
+func TestJWTKeySet_LegacyHS256(t *testing.T) {
+	dir := t.TempDir()
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	writeJWTKey(t, dir, "ec-1", ecKey)
+
+	legacyToken, err := services.NewHS256KeySet("legacy_secret").Sign(testJWTClaims())
+	assert.NoError(t, err)
+
+	cfg := &config.Config{
+		JWTKeysDir:           dir,
+		JWTSigningKeyID:      "ec-1",
+		JWTSecret:            "legacy_secret",
+		JWTAcceptLegacyHS256: true,
+	}
+	keys, err := services.LoadJWTKeySet(cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, parseWithKeySet(keys, legacyToken))
+
+	// 迁移完成后不再接受HS256令牌
+	cfg.JWTAcceptLegacyHS256 = false
+	keys, err = services.LoadJWTKeySet(cfg)
+	assert.NoError(t, err)
+	assert.Error(t, parseWithKeySet(keys, legacyToken))
+}
+
+func TestParseJWTKey_Invalid(t *testing.T) {
+	_, err := services.ParseJWTKey("bad", []byte("not a pem"))
+	assert.True(t, errors.Is(err, services.ErrJWTKeyInvalid))
+
+	// RSA密钥长度不足
+	weakKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakKey)})
+	_, err = services.ParseJWTKey("weak", data)
+	assert.True(t, errors.Is(err, services.ErrJWTKeyInvalid))
+
+	// 不支持的曲线
+	p384Key, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(p384Key)
+	_, err = services.ParseJWTKey("p384", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	assert.True(t, errors.Is(err, services.ErrJWTKeyInvalid))
+}
+
+func TestJWKSController(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writeJWTKey(t, dir, "ec-1", ecKey)
+	writeJWTPublicKey(t, dir, "rsa-old", &rsaKey.PublicKey)
+	keys, err := services.LoadJWTKeySet(&config.Config{JWTKeysDir: dir, JWTSigningKeyID: "ec-1"})
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/.well-known/jwks.json", (&controllers.JWKSController{Keys: keys}).JWKS)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "max-age")
+
+	var set services.JSONWebKeySet
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	assert.Len(t, set.Keys, 2)
+
+	assert.Equal(t, "ec-1", set.Keys[0].Kid)
+	assert.Equal(t, "EC", set.Keys[0].Kty)
+	assert.Equal(t, "ES256", set.Keys[0].Alg)
+	assert.Equal(t, "P-256", set.Keys[0].Crv)
+	assert.Len(t, set.Keys[0].X, 43)
+	assert.Len(t, set.Keys[0].Y, 43)
+
+	assert.Equal(t, "rsa-old", set.Keys[1].Kid)
+	assert.Equal(t, "RSA", set.Keys[1].Kty)
+	assert.Equal(t, "RS256", set.Keys[1].Alg)
+	assert.Equal(t, "AQAB", set.Keys[1].E)
+	assert.NotEmpty(t, set.Keys[1].N)
+
+	// 使用HS256时不发布任何密钥
+	r = gin.New()
+	r.GET("/.well-known/jwks.json", (&controllers.JWKSController{Keys: services.NewHS256KeySet("secret")}).JWKS)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.JSONEq(t, `{"keys":[]}`, w.Body.String())
+}
+
+func TestConfigValidate_DefaultSecret(t *testing.T) {
+	strong := "a_strong_random_secret"
+
+	cfg := &config.Config{
+		AppEnv:             "production",
+		JWTSecret:          config.DefaultJWTSecret,
+		OAuthStateSecret:   strong,
+		TokenEncryptionKey: strong,
+		SmsProvider:        "aliyun",
+	}
+	assert.True(t, errors.Is(cfg.Validate(), config.ErrDefaultSecret))
+
+	// 开发环境允许默认密钥
+	cfg.AppEnv = "development"
+	assert.NoError(t, cfg.Validate())
+
+	// 使用非对称签名且不再接受HS256令牌时，JWT_SECRET 不参与签名
+	cfg.AppEnv = "production"
+	cfg.JWTSigningKeyID = "ec-1"
+	assert.NoError(t, cfg.Validate())
+	cfg.JWTAcceptLegacyHS256 = true
+	assert.Error(t, cfg.Validate())
+
+	// 继承默认JWT密钥的其他密钥
+	cfg = &config.Config{
+		AppEnv:             "staging",
+		JWTSecret:          strong,
+		OAuthStateSecret:   strong,
+		TokenEncryptionKey: config.DefaultJWTSecret,
+		SmsProvider:        "aliyun",
+	}
+	assert.True(t, errors.Is(cfg.Validate(), config.ErrDefaultSecret))
+
+	// 由默认JWT密钥派生的state密钥
+	cfg.TokenEncryptionKey = strong
+	cfg.OAuthStateSecret = config.DeriveSecret(config.DefaultJWTSecret, "oauth-state")
+	assert.True(t, errors.Is(cfg.Validate(), config.ErrDefaultSecret))
+	cfg.OAuthStateSecret = config.DeriveSecret(strong, "oauth-state")
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestDeriveSecret(t *testing.T) {
+	// 派生密钥固定，且与主密钥和其他用途的密钥不同
+	derived := config.DeriveSecret("secret", "oauth-state")
+	assert.Equal(t, derived, config.DeriveSecret("secret", "oauth-state"))
+	assert.NotEqual(t, "secret", derived)
+	assert.NotEqual(t, derived, config.DeriveSecret("secret", "token-encryption"))
+	assert.NotEqual(t, derived, config.DeriveSecret("other", "oauth-state"))
+}
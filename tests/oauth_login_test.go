@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ios-api/controllers"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newOAuthLoginTestRouter 创建只包含第三方登录接口的测试路由（不访问数据库）
+func newOAuthLoginTestRouter(t *testing.T, allowUnsigned bool) (*gin.Engine, *services.RequestSigner) {
+	gin.SetMode(gin.TestMode)
+
+	server, _ := newAppleKeysServer(t, "APPLEKEY", nil)
+	t.Cleanup(server.Close)
+	apple, _ := newTestAppleService(t, server.URL)
+
+	signer := services.NewRequestSigner("signing_secret")
+	controller := &controllers.UserController{
+		Providers:               services.NewOAuthRegistry(&services.WechatService{}, apple),
+		StateService:            services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"}),
+		LoginSigner:             signer,
+		AllowUnsignedOAuthLogin: allowUnsigned,
+	}
+
+	r := gin.New()
+	r.POST("/api/v1/oauth/login", controller.OAuthLogin)
+	return r, signer
+}
+
+func postOAuthLogin(router *gin.Engine, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/oauth/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOAuthLogin_RejectsUnsignedProviderUserID(t *testing.T) {
+	router, _ := newOAuthLoginTestRouter(t, false)
+
+	// 仅凭第三方用户ID无法登录
+	w := postOAuthLogin(router, `{"provider":"apple","provider_user_id":"001234.apple.user"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOAuthLogin_RejectsTamperedSignature(t *testing.T) {
+	router, signer := newOAuthLoginTestRouter(t, true)
+
+	signed := `{"provider":"wechat","provider_user_id":"OPENID"}`
+	headers := signRequestHeaders(signer, http.MethodPost, "/api/v1/oauth/login", "nonce-1", time.Now(), []byte(signed))
+
+	// 即使在迁移模式下，签名错误的请求也会被拒绝
+	w := postOAuthLogin(router, `{"provider":"wechat","provider_user_id":"VICTIM"}`, headers)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOAuthLogin_RejectsForgedAppleIdToken(t *testing.T) {
+	router, _ := newOAuthLoginTestRouter(t, false)
+
+	idToken := buildAppleIdToken(validAppleIdTokenPayload())
+	w := postOAuthLogin(router, `{"provider":"apple","id_token":"`+idToken+`"}`, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestOAuthLogin_ParamErrors(t *testing.T) {
+	router, _ := newOAuthLoginTestRouter(t, false)
+
+	w := postOAuthLogin(router, `{"provider":"facebook","code":"CODE"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "未注册的提供方")
+
+	w = postOAuthLogin(router, `{"provider":"wechat"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "缺少凭证")
+
+	// 授权码换取令牌前校验重定向地址
+	w = postOAuthLogin(router, `{"provider":"wechat","code":"CODE","redirect_uri":"https://evil.example/cb"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "重定向地址不在允许列表中")
+}
@@ -0,0 +1,467 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/controllers"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// newGoogleTestServer 创建模拟Google令牌和公钥接口的本地服务
+func newGoogleTestServer(t *testing.T, kid string, tokenHandler func(w http.ResponseWriter, r *http.Request, key *rsa.PrivateKey)) (*httptest.Server, *services.GoogleService) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成测试RSA密钥失败: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokenHandler(w, r, key)
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": kid,
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	server := httptest.NewServer(mux)
+
+	service := &services.GoogleService{
+		ClientID:      "google-client-id",
+		ClientSecret:  "google-client-secret",
+		AuthEndpoint:  server.URL + "/auth",
+		TokenEndpoint: server.URL + "/token",
+		JWKSEndpoint:  server.URL + "/certs",
+		Client:        &http.Client{Timeout: 2 * time.Second},
+	}
+	return server, service
+}
+
+func googleIdTokenClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            "google-client-id",
+		"sub":            "google-user-1",
+		"email":          "user@gmail.com",
+		"email_verified": true,
+		"name":           "Google User",
+		"picture":        "https://example.com/g.png",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestGoogleService_ExchangeCode_Success(t *testing.T) {
+	var form url.Values
+	server, service := newGoogleTestServer(t, "google-kid", func(w http.ResponseWriter, r *http.Request, key *rsa.PrivateKey) {
+		r.ParseForm()
+		form = r.PostForm
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "G_ACCESS",
+			"refresh_token": "G_REFRESH",
+			"expires_in":    3600,
+			"id_token":      signAppleJWT(t, key, "google-kid", googleIdTokenClaims()),
+		})
+	})
+	defer server.Close()
+
+	params, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "CODE", form.Get("code"))
+	assert.Equal(t, "https://example.com/oauth/cb", form.Get("redirect_uri"))
+	assert.Equal(t, "google-client-secret", form.Get("client_secret"))
+	assert.Equal(t, "authorization_code", form.Get("grant_type"))
+	assert.Equal(t, "google", params.Provider)
+	assert.Equal(t, "google-user-1", params.ProviderUserID)
+	assert.Equal(t, "user@gmail.com", params.Email)
+	assert.Equal(t, "Google User", params.Nickname)
+	assert.Equal(t, "https://example.com/g.png", params.Avatar)
+	assert.Equal(t, "G_REFRESH", params.RefreshToken)
+	assert.NotNil(t, params.TokenExpiresAt)
+}
+
+func TestGoogleService_ExchangeCode_UnverifiedEmailIgnored(t *testing.T) {
+	server, service := newGoogleTestServer(t, "google-kid", func(w http.ResponseWriter, r *http.Request, key *rsa.PrivateKey) {
+		claims := googleIdTokenClaims()
+		claims["email_verified"] = "false"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "G_ACCESS",
+			"id_token":     signAppleJWT(t, key, "google-kid", claims),
+		})
+	})
+	defer server.Close()
+
+	params, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+	assert.NoError(t, err)
+	assert.Empty(t, params.Email)
+}
+
+func TestGoogleService_ExchangeCode_Rejected(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成测试RSA密钥失败: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		idToken func(key *rsa.PrivateKey) string
+	}{
+		{"受众不匹配", func(key *rsa.PrivateKey) string {
+			claims := googleIdTokenClaims()
+			claims["aud"] = "other-client"
+			return signAppleJWT(t, key, "google-kid", claims)
+		}},
+		{"发行者不匹配", func(key *rsa.PrivateKey) string {
+			claims := googleIdTokenClaims()
+			claims["iss"] = "https://evil.example.com"
+			return signAppleJWT(t, key, "google-kid", claims)
+		}},
+		{"已过期", func(key *rsa.PrivateKey) string {
+			claims := googleIdTokenClaims()
+			claims["exp"] = time.Now().Add(-time.Minute).Unix()
+			return signAppleJWT(t, key, "google-kid", claims)
+		}},
+		{"签名密钥不匹配", func(key *rsa.PrivateKey) string {
+			return signAppleJWT(t, otherKey, "google-kid", googleIdTokenClaims())
+		}},
+		{"未知kid", func(key *rsa.PrivateKey) string {
+			return signAppleJWT(t, key, "unknown-kid", googleIdTokenClaims())
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, service := newGoogleTestServer(t, "google-kid", func(w http.ResponseWriter, r *http.Request, key *rsa.PrivateKey) {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"access_token": "G_ACCESS",
+					"id_token":     tc.idToken(key),
+				})
+			})
+			defer server.Close()
+
+			_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+			assert.ErrorIs(t, err, services.ErrGoogleIdTokenInvalid)
+		})
+	}
+}
+
+func TestGoogleService_ExchangeCode_ProviderError(t *testing.T) {
+	server, service := newGoogleTestServer(t, "google-kid", func(w http.ResponseWriter, r *http.Request, key *rsa.PrivateKey) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Bad Request"}`)
+	})
+	defer server.Close()
+
+	_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+	assert.ErrorIs(t, err, services.ErrGoogleAuthFailed)
+	assert.Contains(t, err.Error(), "invalid_grant")
+}
+
+func TestGoogleService_AuthURL(t *testing.T) {
+	service := &services.GoogleService{ClientID: "google-client-id"}
+	authURL, err := url.Parse(service.AuthURL("https://example.com/oauth/cb", "STATE"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "accounts.google.com", authURL.Host)
+	assert.Equal(t, "google-client-id", authURL.Query().Get("client_id"))
+	assert.Equal(t, "https://example.com/oauth/cb", authURL.Query().Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", authURL.Query().Get("scope"))
+	assert.Equal(t, "STATE", authURL.Query().Get("state"))
+}
+
+// newGitHubTestServer 创建模拟GitHub接口的本地服务
+func newGitHubTestServer(tokenHandler, userHandler, emailsHandler http.HandlerFunc) (*httptest.Server, *services.GitHubService) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", tokenHandler)
+	mux.HandleFunc("/user", userHandler)
+	mux.HandleFunc("/user/emails", emailsHandler)
+	server := httptest.NewServer(mux)
+
+	service := &services.GitHubService{
+		ClientID:     "github-client-id",
+		ClientSecret: "github-client-secret",
+		BaseURL:      server.URL,
+		APIBaseURL:   server.URL,
+		Client:       &http.Client{Timeout: 2 * time.Second},
+	}
+	return server, service
+}
+
+func githubTokenOK(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, `{"access_token":"GH_ACCESS","token_type":"bearer","scope":"read:user,user:email"}`)
+}
+
+func TestGitHubService_ExchangeCode_Success(t *testing.T) {
+	var accept, authorization string
+	server, service := newGitHubTestServer(
+		func(w http.ResponseWriter, r *http.Request) {
+			accept = r.Header.Get("Accept")
+			r.ParseForm()
+			assert.Equal(t, "CODE", r.PostForm.Get("code"))
+			assert.Equal(t, "github-client-secret", r.PostForm.Get("client_secret"))
+			githubTokenOK(w, r)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+			fmt.Fprint(w, `{"id":12345,"login":"octocat","name":"","avatar_url":"https://example.com/o.png","email":null}`)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[{"email":"old@example.com","primary":false,"verified":true},{"email":"octo@example.com","primary":true,"verified":true}]`)
+		},
+	)
+	defer server.Close()
+
+	params, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", accept, "GitHub默认返回表单格式，需要声明JSON")
+	assert.Equal(t, "Bearer GH_ACCESS", authorization)
+	assert.Equal(t, "github", params.Provider)
+	assert.Equal(t, "12345", params.ProviderUserID)
+	assert.Equal(t, "octocat", params.Nickname, "未设置名字时使用登录名")
+	assert.Equal(t, "octo@example.com", params.Email, "公开邮箱为空时使用已验证的主邮箱")
+	assert.Equal(t, "GH_ACCESS", params.AccessToken)
+}
+
+func TestGitHubService_ExchangeCode_Errors(t *testing.T) {
+	t.Run("授权码无效", func(t *testing.T) {
+		server, service := newGitHubTestServer(
+			func(w http.ResponseWriter, r *http.Request) {
+				// GitHub授权失败时返回200
+				fmt.Fprint(w, `{"error":"bad_verification_code","error_description":"The code passed is incorrect or expired."}`)
+			},
+			func(w http.ResponseWriter, r *http.Request) { t.Error("授权失败后不应请求用户信息") },
+			func(w http.ResponseWriter, r *http.Request) {},
+		)
+		defer server.Close()
+
+		_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+		assert.ErrorIs(t, err, services.ErrGitHubAuthFailed)
+		assert.Contains(t, err.Error(), "bad_verification_code")
+	})
+
+	t.Run("获取用户信息失败", func(t *testing.T) {
+		server, service := newGitHubTestServer(
+			githubTokenOK,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message":"Bad credentials"}`)
+			},
+			func(w http.ResponseWriter, r *http.Request) {},
+		)
+		defer server.Close()
+
+		_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+		assert.ErrorIs(t, err, services.ErrGitHubUserInfoFailed)
+	})
+
+	t.Run("空授权码", func(t *testing.T) {
+		service := &services.GitHubService{}
+		_, err := service.ExchangeCode("", "https://example.com/oauth/cb")
+		assert.ErrorIs(t, err, services.ErrOAuthCodeInvalid)
+	})
+}
+
+// newWeiboTestServer 创建模拟微博接口的本地服务
+func newWeiboTestServer(tokenHandler, userHandler http.HandlerFunc) (*httptest.Server, *services.WeiboService) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/access_token", tokenHandler)
+	mux.HandleFunc("/2/users/show.json", userHandler)
+	server := httptest.NewServer(mux)
+
+	service := &services.WeiboService{
+		AppKey:    "weibo-app-key",
+		AppSecret: "weibo-app-secret",
+		BaseURL:   server.URL,
+		Client:    &http.Client{Timeout: 2 * time.Second},
+	}
+	return server, service
+}
+
+func TestWeiboService_ExchangeCode_Success(t *testing.T) {
+	var userQuery url.Values
+	server, service := newWeiboTestServer(
+		func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			assert.Equal(t, "CODE", r.PostForm.Get("code"))
+			assert.Equal(t, "https://example.com/oauth/cb", r.PostForm.Get("redirect_uri"))
+			fmt.Fprint(w, `{"access_token":"WB_ACCESS","expires_in":157679999,"uid":"1404376560"}`)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			userQuery = r.URL.Query()
+			fmt.Fprint(w, `{"idstr":"1404376560","screen_name":"微博用户","profile_image_url":"https://example.com/s.jpg","avatar_large":"https://example.com/l.jpg"}`)
+		},
+	)
+	defer server.Close()
+
+	params, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "WB_ACCESS", userQuery.Get("access_token"))
+	assert.Equal(t, "1404376560", userQuery.Get("uid"))
+	assert.Equal(t, "weibo", params.Provider)
+	assert.Equal(t, "1404376560", params.ProviderUserID)
+	assert.Equal(t, "微博用户", params.Nickname)
+	assert.Equal(t, "https://example.com/l.jpg", params.Avatar)
+}
+
+func TestWeiboService_ExchangeCode_Errors(t *testing.T) {
+	t.Run("授权失败", func(t *testing.T) {
+		server, service := newWeiboTestServer(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":"invalid_grant","error_code":21325,"error_description":"invalid authorization code"}`)
+			},
+			func(w http.ResponseWriter, r *http.Request) {},
+		)
+		defer server.Close()
+
+		_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+		assert.ErrorIs(t, err, services.ErrWeiboAuthFailed)
+		assert.Contains(t, err.Error(), "21325")
+	})
+
+	t.Run("获取用户信息失败", func(t *testing.T) {
+		server, service := newWeiboTestServer(
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"access_token":"WB_ACCESS","expires_in":3600,"uid":"1"}`)
+			},
+			func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, `{"error":"expired_token","error_code":21327}`)
+			},
+		)
+		defer server.Close()
+
+		_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+		assert.ErrorIs(t, err, services.ErrWeiboUserInfoFailed)
+	})
+
+	t.Run("响应格式错误", func(t *testing.T) {
+		server, service := newWeiboTestServer(
+			func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `<html>`) },
+			func(w http.ResponseWriter, r *http.Request) {},
+		)
+		defer server.Close()
+
+		_, err := service.ExchangeCode("CODE", "https://example.com/oauth/cb")
+		assert.ErrorIs(t, err, services.ErrWeiboServerError)
+	})
+}
+
+func TestOAuthRegistry_FromConfig(t *testing.T) {
+	cfg := &config.Config{GitHubClientID: "github-client-id"}
+	registry := services.NewOAuthRegistryFromConfig(cfg, &services.WechatService{}, &services.AppleService{})
+
+	// 未配置凭证的提供方不注册
+	assert.Equal(t, []string{"apple", "github", "wechat"}, registry.Names())
+	assert.True(t, registry.Has("github"))
+	assert.False(t, registry.Has("google"))
+
+	_, err := registry.Get("weibo")
+	assert.ErrorIs(t, err, services.ErrOAuthProviderNotFound)
+}
+
+// newProviderTestRouter 创建只包含通用授权路由的测试路由
+func newProviderTestRouter(registry *services.OAuthRegistry, stateService *services.OAuthStateService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	controller := &controllers.OAuthController{
+		Providers:    registry,
+		StateService: stateService,
+	}
+	r := gin.New()
+	r.POST("/api/v1/oauth/:provider/auth", controller.ProviderAuthURL)
+	r.GET("/api/v1/oauth/:provider/callback", controller.ProviderCallback)
+	return r
+}
+
+func TestOAuthController_ProviderAuthURL(t *testing.T) {
+	registry := services.NewOAuthRegistry(&services.GitHubService{ClientID: "github-client-id"}, &services.AppleService{})
+	stateService := services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"})
+	router := newProviderTestRouter(registry, stateService)
+
+	request := func(provider, redirectURI string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		body := strings.NewReader(fmt.Sprintf(`{"redirect_uri":%q}`, redirectURI))
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/oauth/"+provider+"/auth", body)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	w, resp := request("github", "https://example.com/oauth/cb")
+	assert.Equal(t, http.StatusOK, w.Code)
+	data := resp["data"].(map[string]interface{})
+	authURL, err := url.Parse(data["auth_url"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "/login/oauth/authorize", authURL.Path)
+	assert.Equal(t, data["state"], authURL.Query().Get("state"))
+
+	// nonce写入HttpOnly Cookie，签发的state只能用于同一提供方
+	var nonce *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == services.OAuthNonceCookie {
+			nonce = cookie
+		}
+	}
+	if assert.NotNil(t, nonce) {
+		assert.True(t, nonce.HttpOnly)
+		_, err = stateService.Consume("github", data["state"].(string), nonce.Value)
+		assert.NoError(t, err)
+	}
+
+	w, _ = request("google", "https://example.com/oauth/cb")
+	assert.Equal(t, http.StatusNotFound, w.Code, "未注册的提供方")
+
+	w, _ = request("apple", "https://example.com/oauth/cb")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "苹果不支持网页授权")
+
+	w, _ = request("github", "https://evil.example.com/cb")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "重定向地址不在允许列表中")
+}
+
+func TestOAuthController_ProviderCallback_RejectsBadState(t *testing.T) {
+	github := &services.GitHubService{ClientID: "github-client-id", BaseURL: "http://127.0.0.1:1"}
+	registry := services.NewOAuthRegistry(github)
+	stateService := services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"})
+	router := newProviderTestRouter(registry, stateService)
+
+	// 为其他提供方签发的state
+	state, nonce, err := stateService.Generate("google", "https://example.com/oauth/cb")
+	assert.NoError(t, err)
+	// 为GitHub签发但浏览器中没有对应nonce Cookie的state
+	attackerState, _, err := stateService.Generate("github", "https://example.com/oauth/cb")
+	assert.NoError(t, err)
+
+	for _, s := range []string{"forged", state, attackerState} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/oauth/github/callback?code=CODE&state="+url.QueryEscape(s), nil)
+		req.AddCookie(&http.Cookie{Name: services.OAuthNonceCookie, Value: nonce})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, s)
+	}
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuthStateService_GenerateAndConsume(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/wechat/cb"})
+
+	state, nonce, err := service.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, nonce)
+	assert.LessOrEqual(t, len(state), 128, "微信要求state不超过128字节")
+
+	redirectURI, err := service.Consume("wechat", state, nonce)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/wechat/cb", redirectURI)
+
+	// 同一个state只能使用一次
+	_, err = service.Consume("wechat", state, nonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+}
+
+func TestOAuthStateService_RedirectURINotAllowed(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/wechat/cb"})
+
+	_, _, err := service.Generate("wechat", "https://evil.example.com/cb")
+	assert.ErrorIs(t, err, services.ErrRedirectURINotAllowed)
+
+	// 签发后从允许列表移除的地址在回调时同样被拒绝
+	state, nonce, err := service.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+	service.AllowedRedirectURIs = nil
+	_, err = service.Consume("wechat", state, nonce)
+	assert.ErrorIs(t, err, services.ErrRedirectURINotAllowed)
+}
+
+func TestOAuthStateService_RejectsForgedState(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/wechat/cb"})
+	other := services.NewOAuthStateService("other_secret", []string{"https://example.com/wechat/cb"})
+
+	for _, state := range []string{"", "client-supplied", "a.b.c", "nonce.signature"} {
+		_, err := service.Consume("wechat", state, "nonce")
+		assert.ErrorIs(t, err, services.ErrOAuthStateInvalid, state)
+	}
+
+	// 其他密钥签发的state无效
+	state, nonce, err := other.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+	_, err = service.Consume("wechat", state, nonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+}
+
+func TestOAuthStateService_RequiresNonceCookie(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/wechat/cb"})
+
+	// 攻击者自己获取的state不能在受害者的浏览器中使用（Cookie中没有或是其他nonce）
+	state, nonce, err := service.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+	_, victimNonce, err := service.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+
+	_, err = service.Consume("wechat", state, "")
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+	_, err = service.Consume("wechat", state, victimNonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+
+	// 校验失败不消费state
+	_, err = service.Consume("wechat", state, nonce)
+	assert.NoError(t, err)
+}
+
+func TestOAuthStateService_Expired(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/wechat/cb"})
+	now := time.Now()
+	service.SetClock(func() time.Time { return now })
+
+	state, nonce, err := service.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+
+	now = now.Add(services.DefaultOAuthStateTTL + time.Second)
+	_, err = service.Consume("wechat", state, nonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateExpired)
+}
+
+func TestOAuthStateService_ConcurrentConsume(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/wechat/cb"})
+	state, nonce, err := service.Generate("wechat", "https://example.com/wechat/cb")
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	successes := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.Consume("wechat", state, nonce); err == nil {
+				mu.Lock()
+				successes++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, successes, "并发回调中只有一个请求能消费state")
+}
+
+func TestOAuthStateService_ProviderMismatch(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"})
+
+	state, nonce, err := service.Generate("github", "https://example.com/oauth/cb")
+	assert.NoError(t, err)
+
+	// 为GitHub签发的state不能用于Google回调
+	_, err = service.Consume("google", state, nonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+	_, err = service.Consume("github", state, nonce)
+	assert.NoError(t, err)
+}
+
+func TestOAuthStateService_Stateless(t *testing.T) {
+	// state自包含，回调可以由另一个实例处理；签发不占用服务端内存
+	issuer := services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"})
+	handler := services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"})
+
+	state, nonce, err := issuer.Generate("github", "https://example.com/oauth/cb")
+	assert.NoError(t, err)
+	redirectURI, err := handler.Consume("github", state, nonce)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/oauth/cb", redirectURI)
+}
+
+func TestOAuthStateService_ConsumedLimit(t *testing.T) {
+	service := services.NewOAuthStateService("state_secret", []string{"https://example.com/oauth/cb"})
+	service.MaxConsumed = 2
+	now := time.Now()
+	service.SetClock(func() time.Time { return now })
+
+	generate := func() (string, string) {
+		state, nonce, err := service.Generate("github", "https://example.com/oauth/cb")
+		assert.NoError(t, err)
+		return state, nonce
+	}
+	firstState, firstNonce := generate()
+	_, err := service.Consume("github", firstState, firstNonce)
+	assert.NoError(t, err)
+	secondState, secondNonce := generate()
+	_, err = service.Consume("github", secondState, secondNonce)
+	assert.NoError(t, err)
+
+	// 已使用的nonce记录已满时淘汰最早的记录，不拒绝新的回调
+	state, nonce := generate()
+	_, err = service.Consume("github", state, nonce)
+	assert.NoError(t, err)
+	_, err = service.Consume("github", state, nonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+	_, err = service.Consume("github", secondState, secondNonce)
+	assert.ErrorIs(t, err, services.ErrOAuthStateInvalid)
+}
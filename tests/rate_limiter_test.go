@@ -0,0 +1,69 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ios-api/middlewares"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter_Window(t *testing.T) {
+	limiter := services.NewRateLimiter(2, time.Minute)
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+
+	assert.True(t, limiter.Allow("1.2.3.4"))
+	assert.True(t, limiter.Allow("1.2.3.4"))
+	assert.False(t, limiter.Allow("1.2.3.4"))
+	// 不同IP分别计数
+	assert.True(t, limiter.Allow("5.6.7.8"))
+
+	// 窗口结束后重新计数
+	now = now.Add(time.Minute)
+	assert.True(t, limiter.Allow("1.2.3.4"))
+}
+
+func TestRateLimiter_MaxEntries(t *testing.T) {
+	limiter := services.NewRateLimiter(1, time.Minute)
+	limiter.MaxEntries = 2
+
+	assert.True(t, limiter.Allow("a"))
+	assert.True(t, limiter.Allow("b"))
+	// 记录已满时淘汰最早的key，不拒绝新的key
+	assert.True(t, limiter.Allow("c"))
+	assert.False(t, limiter.Allow("c"))
+	assert.True(t, limiter.Allow("a"))
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	limiter := services.NewRateLimiter(0, time.Minute)
+	assert.Nil(t, limiter)
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Allow("1.2.3.4"))
+	}
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/oauth/github/auth", middlewares.RateLimitByIP(services.NewRateLimiter(1, time.Minute)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(ip string) int {
+		req := httptest.NewRequest(http.MethodPost, "/oauth/github/auth", nil)
+		req.RemoteAddr = ip + ":12345"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, request("1.2.3.4"))
+	assert.Equal(t, http.StatusTooManyRequests, request("1.2.3.4"))
+	assert.Equal(t, http.StatusOK, request("5.6.7.8"))
+}
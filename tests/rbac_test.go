@@ -0,0 +1,178 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ios-api/middlewares"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPermission(t *testing.T) {
+	cases := []struct {
+		granted  string
+		required string
+		expected bool
+	}{
+		{"*", "settings:write", true},
+		{"settings:write", "settings:write", true},
+		{"settings:write", "settings:cache", false},
+		{"settings:*", "settings:write", true},
+		{"settings:*", "settings:write:app.theme", true},
+		{"settings:*", "users:read", false},
+		{"settings:*", "settingsx:write", false},
+		{"settings", "settings:write", false},
+		{"settings:write:app.*", "settings:write:app.theme", true},
+		{"settings:write:app.*", "settings:write:apple", false},
+		{"settings:write:app.theme", "settings:write", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.expected, services.MatchPermission(c.granted, c.required), "%s -> %s", c.granted, c.required)
+	}
+}
+
+func TestRBACService_RolePermissions(t *testing.T) {
+	rbac := services.NewRBACService(nil)
+
+	admin := rbac.RolePermissions([]string{services.RoleAdmin})
+	for _, permission := range []string{services.PermSettingsWrite, services.PermUsersWrite, services.PermRolesManage} {
+		assert.True(t, services.PermissionGranted(admin, permission))
+	}
+
+	operator := rbac.RolePermissions([]string{services.RoleOperator})
+	assert.True(t, services.PermissionGranted(operator, services.PermSettingsWrite))
+	assert.True(t, services.PermissionGranted(operator, services.PermSettingsCache))
+	assert.False(t, services.PermissionGranted(operator, services.PermRolesManage))
+
+	// 未知角色没有权限
+	assert.Empty(t, rbac.RolePermissions([]string{"unknown"}))
+
+	names := []string{}
+	for _, role := range rbac.Roles() {
+		names = append(names, role.Name)
+	}
+	assert.Equal(t, []string{services.RoleAdmin, services.RoleOperator}, names)
+}
+
+func TestParseRoles(t *testing.T) {
+	roles, err := services.ParseRoles(" app_editor = settings:write:app.*, settings:cache ; auditor=audit:read;")
+	assert.NoError(t, err)
+	assert.Equal(t, []services.Role{
+		{Name: "app_editor", Description: "app_editor", Permissions: []string{"settings:write:app.*", "settings:cache"}},
+		{Name: "auditor", Description: "auditor", Permissions: []string{"audit:read"}},
+	}, roles)
+
+	roles, err = services.ParseRoles("")
+	assert.NoError(t, err)
+	assert.Empty(t, roles)
+
+	for _, spec := range []string{"editor", "=settings:write", "editor= , "} {
+		_, err := services.ParseRoles(spec)
+		assert.ErrorIs(t, err, services.ErrRoleInvalid, spec)
+	}
+
+	// 自定义角色不能覆盖内置角色
+	rbac := services.NewRBACService(nil)
+	assert.ErrorIs(t, rbac.AddRoles(services.Role{Name: services.RoleAdmin}), services.ErrRoleInvalid)
+	assert.NoError(t, rbac.AddRoles(services.Role{Name: "auditor", Permissions: []string{services.PermAuditRead}}))
+	assert.True(t, services.PermissionGranted(rbac.RolePermissions([]string{"auditor"}), services.PermAuditRead))
+}
+
+func TestRequirePermission_Unauthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rbac := services.NewRBACService(nil)
+
+	// 未经过 AuthMiddleware 时在查询数据库之前拒绝
+	r := gin.New()
+	r.GET("/admin", middlewares.RequirePermission(rbac, services.PermSettingsCache), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/role", middlewares.RequireRole(rbac, services.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.PUT("/settings/:key", middlewares.RequireScopedPermission(rbac, services.PermSettingsWrite, "key"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/admin", "/role"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/settings/app.theme", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+// 测试角色分配和权限中间件（需要数据库）
+func TestRBACService_AssignAndRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	rbac := services.NewRBACService(db)
+
+	testUser, err := createTestUser(db)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", testUser.ID) })
+	r.GET("/cache", middlewares.RequirePermission(rbac, services.PermSettingsCache), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/roles", middlewares.RequirePermission(rbac, services.PermRolesManage), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r.GET("/admin", middlewares.RequireRole(rbac, services.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	// 没有角色
+	assert.Equal(t, http.StatusForbidden, request("/cache"))
+
+	// 运营可以管理缓存，不能分配角色
+	assert.NoError(t, rbac.AssignRole(testUser.ID, services.RoleOperator))
+	assert.ErrorIs(t, rbac.AssignRole(testUser.ID, services.RoleOperator), services.ErrRoleAlreadyAssigned)
+	assert.Equal(t, http.StatusOK, request("/cache"))
+	assert.Equal(t, http.StatusForbidden, request("/roles"))
+	assert.Equal(t, http.StatusForbidden, request("/admin"))
+
+	// 管理员拥有全部权限
+	assert.NoError(t, rbac.AssignRole(testUser.ID, services.RoleAdmin))
+	assert.Equal(t, http.StatusOK, request("/roles"))
+	assert.Equal(t, http.StatusOK, request("/admin"))
+
+	roles, err := rbac.GetUserRoles(testUser.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{services.RoleAdmin, services.RoleOperator}, roles)
+
+	// 移除角色后立即生效
+	assert.NoError(t, rbac.RemoveRole(testUser.ID, services.RoleAdmin))
+	assert.ErrorIs(t, rbac.RemoveRole(testUser.ID, services.RoleAdmin), services.ErrRoleNotAssigned)
+	assert.Equal(t, http.StatusForbidden, request("/roles"))
+
+	// 按key授权修改设置
+	assert.NoError(t, rbac.AddRoles(services.Role{Name: "app_editor", Permissions: []string{"settings:write:app.*"}}))
+	assert.NoError(t, rbac.AssignRole(testUser.ID, "app_editor"))
+	allowed, err := rbac.HasScopedPermission(testUser.ID, services.PermSettingsWrite, "app.theme")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, err = rbac.HasScopedPermission(testUser.ID, services.PermSettingsWrite, "pay.secret")
+	assert.NoError(t, err)
+	assert.True(t, allowed, "运营拥有全部key的修改权限")
+	assert.NoError(t, rbac.RemoveRole(testUser.ID, services.RoleOperator))
+	allowed, err = rbac.HasScopedPermission(testUser.ID, services.PermSettingsWrite, "pay.secret")
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// 未知角色和不存在的用户
+	assert.ErrorIs(t, rbac.AssignRole(testUser.ID, "root"), services.ErrRoleNotFound)
+	assert.ErrorIs(t, rbac.AssignRole(testUser.ID+1000000, services.RoleAdmin), services.ErrUserNotFound)
+}
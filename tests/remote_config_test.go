@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ios-api/controllers"
+	"ios-api/models"
+	"ios-api/remoteconfig"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestRemoteConfig_Parse(t *testing.T) {
+	definition, err := remoteconfig.Parse([]byte(`{
+		"default": false,
+		"rules": [
+			{"name": "内测", "user_ids": [1, 2], "value": true},
+			{"platforms": ["ios"], "min_version": "2.1", "max_version": "3.0.0", "locales": ["zh"], "percentage": 12.5, "value": true}
+		]
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "false", string(definition.Default))
+	assert.Len(t, definition.Rules, 2)
+	assert.Equal(t, "内测", definition.Rules[0].Name)
+	assert.Equal(t, 12.5, *definition.Rules[1].Percentage)
+
+	// 默认值可以是 null
+	_, err = remoteconfig.Parse([]byte(`{"default": null}`))
+	assert.NoError(t, err)
+
+	invalid := []string{
+		``,
+		`[]`,
+		`"string"`,
+		`{}`,
+		`{"default": 1} {}`,
+		`{"default": 1, "unknown": true}`,
+		`{"default": 1, "rules": [{"platforms": ["ios"]}]}`,
+		`{"default": 1, "rules": [{"platforms": [""], "value": 2}]}`,
+		`{"default": 1, "rules": [{"locales": [" "], "value": 2}]}`,
+		`{"default": 1, "rules": [{"user_ids": [0], "value": 2}]}`,
+		`{"default": 1, "rules": [{"user_ids": [-1], "value": 2}]}`,
+		`{"default": 1, "rules": [{"min_version": "2.x", "value": 2}]}`,
+		`{"default": 1, "rules": [{"max_version": "v2", "value": 2}]}`,
+		`{"default": 1, "rules": [{"min_version": "3.0", "max_version": "2.9.9", "value": 2}]}`,
+		`{"default": 1, "rules": [{"percentage": -1, "value": 2}]}`,
+		`{"default": 1, "rules": [{"percentage": 100.5, "value": 2}]}`,
+		`{"default": 1, "rules": [{"value": 2, "typo": 1}]}`,
+	}
+	for _, data := range invalid {
+		_, err := remoteconfig.Parse([]byte(data))
+		assert.ErrorIs(t, err, remoteconfig.ErrDefinitionInvalid, data)
+	}
+}
+
+func TestRemoteConfig_CompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"2.1", "2.1.0", 0},
+		{"2.1.0.0", "2.1", 0},
+		{"2.10.0", "2.9.9", 1},
+		{"2.9", "2.10", -1},
+		{"10", "9.99.99", 1},
+		{" 1.2 ", "1.2", 0},
+	}
+	for _, tc := range cases {
+		got, err := remoteconfig.CompareVersions(tc.a, tc.b)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, got, "%s vs %s", tc.a, tc.b)
+	}
+
+	for _, version := range []string{"", "1..2", "1.2-beta", "v1.2", "1.2.", "-1"} {
+		_, err := remoteconfig.CompareVersions(version, "1.0")
+		assert.ErrorIs(t, err, remoteconfig.ErrVersionInvalid, version)
+	}
+}
+
+func TestRemoteConfig_MatchLocale(t *testing.T) {
+	cases := []struct {
+		pattern, locale string
+		want            bool
+	}{
+		{"zh", "zh", true},
+		{"zh", "zh-Hans-CN", true},
+		{"zh", "ZH_cn", true},
+		{"zh-Hans", "zh-Hans-CN", true},
+		{"zh-Hans", "zh-Hant-TW", false},
+		{"zh-CN", "zh", false},
+		{"en", "eng", false},
+		{"en-US", "en-us", true},
+		{"en", "", false},
+		{"", "en", false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, remoteconfig.MatchLocale(tc.pattern, tc.locale), "%s vs %s", tc.pattern, tc.locale)
+	}
+}
+
+func TestRemoteConfig_Bucket(t *testing.T) {
+	// 同一用户分桶稳定，不同种子独立分桶
+	assert.Equal(t, remoteconfig.Bucket("new_home", 42), remoteconfig.Bucket("new_home", 42))
+
+	sameBucket := 0
+	inRollout := 0
+	for id := uint(1); id <= 10000; id++ {
+		bucket := remoteconfig.Bucket("new_home", id)
+		assert.True(t, bucket >= 0 && bucket < remoteconfig.BucketCount)
+		if bucket == remoteconfig.Bucket("dark_mode", id) {
+			sameBucket++
+		}
+		if bucket < remoteconfig.BucketCount/10 {
+			inRollout++
+		}
+	}
+	assert.Less(t, sameBucket, 20)
+	// 10% 放量的实际比例接近 10%
+	assert.InDelta(t, 1000, inRollout, 150)
+}
+
+func TestRemoteConfig_RuleMatch(t *testing.T) {
+	ios := remoteconfig.Context{UserID: 7, Platform: "iOS", AppVersion: "2.3.1", Locale: "zh-Hans-CN"}
+	anonymous := remoteconfig.Context{Platform: "ios", AppVersion: "2.3.1", Locale: "en-US"}
+
+	cases := []struct {
+		name string
+		rule remoteconfig.Rule
+		ctx  remoteconfig.Context
+		want bool
+	}{
+		{"无条件", remoteconfig.Rule{}, anonymous, true},
+		{"平台不区分大小写", remoteconfig.Rule{Platforms: []string{"ios"}}, ios, true},
+		{"平台不符", remoteconfig.Rule{Platforms: []string{"android"}}, ios, false},
+		{"未传平台", remoteconfig.Rule{Platforms: []string{"ios"}}, remoteconfig.Context{}, false},
+		{"最低版本（含）", remoteconfig.Rule{MinVersion: "2.3.1"}, ios, true},
+		{"低于最低版本", remoteconfig.Rule{MinVersion: "2.4"}, ios, false},
+		{"最高版本（含）", remoteconfig.Rule{MaxVersion: "2.3.1"}, ios, true},
+		{"高于最高版本", remoteconfig.Rule{MaxVersion: "2.3"}, ios, false},
+		{"版本区间", remoteconfig.Rule{MinVersion: "2.0", MaxVersion: "2.9"}, ios, true},
+		{"客户端版本无效", remoteconfig.Rule{MinVersion: "1.0"}, remoteconfig.Context{AppVersion: "dev"}, false},
+		{"未传版本", remoteconfig.Rule{MaxVersion: "9.0"}, remoteconfig.Context{}, false},
+		{"用户白名单", remoteconfig.Rule{UserIDs: []uint{3, 7}}, ios, true},
+		{"不在白名单", remoteconfig.Rule{UserIDs: []uint{3}}, ios, false},
+		{"未登录不匹配白名单", remoteconfig.Rule{UserIDs: []uint{3}}, anonymous, false},
+		{"语言区域", remoteconfig.Rule{Locales: []string{"en", "zh"}}, ios, true},
+		{"语言区域不符", remoteconfig.Rule{Locales: []string{"ja"}}, ios, false},
+		{"全量放量", remoteconfig.Rule{Percentage: float64Ptr(100)}, ios, true},
+		{"零放量", remoteconfig.Rule{Percentage: float64Ptr(0)}, ios, false},
+		{"未登录不参与放量", remoteconfig.Rule{Percentage: float64Ptr(100)}, anonymous, false},
+		{"条件同时满足", remoteconfig.Rule{Platforms: []string{"ios"}, MinVersion: "2.0", Locales: []string{"zh"}, UserIDs: []uint{7}}, ios, true},
+		{"任一条件不满足", remoteconfig.Rule{Platforms: []string{"ios"}, MinVersion: "2.0", Locales: []string{"en"}}, ios, false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, tc.rule.Match("flag", tc.ctx), tc.name)
+	}
+
+	// 按比例放量与分桶一致
+	bucket := remoteconfig.Bucket("flag", 7)
+	below := float64(bucket) / remoteconfig.BucketCount * 100
+	above := float64(bucket+1) / remoteconfig.BucketCount * 100
+	assert.False(t, (&remoteconfig.Rule{Percentage: float64Ptr(below)}).Match("flag", ios))
+	assert.True(t, (&remoteconfig.Rule{Percentage: float64Ptr(above)}).Match("flag", ios))
+}
+
+func TestRemoteConfig_Evaluate(t *testing.T) {
+	definition, err := remoteconfig.Parse([]byte(`{
+		"default": {"layout": "classic"},
+		"rules": [
+			{"name": "内测用户", "user_ids": [1], "value": {"layout": "beta"}},
+			{"name": "新版iOS", "platforms": ["ios"], "min_version": "3.0", "value": {"layout": "grid"}},
+			{"name": "兜底", "platforms": ["ios"], "value": {"layout": "list"}}
+		]
+	}`))
+	assert.NoError(t, err)
+
+	cases := []struct {
+		ctx   remoteconfig.Context
+		value string
+		rule  int
+	}{
+		// 按顺序匹配，第一条命中的规则生效
+		{remoteconfig.Context{UserID: 1, Platform: "ios", AppVersion: "3.1"}, `{"layout": "beta"}`, 0},
+		{remoteconfig.Context{UserID: 2, Platform: "ios", AppVersion: "3.1"}, `{"layout": "grid"}`, 1},
+		{remoteconfig.Context{UserID: 2, Platform: "ios", AppVersion: "2.9"}, `{"layout": "list"}`, 2},
+		{remoteconfig.Context{UserID: 2, Platform: "android", AppVersion: "3.1"}, `{"layout": "classic"}`, -1},
+	}
+	for _, tc := range cases {
+		result := definition.Evaluate("home", tc.ctx)
+		assert.JSONEq(t, tc.value, string(result.Value))
+		assert.Equal(t, tc.rule, result.Rule)
+	}
+
+	// 分桶种子默认为配置名，设置 salt 后使用 salt
+	rollout := &remoteconfig.Definition{
+		Default: json.RawMessage(`false`),
+		Rules:   []remoteconfig.Rule{{Percentage: float64Ptr(50), Value: json.RawMessage(`true`)}},
+	}
+	salted := *rollout
+	salted.Salt = "home"
+	differs := false
+	for id := uint(1); id <= 100; id++ {
+		ctx := remoteconfig.Context{UserID: id}
+		byName := rollout.Evaluate("new_home", ctx)
+		assert.Equal(t, remoteconfig.Bucket("new_home", id) < 5000, byName.Rule == 0)
+		assert.Equal(t, rollout.Evaluate("home", ctx), salted.Evaluate("new_home", ctx))
+		if byName.Rule != salted.Evaluate("new_home", ctx).Rule {
+			differs = true
+		}
+	}
+	assert.True(t, differs)
+}
+
+func TestSettingController_GetConfig(t *testing.T) {
+	service, cleanup := setupTestSettingDBWithCache()
+	if service == nil {
+		t.Skip("跳过测试：无法连接到测试数据库或创建缓存")
+		return
+	}
+	defer cleanup()
+
+	// 远程配置命名空间下只能写入有效的定义
+	_, err := service.SetSetting("config.dark_mode", `{"default": false, "rules": [{"user_ids": [5]}]}`)
+	assert.ErrorIs(t, err, services.ErrSettingValueInvalid)
+	_, err = service.SetSetting("config.dark_mode", `{"default": false, "rules": [{"platforms": ["ios"], "locales": ["zh"], "value": true}]}`)
+	assert.NoError(t, err)
+	_, err = service.SetSetting("config.ios.min_version", `{"default": "2.0.0", "rules": [{"user_ids": [5], "value": "1.0.0"}]}`)
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	controller := &controllers.SettingController{SettingService: service}
+	r := gin.New()
+	r.GET("/config", func(c *gin.Context) { c.Set("userID", uint(5)) }, controller.GetConfig)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/config?platform=ios", nil)
+	req.Header.Set("Accept-Language", "zh-Hans-CN,zh;q=0.9,en;q=0.8")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data struct {
+			Config map[string]json.RawMessage `json:"config"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.JSONEq(t, `true`, string(resp.Data.Config["dark_mode"]))
+	assert.JSONEq(t, `"1.0.0"`, string(resp.Data.Config["ios.min_version"]))
+}
+
+func TestSettingController_RemoteConfigNotPublic(t *testing.T) {
+	definition := `{"default": false, "rules": [{"user_ids": [5], "value": true}]}`
+	service, _, _ := newStubSettingService(t,
+		models.Setting{Key: "config.beta", Value: definition},
+		models.Setting{Key: "app.theme", Value: "dark"},
+	)
+
+	gin.SetMode(gin.TestMode)
+	controller := &controllers.SettingController{SettingService: service}
+	r := gin.New()
+	r.GET("/settings", controller.ListSettings)
+	r.POST("/settings/batch", controller.BatchGetSettings)
+	r.GET("/settings/:key", controller.GetSetting)
+	r.GET("/config", controller.GetConfig)
+	r.GET("/admin/settings/:key", controller.AdminGetSetting)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 公开接口不返回远程配置定义（定向的用户ID），与不存在的key相同
+	w := serve(http.MethodGet, "/settings/config.beta", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "user_ids")
+
+	w = serve(http.MethodPost, "/settings/batch", `{"keys": ["config.beta", "app.theme", "config.missing"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var batch struct {
+		Data struct {
+			Settings []models.Setting `json:"settings"`
+			Missing  []string         `json:"missing"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Len(t, batch.Data.Settings, 1)
+	assert.Equal(t, "app.theme", batch.Data.Settings[0].Key)
+	assert.Equal(t, []string{"config.beta", "config.missing"}, batch.Data.Missing)
+
+	for _, prefix := range []string{"config.", "config"} {
+		w = serve(http.MethodGet, "/settings?prefix="+prefix, "")
+		assert.Equal(t, http.StatusOK, w.Code, prefix)
+		assert.NotContains(t, w.Body.String(), "config.beta", prefix)
+	}
+
+	// 求值结果按用户定向，不能被共享缓存
+	w = serve(http.MethodGet, "/config", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "Authorization", w.Header().Get("Vary"))
+	assert.JSONEq(t, `{"code": 0, "message": "获取远程配置成功", "data": {"config": {"beta": false}}}`, w.Body.String())
+
+	// 管理接口返回原始定义
+	w = serve(http.MethodGet, "/admin/settings/config.beta", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "user_ids")
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+}
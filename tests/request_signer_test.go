@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"ios-api/middlewares"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// signRequestHeaders 生成签名请求头
+func signRequestHeaders(signer *services.RequestSigner, method, path, nonce string, at time.Time, body []byte) map[string]string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return map[string]string{
+		services.SignatureTimestampHeader: timestamp,
+		services.SignatureNonceHeader:     nonce,
+		services.SignatureHeader:          signer.Sign(method, path, timestamp, nonce, body),
+	}
+}
+
+func TestRequestSigner_Verify(t *testing.T) {
+	signer := services.NewRequestSigner("signing_secret")
+	body := []byte(`{"provider":"wechat","provider_user_id":"OPENID"}`)
+	headers := signRequestHeaders(signer, "POST", "/api/v1/oauth/login", "nonce-1", time.Now(), body)
+
+	req := httptest.NewRequest("POST", "/api/v1/oauth/login", bytes.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	assert.NoError(t, signer.VerifyRequest(req))
+
+	// 校验后请求体仍可读取
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(req.Body)
+	assert.Equal(t, body, buf.Bytes())
+}
+
+func TestRequestSigner_Rejected(t *testing.T) {
+	signer := services.NewRequestSigner("signing_secret")
+	body := []byte(`{"provider":"wechat","provider_user_id":"OPENID"}`)
+	now := time.Now()
+	signer.SetClock(func() time.Time { return now })
+
+	verify := func(h map[string]string, method, path string, body []byte) error {
+		return signer.Verify(method, path, h[services.SignatureTimestampHeader], h[services.SignatureNonceHeader], h[services.SignatureHeader], body)
+	}
+
+	t.Run("篡改请求体", func(t *testing.T) {
+		h := signRequestHeaders(signer, "POST", "/api/v1/oauth/login", "n1", now, body)
+		err := verify(h, "POST", "/api/v1/oauth/login", []byte(`{"provider":"wechat","provider_user_id":"VICTIM"}`))
+		assert.ErrorIs(t, err, services.ErrSignatureInvalid)
+	})
+
+	t.Run("路径不匹配", func(t *testing.T) {
+		h := signRequestHeaders(signer, "POST", "/api/v1/oauth/login", "n2", now, body)
+		assert.ErrorIs(t, verify(h, "PUT", "/api/v1/settings/foo", body), services.ErrSignatureInvalid)
+	})
+
+	t.Run("查询字符串不匹配", func(t *testing.T) {
+		h := signRequestHeaders(signer, "PUT", "/api/v1/settings/foo?env=staging", "n7", now, body)
+		assert.ErrorIs(t, verify(h, "PUT", "/api/v1/settings/foo?env=prod", body), services.ErrSignatureInvalid)
+		assert.NoError(t, verify(h, "PUT", "/api/v1/settings/foo?env=staging", body))
+	})
+
+	t.Run("其他密钥签名", func(t *testing.T) {
+		other := services.NewRequestSigner("other_secret")
+		h := signRequestHeaders(other, "POST", "/api/v1/oauth/login", "n3", now, body)
+		assert.ErrorIs(t, verify(h, "POST", "/api/v1/oauth/login", body), services.ErrSignatureInvalid)
+	})
+
+	t.Run("时间戳过期", func(t *testing.T) {
+		h := signRequestHeaders(signer, "POST", "/api/v1/oauth/login", "n4", now.Add(-services.DefaultSignatureMaxSkew-time.Second), body)
+		assert.ErrorIs(t, verify(h, "POST", "/api/v1/oauth/login", body), services.ErrSignatureExpired)
+	})
+
+	t.Run("重放", func(t *testing.T) {
+		h := signRequestHeaders(signer, "POST", "/api/v1/oauth/login", "n5", now, body)
+		assert.NoError(t, verify(h, "POST", "/api/v1/oauth/login", body))
+		assert.ErrorIs(t, verify(h, "POST", "/api/v1/oauth/login", body), services.ErrSignatureReplayed)
+	})
+
+	t.Run("缺少签名", func(t *testing.T) {
+		assert.ErrorIs(t, verify(map[string]string{}, "POST", "/api/v1/oauth/login", body), services.ErrSignatureMissing)
+	})
+
+	t.Run("未配置密钥", func(t *testing.T) {
+		unconfigured := services.NewRequestSigner("")
+		h := signRequestHeaders(unconfigured, "POST", "/api/v1/oauth/login", "n6", now, body)
+		err := unconfigured.Verify("POST", "/api/v1/oauth/login", h[services.SignatureTimestampHeader], h[services.SignatureNonceHeader], h[services.SignatureHeader], body)
+		assert.ErrorIs(t, err, services.ErrSignerNotConfigured)
+	})
+}
+
+func TestRequestSigner_NonceExpiry(t *testing.T) {
+	signer := services.NewRequestSigner("signing_secret")
+	now := time.Now()
+	signer.SetClock(func() time.Time { return now })
+	body := []byte(`{}`)
+
+	verify := func(nonce string, at time.Time) error {
+		h := signRequestHeaders(signer, "POST", "/api/v1/oauth/login", nonce, at, body)
+		return signer.Verify("POST", "/api/v1/oauth/login", h[services.SignatureTimestampHeader], h[services.SignatureNonceHeader], h[services.SignatureHeader], body)
+	}
+
+	// 时间戳较早的请求后到达，其nonce先过期，不影响较新的nonce
+	assert.NoError(t, verify("newer", now))
+	assert.NoError(t, verify("older", now.Add(-4*time.Minute)))
+	now = now.Add(2 * time.Minute)
+	assert.ErrorIs(t, verify("newer", now.Add(-2*time.Minute)), services.ErrSignatureReplayed)
+	assert.NoError(t, verify("another", now))
+}
+
+// 测试签名写入设置：签名校验、防重放和key范围限制
+func TestRequireSignature_SettingScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	signer := services.NewRequestSigner("signing_secret")
+
+	r := gin.New()
+	r.PUT("/settings/:key", middlewares.RequireSignature(signer), middlewares.RequireParamScope("key", []string{"app.*", "feature.flag"}), func(c *gin.Context) {
+		var req struct {
+			Value string `json:"value"`
+		}
+		assert.NoError(t, c.ShouldBindJSON(&req))
+		c.String(http.StatusOK, req.Value)
+	})
+	request := func(path, nonce string, sign bool) *httptest.ResponseRecorder {
+		body := []byte(`{"value":"dark"}`)
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+		if sign {
+			for key, value := range signRequestHeaders(signer, http.MethodPut, path, nonce, time.Now(), body) {
+				req.Header.Set(key, value)
+			}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/settings/app.theme", "nonce-1", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "dark", w.Body.String())
+
+	// 重放、未签名和范围外的key
+	assert.Equal(t, http.StatusUnauthorized, request("/settings/app.theme", "nonce-1", true).Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/settings/app.theme", "", false).Code)
+	assert.Equal(t, http.StatusForbidden, request("/settings/pay.secret", "nonce-2", true).Code)
+	assert.Equal(t, http.StatusOK, request("/settings/feature.flag", "nonce-3", true).Code)
+
+	// 未配置签名密钥时拒绝全部请求
+	disabled := gin.New()
+	disabled.PUT("/settings/:key", middlewares.RequireSignature(services.NewRequestSigner("")), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	w = httptest.NewRecorder()
+	disabled.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/settings/app.theme", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"ios-api/services"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionCache_GetPut(t *testing.T) {
+	cache := services.NewSessionCache(10, time.Minute)
+	now := time.Now()
+	cache.SetClock(func() time.Time { return now })
+
+	_, _, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	cache.Put("a", 1, true, time.Time{}, cache.Generation())
+	cache.Put("b", 2, false, time.Time{}, cache.Generation())
+
+	userID, valid, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.True(t, valid)
+	assert.Equal(t, uint(1), userID)
+
+	// 已撤销的会话
+	_, valid, ok = cache.Get("b")
+	assert.True(t, ok)
+	assert.False(t, valid)
+
+	// 超过TTL后未命中
+	now = now.Add(time.Minute)
+	_, _, ok = cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestSessionCache_SessionExpiry(t *testing.T) {
+	cache := services.NewSessionCache(10, time.Minute)
+	now := time.Now()
+	cache.SetClock(func() time.Time { return now })
+
+	// 会话10秒后过期，缓存不能超过会话有效期
+	cache.Put("a", 1, true, now.Add(10*time.Second), cache.Generation())
+	now = now.Add(10 * time.Second)
+	_, _, ok := cache.Get("a")
+	assert.False(t, ok)
+}
+
+func TestSessionCache_LRUEviction(t *testing.T) {
+	cache := services.NewSessionCache(2, time.Minute)
+	cache.Put("a", 1, true, time.Time{}, cache.Generation())
+	cache.Put("b", 2, true, time.Time{}, cache.Generation())
+	// 访问a后，b成为最久未使用的条目
+	cache.Get("a")
+	cache.Put("c", 3, true, time.Time{}, cache.Generation())
+
+	_, _, ok := cache.Get("b")
+	assert.False(t, ok)
+	_, _, ok = cache.Get("a")
+	assert.True(t, ok)
+	_, _, ok = cache.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestSessionCache_Invalidate(t *testing.T) {
+	cache := services.NewSessionCache(10, time.Minute)
+	cache.Put("a", 1, true, time.Time{}, cache.Generation())
+	cache.Put("b", 1, true, time.Time{}, cache.Generation())
+	cache.Put("c", 2, true, time.Time{}, cache.Generation())
+
+	cache.Invalidate("a")
+	_, _, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	cache.InvalidateUser(1)
+	_, _, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, _, ok = cache.Get("c")
+	assert.True(t, ok)
+}
+
+func TestSessionCache_StalePutIgnored(t *testing.T) {
+	cache := services.NewSessionCache(10, time.Minute)
+
+	// 查询数据库期间会话被撤销，查询结果不能写入缓存
+	generation := cache.Generation()
+	cache.InvalidateUser(1)
+	cache.Put("a", 1, true, time.Time{}, generation)
+
+	_, _, ok := cache.Get("a")
+	assert.False(t, ok)
+}
+
+func TestSessionCache_Disabled(t *testing.T) {
+	cache := services.NewSessionCache(10, 0)
+	assert.Nil(t, cache)
+
+	// nil缓存可以安全调用
+	cache.Put("a", 1, true, time.Time{}, cache.Generation())
+	_, _, ok := cache.Get("a")
+	assert.False(t, ok)
+	cache.Invalidate("a")
+	cache.InvalidateUser(1)
+	assert.Equal(t, 0, cache.Len())
+}
+
+// 签名无效或载荷错误的令牌在查询数据库之前被拒绝（DB为空，查询会panic）
+func TestVerifyToken_SignatureCheckedFirst(t *testing.T) {
+	userService := &services.UserService{JWTSecret: "test_secret"}
+
+	sign := func(secret string, claims jwt.Claims) string {
+		token, err := services.NewHS256KeySet(secret).Sign(claims)
+		assert.NoError(t, err)
+		return token
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	// 签名错误
+	_, err := userService.VerifyToken(sign("other_secret", jwt.MapClaims{"user_id": 1, "exp": exp}))
+	assert.Equal(t, services.ErrInvalidToken, err)
+
+	// 签名错误的过期令牌不提示过期
+	_, err = userService.VerifyToken(sign("other_secret", jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(-time.Hour).Unix()}))
+	assert.Equal(t, services.ErrInvalidToken, err)
+
+	// 已过期
+	_, err = userService.VerifyToken(sign("test_secret", jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(-time.Hour).Unix()}))
+	assert.Equal(t, services.ErrTokenExpired, err)
+
+	// user_id 类型错误或缺失时不会panic
+	_, err = userService.VerifyToken(sign("test_secret", jwt.MapClaims{"user_id": "1", "exp": exp}))
+	assert.Equal(t, services.ErrInvalidToken, err)
+	_, err = userService.VerifyToken(sign("test_secret", jwt.MapClaims{"exp": exp}))
+	assert.Equal(t, services.ErrInvalidToken, err)
+
+	// 格式错误
+	_, err = userService.VerifyToken("invalid_token")
+	assert.Equal(t, services.ErrInvalidToken, err)
+}
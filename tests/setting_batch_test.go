@@ -0,0 +1,165 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ios-api/models"
+	"ios-api/utils"
+
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettingsETag(t *testing.T) {
+	updatedAt := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	settings := []models.Setting{
+		{Key: "app.ios.theme", Value: "dark", UpdatedAt: updatedAt},
+		{Key: "app.ios.version", Value: "2.0", UpdatedAt: updatedAt},
+	}
+	etag := services.SettingsETag(settings)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, etag, services.SettingsETag(settings))
+
+	// 值、更新时间或key变化时ETag变化
+	changed := append([]models.Setting{}, settings...)
+	changed[0].Value = "light"
+	assert.NotEqual(t, etag, services.SettingsETag(changed))
+	changed = append([]models.Setting{}, settings...)
+	changed[1].UpdatedAt = updatedAt.Add(time.Second)
+	assert.NotEqual(t, etag, services.SettingsETag(changed))
+	assert.NotEqual(t, etag, services.SettingsETag(settings[:1]))
+	assert.NotEqual(t, services.SettingsETag(nil), services.SettingsETag([]models.Setting{{Key: ""}}))
+}
+
+func TestNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	etag := `"abc"`
+	lastModified := time.Date(2024, 1, 2, 8, 0, 0, 500000000, time.UTC)
+	handler := func(c *gin.Context) {
+		if utils.NotModified(c, etag, lastModified) {
+			return
+		}
+		utils.Success(c, "ok", nil)
+	}
+	r := gin.New()
+	r.GET("/", handler)
+	r.POST("/", handler)
+
+	cases := []struct {
+		method          string
+		ifNoneMatch     string
+		ifModifiedSince string
+		status          int
+	}{
+		{http.MethodGet, "", "", http.StatusOK},
+		{http.MethodGet, `"other"`, "", http.StatusOK},
+		{http.MethodGet, `"abc"`, "", http.StatusNotModified},
+		{http.MethodGet, `W/"abc"`, "", http.StatusNotModified},
+		{http.MethodGet, `"other", "abc"`, "", http.StatusNotModified},
+		{http.MethodGet, "*", "", http.StatusNotModified},
+		{http.MethodPost, `"abc"`, "", http.StatusNotModified},
+		// 按秒比较更新时间
+		{http.MethodGet, "", "Tue, 02 Jan 2024 08:00:00 GMT", http.StatusNotModified},
+		{http.MethodGet, "", "Tue, 02 Jan 2024 09:00:00 GMT", http.StatusNotModified},
+		{http.MethodGet, "", "Tue, 02 Jan 2024 07:59:59 GMT", http.StatusOK},
+		{http.MethodGet, "", "invalid", http.StatusOK},
+		// 带 If-None-Match 时忽略 If-Modified-Since，POST 请求忽略 If-Modified-Since
+		{http.MethodGet, `"other"`, "Tue, 02 Jan 2024 09:00:00 GMT", http.StatusOK},
+		{http.MethodPost, "", "Tue, 02 Jan 2024 09:00:00 GMT", http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, "/", nil)
+		if tc.ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", tc.ifNoneMatch)
+		}
+		if tc.ifModifiedSince != "" {
+			req.Header.Set("If-Modified-Since", tc.ifModifiedSince)
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, "%s %s %s", tc.method, tc.ifNoneMatch, tc.ifModifiedSince)
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Equal(t, "Tue, 02 Jan 2024 08:00:00 GMT", w.Header().Get("Last-Modified"))
+		if tc.status == http.StatusNotModified {
+			assert.Empty(t, w.Body.String())
+		}
+	}
+
+	// 没有更新时间时不返回 Last-Modified
+	r = gin.New()
+	r.GET("/", func(c *gin.Context) {
+		if !utils.NotModified(c, etag, time.Time{}) {
+			utils.Success(c, "ok", nil)
+		}
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-Modified-Since", "Tue, 02 Jan 2024 09:00:00 GMT")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+}
+
+func TestSettingService_BatchAndPrefix(t *testing.T) {
+	service, cleanup := setupTestSettingDBWithCache()
+	if service == nil {
+		t.Skip("跳过测试：无法连接到测试数据库或创建缓存")
+		return
+	}
+	defer cleanup()
+
+	for key, value := range map[string]string{
+		"app.ios.theme":   "dark",
+		"app.ios.version": "2.0",
+		"app.ios":         "root",
+		"app.iosx.flag":   "1",
+		"app.android.x":   "1",
+	} {
+		_, err := service.SetSetting(key, value)
+		assert.NoError(t, err)
+	}
+
+	// 批量读取：去重、按key排序、返回不存在的key
+	settings, missing, err := service.GetSettings([]string{"app.ios.version", "app.ios.theme", "app.ios.theme", "app.missing"})
+	assert.NoError(t, err)
+	assert.Len(t, settings, 2)
+	assert.Equal(t, "app.ios.theme", settings[0].Key)
+	assert.Equal(t, "app.ios.version", settings[1].Key)
+	assert.Equal(t, []string{"app.missing"}, missing)
+
+	// 第二次读取全部来自缓存，结果和ETag不变
+	cached, _, err := service.GetSettings([]string{"app.ios.theme", "app.ios.version"})
+	assert.NoError(t, err)
+	assert.Equal(t, services.SettingsETag(settings), services.SettingsETag(cached))
+
+	_, _, err = service.GetSettings(nil)
+	assert.ErrorIs(t, err, services.ErrSettingBatchEmpty)
+	_, _, err = service.GetSettings([]string{"bad key"})
+	assert.ErrorIs(t, err, services.ErrSettingKeyInvalid)
+
+	// 命名空间读取：自动补全点号，不包含命名空间本身和相似前缀
+	prefix, settings, err := service.ListSettingsByPrefix("app.ios")
+	assert.NoError(t, err)
+	assert.Equal(t, "app.ios.", prefix)
+	assert.Len(t, settings, 2)
+	etag := services.SettingsETag(settings)
+
+	// 写入命名空间下的key后缓存失效
+	_, err = service.SetSetting("app.ios.beta", "true")
+	assert.NoError(t, err)
+	_, settings, err = service.ListSettingsByPrefix("app.ios.")
+	assert.NoError(t, err)
+	assert.Len(t, settings, 3)
+	assert.NotEqual(t, etag, services.SettingsETag(settings))
+	assert.Equal(t, 1, service.GetCacheStats()["cached_prefixes_count"])
+
+	_, _, err = service.ListSettingsByPrefix("")
+	assert.ErrorIs(t, err, services.ErrSettingPrefixInvalid)
+	_, _, err = service.ListSettingsByPrefix("app ios")
+	assert.ErrorIs(t, err, services.ErrSettingPrefixInvalid)
+}
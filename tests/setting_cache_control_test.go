@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ios-api/controllers"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSettingCacheControl(t *testing.T) {
+	policy, err := services.ParseSettingCacheControl(" app.ios.=300, app.ios.beta.=0 ,config.*=60,*=30,")
+	assert.NoError(t, err)
+
+	// 按最长前缀匹配
+	assert.Equal(t, 300, policy.MaxAge("app.ios.theme"))
+	assert.Equal(t, 0, policy.MaxAge("app.ios.beta.flag"))
+	assert.Equal(t, 60, policy.MaxAge("config.new_home"))
+	assert.Equal(t, 30, policy.MaxAge("app.android.theme"))
+
+	// 命名空间取其中最短的缓存时间
+	assert.Equal(t, 0, policy.MaxAgeForPrefix("app.ios."))
+	assert.Equal(t, 0, policy.MaxAgeForPrefix("app."))
+	assert.Equal(t, 60, policy.MaxAgeForPrefix("config."))
+	assert.Equal(t, 30, policy.MaxAgeForPrefix("user."))
+
+	// 没有匹配的规则时不缓存
+	empty, err := services.ParseSettingCacheControl("")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, empty.MaxAge("app.theme"))
+	var nilPolicy *services.SettingCacheControl
+	assert.Equal(t, 0, nilPolicy.MaxAge("app.theme"))
+	assert.Equal(t, 0, nilPolicy.MaxAgeForPrefix("app."))
+
+	for _, spec := range []string{"app.", "app.=-1", "app.=abc", "app.=1.5", "app.=1,app.*=2"} {
+		_, err := services.ParseSettingCacheControl(spec)
+		assert.ErrorIs(t, err, services.ErrCacheControlInvalid, spec)
+	}
+
+	assert.Equal(t, "no-cache", services.CacheControlHeader(0))
+	assert.Equal(t, "public, max-age=300", services.CacheControlHeader(300))
+}
+
+func TestSettingController_ConditionalGet(t *testing.T) {
+	service, cleanup := setupTestSettingDBWithCache()
+	if service == nil {
+		t.Skip("跳过测试：无法连接到测试数据库或创建缓存")
+		return
+	}
+	defer cleanup()
+
+	var err error
+	service.CacheControl, err = services.ParseSettingCacheControl("app.ios.=300")
+	assert.NoError(t, err)
+	setting, err := service.SetSetting("app.ios.theme", "dark")
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	controller := &controllers.SettingController{SettingService: service}
+	r := gin.New()
+	r.GET("/settings/:key", controller.GetSetting)
+	get := func(key string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/settings/"+key, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("app.ios.theme", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, setting.UpdatedAt.UTC().Format(http.TimeFormat), lastModified)
+
+	w = get("app.ios.theme", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+	w = get("app.ios.theme", map[string]string{"If-Modified-Since": lastModified})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// 修改后ETag变化
+	_, err = service.SetSetting("app.ios.theme", "light")
+	assert.NoError(t, err)
+	w = get("app.ios.theme", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// 未配置的前缀不缓存，不存在的key同样带缓存策略
+	w = get("app.android.theme", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+}
@@ -1,7 +1,6 @@
 package tests
 
 import (
-	"crypto/md5"
 	"fmt"
 	"ios-api/models"
 	"ios-api/services"
@@ -24,15 +23,14 @@ func setupTestSettingDBWithCache() (*services.SettingService, func()) {
 	}
 
 	// 自动迁移
-	db.AutoMigrate(&models.Setting{})
+	db.AutoMigrate(&models.Setting{}, &models.SettingSchema{}, &models.SettingRevision{})
 
 	// 创建临时缓存目录
 	cacheDir := "./test_cache"
 	os.MkdirAll(cacheDir, 0755)
 
 	// 创建设置服务
-	testSalt := "test_salt_12345"
-	service, err := services.NewSettingService(db, testSalt, cacheDir)
+	service, err := services.NewSettingService(db, cacheDir)
 	if err != nil {
 		return nil, nil
 	}
@@ -58,12 +56,10 @@ func TestSettingServiceCache(t *testing.T) {
 	// 测试数据
 	key := "test.cache.setting"
 	value := "cached value"
-	testSalt := "test_salt_12345"
-	correctMD5 := fmt.Sprintf("%x", md5.Sum([]byte(key+testSalt)))
 
 	t.Run("设置数据并验证缓存", func(t *testing.T) {
 		// 设置数据
-		setting, err := service.SetSetting(key, value, correctMD5)
+		setting, err := service.SetSetting(key, value)
 		assert.NoError(t, err)
 		assert.NotNil(t, setting)
 		assert.Equal(t, key, setting.Key)
@@ -86,7 +82,7 @@ func TestSettingServiceCache(t *testing.T) {
 		newValue := "updated cached value"
 
 		// 更新数据（应该清除缓存）
-		setting, err := service.SetSetting(key, newValue, correctMD5)
+		setting, err := service.SetSetting(key, newValue)
 		assert.NoError(t, err)
 		assert.NotNil(t, setting)
 		assert.Equal(t, newValue, setting.Value)
@@ -117,8 +113,7 @@ func TestSettingServiceCache(t *testing.T) {
 		// 创建多个设置
 		keys := []string{"test.cache.1", "test.cache.2", "test.cache.3"}
 		for i, k := range keys {
-			keyMD5 := fmt.Sprintf("%x", md5.Sum([]byte(k+testSalt)))
-			_, err := service.SetSetting(k, fmt.Sprintf("value%d", i), keyMD5)
+			_, err := service.SetSetting(k, fmt.Sprintf("value%d", i))
 			assert.NoError(t, err)
 
 			// 读取一次确保缓存
@@ -152,10 +147,9 @@ func TestSettingServiceCache(t *testing.T) {
 	t.Run("性能测试：缓存vs数据库", func(t *testing.T) {
 		perfKey := "test.performance"
 		perfValue := "performance test value"
-		perfMD5 := fmt.Sprintf("%x", md5.Sum([]byte(perfKey+testSalt)))
 
 		// 设置数据
-		_, err := service.SetSetting(perfKey, perfValue, perfMD5)
+		_, err := service.SetSetting(perfKey, perfValue)
 		assert.NoError(t, err)
 
 		// 第一次读取（从数据库）
@@ -0,0 +1,326 @@
+package tests
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/logger"
+)
+
+// stubSettingDB 不连接MySQL的设置表替身，按查询条件从内存返回设置并统计查询次数
+type stubSettingDB struct {
+	mu       sync.Mutex
+	settings map[string]models.Setting
+	queries  int64
+	delay    time.Duration // 每次查询的耗时，用于模拟慢查询
+	onQuery  func()        // 每次查询读到数据后调用，用于在查询和写入缓存之间插入操作
+}
+
+// newStubSettingDB 创建替换了查询回调的数据库连接，只支持设置服务的读取查询
+func newStubSettingDB(t *testing.T, settings ...models.Setting) (*gorm.DB, *stubSettingDB) {
+	stub := &stubSettingDB{settings: map[string]models.Setting{}}
+	for _, setting := range settings {
+		stub.settings[setting.Key] = setting
+	}
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "stub:stub@tcp(127.0.0.1:1)/stub?parseTime=True",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DisableAutomaticPing: true, Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", stub.query))
+	return db, stub
+}
+
+// Queries 返回已执行的查询次数
+func (s *stubSettingDB) Queries() int64 {
+	return atomic.LoadInt64(&s.queries)
+}
+
+// query 按查询中的字符串参数匹配设置：LIKE 查询按前缀匹配，否则按key匹配（包括 IN 查询）
+func (s *stubSettingDB) query(db *gorm.DB) {
+	callbacks.BuildQuerySQL(db)
+	atomic.AddInt64(&s.queries, 1)
+
+	s.mu.Lock()
+	var matched []models.Setting
+	for _, v := range db.Statement.Vars {
+		value, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if strings.Contains(db.Statement.SQL.String(), "LIKE") {
+			prefix := strings.ReplaceAll(strings.TrimSuffix(value, "%"), `\`, "")
+			for key, setting := range s.settings {
+				if strings.HasPrefix(key, prefix) {
+					matched = append(matched, setting)
+				}
+			}
+		} else if setting, ok := s.settings[value]; ok {
+			matched = append(matched, setting)
+		}
+	}
+	onQuery := s.onQuery
+	s.mu.Unlock()
+	if onQuery != nil {
+		onQuery()
+	}
+	// 读取后再等待，模拟查询期间设置被修改
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Key < matched[j].Key })
+
+	switch dest := db.Statement.Dest.(type) {
+	case *models.Setting:
+		if len(matched) > 0 {
+			*dest = matched[0]
+		}
+	case *[]models.Setting:
+		*dest = append((*dest)[:0], matched...)
+	}
+	db.RowsAffected = int64(len(matched))
+	if db.RowsAffected == 0 && db.Statement.RaiseErrorOnNotFound {
+		db.AddError(gorm.ErrRecordNotFound)
+	}
+}
+
+// newStubSettingService 创建使用替身数据库和临时LevelDB缓存的设置服务，时钟可通过返回的指针调整
+func newStubSettingService(t *testing.T, settings ...models.Setting) (*services.SettingService, *stubSettingDB, *time.Time) {
+	db, stub := newStubSettingDB(t, settings...)
+	service, err := services.NewSettingService(db, t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { service.Close() })
+
+	// 默认关闭过期后返回旧值，需要时在测试中开启
+	service.StaleTTL = 0
+
+	now := time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC)
+	service.SetClock(func() time.Time { return now })
+	return service, stub, &now
+}
+
+func TestSettingMemoryCache_LRU(t *testing.T) {
+	cache := services.NewSettingMemoryCache(2)
+	cache.Put("a", []byte("1"))
+	cache.Put("b", []byte("2"))
+
+	// 读取a后b成为最久未使用的条目
+	data, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(data))
+	cache.Put("c", []byte("3"))
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, uint64(1), cache.Evictions())
+
+	// 更新已有条目不淘汰
+	cache.Put("a", []byte("4"))
+	data, _ = cache.Get("a")
+	assert.Equal(t, "4", string(data))
+	assert.Equal(t, uint64(1), cache.Evictions())
+
+	cache.Delete("a")
+	assert.Equal(t, 1, cache.Len())
+	cache.Clear()
+	assert.Equal(t, 0, cache.Len())
+
+	// 未启用时返回nil，所有方法均可调用
+	var disabled *services.SettingMemoryCache = services.NewSettingMemoryCache(0)
+	assert.Nil(t, disabled)
+	disabled.Put("a", []byte("1"))
+	_, ok = disabled.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, disabled.Len())
+}
+
+func TestSettingService_CacheTTL(t *testing.T) {
+	service, stub, now := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+
+	setting, err := service.GetSetting("app.theme")
+	require.NoError(t, err)
+	require.NotNil(t, setting)
+	assert.Equal(t, "dark", setting.Value)
+	assert.Equal(t, int64(1), stub.Queries())
+
+	// 有效期内从缓存读取
+	*now = now.Add(services.DefaultSettingCacheTTL - time.Second)
+	setting, err = service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", setting.Value)
+	assert.Equal(t, int64(1), stub.Queries())
+
+	// 过期后重新查询数据库
+	*now = now.Add(time.Second)
+	_, err = service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stub.Queries())
+
+	stats := service.GetCacheStats()
+	assert.Equal(t, uint64(1), stats["hits"])
+	assert.Equal(t, uint64(2), stats["misses"])
+	assert.Equal(t, uint64(1), stats["expired"])
+	assert.InDelta(t, 1.0/3, stats["hit_ratio"], 1e-9)
+	assert.Equal(t, 1, stats["cached_settings_count"])
+	assert.Greater(t, stats["disk_size_bytes"], int64(0))
+
+	// CacheTTL 不大于0时不过期
+	service.CacheTTL = 0
+	service.ClearCache("app.theme")
+	service.GetSetting("app.theme")
+	*now = now.Add(24 * time.Hour)
+	service.GetSetting("app.theme")
+	assert.Equal(t, int64(3), stub.Queries())
+}
+
+func TestSettingService_NegativeCache(t *testing.T) {
+	service, stub, now := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+
+	for i := 0; i < 3; i++ {
+		setting, err := service.GetSetting("app.missing")
+		require.NoError(t, err)
+		assert.Nil(t, setting)
+	}
+	assert.Equal(t, int64(1), stub.Queries())
+
+	// 批量读取同样使用不存在的缓存，查询后仍不存在的key也写入缓存
+	settings, missing, err := service.GetSettings([]string{"app.theme", "app.missing", "app.other"})
+	require.NoError(t, err)
+	assert.Len(t, settings, 1)
+	assert.Equal(t, []string{"app.missing", "app.other"}, missing)
+	assert.Equal(t, int64(2), stub.Queries())
+	_, missing, err = service.GetSettings([]string{"app.theme", "app.missing", "app.other"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app.missing", "app.other"}, missing)
+	assert.Equal(t, int64(2), stub.Queries())
+
+	stats := service.GetCacheStats()
+	assert.Equal(t, 2, stats["cached_missing_count"])
+	assert.Equal(t, uint64(5), stats["negative_hits"])
+
+	// 不存在的缓存有效期较短
+	*now = now.Add(services.DefaultSettingNegativeCacheTTL)
+	service.GetSetting("app.missing")
+	assert.Equal(t, int64(3), stub.Queries())
+
+	// 写入后立即可见
+	stub.mu.Lock()
+	stub.settings["app.missing"] = models.Setting{Key: "app.missing", Value: "found"}
+	stub.mu.Unlock()
+	service.ClearCache("app.missing")
+	setting, err := service.GetSetting("app.missing")
+	require.NoError(t, err)
+	require.NotNil(t, setting)
+	assert.Equal(t, "found", setting.Value)
+
+	// NegativeCacheTTL 不大于0时不缓存不存在的key
+	service.NegativeCacheTTL = 0
+	queries := stub.Queries()
+	service.GetSetting("app.none")
+	service.GetSetting("app.none")
+	assert.Equal(t, queries+2, stub.Queries())
+}
+
+func TestSettingService_MemoryTier(t *testing.T) {
+	service, stub, _ := newStubSettingService(t,
+		models.Setting{Key: "app.a", Value: "1"},
+		models.Setting{Key: "app.b", Value: "2"},
+	)
+	service.Memory = services.NewSettingMemoryCache(1)
+
+	service.GetSetting("app.a")
+	service.GetSetting("app.a")
+	stats := service.GetCacheStats()
+	assert.Equal(t, uint64(1), stats["memory_hits"])
+
+	// 内存缓存淘汰后仍可从LevelDB读取，并重新放入内存缓存
+	service.GetSetting("app.b")
+	setting, err := service.GetSetting("app.a")
+	require.NoError(t, err)
+	assert.Equal(t, "1", setting.Value)
+	assert.Equal(t, int64(2), stub.Queries())
+
+	stats = service.GetCacheStats()
+	assert.Equal(t, true, stats["memory_enabled"])
+	assert.Equal(t, 1, stats["memory_entries"])
+	assert.Equal(t, uint64(2), stats["evictions"])
+	assert.Equal(t, uint64(1), stats["memory_hits"])
+	assert.Equal(t, uint64(2), stats["hits"])
+
+	// 清除缓存同时清除内存缓存
+	require.NoError(t, service.ClearCache("app.a"))
+	service.GetSetting("app.a")
+	assert.Equal(t, int64(3), stub.Queries())
+	require.NoError(t, service.ClearAllCache())
+	assert.Equal(t, 0, service.Memory.Len())
+}
+
+func TestSettingService_PurgeExpiredCache(t *testing.T) {
+	service, _, now := newStubSettingService(t,
+		models.Setting{Key: "app.ios.theme", Value: "dark"},
+		models.Setting{Key: "app.ios.version", Value: "2.0"},
+	)
+	service.Memory = services.NewSettingMemoryCache(10)
+
+	_, settings, err := service.ListSettingsByPrefix("app.ios")
+	require.NoError(t, err)
+	assert.Len(t, settings, 2)
+	service.GetSetting("app.missing")
+
+	stats := service.GetCacheStats()
+	assert.Equal(t, 2, stats["cached_settings_count"])
+	assert.Equal(t, 1, stats["cached_prefixes_count"])
+	assert.Equal(t, 1, stats["cached_missing_count"])
+
+	// 只有不存在的缓存过期
+	*now = now.Add(services.DefaultSettingNegativeCacheTTL)
+	assert.Equal(t, 1, service.GetCacheStats()["expired_entries_count"])
+	removed, err := service.PurgeExpiredCache()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, 3, service.Memory.Len())
+
+	*now = now.Add(services.DefaultSettingCacheTTL)
+	removed, err = service.PurgeExpiredCache()
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	assert.Equal(t, 0, service.Memory.Len())
+
+	stats = service.GetCacheStats()
+	assert.Equal(t, 0, stats["cached_settings_count"])
+	assert.Equal(t, 0, stats["expired_entries_count"])
+	assert.Equal(t, uint64(4), stats["expired"])
+}
+
+func TestSettingService_LegacyCacheEntry(t *testing.T) {
+	service, stub, _ := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+
+	// 旧版本直接保存设置JSON、不带过期时间的缓存按未命中处理并被替换
+	legacy, _ := json.Marshal(models.Setting{Key: "app.theme", Value: "stale"})
+	require.NoError(t, service.Cache.Put([]byte("setting:app.theme"), legacy, nil))
+
+	setting, err := service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", setting.Value)
+	assert.Equal(t, int64(1), stub.Queries())
+
+	setting, err = service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", setting.Value)
+	assert.Equal(t, int64(1), stub.Queries())
+}
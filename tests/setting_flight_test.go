@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrentGetSetting 同时发起n个读取请求，返回每个请求读到的值，不存在时为空字符串
+func concurrentGetSetting(t *testing.T, service *services.SettingService, key string, n int) []string {
+	values := make([]string, n)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			setting, err := service.GetSetting(key)
+			assert.NoError(t, err)
+			if setting != nil {
+				values[i] = setting.Value
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return values
+}
+
+func TestSettingService_ConcurrentMissesSingleQuery(t *testing.T) {
+	service, stub, _ := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+	stub.delay = 50 * time.Millisecond
+	const n = 50
+
+	// 冷启动时同时未命中，只查询一次数据库
+	for _, value := range concurrentGetSetting(t, service, "app.theme", n) {
+		assert.Equal(t, "dark", value)
+	}
+	assert.Equal(t, int64(1), stub.Queries())
+
+	// 清除全部缓存后同样只查询一次
+	require.NoError(t, service.ClearAllCache())
+	for _, value := range concurrentGetSetting(t, service, "app.theme", n) {
+		assert.Equal(t, "dark", value)
+	}
+	assert.Equal(t, int64(2), stub.Queries())
+
+	// 不存在的key
+	for _, value := range concurrentGetSetting(t, service, "app.missing", n) {
+		assert.Empty(t, value)
+	}
+	assert.Equal(t, int64(3), stub.Queries())
+
+	// 每个请求得到独立的副本
+	a, _ := service.GetSetting("app.theme")
+	b, _ := service.GetSetting("app.theme")
+	a.Value = "changed"
+	assert.Equal(t, "dark", b.Value)
+}
+
+func TestSettingService_StaleWhileRevalidate(t *testing.T) {
+	service, stub, now := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+	service.StaleTTL = time.Minute
+
+	_, err := service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stub.Queries())
+
+	stub.mu.Lock()
+	stub.settings["app.theme"] = models.Setting{Key: "app.theme", Value: "light"}
+	stub.mu.Unlock()
+	stub.delay = 50 * time.Millisecond
+
+	// 过期后先返回旧值，后台只刷新一次
+	*now = now.Add(services.DefaultSettingCacheTTL)
+	for _, value := range concurrentGetSetting(t, service, "app.theme", 20) {
+		assert.Equal(t, "dark", value)
+	}
+	// 等待后台刷新写入缓存，读取统计不会触发刷新
+	assert.Eventually(t, func() bool {
+		return service.GetCacheStats()["expired_entries_count"] == 0
+	}, time.Second, 10*time.Millisecond)
+	setting, err := service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "light", setting.Value)
+	assert.Equal(t, int64(2), stub.Queries())
+	assert.Greater(t, service.GetCacheStats()["stale_hits"], uint64(0))
+
+	// 超过StaleTTL后不再返回旧值，同步查询数据库
+	stub.mu.Lock()
+	stub.settings["app.theme"] = models.Setting{Key: "app.theme", Value: "blue"}
+	stub.mu.Unlock()
+	*now = now.Add(services.DefaultSettingCacheTTL + time.Minute)
+	setting, err = service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", setting.Value)
+	assert.Equal(t, int64(3), stub.Queries())
+
+	// 旧值保留到StaleTTL结束后才被定时清理
+	*now = now.Add(services.DefaultSettingCacheTTL)
+	removed, err := service.PurgeExpiredCache()
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	*now = now.Add(time.Minute)
+	removed, err = service.PurgeExpiredCache()
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
+
+func TestSettingService_InvalidateDuringLoad(t *testing.T) {
+	service, stub, _ := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+	stub.delay = 100 * time.Millisecond
+
+	// 查询读到旧值后设置被修改，旧值只返回给本次请求，不写入缓存
+	done := make(chan string)
+	go func() {
+		setting, _ := service.GetSetting("app.theme")
+		done <- setting.Value
+	}()
+	time.Sleep(20 * time.Millisecond)
+	stub.mu.Lock()
+	stub.settings["app.theme"] = models.Setting{Key: "app.theme", Value: "light"}
+	stub.mu.Unlock()
+	require.NoError(t, service.ClearCache("app.theme"))
+	assert.Equal(t, "dark", <-done)
+
+	setting, err := service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "light", setting.Value)
+	assert.Equal(t, int64(2), stub.Queries())
+}
+
+// interleaveWriteWithPut 在下一次查询之后的第一次写入缓存时（读取时钟计算过期时间）并发修改设置并清除缓存
+// 返回等待修改完成的函数。写入缓存与清除缓存互斥时，清除等待写入完成后执行，旧值不会留在缓存中。
+func interleaveWriteWithPut(t *testing.T, service *services.SettingService, stub *stubSettingDB, now *time.Time, key, value string) func() {
+	var armed int32
+	done := make(chan struct{})
+	stub.mu.Lock()
+	stub.onQuery = func() { atomic.StoreInt32(&armed, 1) }
+	stub.mu.Unlock()
+
+	service.SetClock(func() time.Time {
+		if atomic.CompareAndSwapInt32(&armed, 1, 0) {
+			go func() {
+				defer close(done)
+				stub.mu.Lock()
+				stub.settings[key] = models.Setting{Key: key, Value: value}
+				stub.onQuery = nil
+				stub.mu.Unlock()
+				assert.NoError(t, service.ClearCache(key))
+			}()
+			// 留出时间让修改在写入缓存之前完成（写入与清除互斥时清除会等待）
+			time.Sleep(50 * time.Millisecond)
+		}
+		return *now
+	})
+	return func() { <-done }
+}
+
+func TestSettingService_InvalidateDuringPut(t *testing.T) {
+	service, stub, now := newStubSettingService(t, models.Setting{Key: "app.theme", Value: "dark"})
+
+	// 单个读取：查询读到旧值，写入缓存时设置被修改
+	wait := interleaveWriteWithPut(t, service, stub, now, "app.theme", "light")
+	setting, err := service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "dark", setting.Value)
+	wait()
+	setting, err = service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "light", setting.Value)
+
+	// 命名空间读取
+	wait = interleaveWriteWithPut(t, service, stub, now, "app.theme", "blue")
+	_, settings, err := service.ListSettingsByPrefix("app.")
+	require.NoError(t, err)
+	assert.Equal(t, "light", settings[0].Value)
+	wait()
+	_, settings, err = service.ListSettingsByPrefix("app.")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", settings[0].Value)
+	setting, err = service.GetSetting("app.theme")
+	require.NoError(t, err)
+	assert.Equal(t, "blue", setting.Value)
+
+	// 批量读取
+	require.NoError(t, service.ClearAllCache())
+	wait = interleaveWriteWithPut(t, service, stub, now, "app.theme", "green")
+	settings, _, err = service.GetSettings([]string{"app.theme"})
+	require.NoError(t, err)
+	assert.Equal(t, "blue", settings[0].Value)
+	wait()
+	settings, _, err = service.GetSettings([]string{"app.theme"})
+	require.NoError(t, err)
+	assert.Equal(t, "green", settings[0].Value)
+}
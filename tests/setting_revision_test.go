@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"testing"
+
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSettingValues_JSON(t *testing.T) {
+	diff := services.DiffSettingValues(
+		`{"theme":"light","limits":{"upload":10,"download":20},"channels":["ios"],"legacy":true}`,
+		`{"theme":"dark","limits":{"upload":10,"download":50},"channels":["ios","android"],"beta":{}}`,
+	)
+	assert.Equal(t, services.SettingDiffJSON, diff.Format)
+	assert.Empty(t, diff.Lines)
+	assert.Equal(t, []services.SettingValueChange{
+		{Path: "beta", Type: services.SettingChangeAdded, New: map[string]interface{}{}},
+		{Path: "channels", Type: services.SettingChangeChanged, Old: []interface{}{"ios"}, New: []interface{}{"ios", "android"}},
+		{Path: "legacy", Type: services.SettingChangeRemoved, Old: true},
+		{Path: "limits.download", Type: services.SettingChangeChanged, Old: float64(20), New: float64(50)},
+		{Path: "theme", Type: services.SettingChangeChanged, Old: "light", New: "dark"},
+	}, diff.Changes)
+
+	// 值相同时没有变更
+	diff = services.DiffSettingValues(`{"a":1}`, `{ "a": 1 }`)
+	assert.Equal(t, services.SettingDiffJSON, diff.Format)
+	assert.Empty(t, diff.Changes)
+}
+
+func TestDiffSettingValues_Text(t *testing.T) {
+	diff := services.DiffSettingValues("a\nb\nc", "a\nc\nd")
+	assert.Equal(t, services.SettingDiffText, diff.Format)
+	assert.Equal(t, []string{" a", "-b", " c", "+d"}, diff.Lines)
+
+	// 只有一边是JSON对象时按行对比
+	diff = services.DiffSettingValues(`{"a":1}`, "42")
+	assert.Equal(t, services.SettingDiffText, diff.Format)
+	assert.Equal(t, []string{`-{"a":1}`, "+42"}, diff.Lines)
+}
+
+func TestSettingService_Revisions(t *testing.T) {
+	db := setupTestSettingDB()
+	if db == nil {
+		t.Skip("跳过测试：无法连接到测试数据库")
+		return
+	}
+
+	// 清理测试数据
+	db.Where("1 = 1").Delete(&models.Setting{})
+	db.Where("1 = 1").Delete(&models.SettingSchema{})
+	db.Where("1 = 1").Delete(&models.SettingRevision{})
+
+	service := (&services.SettingService{DB: db}).WithClient(services.ClientInfo{ActorID: 7})
+	key := "app.banner"
+
+	_, err := service.SetSettingWithComment(key, "v1", "首次发布")
+	assert.NoError(t, err)
+	_, err = service.SetSetting(key, "v2")
+	assert.NoError(t, err)
+
+	revisions, total, err := service.ListRevisions(key, services.SettingRevisionQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	first, second := revisions[1], revisions[0]
+	assert.Nil(t, first.OldValue)
+	assert.Equal(t, "v1", first.NewValue)
+	assert.Equal(t, "首次发布", first.Comment)
+	assert.Equal(t, uint(7), *first.AuthorID)
+	assert.Equal(t, "v1", *second.OldValue)
+	assert.Equal(t, "v2", second.NewValue)
+
+	diff, err := service.DiffRevisions(key, first.ID, second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-v1", "+v2"}, diff.Lines)
+	_, err = service.DiffRevisions("app.other", first.ID, second.ID)
+	assert.ErrorIs(t, err, services.ErrSettingRevisionNotFound)
+
+	// 回滚经过相同的写入流程，追加一条修改记录
+	setting, err := service.Rollback(key, first.ID, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", setting.Value)
+	_, err = service.Rollback(key, first.ID, "")
+	assert.ErrorIs(t, err, services.ErrSettingRevisionUnchanged)
+
+	revisions, total, err = service.ListRevisions(key, services.SettingRevisionQuery{PageSize: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Len(t, revisions, 1)
+	assert.Equal(t, first.ID, *revisions[0].RevertedFrom)
+	assert.Equal(t, "v2", *revisions[0].OldValue)
+
+	// 旧版本的值不符合当前定义时拒绝回滚
+	assert.NoError(t, service.SetSchema(&models.SettingSchema{Key: key, Type: services.SettingTypeString, Min: int64Ptr(2)}))
+	_, err = service.Rollback(key, second.ID, "")
+	assert.NoError(t, err)
+	assert.NoError(t, service.SetSchema(&models.SettingSchema{Key: key, Type: services.SettingTypeString, Enum: []byte(`["v2","v3"]`)}))
+	_, err = service.Rollback(key, first.ID, "")
+	assert.ErrorIs(t, err, services.ErrSettingValueInvalid)
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func int64Ptr(n int64) *int64 {
+	return &n
+}
+
+func TestJSONSchema_Validate(t *testing.T) {
+	schema, err := services.ParseJSONSchema([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"required": ["version", "channels"],
+		"additionalProperties": false,
+		"properties": {
+			"version": {"type": "integer", "minimum": 1},
+			"theme": {"type": "string", "enum": ["light", "dark"]},
+			"channels": {"type": "array", "minItems": 1, "items": {"type": "string", "maxLength": 8}}
+		}
+	}`))
+	assert.NoError(t, err)
+
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{`{"version": 2, "channels": ["ios"]}`, true},
+		{`{"version": 2, "theme": "dark", "channels": ["ios", "android"]}`, true},
+		{`{"version": 1.5, "channels": ["ios"]}`, false},
+		{`{"version": 0, "channels": ["ios"]}`, false},
+		{`{"version": 2, "theme": "blue", "channels": ["ios"]}`, false},
+		{`{"version": 2, "channels": []}`, false},
+		{`{"version": 2, "channels": ["harmonyos"]}`, false},
+		{`{"version": 2}`, false},
+		{`{"version": 2, "channels": ["ios"], "extra": true}`, false},
+		{`[1, 2]`, false},
+		{`{"version": 2,`, false},
+	}
+	for _, c := range cases {
+		err := schema.ValidateJSON([]byte(c.value))
+		assert.Equal(t, c.valid, err == nil, "%s: %v", c.value, err)
+	}
+
+	// 不支持的关键字和类型
+	_, err = services.ParseJSONSchema([]byte(`{"type": "string", "pattern": "^a"}`))
+	assert.Error(t, err)
+	_, err = services.ParseJSONSchema([]byte(`{"type": "date"}`))
+	assert.Error(t, err)
+}
+
+func TestValidateSettingSchema(t *testing.T) {
+	valid := []models.SettingSchema{
+		{Type: services.SettingTypeString, Min: int64Ptr(1), Max: int64Ptr(20)},
+		{Type: services.SettingTypeInt, Enum: json.RawMessage(`[1, 2, 3]`)},
+		{Type: services.SettingTypeBool},
+		{Type: services.SettingTypeJSON, Schema: json.RawMessage(`{"type": "object"}`)},
+	}
+	for _, schema := range valid {
+		assert.NoError(t, services.ValidateSettingSchema(&schema), schema.Type)
+	}
+
+	invalid := []models.SettingSchema{
+		{Type: "float"},
+		{Type: services.SettingTypeString, Schema: json.RawMessage(`{"type": "string"}`)},
+		{Type: services.SettingTypeBool, Min: int64Ptr(0)},
+		{Type: services.SettingTypeInt, Min: int64Ptr(10), Max: int64Ptr(1)},
+		{Type: services.SettingTypeString, Min: int64Ptr(-1)},
+		{Type: services.SettingTypeInt, Enum: json.RawMessage(`[1, "2"]`)},
+		{Type: services.SettingTypeInt, Enum: json.RawMessage(`[1.5]`)},
+		{Type: services.SettingTypeString, Enum: json.RawMessage(`[]`)},
+		{Type: services.SettingTypeJSON, Enum: json.RawMessage(`[{}]`)},
+		{Type: services.SettingTypeJSON, Schema: json.RawMessage(`{"type": 1}`)},
+	}
+	for _, schema := range invalid {
+		assert.ErrorIs(t, services.ValidateSettingSchema(&schema), services.ErrSettingSchemaInvalid, "%+v", schema)
+	}
+}
+
+func TestValidateSettingValue(t *testing.T) {
+	cases := []struct {
+		schema models.SettingSchema
+		value  string
+		valid  bool
+	}{
+		{models.SettingSchema{Type: services.SettingTypeString, Max: int64Ptr(4)}, "主题名称", true},
+		{models.SettingSchema{Type: services.SettingTypeString, Max: int64Ptr(4)}, "主题名称过长", false},
+		{models.SettingSchema{Type: services.SettingTypeString, Enum: json.RawMessage(`["light", "dark"]`)}, "dark", true},
+		{models.SettingSchema{Type: services.SettingTypeString, Enum: json.RawMessage(`["light", "dark"]`)}, "blue", false},
+		{models.SettingSchema{Type: services.SettingTypeInt, Min: int64Ptr(1), Max: int64Ptr(100)}, "100", true},
+		{models.SettingSchema{Type: services.SettingTypeInt, Min: int64Ptr(1), Max: int64Ptr(100)}, "0", false},
+		{models.SettingSchema{Type: services.SettingTypeInt}, "1.5", false},
+		{models.SettingSchema{Type: services.SettingTypeInt, Enum: json.RawMessage(`[10, 20]`)}, "20", true},
+		{models.SettingSchema{Type: services.SettingTypeInt, Enum: json.RawMessage(`[10, 20]`)}, "30", false},
+		{models.SettingSchema{Type: services.SettingTypeBool}, "true", true},
+		{models.SettingSchema{Type: services.SettingTypeBool}, "1", false},
+		{models.SettingSchema{Type: services.SettingTypeJSON}, `{"a": 1}`, true},
+		{models.SettingSchema{Type: services.SettingTypeJSON}, `{"a": 1`, false},
+		{models.SettingSchema{Type: services.SettingTypeJSON, Schema: json.RawMessage(`{"type": "array"}`)}, `{}`, false},
+	}
+	for _, c := range cases {
+		err := services.ValidateSettingValue(&c.schema, c.value)
+		if c.valid {
+			assert.NoError(t, err, "%s %s", c.schema.Type, c.value)
+		} else {
+			assert.ErrorIs(t, err, services.ErrSettingValueInvalid, "%s %s", c.schema.Type, c.value)
+		}
+	}
+}
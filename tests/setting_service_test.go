@@ -1,10 +1,9 @@
 package tests
 
 import (
-	"crypto/md5"
-	"fmt"
 	"ios-api/models"
 	"ios-api/services"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,12 +21,12 @@ func setupTestSettingDB() *gorm.DB {
 	}
 
 	// 自动迁移
-	db.AutoMigrate(&models.Setting{})
+	db.AutoMigrate(&models.Setting{}, &models.SettingSchema{}, &models.SettingRevision{})
 
 	return db
 }
 
-func TestSettingService_SetSetting_WithSalt(t *testing.T) {
+func TestSettingService_SetSetting(t *testing.T) {
 	db := setupTestSettingDB()
 	if db == nil {
 		t.Skip("跳过测试：无法连接到测试数据库")
@@ -37,26 +36,21 @@ func TestSettingService_SetSetting_WithSalt(t *testing.T) {
 	// 清理测试数据
 	db.Where("1 = 1").Delete(&models.Setting{})
 
-	// 测试盐值
-	testSalt := "test_salt_12345"
-	service := &services.SettingService{
-		DB:   db,
-		Salt: testSalt,
-	}
+	service := &services.SettingService{DB: db}
 
-	// 测试MD5校验（使用测试盐值）
 	key := "test.setting"
 	value := "test value"
-	correctMD5 := fmt.Sprintf("%x", md5.Sum([]byte(key+testSalt)))
-	wrongMD5 := "wrong_md5"
 
-	// 测试错误的MD5
-	_, err := service.SetSetting(key, value, wrongMD5)
-	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "MD5校验失败")
+	// 测试格式校验错误
+	_, err := service.SetSetting("bad key", value)
+	assert.ErrorIs(t, err, services.ErrSettingKeyInvalid)
+	_, err = service.SetSetting(strings.Repeat("k", 65), value)
+	assert.ErrorIs(t, err, services.ErrSettingKeyLength)
+	_, err = service.SetSetting(key, strings.Repeat("v", 10241))
+	assert.ErrorIs(t, err, services.ErrSettingValueTooLarge)
 
-	// 测试正确的MD5 - 创建新设置
-	setting, err := service.SetSetting(key, value, correctMD5)
+	// 测试创建新设置
+	setting, err := service.SetSetting(key, value)
 	assert.NoError(t, err)
 	assert.NotNil(t, setting)
 	assert.Equal(t, key, setting.Key)
@@ -64,9 +58,66 @@ func TestSettingService_SetSetting_WithSalt(t *testing.T) {
 
 	// 测试更新现有设置
 	newValue := "updated value"
-	setting, err = service.SetSetting(key, newValue, correctMD5)
+	setting, err = service.SetSetting(key, newValue)
 	assert.NoError(t, err)
 	assert.NotNil(t, setting)
 	assert.Equal(t, key, setting.Key)
 	assert.Equal(t, newValue, setting.Value)
 }
+
+func TestSettingService_TypedValues(t *testing.T) {
+	db := setupTestSettingDB()
+	if db == nil {
+		t.Skip("跳过测试：无法连接到测试数据库")
+		return
+	}
+
+	// 清理测试数据
+	db.Where("1 = 1").Delete(&models.Setting{})
+	db.Where("1 = 1").Delete(&models.SettingSchema{})
+
+	service := &services.SettingService{DB: db}
+
+	// 定义后写入时校验
+	assert.NoError(t, service.SetSchema(&models.SettingSchema{Key: "app.max_upload", Type: services.SettingTypeInt, Min: int64Ptr(1), Max: int64Ptr(100)}))
+	_, err := service.SetSetting("app.max_upload", "200")
+	assert.ErrorIs(t, err, services.ErrSettingValueInvalid)
+	_, err = service.SetSetting("app.max_upload", "50")
+	assert.NoError(t, err)
+
+	// 已有值不符合新定义时拒绝修改定义
+	err = service.SetSchema(&models.SettingSchema{Key: "app.max_upload", Type: services.SettingTypeBool})
+	assert.ErrorIs(t, err, services.ErrSettingValueInvalid)
+
+	// 类型化读取，不存在时返回默认值
+	n, err := service.GetInt("app.max_upload", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(50), n)
+	n, err = service.GetInt("app.missing", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+
+	_, err = service.SetSetting("app.enabled", "true")
+	assert.NoError(t, err)
+	enabled, err := service.GetBool("app.enabled", false)
+	assert.NoError(t, err)
+	assert.True(t, enabled)
+	_, err = service.GetInt("app.enabled", 0)
+	assert.ErrorIs(t, err, services.ErrSettingTypeMismatch)
+
+	_, err = service.SetSetting("app.config", `{"theme":"dark"}`)
+	assert.NoError(t, err)
+	config := struct {
+		Theme    string `json:"theme"`
+		Language string `json:"language"`
+	}{Language: "zh-CN"}
+	assert.NoError(t, service.GetJSON("app.config", &config))
+	assert.Equal(t, "dark", config.Theme)
+	assert.Equal(t, "zh-CN", config.Language)
+
+	// 删除定义后不再校验
+	assert.NoError(t, service.DeleteSchema("app.max_upload"))
+	assert.ErrorIs(t, service.DeleteSchema("app.max_upload"), services.ErrSettingSchemaNotFound)
+	_, err = service.SetSetting("app.max_upload", "200")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,142 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingSmsSender 总是发送失败的短信发送器
+type failingSmsSender struct{}
+
+func (failingSmsSender) SendCode(phone, code string) error {
+	return errors.New("网络错误")
+}
+
+// newTestSmsCodeService 创建使用日志发送器和可控时钟的验证码服务
+func newTestSmsCodeService(cfg *config.Config) (*services.SmsCodeService, *services.LogSmsSender, *time.Time) {
+	sender := &services.LogSmsSender{}
+	service := services.NewSmsCodeService(sender, cfg)
+	now := time.Now()
+	service.SetClock(func() time.Time { return now })
+	return service, sender, &now
+}
+
+func TestNormalizePhone(t *testing.T) {
+	valid := map[string]string{
+		"13800138000":       "+8613800138000",
+		"138 0013 8000":     "+8613800138000",
+		"+8613800138000":    "+8613800138000",
+		"+14155552671":      "+14155552671",
+		" +44 20-7946-0958": "+442079460958",
+	}
+	for input, expected := range valid {
+		phone, err := services.NormalizePhone(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, phone, input)
+	}
+
+	for _, input := range []string{"", "12345", "23800138000", "+8612345", "+0123456789", "abc13800138000"} {
+		_, err := services.NormalizePhone(input)
+		assert.ErrorIs(t, err, services.ErrPhoneInvalid, input)
+	}
+}
+
+func TestSmsCodeService_SendAndVerify(t *testing.T) {
+	service, sender, _ := newTestSmsCodeService(&config.Config{})
+
+	assert.NoError(t, service.SendCode("+8613800138000", "1.1.1.1"))
+	code := sender.LastCode("+8613800138000")
+	assert.Len(t, code, 6)
+
+	assert.ErrorIs(t, service.VerifyCode("+8613800138001", code), services.ErrSmsCodeInvalid, "其他手机号不能使用")
+	assert.NoError(t, service.VerifyCode("+8613800138000", code))
+
+	// 验证码只能使用一次
+	assert.ErrorIs(t, service.VerifyCode("+8613800138000", code), services.ErrSmsCodeInvalid)
+}
+
+func TestSmsCodeService_Expired(t *testing.T) {
+	service, sender, now := newTestSmsCodeService(&config.Config{SmsCodeTTL: time.Minute})
+
+	assert.NoError(t, service.SendCode("+8613800138000", "1.1.1.1"))
+	*now = now.Add(time.Minute + time.Second)
+
+	err := service.VerifyCode("+8613800138000", sender.LastCode("+8613800138000"))
+	assert.ErrorIs(t, err, services.ErrSmsCodeExpired)
+}
+
+func TestSmsCodeService_TooManyAttempts(t *testing.T) {
+	service, sender, _ := newTestSmsCodeService(&config.Config{})
+
+	assert.NoError(t, service.SendCode("+8613800138000", "1.1.1.1"))
+	code := sender.LastCode("+8613800138000")
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	for i := 1; i < services.DefaultSmsMaxAttempts; i++ {
+		assert.ErrorIs(t, service.VerifyCode("+8613800138000", wrong), services.ErrSmsCodeInvalid)
+	}
+	assert.ErrorIs(t, service.VerifyCode("+8613800138000", wrong), services.ErrSmsCodeTooManyTries)
+
+	// 达到次数后正确的验证码也失效
+	assert.ErrorIs(t, service.VerifyCode("+8613800138000", code), services.ErrSmsCodeInvalid)
+}
+
+func TestSmsCodeService_PhoneThrottle(t *testing.T) {
+	service, sender, now := newTestSmsCodeService(&config.Config{
+		SmsPhoneInterval:   time.Minute,
+		SmsPhoneDailyLimit: 3,
+		SmsIPHourlyLimit:   100,
+	})
+	phone := "+8613800138000"
+
+	assert.NoError(t, service.SendCode(phone, "1.1.1.1"))
+	first := sender.LastCode(phone)
+
+	// 发送间隔内再次请求，之前的验证码仍然有效
+	assert.ErrorIs(t, service.SendCode(phone, "2.2.2.2"), services.ErrSmsTooFrequent)
+	assert.Equal(t, first, sender.LastCode(phone))
+
+	*now = now.Add(time.Minute)
+	assert.NoError(t, service.SendCode(phone, "1.1.1.1"))
+	*now = now.Add(time.Minute)
+	assert.NoError(t, service.SendCode(phone, "1.1.1.1"))
+	*now = now.Add(time.Minute)
+	assert.ErrorIs(t, service.SendCode(phone, "1.1.1.1"), services.ErrSmsPhoneLimit)
+
+	// 24小时后恢复
+	*now = now.Add(24 * time.Hour)
+	assert.NoError(t, service.SendCode(phone, "1.1.1.1"))
+}
+
+func TestSmsCodeService_IPThrottle(t *testing.T) {
+	service, _, now := newTestSmsCodeService(&config.Config{SmsIPHourlyLimit: 2})
+
+	assert.NoError(t, service.SendCode("+8613800138000", "1.1.1.1"))
+	assert.NoError(t, service.SendCode("+8613800138001", "1.1.1.1"))
+	assert.ErrorIs(t, service.SendCode("+8613800138002", "1.1.1.1"), services.ErrSmsIPLimit)
+
+	// 其他IP不受影响
+	assert.NoError(t, service.SendCode("+8613800138002", "2.2.2.2"))
+
+	*now = now.Add(time.Hour + time.Second)
+	assert.NoError(t, service.SendCode("+8613800138003", "1.1.1.1"))
+}
+
+func TestSmsCodeService_SendFailure(t *testing.T) {
+	service := services.NewSmsCodeService(failingSmsSender{}, &config.Config{})
+
+	assert.Error(t, service.SendCode("+8613800138000", "1.1.1.1"))
+
+	// 发送失败同样计入限流，且不会留下可用的验证码
+	assert.ErrorIs(t, service.SendCode("+8613800138000", "1.1.1.1"), services.ErrSmsTooFrequent)
+	assert.ErrorIs(t, service.VerifyCode("+8613800138000", "000000"), services.ErrSmsCodeInvalid)
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// aliyunTestCanonicalQuery 按阿里云文档独立实现的规范化查询字符串（不含Signature）
+func aliyunTestCanonicalQuery(query url.Values) string {
+	encode := func(s string) string {
+		return strings.NewReplacer("+", "%20", "*", "%2A", "%7E", "~").Replace(url.QueryEscape(s))
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if key != "Signature" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, encode(key)+"="+encode(query.Get(key)))
+	}
+	return strings.Join(pairs, "&")
+}
+
+func TestAliyunSmsSender_SendCode(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{"Code":"OK","Message":"OK","BizId":"900619746936498440^0","RequestId":"F655A8D5-B967-440B-8683-DAD6FF8DE990"}`)
+	}))
+	defer server.Close()
+
+	sender := &services.AliyunSmsSender{
+		AccessKeyID:     "testid",
+		AccessKeySecret: "testsecret",
+		SignName:        "阿里云短信测试",
+		TemplateCode:    "SMS_154950909",
+		Endpoint:        server.URL,
+	}
+	assert.NoError(t, sender.SendCode("+8613800138000", "123456"))
+
+	assert.Equal(t, "SendSms", query.Get("Action"))
+	assert.Equal(t, "13800138000", query.Get("PhoneNumbers"), "大陆号码不带国家码")
+	assert.Equal(t, `{"code":"123456"}`, query.Get("TemplateParam"))
+	assert.Equal(t, "阿里云短信测试", query.Get("SignName"))
+
+	// 使用独立实现的规范化方式校验签名
+	expected := services.AliyunSignature("testsecret", http.MethodGet, aliyunTestCanonicalQuery(query))
+	assert.Equal(t, expected, query.Get("Signature"))
+}
+
+func TestAliyunSmsSender_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"触发分钟级流控Permits:1"}`)
+	}))
+	defer server.Close()
+
+	sender := &services.AliyunSmsSender{AccessKeyID: "id", AccessKeySecret: "secret", Endpoint: server.URL}
+	err := sender.SendCode("+8613800138000", "123456")
+	assert.ErrorIs(t, err, services.ErrSmsSendFailed)
+	assert.Contains(t, err.Error(), "isv.BUSINESS_LIMIT_CONTROL")
+}
+
+func TestTencentSmsSender_SendCode(t *testing.T) {
+	var body []byte
+	var header http.Header
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		host = r.Host
+		fmt.Fprint(w, `{"Response":{"SendStatusSet":[{"SerialNo":"5000:1045710669157053657849499619","PhoneNumber":"+8613800138000","Fee":1,"Code":"Ok","Message":"send success"}],"RequestId":"a0aabda6-cf91-4f3e-a81f-9198114a2279"}}`)
+	}))
+	defer server.Close()
+
+	sender := &services.TencentSmsSender{
+		SecretID:   "AKIDtest",
+		SecretKey:  "secretkey",
+		AppID:      "1400006666",
+		SignName:   "腾讯云",
+		TemplateID: "449739",
+		Endpoint:   server.URL,
+	}
+	assert.NoError(t, sender.SendCode("+8613800138000", "123456"))
+
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, []interface{}{"+8613800138000"}, payload["PhoneNumberSet"])
+	assert.Equal(t, []interface{}{"123456"}, payload["TemplateParamSet"])
+	assert.Equal(t, "1400006666", payload["SmsSdkAppId"])
+
+	assert.Equal(t, "SendSms", header.Get("X-TC-Action"))
+	assert.Equal(t, "2021-01-11", header.Get("X-TC-Version"))
+	assert.Equal(t, services.DefaultTencentSmsRegion, header.Get("X-TC-Region"))
+
+	timestamp, err := strconv.ParseInt(header.Get("X-TC-Timestamp"), 10, 64)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(timestamp, 0), time.Minute)
+
+	authorization := header.Get("Authorization")
+	date := time.Unix(timestamp, 0).UTC().Format("2006-01-02")
+	assert.True(t, strings.HasPrefix(authorization, "TC3-HMAC-SHA256 Credential=AKIDtest/"+date+"/sms/tc3_request, SignedHeaders=content-type;host, Signature="))
+	assert.Equal(t, services.TencentAuthorization("AKIDtest", "secretkey", "sms", host, timestamp, body), authorization)
+}
+
+func TestTencentSmsSender_Error(t *testing.T) {
+	cases := map[string]string{
+		"接口错误": `{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"签名错误"},"RequestId":"x"}}`,
+		"发送失败": `{"Response":{"SendStatusSet":[{"Code":"LimitExceeded.PhoneNumberDailyLimit","Message":"单个手机号日下发条数超过设定的上限"}],"RequestId":"x"}}`,
+	}
+	for name, response := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, response)
+			}))
+			defer server.Close()
+
+			sender := &services.TencentSmsSender{SecretID: "id", SecretKey: "key", Endpoint: server.URL}
+			err := sender.SendCode("+8613800138000", "123456")
+			assert.ErrorIs(t, err, services.ErrSmsSendFailed)
+		})
+	}
+}
+
+func TestNewSmsSender(t *testing.T) {
+	sender, err := services.NewSmsSender(&config.Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, &services.LogSmsSender{}, sender)
+
+	_, err = services.NewSmsSender(&config.Config{SmsProvider: services.SmsProviderAliyun})
+	assert.ErrorIs(t, err, services.ErrSmsNotConfigured)
+
+	_, err = services.NewSmsSender(&config.Config{SmsProvider: services.SmsProviderTencent, TencentSmsSecretID: "id"})
+	assert.ErrorIs(t, err, services.ErrSmsNotConfigured)
+
+	_, err = services.NewSmsSender(&config.Config{SmsProvider: "unknown"})
+	assert.ErrorIs(t, err, services.ErrSmsNotConfigured)
+
+	sender, err = services.NewSmsSender(&config.Config{
+		SmsProvider:              services.SmsProviderAliyun,
+		AliyunSmsAccessKeyID:     "id",
+		AliyunSmsAccessKeySecret: "secret",
+		AliyunSmsSignName:        "签名",
+		AliyunSmsTemplateCode:    "SMS_1",
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &services.AliyunSmsSender{}, sender)
+}
+
+func TestConfigValidate_SmsProvider(t *testing.T) {
+	strong := "a_strong_random_secret"
+	cfg := &config.Config{
+		AppEnv:             "production",
+		JWTSecret:          strong,
+		OAuthStateSecret:   strong,
+		TokenEncryptionKey: strong,
+	}
+
+	// 非开发环境不能不配置短信服务商或只写日志
+	for _, provider := range []string{"", "log"} {
+		cfg.SmsProvider = provider
+		assert.True(t, errors.Is(cfg.Validate(), config.ErrSmsProviderMissing), provider)
+	}
+	cfg.SmsProvider = "tencent"
+	assert.NoError(t, cfg.Validate())
+
+	// 开发环境可以只写日志
+	cfg.AppEnv = "development"
+	cfg.SmsProvider = ""
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"ios-api/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenCipher_EncryptDecrypt(t *testing.T) {
+	cipher, err := utils.NewTokenCipher("test_encryption_key")
+	assert.NoError(t, err)
+	aad := utils.CipherAAD("oauth_accounts", 1, "refresh_token")
+
+	encrypted, err := cipher.Encrypt("refresh-token-value", aad)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "refresh-token-value", encrypted)
+
+	// 每次加密使用随机nonce，密文不同
+	encrypted2, err := cipher.Encrypt("refresh-token-value", aad)
+	assert.NoError(t, err)
+	assert.NotEqual(t, encrypted, encrypted2)
+
+	decrypted, err := cipher.Decrypt(encrypted, aad)
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh-token-value", decrypted)
+
+	// 空值原样返回
+	empty, err := cipher.Encrypt("", aad)
+	assert.NoError(t, err)
+	assert.Equal(t, "", empty)
+}
+
+func TestTokenCipher_RejectsTamperedOrForeignCiphertext(t *testing.T) {
+	cipher, _ := utils.NewTokenCipher("test_encryption_key")
+	other, _ := utils.NewTokenCipher("other_key")
+	aad := utils.CipherAAD("oauth_accounts", 1, "refresh_token")
+
+	encrypted, err := other.Encrypt("secret", aad)
+	assert.NoError(t, err)
+
+	_, err = cipher.Decrypt(encrypted, aad)
+	assert.ErrorIs(t, err, utils.ErrDecryptFailed)
+
+	_, err = cipher.Decrypt("not-base64!", aad)
+	assert.ErrorIs(t, err, utils.ErrDecryptFailed)
+}
+
+func TestTokenCipher_BindsRowAndColumn(t *testing.T) {
+	cipher, _ := utils.NewTokenCipher("test_encryption_key")
+
+	encrypted, err := cipher.Encrypt("secret", utils.CipherAAD("oauth_accounts", 1, "refresh_token"))
+	assert.NoError(t, err)
+
+	// 复制到其他行或其他字段的密文无法解密
+	_, err = cipher.Decrypt(encrypted, utils.CipherAAD("oauth_accounts", 2, "refresh_token"))
+	assert.ErrorIs(t, err, utils.ErrDecryptFailed)
+	_, err = cipher.Decrypt(encrypted, utils.CipherAAD("oauth_accounts", 1, "access_token"))
+	assert.ErrorIs(t, err, utils.ErrDecryptFailed)
+}
+
+func TestTokenCipher_DecryptsLegacyCiphertext(t *testing.T) {
+	tokenCipher, _ := utils.NewTokenCipher("test_encryption_key")
+
+	// 升级前未绑定附加数据的密文
+	key := sha256.Sum256([]byte("test_encryption_key"))
+	block, err := aes.NewCipher(key[:])
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	nonce := make([]byte, aead.NonceSize())
+	legacy := base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte("secret"), nil))
+
+	decrypted, err := tokenCipher.Decrypt(legacy, utils.CipherAAD("oauth_accounts", 1, "refresh_token"))
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", decrypted)
+}
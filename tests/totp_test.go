@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 附录B的SHA1测试密钥 "12345678901234567890" 的base32编码
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// RFC给出的是8位验证码，6位验证码为其后6位
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := services.TOTPCode(rfc6238Secret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, unix)
+	}
+
+	// 密钥忽略大小写和空格
+	code, err := services.TOTPCode("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	_, err = services.TOTPCode("not-base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := services.TOTPCode(rfc6238Secret, now)
+	current := now.Unix() / services.TOTPPeriod
+
+	step, ok := services.VerifyTOTP(rfc6238Secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, current, step)
+
+	// 允许前后一个时间步的时钟误差
+	_, ok = services.VerifyTOTP(rfc6238Secret, code, now.Add(services.TOTPPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = services.VerifyTOTP(rfc6238Secret, code, now.Add(-services.TOTPPeriod*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = services.VerifyTOTP(rfc6238Secret, code, now.Add(2*services.TOTPPeriod*time.Second), 0)
+	assert.False(t, ok)
+
+	// 已使用过的时间步不能再次使用
+	_, ok = services.VerifyTOTP(rfc6238Secret, code, now, current)
+	assert.False(t, ok)
+
+	for _, invalid := range []string{"", "12345", "1234567", "000000"} {
+		_, ok = services.VerifyTOTP(rfc6238Secret, invalid, now, 0)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := services.GenerateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32, "160位密钥的base32编码为32个字符")
+
+	other, _ := services.GenerateTOTPSecret()
+	assert.NotEqual(t, secret, other)
+
+	_, err = services.TOTPCode(secret, time.Now())
+	assert.NoError(t, err)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := services.TOTPURI("iOS API", "user@example.com", rfc6238Secret)
+
+	parsed, err := url.Parse(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/iOS API:user@example.com", parsed.Path)
+	assert.Equal(t, rfc6238Secret, parsed.Query().Get("secret"))
+	assert.Equal(t, "iOS API", parsed.Query().Get("issuer"))
+	assert.Equal(t, "6", parsed.Query().Get("digits"))
+	assert.Equal(t, "30", parsed.Query().Get("period"))
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	hash := services.HashRecoveryCode("ab12-cd34-ef56-7890")
+	assert.Len(t, hash, 64)
+	// 忽略大小写、空格和连字符
+	assert.Equal(t, hash, services.HashRecoveryCode("AB12CD34 EF567890"))
+	assert.NotEqual(t, hash, services.HashRecoveryCode("ab12-cd34-ef56-7891"))
+}
+
+func TestMFARequiredError(t *testing.T) {
+	var err error = &services.MFARequiredError{Token: "TOKEN", ExpiresIn: time.Minute}
+	assert.True(t, errors.Is(err, services.ErrMFARequired))
+	assert.Equal(t, services.ErrMFARequired.Error(), err.Error())
+
+	var mfaErr *services.MFARequiredError
+	assert.True(t, errors.As(err, &mfaErr))
+	assert.Equal(t, "TOKEN", mfaErr.Token)
+}
+
+func TestTOTPService_VerifyChallenge_UnknownToken(t *testing.T) {
+	service := services.NewTOTPService(nil, nil, &config.Config{TOTPIssuer: "ios-api"})
+
+	_, err := service.VerifyChallenge("unknown", "123456")
+	assert.ErrorIs(t, err, services.ErrMFAChallengeInvalid)
+
+	// 挑战过期后失效
+	now := time.Now()
+	service.SetClock(func() time.Time { return now })
+	token, err := service.NewChallenge(1)
+	assert.NoError(t, err)
+	now = now.Add(services.DefaultMFAChallengeTTL + time.Second)
+	_, err = service.VerifyChallenge(token, "123456")
+	assert.ErrorIs(t, err, services.ErrMFAChallengeInvalid)
+}
+
+func TestTOTPService_ChallengeLimit(t *testing.T) {
+	service := services.NewTOTPService(nil, nil, &config.Config{TOTPIssuer: "ios-api"})
+	service.MaxChallenges = 1
+
+	// 挑战数量达到上限时淘汰最早的挑战
+	first, err := service.NewChallenge(1)
+	assert.NoError(t, err)
+	_, err = service.NewChallenge(2)
+	assert.NoError(t, err)
+	_, err = service.VerifyChallenge(first, "123456")
+	assert.ErrorIs(t, err, services.ErrMFAChallengeInvalid)
+}
@@ -0,0 +1,261 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ios-api/controllers"
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// 测试管理后台搜索用户（需要数据库）
+func TestSearchUsers(t *testing.T) {
+	cfg := getTestConfig()
+	db := setupTestDB()
+	userService := &services.UserService{DB: db, JWTSecret: cfg.JWTSecret}
+
+	alice := models.User{Email: "alice@example.com", Nickname: "Alice", Phone: "+8613800000001"}
+	bob := models.User{Email: "bob@example.com", Nickname: "Bob_100%"}
+	assert.NoError(t, db.Create(&alice).Error)
+	assert.NoError(t, db.Create(&bob).Error)
+	assert.NoError(t, db.Create(&models.OAuthAccount{UserID: bob.ID, Provider: "github", ProviderUserID: "gh-42"}).Error)
+
+	search := func(params services.UserSearchParams) []uint {
+		users, total, err := userService.SearchUsers(params)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(len(users)), total)
+		ids := []uint{}
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []uint{alice.ID}, search(services.UserSearchParams{Query: "alice"}))
+	assert.Equal(t, []uint{alice.ID}, search(services.UserSearchParams{Phone: "13800000001"}))
+	assert.Equal(t, []uint{bob.ID, alice.ID}, search(services.UserSearchParams{Email: "@example.com"}))
+	assert.Equal(t, []uint{bob.ID}, search(services.UserSearchParams{ProviderUserID: "gh-42"}))
+	assert.Equal(t, []uint{bob.ID}, search(services.UserSearchParams{Provider: "github", ProviderUserID: "gh-42"}))
+	assert.Empty(t, search(services.UserSearchParams{Provider: "wechat", ProviderUserID: "gh-42"}))
+
+	// 通配符按字面匹配
+	assert.Equal(t, []uint{bob.ID}, search(services.UserSearchParams{Nickname: "100%"}))
+	assert.Empty(t, search(services.UserSearchParams{Nickname: "A_ice"}))
+
+	// 分页
+	users, total, err := userService.SearchUsers(services.UserSearchParams{Email: "@example.com", PageSize: 1, Page: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, users, 1)
+	assert.Equal(t, alice.ID, users[0].ID)
+}
+
+// 测试封禁用户：禁止登录并使会话立即失效（需要数据库）
+func TestBanUser(t *testing.T) {
+	cfg := getTestConfig()
+	db := setupTestDB()
+	userService := &services.UserService{
+		DB:        db,
+		JWTSecret: cfg.JWTSecret,
+		Sessions:  services.NewSessionCache(100, time.Minute),
+	}
+
+	testUser, err := createTestUser(db)
+	assert.NoError(t, err)
+
+	token, err := userService.GenerateToken(testUser.ID)
+	assert.NoError(t, err)
+	_, err = userService.VerifyToken(token)
+	assert.NoError(t, err)
+
+	revoked, err := userService.BanUser(testUser.ID, "发布违规内容")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	_, err = userService.BanUser(testUser.ID, "")
+	assert.ErrorIs(t, err, services.ErrUserAlreadyBanned)
+
+	// 会话立即失效，且不能再登录
+	_, err = userService.VerifyToken(token)
+	assert.Error(t, err)
+	_, _, err = userService.Login(services.LoginParams{Email: testUser.Email, Password: "testpassword"})
+	assert.Equal(t, services.ErrUserBanned, err)
+	_, err = userService.GenerateToken(testUser.ID)
+	assert.Equal(t, services.ErrUserBanned, err)
+
+	// 密码错误时不提示封禁
+	_, _, err = userService.Login(services.LoginParams{Email: testUser.Email, Password: "wrong"})
+	assert.Equal(t, services.ErrInvalidPassword, err)
+
+	user, err := userService.GetUserByID(testUser.ID)
+	assert.NoError(t, err)
+	assert.True(t, user.IsBanned())
+	assert.Equal(t, "发布违规内容", user.BanReason)
+
+	// 解除封禁后可以登录
+	assert.NoError(t, userService.UnbanUser(testUser.ID))
+	assert.ErrorIs(t, userService.UnbanUser(testUser.ID), services.ErrUserNotBanned)
+	_, token, err = userService.Login(services.LoginParams{Email: testUser.Email, Password: "testpassword"})
+	assert.NoError(t, err)
+	_, err = userService.VerifyToken(token)
+	assert.NoError(t, err)
+}
+
+// 测试管理后台用户详情、修改资料、撤销会话和审计日志（需要数据库）
+func TestAdminController_UserManagement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := getTestConfig()
+	db := setupTestDB()
+	userService := &services.UserService{DB: db, JWTSecret: cfg.JWTSecret}
+	auditService := services.NewAuditService(db, 0)
+	defer auditService.Close()
+	controller := &controllers.AdminController{
+		UserService: userService,
+		RBAC:        services.NewRBACService(db),
+		Audit:       auditService,
+	}
+
+	admin, err := createTestUser(db)
+	assert.NoError(t, err)
+	target, err := createTestUser(db)
+	assert.NoError(t, err)
+	token, err := userService.GenerateToken(target.ID)
+	assert.NoError(t, err)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("userID", admin.ID) })
+	r.GET("/admin/users", controller.SearchUsers)
+	r.GET("/admin/users/:id", controller.GetUser)
+	r.PUT("/admin/users/:id", controller.UpdateUser)
+	r.POST("/admin/users/:id/ban", controller.BanUser)
+	r.DELETE("/admin/users/:id/sessions/:session_id", controller.RevokeSession)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "admin-test")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 详情中的会话不包含令牌
+	w := request(http.MethodGet, fmt.Sprintf("/admin/users/%d", target.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sessions":[{"id":`)
+	assert.NotContains(t, w.Body.String(), token)
+
+	// 搜索和查看详情也记录审计日志
+	w = request(http.MethodGet, "/admin/users?q=test", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	auditService.Flush()
+	var viewCount, searchCount int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND target_id = ?", services.AuditAdminUserView, fmt.Sprint(target.ID)).Count(&viewCount)
+	db.Model(&models.AuditLog{}).Where("action = ? AND actor_id = ?", services.AuditAdminUserSearch, admin.ID).Count(&searchCount)
+	assert.Equal(t, int64(1), viewCount)
+	assert.Equal(t, int64(1), searchCount)
+
+	// 修改资料并记录字段变更
+	w = request(http.MethodPut, fmt.Sprintf("/admin/users/%d", target.ID), `{"nickname":"新昵称","signature":""}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	auditService.Flush()
+	var log models.AuditLog
+	assert.NoError(t, db.Where("action = ?", services.AuditAdminUserUpdate).First(&log).Error)
+	assert.Equal(t, admin.ID, *log.ActorID)
+	assert.Equal(t, fmt.Sprint(target.ID), log.TargetID)
+	assert.Equal(t, "admin-test", log.UserAgent)
+	assert.JSONEq(t, `{"nickname":{"old":"测试用户","new":"新昵称"}}`, log.Detail)
+
+	// 撤销指定会话
+	var session models.UserSession
+	assert.NoError(t, db.Where("user_id = ?", target.ID).First(&session).Error)
+	w = request(http.MethodDelete, fmt.Sprintf("/admin/users/%d/sessions/%d", target.ID, session.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, err = userService.VerifyToken(token)
+	assert.Error(t, err)
+	w = request(http.MethodDelete, fmt.Sprintf("/admin/users/%d/sessions/%d", target.ID, session.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 不能封禁自己
+	w = request(http.MethodPost, fmt.Sprintf("/admin/users/%d/ban", admin.ID), "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(http.MethodPost, fmt.Sprintf("/admin/users/%d/ban", target.ID), `{"reason":"spam"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	auditService.Flush()
+	var count int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND target_id = ?", services.AuditAdminUserBan, fmt.Sprint(target.ID)).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+// 测试用户注册、登录、修改资料的审计日志及查询（需要数据库）
+func TestAuditLog_Events(t *testing.T) {
+	cfg := getTestConfig()
+	db := setupTestDB()
+	auditService := services.NewAuditService(db, 0)
+	defer auditService.Close()
+	userService := &services.UserService{DB: db, JWTSecret: cfg.JWTSecret, Audit: auditService}
+	client := services.ClientInfo{IP: "203.0.113.7", UserAgent: "audit-test"}
+
+	user, _, err := userService.WithClient(client).Register(services.RegisterParams{
+		Email: "audit@example.com", Password: "password123", Nickname: "审计",
+	})
+	assert.NoError(t, err)
+	_, _, err = userService.WithClient(client).Login(services.LoginParams{Email: "audit@example.com", Password: "wrong"})
+	assert.Equal(t, services.ErrInvalidPassword, err)
+	_, _, err = userService.WithClient(client).Login(services.LoginParams{Email: "audit@example.com", Password: "password123"})
+	assert.NoError(t, err)
+
+	client.ActorID = user.ID
+	_, err = userService.WithClient(client).UpdateUser(user.ID, services.UpdateUserParams{Nickname: "新审计"})
+	assert.NoError(t, err)
+	auditService.Flush()
+
+	logs, total, err := auditService.Query(services.AuditLogQuery{
+		TargetType: services.AuditTargetUser,
+		TargetID:   fmt.Sprint(user.ID),
+		Action:     "user.*",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	actions := []string{}
+	for _, log := range logs {
+		actions = append(actions, log.Action)
+		assert.Equal(t, "203.0.113.7", log.IP)
+	}
+	assert.Equal(t, []string{
+		services.AuditUserUpdate, services.AuditUserLogin, services.AuditUserLoginFailed, services.AuditUserRegister,
+	}, actions)
+	assert.JSONEq(t, `{"nickname":{"old":"审计","new":"新审计"}}`, logs[0].Detail)
+
+	// 登录失败的操作人为空，前缀条件中的通配符按字面匹配
+	_, total, err = auditService.Query(services.AuditLogQuery{ActorID: user.ID, Action: services.AuditUserLoginFailed})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+	_, total, err = auditService.Query(services.AuditLogQuery{Action: "user_*"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+// 测试审计日志服务关闭后丢弃新记录
+func TestAuditService_DropAfterClose(t *testing.T) {
+	var nilService *services.AuditService
+	nilService.Record(services.AuditEntry{Action: services.AuditUserLogin})
+	nilService.Flush()
+	assert.Equal(t, uint64(0), nilService.Dropped())
+
+	auditService := services.NewAuditService(nil, 1)
+	auditService.Flush()
+	auditService.Close()
+	auditService.Close()
+
+	auditService.Record(services.AuditEntry{Action: services.AuditUserLogin})
+	auditService.Flush()
+	assert.Equal(t, uint64(1), auditService.Dropped())
+}
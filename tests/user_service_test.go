@@ -3,12 +3,14 @@ package tests
 import (
 	"fmt"
 	"log"
+	"strings"
 	"testing"
 	"time"
 
 	"ios-api/config"
 	"ios-api/models"
 	"ios-api/services"
+	"ios-api/utils"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/mysql"
@@ -50,6 +52,8 @@ func setupTestDB() *gorm.DB {
 	db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 
 	// 清空测试数据
+	db.Exec("DROP TABLE IF EXISTS audit_logs")
+	db.Exec("DROP TABLE IF EXISTS user_roles")
 	db.Exec("DROP TABLE IF EXISTS user_sessions")
 	db.Exec("DROP TABLE IF EXISTS oauth_accounts")
 	db.Exec("DROP TABLE IF EXISTS users")
@@ -58,7 +62,7 @@ func setupTestDB() *gorm.DB {
 	db.Exec("SET FOREIGN_KEY_CHECKS = 1")
 
 	// 迁移表结构
-	err = db.AutoMigrate(&models.User{}, &models.OAuthAccount{}, &models.UserSession{})
+	err = db.AutoMigrate(&models.User{}, &models.OAuthAccount{}, &models.UserSession{}, &models.WebAuthnCredential{}, &models.MFARecoveryCode{}, &models.UserRole{}, &models.AuditLog{})
 	if err != nil {
 		log.Fatalf("迁移表结构失败: %v", err)
 	}
@@ -256,6 +260,371 @@ func TestOAuthLogin(t *testing.T) {
 	}
 }
 
+// 测试微信UnionID跨应用账号合并
+func TestOAuthLoginUnionIDMerge(t *testing.T) {
+	// 加载测试配置
+	cfg := getTestConfig()
+
+	db := setupTestDB()
+	userService := &services.UserService{
+		DB:        db,
+		JWTSecret: cfg.JWTSecret,
+	}
+
+	// 旧版本创建的绑定只有OpenID
+	legacyUser, _, err := userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: "app_openid",
+		Nickname:       "微信用户",
+	})
+	if err != nil {
+		t.Errorf("第三方登录失败: %v", err)
+		return
+	}
+
+	// 同一应用再次登录时补齐UnionID
+	user, _, err := userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: "app_openid",
+		UnionID:        "union123",
+	})
+	if err != nil {
+		t.Errorf("第三方登录失败: %v", err)
+		return
+	}
+	if user.ID != legacyUser.ID {
+		t.Errorf("用户ID不匹配，期望 %d，实际 %d", legacyUser.ID, user.ID)
+	}
+
+	var account models.OAuthAccount
+	db.Where("provider = ? AND provider_user_id = ?", "wechat", "app_openid").First(&account)
+	if account.UnionID != "union123" {
+		t.Errorf("UnionID未补齐，期望 union123，实际 %s", account.UnionID)
+	}
+
+	// 小程序使用不同的OpenID但相同的UnionID，应登录到同一用户
+	miniUser, _, err := userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: "mini_openid",
+		UnionID:        "union123",
+	})
+	if err != nil {
+		t.Errorf("小程序登录失败: %v", err)
+		return
+	}
+	if miniUser.ID != legacyUser.ID {
+		t.Errorf("小程序用户未合并，期望 %d，实际 %d", legacyUser.ID, miniUser.ID)
+	}
+
+	var count int64
+	db.Model(&models.OAuthAccount{}).Where("user_id = ?", legacyUser.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("绑定数量不匹配，期望 2，实际 %d", count)
+	}
+
+	// 另一个用户的旧绑定返回同一UnionID时不补齐，仍登录到原用户
+	separateUser, _, err := userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: "separate_openid",
+	})
+	if err != nil {
+		t.Errorf("第三方登录失败: %v", err)
+		return
+	}
+	user, _, err = userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: "separate_openid",
+		UnionID:        "union123",
+	})
+	if err != nil {
+		t.Errorf("第三方登录失败: %v", err)
+		return
+	}
+	if user.ID != separateUser.ID {
+		t.Errorf("用户ID不匹配，期望 %d，实际 %d", separateUser.ID, user.ID)
+	}
+	var separateAccount models.OAuthAccount
+	db.Where("provider = ? AND provider_user_id = ?", "wechat", "separate_openid").First(&separateAccount)
+	if separateAccount.UnionID != "" {
+		t.Errorf("已绑定到其他用户的UnionID不应补齐，实际 %s", separateAccount.UnionID)
+	}
+
+	// 不同UnionID创建新用户
+	otherUser, _, err := userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "wechat",
+		ProviderUserID: "other_openid",
+		UnionID:        "union456",
+	})
+	if err != nil {
+		t.Errorf("第三方登录失败: %v", err)
+		return
+	}
+	if otherUser.ID == legacyUser.ID {
+		t.Error("不同UnionID不应合并到同一用户")
+	}
+}
+
+// 测试处理苹果服务端通知
+func TestHandleAppleNotification(t *testing.T) {
+	// 加载测试配置
+	cfg := getTestConfig()
+
+	db := setupTestDB()
+	userService := &services.UserService{
+		DB:        db,
+		JWTSecret: cfg.JWTSecret,
+	}
+
+	user, _, err := userService.OAuthLogin(services.OAuthLoginParams{
+		Provider:       "apple",
+		ProviderUserID: "apple_sub",
+		Email:          "old@privaterelay.appleid.com",
+	})
+	if err != nil {
+		t.Errorf("第三方登录失败: %v", err)
+		return
+	}
+
+	// 中转邮箱变更
+	err = userService.HandleAppleNotification(&services.AppleNotificationEvent{
+		Type:  services.AppleEventEmailDisabled,
+		Sub:   "apple_sub",
+		Email: "new@privaterelay.appleid.com",
+	})
+	if err != nil {
+		t.Errorf("处理邮箱通知失败: %v", err)
+	}
+	var account models.OAuthAccount
+	db.Where("provider = ? AND provider_user_id = ?", "apple", "apple_sub").First(&account)
+	if account.Email != "new@privaterelay.appleid.com" || !account.EmailDisabled {
+		t.Errorf("中转邮箱未更新，实际 %s (disabled=%v)", account.Email, account.EmailDisabled)
+	}
+	updated, _ := userService.GetUserByID(user.ID)
+	if updated.Email != "new@privaterelay.appleid.com" {
+		t.Errorf("用户邮箱未同步更新，实际 %s", updated.Email)
+	}
+
+	// 撤销授权时撤销所有会话
+	userService.GenerateToken(user.ID)
+	err = userService.HandleAppleNotification(&services.AppleNotificationEvent{
+		Type: services.AppleEventConsentRevoked,
+		Sub:  "apple_sub",
+	})
+	if err != nil {
+		t.Errorf("处理撤销授权通知失败: %v", err)
+	}
+	var sessionCount int64
+	db.Model(&models.UserSession{}).Where("user_id = ?", user.ID).Count(&sessionCount)
+	if sessionCount != 0 {
+		t.Errorf("会话未撤销，剩余 %d 个", sessionCount)
+	}
+
+	// 删除账号
+	err = userService.HandleAppleNotification(&services.AppleNotificationEvent{
+		Type: services.AppleEventAccountDelete,
+		Sub:  "apple_sub",
+	})
+	if err != nil {
+		t.Errorf("处理删除账号通知失败: %v", err)
+	}
+	if _, err := userService.GetUserByID(user.ID); err != services.ErrUserNotFound {
+		t.Errorf("用户未删除，实际返回 %v", err)
+	}
+
+	// 未绑定的用户
+	err = userService.HandleAppleNotification(&services.AppleNotificationEvent{
+		Type: services.AppleEventConsentRevoked,
+		Sub:  "unknown_sub",
+	})
+	if err != services.ErrUserNotFound {
+		t.Errorf("应返回用户不存在错误，实际返回 %v", err)
+	}
+}
+
+// 测试短信验证码登录
+func TestSmsLogin(t *testing.T) {
+	// 加载测试配置
+	cfg := getTestConfig()
+
+	db := setupTestDB()
+	userService := &services.UserService{
+		DB:        db,
+		JWTSecret: cfg.JWTSecret,
+	}
+
+	// 首次登录自动创建用户
+	user, token, err := userService.SmsLogin("+8613800138000")
+	if err != nil {
+		t.Errorf("短信登录失败: %v", err)
+		return
+	}
+	if token == "" {
+		t.Errorf("token不应为空")
+	}
+	if user.Phone != "+8613800138000" {
+		t.Errorf("手机号不匹配，期望 %s，实际 %s", "+8613800138000", user.Phone)
+	}
+	if user.Nickname != "用户8000" {
+		t.Errorf("默认昵称不匹配，实际 %s", user.Nickname)
+	}
+
+	// 再次登录返回同一用户
+	again, _, err := userService.SmsLogin("+8613800138000")
+	if err != nil {
+		t.Errorf("再次短信登录失败: %v", err)
+		return
+	}
+	if again.ID != user.ID {
+		t.Errorf("同一手机号应登录同一用户，期望 %d，实际 %d", user.ID, again.ID)
+	}
+
+	// 邮箱用户的手机号为空，不应与其他用户冲突
+	if _, err := createTestUser(db); err != nil {
+		t.Errorf("创建邮箱用户失败: %v", err)
+	}
+	if _, err := createTestUser(db); err != nil {
+		t.Errorf("创建第二个邮箱用户失败: %v", err)
+	}
+}
+
+// 测试两步验证登录
+func TestTOTPLogin(t *testing.T) {
+	// 加载测试配置
+	cfg := getTestConfig()
+	cfg.TOTPIssuer = "ios-api"
+
+	db := setupTestDB()
+	cipher, err := utils.NewTokenCipher("test_token_key")
+	if err != nil {
+		t.Fatalf("创建加密器失败: %v", err)
+	}
+	now := time.Now()
+	totpService := services.NewTOTPService(db, cipher, cfg)
+	totpService.SetClock(func() time.Time { return now })
+	userService := &services.UserService{
+		DB:        db,
+		JWTSecret: cfg.JWTSecret,
+		MFA:       totpService,
+	}
+
+	testUser, err := createTestUser(db)
+	if err != nil {
+		t.Errorf("创建测试用户失败: %v", err)
+		return
+	}
+
+	// 开启两步验证
+	enrollment, err := totpService.BeginEnrollment(testUser.ID)
+	if err != nil {
+		t.Errorf("获取两步验证密钥失败: %v", err)
+		return
+	}
+	if _, err := totpService.ConfirmEnrollment(testUser.ID, "000000"); err != services.ErrTOTPCodeInvalid {
+		t.Errorf("错误验证码应确认失败，实际返回 %v", err)
+	}
+	code, _ := services.TOTPCode(enrollment.Secret, now)
+	recoveryCodes, err := totpService.ConfirmEnrollment(testUser.ID, code)
+	if err != nil {
+		t.Errorf("确认开启两步验证失败: %v", err)
+		return
+	}
+	if len(recoveryCodes) != services.DefaultMFARecoveryCodes {
+		t.Errorf("恢复码数量不匹配，实际 %d", len(recoveryCodes))
+	}
+
+	// 密码登录不再直接返回会话
+	params := services.LoginParams{Email: testUser.Email, Password: "testpassword"}
+	_, token, err := userService.Login(params)
+	mfaErr, ok := err.(*services.MFARequiredError)
+	if !ok || token != "" {
+		t.Errorf("开启两步验证后应返回挑战令牌，实际返回 %v", err)
+		return
+	}
+
+	// 确认时使用过的验证码不能再次使用
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, code); err != services.ErrTOTPCodeInvalid {
+		t.Errorf("重放验证码应失败，实际返回 %v", err)
+	}
+
+	// 下一个时间步的验证码可以登录，挑战令牌随即失效
+	now = now.Add(services.TOTPPeriod * time.Second)
+	code, _ = services.TOTPCode(enrollment.Secret, now)
+	userID, err := totpService.VerifyChallenge(mfaErr.Token, code)
+	if err != nil || userID != testUser.ID {
+		t.Errorf("两步验证登录失败: %v", err)
+	}
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, code); err != services.ErrMFAChallengeInvalid {
+		t.Errorf("挑战令牌应只能使用一次，实际返回 %v", err)
+	}
+
+	// 恢复码只能使用一次
+	_, _, err = userService.Login(params)
+	mfaErr, _ = err.(*services.MFARequiredError)
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, strings.ToUpper(recoveryCodes[0])); err != nil {
+		t.Errorf("恢复码登录失败: %v", err)
+	}
+	_, _, err = userService.Login(params)
+	mfaErr, _ = err.(*services.MFARequiredError)
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, recoveryCodes[0]); err != services.ErrTOTPCodeInvalid {
+		t.Errorf("已使用的恢复码应失败，实际返回 %v", err)
+	}
+
+	// 超过尝试次数后挑战令牌失效
+	for i := 1; i < totpService.MaxAttempts; i++ {
+		totpService.VerifyChallenge(mfaErr.Token, "000000")
+	}
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, recoveryCodes[1]); err != services.ErrMFATooManyTries {
+		t.Errorf("超过尝试次数应失败，实际返回 %v", err)
+	}
+
+	// 重新登录获取新令牌后继续累计失败次数，达到上限后锁定
+	for {
+		_, _, err = userService.Login(params)
+		mfaErr, _ = err.(*services.MFARequiredError)
+		err = nil
+		for i := 0; i < totpService.MaxAttempts && err == nil; i++ {
+			_, err = totpService.VerifyChallenge(mfaErr.Token, "000000")
+			if err == services.ErrTOTPCodeInvalid {
+				err = nil
+			}
+		}
+		if err == services.ErrMFALocked {
+			break
+		}
+		if err != services.ErrMFATooManyTries {
+			t.Errorf("连续失败应锁定，实际返回 %v", err)
+			return
+		}
+	}
+	_, _, err = userService.Login(params)
+	mfaErr, _ = err.(*services.MFARequiredError)
+	now = now.Add(services.TOTPPeriod * time.Second)
+	code, _ = services.TOTPCode(enrollment.Secret, now)
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, code); err != services.ErrMFALocked {
+		t.Errorf("锁定期间正确验证码也应失败，实际返回 %v", err)
+	}
+
+	// 锁定到期后可以正常验证
+	now = now.Add(totpService.LockDuration)
+	code, _ = services.TOTPCode(enrollment.Secret, now)
+	_, _, err = userService.Login(params)
+	mfaErr, _ = err.(*services.MFARequiredError)
+	if _, err := totpService.VerifyChallenge(mfaErr.Token, code); err != nil {
+		t.Errorf("锁定到期后验证失败: %v", err)
+	}
+
+	// 关闭两步验证需要密码
+	if err := totpService.Disable(testUser.ID, "wrongpassword"); err != services.ErrInvalidPassword {
+		t.Errorf("错误密码应无法关闭两步验证，实际返回 %v", err)
+	}
+	if err := totpService.Disable(testUser.ID, "testpassword"); err != nil {
+		t.Errorf("关闭两步验证失败: %v", err)
+	}
+	if _, token, err = userService.Login(params); err != nil || token == "" {
+		t.Errorf("关闭两步验证后应直接登录，实际返回 %v", err)
+	}
+}
+
 // 测试退出登录
 func TestLogout(t *testing.T) {
 	// 加载测试配置
@@ -437,3 +806,68 @@ func TestVerifyToken(t *testing.T) {
 		t.Errorf("应返回错误，实际没有返回错误")
 	}
 }
+
+// 测试会话缓存在退出登录和撤销会话时立即失效
+func TestVerifyToken_SessionCacheInvalidation(t *testing.T) {
+	// 加载测试配置
+	cfg := getTestConfig()
+
+	db := setupTestDB()
+	userService := &services.UserService{
+		DB:        db,
+		JWTSecret: cfg.JWTSecret,
+		Sessions:  services.NewSessionCache(100, time.Minute),
+	}
+
+	// 创建测试用户
+	testUser, err := createTestUser(db)
+	if err != nil {
+		t.Errorf("创建测试用户失败: %v", err)
+		return
+	}
+
+	// 验证后会话写入缓存
+	token, err := userService.GenerateToken(testUser.ID)
+	if err != nil {
+		t.Errorf("生成token失败: %v", err)
+		return
+	}
+	if _, err := userService.VerifyToken(token); err != nil {
+		t.Errorf("验证token失败: %v", err)
+		return
+	}
+	if userService.Sessions.Len() != 1 {
+		t.Errorf("会话应写入缓存，实际缓存数 %d", userService.Sessions.Len())
+	}
+
+	// 退出登录后立即失效
+	if err := userService.Logout(token); err != nil {
+		t.Errorf("退出登录失败: %v", err)
+		return
+	}
+	if _, err := userService.VerifyToken(token); err != services.ErrInvalidToken {
+		t.Errorf("退出登录后应返回无效令牌错误，实际返回 %v", err)
+	}
+
+	// 撤销用户所有会话后立即失效
+	tokens := make([]string, 2)
+	for i := range tokens {
+		if tokens[i], err = userService.GenerateToken(testUser.ID); err != nil {
+			t.Errorf("生成token失败: %v", err)
+			return
+		}
+		if _, err := userService.VerifyToken(tokens[i]); err != nil {
+			t.Errorf("验证token失败: %v", err)
+			return
+		}
+	}
+	if _, err := userService.RevokeUserSessions(testUser.ID); err != nil {
+		t.Errorf("撤销会话失败: %v", err)
+		return
+	}
+	for _, token := range tokens {
+		if _, err := userService.VerifyToken(token); err != services.ErrInvalidToken {
+			t.Errorf("撤销会话后应返回无效令牌错误，实际返回 %v", err)
+		}
+	}
+}
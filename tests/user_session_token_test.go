@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"testing"
+
+	"ios-api/config"
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// stubSessionDB 不连接MySQL的会话表替身
+// 与严格模式的MySQL一样，令牌超过 user_sessions.token 字段长度时写入失败。
+type stubSessionDB struct {
+	mu       sync.Mutex
+	sessions []models.UserSession
+}
+
+// newStubSessionDB 创建替换了增删查回调的数据库连接，只支持会话的创建、验证和退出登录
+func newStubSessionDB(t *testing.T) (*gorm.DB, *stubSessionDB) {
+	stub := &stubSessionDB{}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "stub:stub@tcp(127.0.0.1:1)/stub?parseTime=True",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Default.LogMode(logger.Silent)})
+	require.NoError(t, err)
+	require.NoError(t, db.Callback().Create().Replace("gorm:create", stub.create))
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", stub.query))
+	require.NoError(t, db.Callback().Delete().Replace("gorm:delete", stub.delete))
+	return db, stub
+}
+
+// create 保存会话，按模型定义的字段长度检查令牌
+func (s *stubSessionDB) create(db *gorm.DB) {
+	session, ok := db.Statement.Dest.(*models.UserSession)
+	if !ok {
+		db.AddError(fmt.Errorf("stub: 不支持的写入 %T", db.Statement.Dest))
+		return
+	}
+	if size := db.Statement.Schema.LookUpField("Token").Size; len(session.Token) > size {
+		db.AddError(fmt.Errorf("Error 1406: Data too long for column 'token' (%d > %d)", len(session.Token), size))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session.ID = uint(len(s.sessions) + 1)
+	s.sessions = append(s.sessions, *session)
+	db.RowsAffected = 1
+}
+
+// query 封禁检查的计数查询返回0，会话查询按jti或token匹配
+func (s *stubSessionDB) query(db *gorm.DB) {
+	callbacks.BuildQuerySQL(db)
+	switch dest := db.Statement.Dest.(type) {
+	case *int64:
+		*dest = 0
+		db.RowsAffected = 1
+	case *models.UserSession:
+		if session, ok := s.find(db.Statement.Vars); ok {
+			*dest = session
+			db.RowsAffected = 1
+		} else {
+			db.AddError(gorm.ErrRecordNotFound)
+		}
+	}
+}
+
+// delete 按token删除会话
+func (s *stubSessionDB) delete(db *gorm.DB) {
+	db.Statement.AddClauseIfNotExists(clause.Delete{})
+	db.Statement.AddClauseIfNotExists(clause.From{})
+	db.Statement.Build("DELETE", "FROM", "WHERE")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range db.Statement.Vars {
+		for i, session := range s.sessions {
+			if session.Token == v {
+				s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+				db.RowsAffected = 1
+				return
+			}
+		}
+	}
+}
+
+// find 按查询参数查找会话
+func (s *stubSessionDB) find(vars []interface{}) (models.UserSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range vars {
+		for _, session := range s.sessions {
+			if (session.JTI != nil && *session.JTI == v) || session.Token == v {
+				return session, true
+			}
+		}
+	}
+	return models.UserSession{}, false
+}
+
+func TestUserService_AsymmetricTokenSession(t *testing.T) {
+	dir := t.TempDir()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	require.NoError(t, err)
+	writeJWTKey(t, dir, "ec-1", ecKey)
+	writeJWTKey(t, dir, "rsa-1", rsaKey)
+
+	// RS256签名（4096位密钥）的令牌远超过255字符，会话必须能保存完整令牌
+	for _, kid := range []string{"ec-1", "rsa-1"} {
+		keys, err := services.LoadJWTKeySet(&config.Config{JWTKeysDir: dir, JWTSigningKeyID: kid})
+		require.NoError(t, err)
+		db, _ := newStubSessionDB(t)
+		service := &services.UserService{DB: db, Keys: keys}
+
+		token, err := service.GenerateToken(42)
+		require.NoError(t, err, kid)
+		assert.Greater(t, len(token), 255, kid)
+
+		userID, err := service.VerifyToken(token)
+		assert.NoError(t, err, kid)
+		assert.Equal(t, uint(42), userID, kid)
+
+		assert.NoError(t, service.Logout(token), kid)
+		_, err = service.VerifyToken(token)
+		assert.ErrorIs(t, err, services.ErrInvalidToken, kid)
+	}
+}
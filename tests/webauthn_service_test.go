@@ -0,0 +1,483 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"ios-api/config"
+	"ios-api/models"
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 录制的通行密钥数据：依赖方ID为 example.com，来源为 https://example.com，用户ID为 42
+const (
+	// 凭证ID
+	webAuthnFixtureCredentialID = "cGFzc2tleS1maXh0dXJlLWVzMjU2"
+	// 注册的clientDataJSON，挑战为 0x01..0x20
+	webAuthnFixtureRegisterClientData = "eyJ0eXBlIjoid2ViYXV0aG4uY3JlYXRlIiwiY2hhbGxlbmdlIjoiQVFJREJBVUdCd2dKQ2dzTURRNFBFQkVTRXhRVk" +
+		"ZoY1lHUm9iSEIwZUh5QSIsIm9yaWdpbiI6Imh0dHBzOi8vZXhhbXBsZS5jb20ifQ"
+	// none格式的证明对象，标志位 UP|UV|AT，ES256公钥
+	webAuthnFixtureAttestation = "o2NmbXRkbm9uZWdhdHRTdG10oGhhdXRoRGF0YViZo3mm9u6vuaVeN4wRgDTidR5oL6ufLTCrE9ISVYbOGUdFAAAAAA" +
+		"AAAAAAAAAAAAAAAAAAAAAAFXBhc3NrZXktZml4dHVyZS1lczI1NqUBAgMmIAEhWCBg_tS6JVqdMclh63TGNW1owEm4" +
+		"kjth-mzmaWIuYPKftiJYIHkD_hAIuLyZpBrp6VYovGTy8bIMLX6fUXejwpTURiKZ"
+	// 同一认证器数据的packed格式证明对象（不接受）
+	webAuthnFixturePackedAttestation = "o2NmbXRmcGFja2VkZ2F0dFN0bXSiY2FsZyZjc2lnQwECA2hhdXRoRGF0YViZo3mm9u6vuaVeN4wRgDTidR5oL6ufLT" +
+		"CrE9ISVYbOGUdFAAAAAAAAAAAAAAAAAAAAAAAAAAAAFXBhc3NrZXktZml4dHVyZS1lczI1NqUBAgMmIAEhWCBg_tS6" +
+		"JVqdMclh63TGNW1owEm4kjth-mzmaWIuYPKftiJYIHkD_hAIuLyZpBrp6VYovGTy8bIMLX6fUXejwpTURiKZ"
+	// 登录的clientDataJSON，挑战为 0x21..0x40
+	webAuthnFixtureLoginClientData = "eyJ0eXBlIjoid2ViYXV0aG4uZ2V0IiwiY2hhbGxlbmdlIjoiSVNJakpDVW1KeWdwS2lzc0xTNHZNREV5TXpRMU5qYz" +
+		"RPVG83UEQwLVAwQSIsIm9yaWdpbiI6Imh0dHBzOi8vZXhhbXBsZS5jb20ifQ"
+	// 登录的认证器数据，标志位 UP|UV，签名计数为0（与iOS通行密钥一致）
+	webAuthnFixtureLoginAuthData = "o3mm9u6vuaVeN4wRgDTidR5oL6ufLTCrE9ISVYbOGUcFAAAAAA"
+	// ES256签名
+	webAuthnFixtureLoginSignature = "MEUCIQCjzDUjrs4KSt1EqOBTqdL87egBk1_-e_QwcFDtobzVywIgXkCMM003vdFmVoDvg3KD_DdZx1acQfLRCxa8Sm" +
+		"qjmiM"
+	// 用户ID 42 的用户句柄
+	webAuthnFixtureUserHandle = "AAAAAAAAACo"
+	// RS256凭证的COSE公钥（RSA-2048）
+	webAuthnFixtureRSAPublicKey = "pAEDAzkBACBZAQDX3HYC6AkQBD242wdM6zXbYcGoFvzOPPuHP41HK_wUN5UhJe0qCgFVhIlUckfs3HTk4wBUizIw27" +
+		"7Q6i09tnP5O9KwX0VO8bwmxqGxfaUt9bbEyt4fWtvsHAsF6-0oeUw1bI9kKgw72MhWEEwbsDdC0ulB48KbXfpy2Z4E" +
+		"4AdxQkreTQj9zFnHf_iI_5GZ7woaJKCaQqzVS3TDkW3g1L1DkUtdj9gs9yxwF9EdKEvQdOywwQEqd3jtmaKkwZJCOi" +
+		"UZzsd_iazVM60zDHI2_8btHQx-WxHFTfjf-9CAQfL4RtJYsikct8tWHfcSRJsBn0Z-qSxXO2-6fJkNYIDmUAy5IUMB" +
+		"AAE"
+	// RS256登录的clientDataJSON，挑战为 0x41..0x60
+	webAuthnFixtureRSALoginClientData = "eyJ0eXBlIjoid2ViYXV0aG4uZ2V0IiwiY2hhbGxlbmdlIjoiUVVKRFJFVkdSMGhKU2t0TVRVNVBVRkZTVTFSVlZsZF" +
+		"lXVnBiWEYxZVgyQSIsIm9yaWdpbiI6Imh0dHBzOi8vZXhhbXBsZS5jb20ifQ"
+	// RS256登录的认证器数据，签名计数为5
+	webAuthnFixtureRSALoginAuthData = "o3mm9u6vuaVeN4wRgDTidR5oL6ufLTCrE9ISVYbOGUcFAAAABQ"
+	// RS256签名
+	webAuthnFixtureRSALoginSignature = "u0ppgPCkM1VcmrtEUuvrEvYCbpWBqU6cC-P7R3H3TFKZyn8kf5T8l5C9xGOrADFJ0Mw9mxo2RGGuxXDaxkIaUXbsZT" +
+		"MgmqzQWoLVneJoagGuu4pFJmkPhYDqzGuaSs0ktZkLGgjWBxRITddv_08fQoRFxDnl8t18MPwEah9fIrJ5yEHCLJ5Z" +
+		"cc_13wYZtAln6WAd50Q_dFeExNJ2Llql52hVnDmrRU5dnedU92DlgkuWG6MtAj1twubwbm5PRDwhw5PnO0zpTfte5G" +
+		"9v4whWG-xUYb_x7cssh-nw_463RAukXrO0JZw-i5_yHcM2w66s4a0pe2zZLd1gFX2Ly73dyg"
+)
+
+// 录制数据中使用的用户ID
+const webAuthnFixtureUserID uint = 42
+
+// fixtureChallengeBytes 生成录制数据使用的挑战：从start开始递增的32字节
+func fixtureChallengeBytes(start byte) []byte {
+	buf := make([]byte, 32)
+	for i := range buf {
+		buf[i] = start + byte(i)
+	}
+	return buf
+}
+
+// newTestWebAuthnService 创建依赖方为 example.com、时钟可控的通行密钥服务
+func newTestWebAuthnService() (*services.WebAuthnService, *time.Time) {
+	service := services.NewWebAuthnService(nil, &config.Config{WebAuthnRPID: "example.com", WebAuthnRPName: "Example"})
+	now := time.Now()
+	service.SetClock(func() time.Time { return now })
+	return service, &now
+}
+
+// beginFixtureRegistration 为录制数据的用户生成注册挑战
+func beginFixtureRegistration(t *testing.T, service *services.WebAuthnService, userID uint) {
+	service.SetRandom(bytes.NewReader(fixtureChallengeBytes(0x01)))
+	_, err := service.RegistrationOptions(&models.User{ID: userID, Email: "passkey@example.com"}, nil)
+	assert.NoError(t, err)
+}
+
+// beginFixtureLogin 生成登录挑战，start为录制数据的挑战起始字节
+func beginFixtureLogin(t *testing.T, service *services.WebAuthnService, start byte, userID uint) {
+	service.SetRandom(bytes.NewReader(fixtureChallengeBytes(start)))
+	_, err := service.LoginOptions(userID, nil)
+	assert.NoError(t, err)
+}
+
+// fixtureRegistration 录制的注册结果
+func fixtureRegistration() services.WebAuthnRegistrationResponse {
+	return services.WebAuthnRegistrationResponse{
+		ID:    webAuthnFixtureCredentialID,
+		RawID: webAuthnFixtureCredentialID,
+		Type:  "public-key",
+		Response: services.WebAuthnAttestationData{
+			ClientDataJSON:    webAuthnFixtureRegisterClientData,
+			AttestationObject: webAuthnFixtureAttestation,
+			Transports:        []string{"internal", "hybrid"},
+		},
+	}
+}
+
+// fixtureAssertion 录制的ES256登录结果
+func fixtureAssertion() services.WebAuthnAssertionResponse {
+	return services.WebAuthnAssertionResponse{
+		ID:    webAuthnFixtureCredentialID,
+		RawID: webAuthnFixtureCredentialID,
+		Type:  "public-key",
+		Response: services.WebAuthnAssertionData{
+			ClientDataJSON:    webAuthnFixtureLoginClientData,
+			AuthenticatorData: webAuthnFixtureLoginAuthData,
+			Signature:         webAuthnFixtureLoginSignature,
+			UserHandle:        webAuthnFixtureUserHandle,
+		},
+	}
+}
+
+// fixtureCredential 通过录制的注册结果得到已保存的ES256凭证
+func fixtureCredential(t *testing.T) *models.WebAuthnCredential {
+	service, _ := newTestWebAuthnService()
+	beginFixtureRegistration(t, service, webAuthnFixtureUserID)
+	credential, err := service.VerifyRegistration(webAuthnFixtureUserID, fixtureRegistration())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return credential
+}
+
+// modifyBase64 解码base64url数据，修改后重新编码
+func modifyBase64(t *testing.T, value string, modify func([]byte) []byte) string {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	assert.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(modify(raw))
+}
+
+// setAuthenticatorFlags 修改证明对象或认证器数据中rpIdHash之后的标志位
+func setAuthenticatorFlags(t *testing.T, value string, flags byte) string {
+	rpIDHash := sha256.Sum256([]byte("example.com"))
+	return modifyBase64(t, value, func(raw []byte) []byte {
+		index := bytes.Index(raw, rpIDHash[:])
+		assert.GreaterOrEqual(t, index, 0)
+		raw[index+32] = flags
+		return raw
+	})
+}
+
+func TestWebAuthnService_RegistrationOptions(t *testing.T) {
+	service, _ := newTestWebAuthnService()
+	service.SetRandom(bytes.NewReader(fixtureChallengeBytes(0x01)))
+
+	user := &models.User{ID: webAuthnFixtureUserID, Phone: "+8613800138000", Nickname: "小明"}
+	existing := []models.WebAuthnCredential{{CredentialID: "b2xk", Transports: "internal,hybrid"}}
+	options, err := service.RegistrationOptions(user, existing)
+	assert.NoError(t, err)
+
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(fixtureChallengeBytes(0x01)), options.Challenge)
+	assert.Equal(t, services.WebAuthnRelyingParty{ID: "example.com", Name: "Example"}, options.RP)
+	assert.Equal(t, webAuthnFixtureUserHandle, options.User.ID, "用户句柄为用户ID，不包含个人信息")
+	assert.Equal(t, "+8613800138000", options.User.Name)
+	assert.Equal(t, "小明", options.User.DisplayName)
+	assert.Equal(t, []services.WebAuthnCredentialParameter{
+		{Type: "public-key", Alg: services.COSEAlgES256},
+		{Type: "public-key", Alg: services.COSEAlgRS256},
+	}, options.PubKeyCredParams)
+	assert.Equal(t, []services.WebAuthnCredentialDescriptor{
+		{Type: "public-key", ID: "b2xk", Transports: []string{"internal", "hybrid"}},
+	}, options.ExcludeCredentials)
+	assert.Equal(t, "none", options.Attestation)
+	assert.Equal(t, "required", options.AuthenticatorSelection.UserVerification)
+	assert.Equal(t, "required", options.AuthenticatorSelection.ResidentKey)
+	assert.Equal(t, services.DefaultWebAuthnTimeout.Milliseconds(), options.Timeout)
+}
+
+func TestWebAuthnService_VerifyRegistration(t *testing.T) {
+	service, _ := newTestWebAuthnService()
+	beginFixtureRegistration(t, service, webAuthnFixtureUserID)
+
+	credential, err := service.VerifyRegistration(webAuthnFixtureUserID, fixtureRegistration())
+	assert.NoError(t, err)
+	assert.Equal(t, webAuthnFixtureUserID, credential.UserID)
+	assert.Equal(t, webAuthnFixtureCredentialID, credential.CredentialID)
+	assert.NotEmpty(t, credential.PublicKey)
+	assert.Equal(t, uint32(0), credential.SignCount)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", credential.AAGUID)
+	assert.Equal(t, "internal,hybrid", credential.Transports)
+
+	// 挑战只能使用一次
+	_, err = service.VerifyRegistration(webAuthnFixtureUserID, fixtureRegistration())
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallengeInvalid)
+}
+
+func TestWebAuthnService_VerifyRegistration_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(service *services.WebAuthnService, now *time.Time)
+		userID   uint
+		modify   func(resp *services.WebAuthnRegistrationResponse)
+		expected error
+	}{
+		{
+			name:     "未开始注册",
+			setup:    func(service *services.WebAuthnService, now *time.Time) {},
+			expected: services.ErrWebAuthnChallengeInvalid,
+		},
+		{
+			name: "挑战已过期",
+			setup: func(service *services.WebAuthnService, now *time.Time) {
+				beginFixtureRegistration(t, service, webAuthnFixtureUserID)
+				*now = now.Add(services.DefaultWebAuthnTimeout + time.Second)
+			},
+			expected: services.ErrWebAuthnChallengeInvalid,
+		},
+		{
+			name: "其他用户的挑战",
+			setup: func(service *services.WebAuthnService, now *time.Time) {
+				beginFixtureRegistration(t, service, 7)
+			},
+			expected: services.ErrWebAuthnUserMismatch,
+		},
+		{
+			name: "登录挑战不能用于注册",
+			setup: func(service *services.WebAuthnService, now *time.Time) {
+				beginFixtureLogin(t, service, 0x01, 0)
+			},
+			expected: services.ErrWebAuthnChallengeInvalid,
+		},
+		{
+			name: "仪式类型错误",
+			modify: func(resp *services.WebAuthnRegistrationResponse) {
+				resp.Response.ClientDataJSON = webAuthnFixtureLoginClientData
+			},
+			expected: services.ErrWebAuthnClientDataInvalid,
+		},
+		{
+			name: "来源不在允许列表",
+			setup: func(service *services.WebAuthnService, now *time.Time) {
+				beginFixtureRegistration(t, service, webAuthnFixtureUserID)
+				service.Origins = []string{"https://app.example.com"}
+			},
+			expected: services.ErrWebAuthnOriginNotAllowed,
+		},
+		{
+			name: "依赖方ID不匹配",
+			setup: func(service *services.WebAuthnService, now *time.Time) {
+				beginFixtureRegistration(t, service, webAuthnFixtureUserID)
+				service.RPID = "other.com"
+			},
+			expected: services.ErrWebAuthnRPIDMismatch,
+		},
+		{
+			name: "packed证明格式",
+			modify: func(resp *services.WebAuthnRegistrationResponse) {
+				resp.Response.AttestationObject = webAuthnFixturePackedAttestation
+			},
+			expected: services.ErrWebAuthnAttestationUnsupported,
+		},
+		{
+			name: "未完成用户验证",
+			modify: func(resp *services.WebAuthnRegistrationResponse) {
+				// 只保留 UP|AT
+				resp.Response.AttestationObject = setAuthenticatorFlags(t, resp.Response.AttestationObject, 0x41)
+			},
+			expected: services.ErrWebAuthnUserNotVerified,
+		},
+		{
+			name: "证明对象被截断",
+			modify: func(resp *services.WebAuthnRegistrationResponse) {
+				resp.Response.AttestationObject = modifyBase64(t, resp.Response.AttestationObject, func(raw []byte) []byte {
+					return raw[:len(raw)-10]
+				})
+			},
+			expected: services.ErrWebAuthnAttestationInvalid,
+		},
+		{
+			name: "凭证ID与认证器数据不一致",
+			modify: func(resp *services.WebAuthnRegistrationResponse) {
+				resp.ID = "b3RoZXI"
+			},
+			expected: services.ErrWebAuthnAttestationInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, now := newTestWebAuthnService()
+			if tt.setup != nil {
+				tt.setup(service, now)
+			} else {
+				beginFixtureRegistration(t, service, webAuthnFixtureUserID)
+			}
+
+			resp := fixtureRegistration()
+			if tt.modify != nil {
+				tt.modify(&resp)
+			}
+			userID := tt.userID
+			if userID == 0 {
+				userID = webAuthnFixtureUserID
+			}
+
+			credential, err := service.VerifyRegistration(userID, resp)
+			assert.ErrorIs(t, err, tt.expected)
+			assert.Nil(t, credential)
+		})
+	}
+}
+
+func TestWebAuthnService_VerifyAssertion(t *testing.T) {
+	credential := fixtureCredential(t)
+	service, _ := newTestWebAuthnService()
+	beginFixtureLogin(t, service, 0x21, 0)
+
+	signCount, err := service.VerifyAssertion(fixtureAssertion(), credential)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), signCount, "认证器不支持计数时保持为0")
+
+	// 重放同一登录结果
+	_, err = service.VerifyAssertion(fixtureAssertion(), credential)
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallengeInvalid)
+}
+
+func TestWebAuthnService_VerifyAssertion_BoundUser(t *testing.T) {
+	credential := fixtureCredential(t)
+
+	// 指定账号登录时，凭证必须属于该账号
+	service, _ := newTestWebAuthnService()
+	beginFixtureLogin(t, service, 0x21, webAuthnFixtureUserID)
+	_, err := service.VerifyAssertion(fixtureAssertion(), credential)
+	assert.NoError(t, err)
+
+	service, _ = newTestWebAuthnService()
+	beginFixtureLogin(t, service, 0x21, 7)
+	_, err = service.VerifyAssertion(fixtureAssertion(), credential)
+	assert.ErrorIs(t, err, services.ErrWebAuthnUserMismatch)
+}
+
+func TestWebAuthnService_VerifyAssertion_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(resp *services.WebAuthnAssertionResponse)
+		credential func(credential *models.WebAuthnCredential)
+		expected   error
+	}{
+		{
+			name: "签名被篡改",
+			modify: func(resp *services.WebAuthnAssertionResponse) {
+				resp.Response.Signature = modifyBase64(t, resp.Response.Signature, func(raw []byte) []byte {
+					raw[len(raw)-1] ^= 0xff
+					return raw
+				})
+			},
+			expected: services.ErrWebAuthnSignatureInvalid,
+		},
+		{
+			name: "认证器数据被篡改",
+			modify: func(resp *services.WebAuthnAssertionResponse) {
+				// 将签名计数改为1
+				resp.Response.AuthenticatorData = modifyBase64(t, resp.Response.AuthenticatorData, func(raw []byte) []byte {
+					raw[len(raw)-1] = 1
+					return raw
+				})
+			},
+			expected: services.ErrWebAuthnSignatureInvalid,
+		},
+		{
+			name: "未完成用户验证",
+			modify: func(resp *services.WebAuthnAssertionResponse) {
+				resp.Response.AuthenticatorData = setAuthenticatorFlags(t, resp.Response.AuthenticatorData, 0x01)
+			},
+			expected: services.ErrWebAuthnUserNotVerified,
+		},
+		{
+			name: "仪式类型错误",
+			modify: func(resp *services.WebAuthnAssertionResponse) {
+				resp.Response.ClientDataJSON = webAuthnFixtureRegisterClientData
+			},
+			expected: services.ErrWebAuthnClientDataInvalid,
+		},
+		{
+			name: "用户句柄不匹配",
+			credential: func(credential *models.WebAuthnCredential) {
+				credential.UserID = 7
+			},
+			expected: services.ErrWebAuthnUserMismatch,
+		},
+		{
+			name: "签名计数回退",
+			credential: func(credential *models.WebAuthnCredential) {
+				credential.SignCount = 3
+			},
+			expected: services.ErrWebAuthnSignCountInvalid,
+		},
+		{
+			name: "公钥不匹配",
+			credential: func(credential *models.WebAuthnCredential) {
+				credential.PublicKey, _ = base64.RawURLEncoding.DecodeString(webAuthnFixtureRSAPublicKey)
+			},
+			expected: services.ErrWebAuthnSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credential := fixtureCredential(t)
+			if tt.credential != nil {
+				tt.credential(credential)
+			}
+			service, _ := newTestWebAuthnService()
+			beginFixtureLogin(t, service, 0x21, 0)
+
+			resp := fixtureAssertion()
+			if tt.modify != nil {
+				tt.modify(&resp)
+			}
+
+			_, err := service.VerifyAssertion(resp, credential)
+			assert.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
+
+func TestWebAuthnService_VerifyAssertion_RS256(t *testing.T) {
+	publicKey, _ := base64.RawURLEncoding.DecodeString(webAuthnFixtureRSAPublicKey)
+	resp := services.WebAuthnAssertionResponse{
+		ID: "cnNhLWNyZWRlbnRpYWw",
+		Response: services.WebAuthnAssertionData{
+			ClientDataJSON:    webAuthnFixtureRSALoginClientData,
+			AuthenticatorData: webAuthnFixtureRSALoginAuthData,
+			Signature:         webAuthnFixtureRSALoginSignature,
+		},
+	}
+
+	// 签名计数递增
+	service, _ := newTestWebAuthnService()
+	beginFixtureLogin(t, service, 0x41, 0)
+	credential := &models.WebAuthnCredential{UserID: webAuthnFixtureUserID, PublicKey: publicKey, SignCount: 4}
+	signCount, err := service.VerifyAssertion(resp, credential)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(5), signCount)
+
+	// 签名计数未递增，可能是克隆的认证器
+	service, _ = newTestWebAuthnService()
+	beginFixtureLogin(t, service, 0x41, 0)
+	credential.SignCount = 5
+	_, err = service.VerifyAssertion(resp, credential)
+	assert.ErrorIs(t, err, services.ErrWebAuthnSignCountInvalid)
+}
+
+func TestWebAuthnService_NotConfigured(t *testing.T) {
+	service := services.NewWebAuthnService(nil, &config.Config{})
+	assert.False(t, service.Enabled())
+
+	_, err := service.RegistrationOptions(&models.User{ID: 1}, nil)
+	assert.ErrorIs(t, err, services.ErrWebAuthnNotConfigured)
+	_, err = service.LoginOptions(0, nil)
+	assert.ErrorIs(t, err, services.ErrWebAuthnNotConfigured)
+	_, err = service.VerifyAssertion(fixtureAssertion(), &models.WebAuthnCredential{})
+	assert.ErrorIs(t, err, services.ErrWebAuthnNotConfigured)
+}
+
+func TestWebAuthnService_ChallengeLimit(t *testing.T) {
+	service, now := newTestWebAuthnService()
+	service.MaxChallenges = 2
+
+	beginFixtureLogin(t, service, 0x21, 7)
+	*now = now.Add(time.Minute)
+	service.SetRandom(bytes.NewReader(fixtureChallengeBytes(0x01)))
+	_, err := service.LoginOptions(0, nil)
+	assert.NoError(t, err)
+
+	// 未使用的挑战已满时淘汰最早的挑战，不拒绝新的登录请求
+	service.SetRandom(bytes.NewReader(fixtureChallengeBytes(0x41)))
+	_, err = service.LoginOptions(0, nil)
+	assert.NoError(t, err)
+	// 录制的登录结果使用最早的挑战，挑战已被淘汰
+	_, err = service.VerifyAssertion(fixtureAssertion(), &models.WebAuthnCredential{UserID: webAuthnFixtureUserID})
+	assert.ErrorIs(t, err, services.ErrWebAuthnChallengeInvalid)
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ios-api/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newWechatTestServer 创建模拟微信接口的本地服务
+func newWechatTestServer(tokenHandler, userInfoHandler http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/oauth2/access_token", tokenHandler)
+	mux.HandleFunc("/sns/userinfo", userInfoHandler)
+	return httptest.NewServer(mux)
+}
+
+// newTestWechatService 创建指向本地模拟服务的微信服务
+func newTestWechatService(baseURL string) *services.WechatService {
+	return &services.WechatService{
+		AppID:      "wx_test_app",
+		AppSecret:  "wx_test_secret",
+		APIBaseURL: baseURL,
+		Client:     &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+func wechatTokenOK(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, `{"access_token":"ACCESS","expires_in":7200,"refresh_token":"REFRESH","openid":"OPENID","scope":"snsapi_userinfo"}`)
+}
+
+func wechatUserInfoOK(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, `{"openid":"OPENID","nickname":"微信用户","headimgurl":"https://example.com/a.png","unionid":"UNIONID"}`)
+}
+
+func TestWechatService_HandleCallback_Success(t *testing.T) {
+	var tokenQuery, userInfoQuery map[string]string
+	server := newWechatTestServer(
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			tokenQuery = map[string]string{"appid": q.Get("appid"), "secret": q.Get("secret"), "code": q.Get("code")}
+			wechatTokenOK(w, r)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			userInfoQuery = map[string]string{"access_token": q.Get("access_token"), "openid": q.Get("openid")}
+			wechatUserInfoOK(w, r)
+		},
+	)
+	defer server.Close()
+
+	service := newTestWechatService(server.URL)
+	params, err := service.HandleCallback("CODE")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "wechat", params.Provider)
+	assert.Equal(t, "OPENID", params.ProviderUserID)
+	assert.Equal(t, "UNIONID", params.UnionID)
+	assert.Equal(t, "微信用户", params.Nickname)
+	assert.Equal(t, "https://example.com/a.png", params.Avatar)
+	assert.Equal(t, "ACCESS", params.AccessToken)
+	assert.Equal(t, "REFRESH", params.RefreshToken)
+	assert.WithinDuration(t, time.Now().Add(7200*time.Second), *params.TokenExpiresAt, time.Minute)
+	assert.Equal(t, map[string]string{"appid": "wx_test_app", "secret": "wx_test_secret", "code": "CODE"}, tokenQuery)
+	assert.Equal(t, map[string]string{"access_token": "ACCESS", "openid": "OPENID"}, userInfoQuery)
+}
+
+func TestWechatService_HandleCallback_EmptyCode(t *testing.T) {
+	service := newTestWechatService("http://127.0.0.1:0")
+	_, err := service.HandleCallback("")
+	assert.ErrorIs(t, err, services.ErrWechatCodeInvalid)
+}
+
+func TestWechatService_HandleCallback_TokenErrorCode(t *testing.T) {
+	server := newWechatTestServer(
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"errcode":40029,"errmsg":"invalid code"}`)
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			t.Error("授权码无效时不应请求用户信息")
+		},
+	)
+	defer server.Close()
+
+	_, err := newTestWechatService(server.URL).HandleCallback("BAD")
+	assert.ErrorIs(t, err, services.ErrWechatAuthFailed)
+	assert.Contains(t, err.Error(), "40029")
+}
+
+func TestWechatService_HandleCallback_UserInfoErrorCode(t *testing.T) {
+	server := newWechatTestServer(
+		wechatTokenOK,
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"errcode":40003,"errmsg":"invalid openid"}`)
+		},
+	)
+	defer server.Close()
+
+	_, err := newTestWechatService(server.URL).HandleCallback("CODE")
+	assert.ErrorIs(t, err, services.ErrWechatUserInfoFailed)
+	assert.Contains(t, err.Error(), "40003")
+}
+
+func TestWechatService_HandleCallback_MalformedJSON(t *testing.T) {
+	t.Run("令牌接口返回非法JSON", func(t *testing.T) {
+		server := newWechatTestServer(
+			func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `<html>bad gateway</html>`) },
+			wechatUserInfoOK,
+		)
+		defer server.Close()
+
+		_, err := newTestWechatService(server.URL).HandleCallback("CODE")
+		assert.ErrorIs(t, err, services.ErrWechatServerError)
+	})
+
+	t.Run("用户信息接口返回非法JSON", func(t *testing.T) {
+		server := newWechatTestServer(
+			wechatTokenOK,
+			func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, `{"openid":`) },
+		)
+		defer server.Close()
+
+		_, err := newTestWechatService(server.URL).HandleCallback("CODE")
+		assert.ErrorIs(t, err, services.ErrWechatServerError)
+	})
+}
+
+func TestWechatService_HandleCallback_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := newWechatTestServer(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-time.After(2 * time.Second):
+			}
+			wechatTokenOK(w, r)
+		},
+		wechatUserInfoOK,
+	)
+	defer server.Close()
+	defer close(release)
+
+	service := newTestWechatService(server.URL)
+	service.Client = &http.Client{Timeout: 100 * time.Millisecond}
+
+	_, err := service.HandleCallback("CODE")
+	assert.ErrorIs(t, err, services.ErrWechatServerError)
+	assert.Contains(t, err.Error(), "Client.Timeout")
+}
+
+func TestWechatService_GetAuthURL_UsesOpenBaseURL(t *testing.T) {
+	service := &services.WechatService{
+		AppID:       "wx_test_app",
+		OpenBaseURL: "http://127.0.0.1:9999/",
+	}
+
+	authURL := service.GetAuthURL("https://example.com/cb", "STATE")
+	assert.Contains(t, authURL, "http://127.0.0.1:9999/connect/oauth2/authorize?appid=wx_test_app")
+	assert.Contains(t, authURL, "redirect_uri=https%3A%2F%2Fexample.com%2Fcb")
+	assert.Contains(t, authURL, "state=STATE")
+}
+
+func TestWechatService_HandleMiniProgramLogin(t *testing.T) {
+	var query map[string]string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/jscode2session", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		query = map[string]string{"appid": q.Get("appid"), "secret": q.Get("secret"), "js_code": q.Get("js_code")}
+		if q.Get("js_code") == "BAD" {
+			fmt.Fprint(w, `{"errcode":40163,"errmsg":"code been used"}`)
+			return
+		}
+		fmt.Fprint(w, `{"openid":"MINI_OPENID","session_key":"KEY","unionid":"UNIONID"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	service := newTestWechatService(server.URL)
+
+	// 未配置小程序时直接返回错误
+	_, err := service.HandleMiniProgramLogin("CODE", "", "")
+	assert.ErrorIs(t, err, services.ErrWechatMiniNotConfig)
+
+	service.MiniAppID = "wx_mini_app"
+	service.MiniAppSecret = "wx_mini_secret"
+
+	params, err := service.HandleMiniProgramLogin("CODE", "小程序用户", "https://example.com/m.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "wechat", params.Provider)
+	assert.Equal(t, "MINI_OPENID", params.ProviderUserID)
+	assert.Equal(t, "UNIONID", params.UnionID)
+	assert.Equal(t, "小程序用户", params.Nickname)
+	assert.Equal(t, map[string]string{"appid": "wx_mini_app", "secret": "wx_mini_secret", "js_code": "CODE"}, query)
+
+	_, err = service.HandleMiniProgramLogin("BAD", "", "")
+	assert.ErrorIs(t, err, services.ErrWechatAuthFailed)
+
+	_, err = service.HandleMiniProgramLogin("", "", "")
+	assert.ErrorIs(t, err, services.ErrWechatCodeInvalid)
+}
+
+func TestWechatService_RefreshAccessToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/oauth2/refresh_token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "wx_test_app", q.Get("appid"))
+		assert.Equal(t, "refresh_token", q.Get("grant_type"))
+		if q.Get("refresh_token") != "REFRESH" {
+			fmt.Fprint(w, `{"errcode":42002,"errmsg":"refresh_token timeout"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"NEW_ACCESS","expires_in":7200,"refresh_token":"REFRESH","openid":"OPENID"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	service := newTestWechatService(server.URL)
+
+	tokenResp, err := service.RefreshAccessToken("REFRESH")
+	assert.NoError(t, err)
+	assert.Equal(t, "NEW_ACCESS", tokenResp.AccessToken)
+
+	_, err = service.RefreshAccessToken("EXPIRED")
+	assert.ErrorIs(t, err, services.ErrWechatAuthFailed)
+	assert.Contains(t, err.Error(), "42002")
+}
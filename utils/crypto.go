@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrDecryptFailed 解密失败
+var ErrDecryptFailed = errors.New("解密失败")
+
+// boundCiphertextPrefix 绑定了附加数据（AAD）的密文前缀，没有前缀的是旧版本未绑定的密文
+const boundCiphertextPrefix = "v2:"
+
+// CipherAAD 返回数据库字段的附加数据，密文只能在加密时所在的行和字段解密，
+// 防止能写数据库的人把一行的密文复制到另一行（如把自己的令牌换成别人的）
+func CipherAAD(table string, id uint, column string) string {
+	return fmt.Sprintf("%s:%d:%s", table, id, column)
+}
+
+// TokenCipher 使用AES-GCM加密存储第三方令牌等敏感数据
+type TokenCipher struct {
+	aead cipher.AEAD
+}
+
+// NewTokenCipher 创建加密器，密钥由任意长度的字符串经SHA-256派生
+func NewTokenCipher(secret string) (*TokenCipher, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenCipher{aead: aead}, nil
+}
+
+// Encrypt 加密明文并绑定附加数据 aad（见 CipherAAD），返回带版本前缀的base64密文；空字符串原样返回
+func (c *TokenCipher) Encrypt(plaintext, aad string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return boundCiphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密密文，aad 需与加密时一致；空字符串原样返回
+// 没有版本前缀的旧密文未绑定附加数据，按旧方式解密，下次写入时改为绑定后的密文。
+func (c *TokenCipher) Decrypt(ciphertext, aad string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+
+	var additional []byte
+	if strings.HasPrefix(ciphertext, boundCiphertextPrefix) {
+		ciphertext = strings.TrimPrefix(ciphertext, boundCiphertextPrefix)
+		additional = []byte(aad)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return "", ErrDecryptFailed
+	}
+
+	nonce, sealed := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, additional)
+	if err != nil {
+		return "", ErrDecryptFailed
+	}
+
+	return string(plaintext), nil
+}
@@ -2,18 +2,22 @@ package utils
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 // 响应码定义
 const (
-	CodeSuccess      = 0    // 成功
-	CodeParamError   = 1001 // 参数错误
-	CodeUnauthorized = 1002 // 未授权
-	CodeNotFound     = 1004 // 资源不存在
-	CodeConflict     = 1009 // 资源冲突
-	CodeServerError  = 2000 // 服务器内部错误
+	CodeSuccess         = 0    // 成功
+	CodeParamError      = 1001 // 参数错误
+	CodeUnauthorized    = 1002 // 未授权
+	CodeForbidden       = 1003 // 无权限
+	CodeNotFound        = 1004 // 资源不存在
+	CodeConflict        = 1009 // 资源冲突
+	CodeTooManyRequests = 1029 // 请求过于频繁
+	CodeServerError     = 2000 // 服务器内部错误
 )
 
 // Response 统一响应结构
@@ -60,6 +64,11 @@ func Unauthorized(c *gin.Context, message string) {
 	Error(c, http.StatusUnauthorized, CodeUnauthorized, message)
 }
 
+// Forbidden 无权限响应
+func Forbidden(c *gin.Context, message string) {
+	Error(c, http.StatusForbidden, CodeForbidden, message)
+}
+
 // NotFound 资源不存在响应
 func NotFound(c *gin.Context, message string) {
 	Error(c, http.StatusNotFound, CodeNotFound, message)
@@ -70,7 +79,45 @@ func Conflict(c *gin.Context, message string) {
 	Error(c, http.StatusConflict, CodeConflict, message)
 }
 
+// TooManyRequests 请求过于频繁响应
+func TooManyRequests(c *gin.Context, message string) {
+	Error(c, http.StatusTooManyRequests, CodeTooManyRequests, message)
+}
+
 // ServerError 服务器内部错误响应
 func ServerError(c *gin.Context, message string) {
 	Error(c, http.StatusInternalServerError, CodeServerError, message)
 }
+
+// NotModified 设置ETag和Last-Modified响应头，请求的条件与之一致时返回 304 并返回true，调用方不再输出响应体
+// If-None-Match 可以包含多个以逗号分隔的ETag，或为 *；比较时忽略弱ETag前缀 W/。
+// 请求带 If-None-Match 时忽略 If-Modified-Since；If-Modified-Since 只用于 GET 和 HEAD 请求，lastModified 为零值时不使用。
+func NotModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || (candidate != "" && candidate == strings.TrimPrefix(etag, "W/")) {
+				c.Status(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	method := c.Request.Method
+	if lastModified.IsZero() || (method != http.MethodGet && method != http.MethodHead) {
+		return false
+	}
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	// HTTP日期精确到秒
+	if err == nil && !lastModified.Truncate(time.Second).After(since) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}